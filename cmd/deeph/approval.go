@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"deeph/internal/runtime"
+)
+
+// newTerminalApprover prompts on out and reads the answer with readLine. Calls
+// are serialized so parallel agents never interleave prompts; answering "a"
+// approves the rest of the run's calls to that skill.
+func newTerminalApprover(readLine func() (string, bool), out io.Writer) runtime.Approver {
+	var mu sync.Mutex
+	always := map[string]bool{}
+	return func(ctx context.Context, req runtime.ApprovalRequest) (runtime.ApprovalDecision, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if always[req.Skill] {
+			return runtime.ApprovalDecision{Approved: true, Reason: "approved for this run"}, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return runtime.ApprovalDecision{}, err
+		}
+		fmt.Fprintf(out, "\napproval: agent %q wants to call %s (%s)\n", req.Agent, approvalTarget(req), req.Reason)
+		if args := approvalArgsPreview(req.Args, 600); args != "" {
+			fmt.Fprintf(out, "  args: %s\n", args)
+		}
+		fmt.Fprint(out, "  allow? [y]es / [N]o / [a]lways for this skill: ")
+		line, ok := readLine()
+		if !ok {
+			return runtime.ApprovalDecision{Reason: "no answer (stdin closed)"}, nil
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes", "s", "sim":
+			return runtime.ApprovalDecision{Approved: true}, nil
+		case "a", "always":
+			always[req.Skill] = true
+			return runtime.ApprovalDecision{Approved: true, Reason: "approved for this run"}, nil
+		default:
+			return runtime.ApprovalDecision{Reason: "declined at prompt"}, nil
+		}
+	}
+}
+
+// withCLIApprover attaches a stdin prompt to ctx when the CLI runs in a
+// terminal; otherwise gated calls keep the runtime's deny-by-default.
+func withCLIApprover(ctx context.Context) context.Context {
+	if !isInteractiveTerminal(os.Stdin) {
+		return ctx
+	}
+	return runtime.WithApprover(ctx, newTerminalApprover(newStdinLineReader(), os.Stderr))
+}
+
+func newStdinLineReader() func() (string, bool) {
+	reader := bufio.NewReader(os.Stdin)
+	return func() (string, bool) {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			return "", false
+		}
+		return line, true
+	}
+}
+
+func approvalTarget(req runtime.ApprovalRequest) string {
+	if req.Tool != "" {
+		return req.Skill + "/" + req.Tool
+	}
+	return req.Skill
+}
+
+func approvalArgsPreview(args map[string]any, max int) string {
+	if len(args) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(args)
+	if err != nil {
+		return ""
+	}
+	s := string(b)
+	if len(s) > max {
+		s = s[:max] + "..."
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"deeph/internal/runtime"
+)
+
+// cassetteFlags are run's --record/--replay flags.
+type cassetteFlags struct {
+	record *string
+	replay *string
+}
+
+func addCassetteFlags(fs *flag.FlagSet) cassetteFlags {
+	return cassetteFlags{
+		record: fs.String("record", "", "record every provider call and skill result of the run into this cassette file"),
+		replay: fs.String("replay", "", "serve provider calls and skill results from this cassette file instead of running them"),
+	}
+}
+
+// resolve makes the cassette paths absolute and, for a replay without an
+// agent spec, takes spec and input from the cassette.
+func (f cassetteFlags) resolve(rest []string) ([]string, error) {
+	record, replay := strings.TrimSpace(*f.record), strings.TrimSpace(*f.replay)
+	if record != "" && replay != "" {
+		return nil, errors.New("--record and --replay cannot be combined")
+	}
+	for _, p := range []*string{f.record, f.replay} {
+		if *p = strings.TrimSpace(*p); *p == "" {
+			continue
+		}
+		abs, err := filepath.Abs(*p)
+		if err != nil {
+			return nil, err
+		}
+		*p = abs
+	}
+	if replay == "" || len(rest) > 0 {
+		return rest, nil
+	}
+	c, err := runtime.LoadCassette(*f.replay)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(c.Spec) == "" {
+		return nil, fmt.Errorf("cassette %s does not name an agent spec; pass one", *f.replay)
+	}
+	out := []string{c.Spec}
+	if c.Input != "" {
+		out = append(out, c.Input)
+	}
+	return out, nil
+}
+
+// active reports whether the run records or replays; such runs execute
+// in-process so the recorder and replay live next to the engine.
+func (f cassetteFlags) active() bool {
+	return strings.TrimSpace(*f.record) != "" || strings.TrimSpace(*f.replay) != ""
+}
+
+// context attaches recording or replay to ctx. The returned save writes the
+// recording and reports it; callers run it whether or not the run succeeded,
+// so failed runs can be replayed too.
+func (f cassetteFlags) context(ctx context.Context, spec, input string) (context.Context, func(), error) {
+	save := func() {}
+	switch path := strings.TrimSpace(*f.record); {
+	case strings.TrimSpace(*f.replay) != "":
+		c, err := runtime.LoadCassette(*f.replay)
+		if err != nil {
+			return ctx, save, err
+		}
+		return runtime.WithCassetteReplay(ctx, runtime.NewCassetteReplay(c)), save, nil
+	case path != "":
+		rec := runtime.NewCassetteRecorder(spec, input)
+		save = func() {
+			c := rec.Cassette()
+			if err := runtime.SaveCassette(path, c); err != nil {
+				fmt.Fprintf(os.Stderr, "warn: cassette not saved: %v\n", err)
+				return
+			}
+			fmt.Printf("cassette recorded: %s interactions=%d skills=%d (replay with --replay %s)\n", path, len(c.Interactions), len(c.Skills), path)
+		}
+		return runtime.WithCassetteRecorder(ctx, rec), save, nil
+	}
+	return ctx, save, nil
+}
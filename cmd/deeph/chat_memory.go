@@ -9,6 +9,8 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+
+	"deeph/internal/tokenizer"
 )
 
 type chatSessionMemory struct {
@@ -304,7 +306,7 @@ func appendIndexedChatEntries(index map[int][]chatSessionEntry, entries []chatSe
 	return index
 }
 
-func buildChatMemoryBlock(memory *chatSessionMemory, maxTokens int) string {
+func buildChatMemoryBlock(memory *chatSessionMemory, maxTokens int, tok tokenizer.Tokenizer) string {
 	if memory == nil || len(memory.Episodes) == 0 || maxTokens <= 0 {
 		return ""
 	}
@@ -322,13 +324,13 @@ func buildChatMemoryBlock(memory *chatSessionMemory, maxTokens int) string {
 		rendered = append(rendered, renderedEpisode{
 			episode: episode,
 			block:   block,
-			tokens:  estimateChatTokens(block),
+			tokens:  estimateChatTokens(tok, block),
 		})
 	}
 	if len(rendered) == 0 {
 		return ""
 	}
-	used := estimateChatTokens("[chat_memory]\n")
+	used := estimateChatTokens(tok, "[chat_memory]\n")
 	selected := make([]renderedEpisode, 0, len(rendered))
 	for i := len(rendered) - 1; i >= 0; i-- {
 		ep := rendered[i]
@@ -398,16 +400,17 @@ func renderChatEpisode(episode chatSessionEpisode) string {
 	return strings.Join(lines, "\n")
 }
 
-func estimateChatTokens(s string) int {
+// estimateChatTokens counts with the chat agent's tokenizer (the heuristic
+// when tok is nil).
+func estimateChatTokens(tok tokenizer.Tokenizer, s string) int {
 	s = strings.TrimSpace(s)
 	if s == "" {
 		return 0
 	}
-	tok := (len(s) + 3) / 4
-	if tok <= 0 {
-		return 1
+	if tok == nil {
+		tok = tokenizer.Heuristic()
 	}
-	return tok
+	return max(tok.Count(s), 1)
 }
 
 func refreshChatWorkingSet(memory *chatSessionMemory, meta *chatSessionMeta, entriesByTurn map[int][]chatSessionEntry, totalTurns int, cfg chatMemoryConfig) bool {
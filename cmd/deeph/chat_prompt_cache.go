@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"strings"
+
+	"deeph/internal/tokenizer"
 )
 
 type chatPromptCache struct {
@@ -20,9 +22,9 @@ type chatPromptCache struct {
 	historyBuilds     int
 }
 
-func buildChatTurnInputCached(meta *chatSessionMeta, memory *chatSessionMemory, entries []chatSessionEntry, userMessage string, historyTurns, historyTokens int, cache *chatPromptCache) string {
+func buildChatTurnInputCached(meta *chatSessionMeta, memory *chatSessionMemory, entries []chatSessionEntry, userMessage string, historyTurns, historyTokens int, tok tokenizer.Tokenizer, cache *chatPromptCache) string {
 	if cache == nil {
-		return buildChatTurnInput(meta, memory, entries, userMessage, historyTurns, historyTokens)
+		return buildChatTurnInput(meta, memory, entries, userMessage, historyTurns, historyTokens, tok)
 	}
 	userMessage = strings.TrimSpace(userMessage)
 	if userMessage == "" {
@@ -32,7 +34,7 @@ func buildChatTurnInputCached(meta *chatSessionMeta, memory *chatSessionMemory,
 	primer := buildChatCommandPrimer(meta, userMessage)
 	operationalBlock := cache.cachedOperationalBlock(meta)
 	workingSetBlock := cache.cachedWorkingSetBlock(memory)
-	memoryBlock, historyTailBlock := cache.cachedMemoryAndTail(memory, entries, historyTurns, historyTokens)
+	memoryBlock, historyTailBlock := cache.cachedMemoryAndTail(memory, entries, historyTurns, historyTokens, tok)
 	if operationalBlock == "" && workingSetBlock == "" && memoryBlock == "" && historyTailBlock == "" && primer == "" {
 		return userMessage
 	}
@@ -91,19 +93,19 @@ func (c *chatPromptCache) cachedWorkingSetBlock(memory *chatSessionMemory) strin
 	return c.workingSetBlock
 }
 
-func (c *chatPromptCache) cachedMemoryAndTail(memory *chatSessionMemory, entries []chatSessionEntry, historyTurns, historyTokens int) (string, string) {
+func (c *chatPromptCache) cachedMemoryAndTail(memory *chatSessionMemory, entries []chatSessionEntry, historyTurns, historyTokens int, tok tokenizer.Tokenizer) (string, string) {
 	memoryBudget, tailBudget := splitChatHistoryBudget(memory, historyTokens)
 	memoryKey := chatMemoryBlockKey(memory, memoryBudget)
 	if memoryKey != c.memoryKey {
 		c.memoryKey = memoryKey
-		c.memoryBlock = buildChatMemoryBlock(memory, memoryBudget)
+		c.memoryBlock = buildChatMemoryBlock(memory, memoryBudget, tok)
 		c.memoryBuilds++
 	}
 
 	historyKey := chatHistoryTailKey(entries, memory, historyTurns, tailBudget)
 	if historyKey != c.historyKey {
 		c.historyKey = historyKey
-		c.historyTailBlock = buildChatHistoryTailBlock(entries, memory, historyTurns, tailBudget)
+		c.historyTailBlock = buildChatHistoryTailBlock(entries, memory, historyTurns, tailBudget, tok)
 		c.historyBuilds++
 	}
 	return c.memoryBlock, c.historyTailBlock
@@ -202,12 +204,12 @@ func splitChatHistoryBudget(memory *chatSessionMemory, historyTokens int) (memor
 	return memoryBudget, tailBudget
 }
 
-func buildChatHistoryTailBlock(entries []chatSessionEntry, memory *chatSessionMemory, historyTurns, historyTokens int) string {
+func buildChatHistoryTailBlock(entries []chatSessionEntry, memory *chatSessionMemory, historyTurns, historyTokens int, tok tokenizer.Tokenizer) string {
 	rawTailTurns := historyTurns
 	if memory != nil && memory.RawTailTurns > 0 && (rawTailTurns <= 0 || memory.RawTailTurns < rawTailTurns) {
 		rawTailTurns = memory.RawTailTurns
 	}
-	selected := selectChatHistoryEntries(entries, rawTailTurns, historyTokens)
+	selected := selectChatHistoryEntries(entries, rawTailTurns, historyTokens, tok)
 	if len(selected) == 0 {
 		return ""
 	}
@@ -14,6 +14,7 @@ import (
 
 	"deeph/internal/commanddoc"
 	"deeph/internal/runtime"
+	"deeph/internal/tokenizer"
 )
 
 func cmdChat(args []string) error {
@@ -56,6 +57,7 @@ func cmdChat(args []string) error {
 	if err != nil {
 		return err
 	}
+	defer eng.Close()
 
 	plan, tasks, err := eng.PlanSpec(context.Background(), meta.AgentSpec, "")
 	if err != nil {
@@ -79,11 +81,21 @@ func cmdChat(args []string) error {
 		Tasks:         tasks,
 		SinkIdxs:      sinkIdxs,
 		Engine:        eng,
+		Tokenizer:     chatTokenizer(eng, tasks),
 	}, meta, entries)
 	defer actor.Close()
 
 	scanner := bufio.NewScanner(os.Stdin)
 	scanner.Buffer(make([]byte, 0, 64*1024), 2*1024*1024)
+	if isInteractiveTerminal(os.Stdin) {
+		// The input loop is blocked while a turn runs, so approval prompts can share the scanner.
+		eng.SetApprover(newTerminalApprover(func() (string, bool) {
+			if !scanner.Scan() {
+				return "", false
+			}
+			return scanner.Text(), true
+		}, os.Stdout))
+	}
 	lastStatusBar := ""
 	for {
 		snap := actor.Snapshot()
@@ -305,6 +317,13 @@ func collectChatReplies(report runtime.ExecutionReport, sinkIdxs []int) []chatRe
 			if idx < 0 || idx >= len(report.Results) {
 				continue
 			}
+			// Loops append later iterations; reply with the agent's latest one.
+			for i := len(report.Results) - 1; i > idx; i-- {
+				if report.Results[i].Agent == report.Results[idx].Agent {
+					idx = i
+					break
+				}
+			}
 			r := report.Results[idx]
 			replies = append(replies, chatReply{
 				Agent: r.Agent,
@@ -535,14 +554,14 @@ func handleChatSlashCommand(line, workspace string, meta *chatSessionMeta, entri
 	}
 }
 
-func buildChatTurnInput(meta *chatSessionMeta, memory *chatSessionMemory, entries []chatSessionEntry, userMessage string, historyTurns, historyTokens int) string {
+func buildChatTurnInput(meta *chatSessionMeta, memory *chatSessionMemory, entries []chatSessionEntry, userMessage string, historyTurns, historyTokens int, tok tokenizer.Tokenizer) string {
 	userMessage = strings.TrimSpace(userMessage)
 	if userMessage == "" {
 		return ""
 	}
 	primer := buildChatCommandPrimer(meta, userMessage)
 	operational := buildChatOperationalState(meta)
-	memoryBlock, selected := buildChatPromptMemoryAndTail(memory, entries, historyTurns, historyTokens)
+	memoryBlock, selected := buildChatPromptMemoryAndTail(memory, entries, historyTurns, historyTokens, tok)
 	if len(selected) == 0 && primer == "" && len(operational) == 0 && memoryBlock == "" {
 		return userMessage
 	}
@@ -583,12 +602,12 @@ func buildChatTurnInput(meta *chatSessionMeta, memory *chatSessionMemory, entrie
 	return strings.Join(lines, "\n")
 }
 
-func buildChatPromptMemoryAndTail(memory *chatSessionMemory, entries []chatSessionEntry, historyTurns, historyTokens int) (string, []chatSessionEntry) {
+func buildChatPromptMemoryAndTail(memory *chatSessionMemory, entries []chatSessionEntry, historyTurns, historyTokens int, tok tokenizer.Tokenizer) (string, []chatSessionEntry) {
 	if historyTokens <= 0 {
-		return "", selectChatHistoryEntries(entries, historyTurns, historyTokens)
+		return "", selectChatHistoryEntries(entries, historyTurns, historyTokens, tok)
 	}
 	if memory == nil || len(memory.Episodes) == 0 {
-		return "", selectChatHistoryEntries(entries, historyTurns, historyTokens)
+		return "", selectChatHistoryEntries(entries, historyTurns, historyTokens, tok)
 	}
 	memoryBudget := historyTokens / 2
 	if memoryBudget < 120 {
@@ -599,12 +618,12 @@ func buildChatPromptMemoryAndTail(memory *chatSessionMemory, entries []chatSessi
 		tailBudget = min(historyTokens, 120)
 		memoryBudget = max(0, historyTokens-tailBudget)
 	}
-	memoryBlock := buildChatMemoryBlock(memory, memoryBudget)
+	memoryBlock := buildChatMemoryBlock(memory, memoryBudget, tok)
 	rawTailTurns := historyTurns
 	if memory.RawTailTurns > 0 && (rawTailTurns <= 0 || memory.RawTailTurns < rawTailTurns) {
 		rawTailTurns = memory.RawTailTurns
 	}
-	selected := selectChatHistoryEntries(entries, rawTailTurns, tailBudget)
+	selected := selectChatHistoryEntries(entries, rawTailTurns, tailBudget, tok)
 	return memoryBlock, selected
 }
 
@@ -834,7 +853,7 @@ func normalizeChatLookupText(s string) string {
 	return strings.Join(strings.Fields(s), " ")
 }
 
-func selectChatHistoryEntries(entries []chatSessionEntry, maxTurns, maxTokens int) []chatSessionEntry {
+func selectChatHistoryEntries(entries []chatSessionEntry, maxTurns, maxTokens int, tok tokenizer.Tokenizer) []chatSessionEntry {
 	if len(entries) == 0 {
 		return nil
 	}
@@ -861,14 +880,11 @@ func selectChatHistoryEntries(entries []chatSessionEntry, maxTurns, maxTokens in
 	startByBudget := len(cands)
 	for i := len(cands) - 1; i >= 0; i-- {
 		line := cands[i].Role + ":" + cands[i].Agent + ":" + clipLine(cands[i].Text, 420)
-		tok := (len(strings.TrimSpace(line)) + 3) / 4
-		if tok <= 0 {
-			tok = 1
-		}
-		if used+tok > maxTokens {
+		n := estimateChatTokens(tok, line)
+		if used+n > maxTokens {
 			break
 		}
-		used += tok
+		used += n
 		startByBudget = i
 	}
 	if startByBudget >= len(cands) {
@@ -901,7 +917,9 @@ func indentForSessionShow(s string) string {
 	return strings.Join(lines, "\n")
 }
 
-func persistChatTurn(workspace string, meta *chatSessionMeta, entries *[]chatSessionEntry, userLine string, replies []chatReply) {
+// persistChatTurn appends the turn to the session log; redactor (may be nil)
+// scrubs secrets before anything is written.
+func persistChatTurn(workspace string, meta *chatSessionMeta, entries *[]chatSessionEntry, redactor *runtime.Redactor, userLine string, replies []chatReply) {
 	if meta == nil {
 		return
 	}
@@ -913,7 +931,7 @@ func persistChatTurn(workspace string, meta *chatSessionMeta, entries *[]chatSes
 	toAppend = append(toAppend, chatSessionEntry{
 		Turn:      meta.Turns,
 		Role:      "user",
-		Text:      userLine,
+		Text:      redactor.Redact(userLine),
 		CreatedAt: now,
 	})
 	for _, r := range replies {
@@ -928,7 +946,7 @@ func persistChatTurn(workspace string, meta *chatSessionMeta, entries *[]chatSes
 			Turn:      meta.Turns,
 			Role:      "assistant",
 			Agent:     r.Agent,
-			Text:      text,
+			Text:      redactor.Redact(text),
 			CreatedAt: now,
 		})
 	}
@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"deeph/internal/runtime"
+	"deeph/internal/tokenizer"
 )
 
 type chatSessionActor struct {
@@ -39,6 +40,8 @@ type chatSessionActorConfig struct {
 	Tasks         []runtime.Task
 	SinkIdxs      []int
 	Engine        *runtime.Engine
+	// Tokenizer budgets the history sent to the first agents of the spec.
+	Tokenizer tokenizer.Tokenizer
 }
 
 type chatSessionActorState struct {
@@ -118,7 +121,7 @@ func (s *chatSessionActorState) processLine(line string) chatSessionActorTurnRes
 			route.Replies = sanitizeChatReplies(s.meta, route.Replies)
 			printChatReplies(route.Replies)
 			before := len(s.entries)
-			persistChatTurn(s.cfg.Workspace, s.meta, &s.entries, line, route.Replies)
+			persistChatTurn(s.cfg.Workspace, s.meta, &s.entries, s.cfg.Engine.Redactor(), line, route.Replies)
 			s.afterPersist(before)
 		}
 		return chatSessionActorTurnResult{Done: route.Done}
@@ -132,7 +135,7 @@ func (s *chatSessionActorState) processLine(line string) chatSessionActorTurnRes
 		return chatSessionActorTurnResult{}
 	}
 
-	input := buildChatTurnInputCached(s.meta, s.memory, s.entries, line, s.cfg.HistoryTurns, s.cfg.HistoryTokens, s.promptCache)
+	input := buildChatTurnInputCached(s.meta, s.memory, s.entries, line, s.cfg.HistoryTurns, s.cfg.HistoryTokens, s.cfg.Tokenizer, s.promptCache)
 	ctx := context.Background()
 	stopCoach := func() {}
 	if s.cfg.ShowCoach {
@@ -163,7 +166,7 @@ func (s *chatSessionActorState) processLine(line string) chatSessionActorTurnRes
 			replies = sanitizeChatReplies(s.meta, replies)
 			printChatReplies(replies)
 			before := len(s.entries)
-			persistChatTurn(s.cfg.Workspace, s.meta, &s.entries, line, replies)
+			persistChatTurn(s.cfg.Workspace, s.meta, &s.entries, s.cfg.Engine.Redactor(), line, replies)
 			s.afterPersist(before)
 			return chatSessionActorTurnResult{}
 		}
@@ -183,7 +186,7 @@ func (s *chatSessionActorState) processLine(line string) chatSessionActorTurnRes
 		maybePrintCoachPostRunHint(s.cfg.Workspace, "chat", &s.cfg.Plan, report)
 	}
 	before := len(s.entries)
-	persistChatTurn(s.cfg.Workspace, s.meta, &s.entries, line, replies)
+	persistChatTurn(s.cfg.Workspace, s.meta, &s.entries, s.cfg.Engine.Redactor(), line, replies)
 	s.afterPersist(before)
 	return chatSessionActorTurnResult{}
 }
@@ -96,7 +96,7 @@ func TestChatSessionActorPersistsCompactMemoryAfterTailBoundary(t *testing.T) {
 }
 
 func TestChatSessionActorProcessesExitSlashCommand(t *testing.T) {
-	actor := newChatSessionActor(chatSessionActorConfig{}, &chatSessionMeta{
+	actor := newChatSessionActor(chatSessionActorConfig{Workspace: t.TempDir()}, &chatSessionMeta{
 		ID:        "actor-exit",
 		AgentSpec: "guide",
 	}, nil)
@@ -115,7 +115,7 @@ func TestChatSessionActorProcessesExitSlashCommand(t *testing.T) {
 }
 
 func TestChatSessionActorProcessesPendingExecReply(t *testing.T) {
-	actor := newChatSessionActor(chatSessionActorConfig{}, &chatSessionMeta{
+	actor := newChatSessionActor(chatSessionActorConfig{Workspace: t.TempDir()}, &chatSessionMeta{
 		ID:        "actor-exec",
 		AgentSpec: "guide",
 		PendingExec: &deephCommand{
@@ -10,7 +10,7 @@ import (
 func TestBuildChatTurnInputAddsDeepHCommandPrimer(t *testing.T) {
 	meta := &chatSessionMeta{ID: "s1", AgentSpec: "guide"}
 
-	got := buildChatTurnInput(meta, nil, nil, "como configuro provider deepseek e valido o workspace?", 8, 900)
+	got := buildChatTurnInput(meta, nil, nil, "como configuro provider deepseek e valido o workspace?", 8, 900, nil)
 
 	for _, want := range []string{
 		"[deeph_command_primer]",
@@ -27,7 +27,7 @@ func TestBuildChatTurnInputAddsDeepHCommandPrimer(t *testing.T) {
 func TestBuildChatTurnInputAddsPowerShellCrewNote(t *testing.T) {
 	meta := &chatSessionMeta{ID: "s2", AgentSpec: "guide"}
 
-	got := buildChatTurnInput(meta, nil, nil, "no windows powershell como eu rodo uma crew no deeph?", 8, 900)
+	got := buildChatTurnInput(meta, nil, nil, "no windows powershell como eu rodo uma crew no deeph?", 8, 900, nil)
 
 	if !strings.Contains(got, "prefer 'crew:name' instead of @name") {
 		t.Fatalf("expected PowerShell crew note in chat input, got:\n%s", got)
@@ -37,7 +37,7 @@ func TestBuildChatTurnInputAddsPowerShellCrewNote(t *testing.T) {
 func TestBuildChatTurnInputSkipsPrimerForCodingRequest(t *testing.T) {
 	meta := &chatSessionMeta{ID: "s3", AgentSpec: "coder"}
 
-	got := buildChatTurnInput(meta, nil, nil, "implemente um CRUD em Go com postgres e testes", 8, 900)
+	got := buildChatTurnInput(meta, nil, nil, "implemente um CRUD em Go com postgres e testes", 8, 900, nil)
 
 	if strings.Contains(got, "[deeph_command_primer]") {
 		t.Fatalf("did not expect command primer for coding-only request, got:\n%s", got)
@@ -68,7 +68,7 @@ func TestBuildChatTurnInputAddsOperationalState(t *testing.T) {
 		},
 	}
 
-	got := buildChatTurnInput(meta, nil, nil, "segue", 8, 900)
+	got := buildChatTurnInput(meta, nil, nil, "segue", 8, 900, nil)
 
 	for _, want := range []string{
 		"[chat_operational_state]",
@@ -113,7 +113,7 @@ func TestBuildChatTurnInputUsesEpisodeMemoryBeforeOldRawHistory(t *testing.T) {
 		{Turn: 4, Role: "assistant", Agent: "guide", Text: "rode deeph studio"},
 	}
 
-	got := buildChatTurnInput(meta, memory, entries, "continua", 8, 220)
+	got := buildChatTurnInput(meta, memory, entries, "continua", 8, 220, nil)
 
 	for _, want := range []string{
 		"[chat_working_set]",
@@ -229,8 +229,8 @@ func TestBuildChatTurnInputCachedReusesStableBlocks(t *testing.T) {
 	}
 	cache := &chatPromptCache{}
 
-	first := buildChatTurnInputCached(meta, memory, entries, "continua", 8, 220, cache)
-	second := buildChatTurnInputCached(meta, memory, entries, "me da o proximo passo", 8, 220, cache)
+	first := buildChatTurnInputCached(meta, memory, entries, "continua", 8, 220, nil, cache)
+	second := buildChatTurnInputCached(meta, memory, entries, "me da o proximo passo", 8, 220, nil, cache)
 
 	if first == "" || second == "" {
 		t.Fatalf("expected non-empty cached inputs")
@@ -249,7 +249,7 @@ func TestBuildChatTurnInputCachedReusesStableBlocks(t *testing.T) {
 	}
 
 	entries = append(entries, chatSessionEntry{Turn: 5, Role: "user", Text: "e o validate?"})
-	_ = buildChatTurnInputCached(meta, memory, entries, "agora sim", 8, 220, cache)
+	_ = buildChatTurnInputCached(meta, memory, entries, "agora sim", 8, 220, nil, cache)
 
 	if cache.historyBuilds != 2 {
 		t.Fatalf("expected history block rebuild after tail change, got %d", cache.historyBuilds)
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"deeph/internal/runtime"
+)
+
+// contextResumeFlags are the context save/resume flags shared by run, edit and
+// diagnose.
+type contextResumeFlags struct {
+	save   *bool
+	resume *string
+	merge  *string
+	ttl    *time.Duration
+}
+
+func addContextResumeFlags(fs *flag.FlagSet) contextResumeFlags {
+	return contextResumeFlags{
+		save:   fs.Bool("save-context", true, "save the run's context to .deeph/contexts/<run-id>.json"),
+		resume: fs.String("resume-context", "", "seed the run with a saved context (run id, id prefix, or \"last\")"),
+		merge:  fs.String("resume-merge", runtime.ContextMergeAuto, "how a resumed context merges: auto|all|facts"),
+		ttl:    fs.Duration("resume-ttl", runtime.DefaultContextResumeTTL, "drop resumed facts and events older than this"),
+	}
+}
+
+// args renders the flags that differ from their defaults, for commands that
+// hand off to another command (diagnose --fix -> edit).
+func (f contextResumeFlags) args() []string {
+	var out []string
+	if !*f.save {
+		out = append(out, "--save-context=false")
+	}
+	if ref := strings.TrimSpace(*f.resume); ref != "" {
+		out = append(out, "--resume-context", ref)
+	}
+	if m := strings.TrimSpace(*f.merge); m != "" && m != runtime.ContextMergeAuto {
+		out = append(out, "--resume-merge", m)
+	}
+	if *f.ttl != runtime.DefaultContextResumeTTL {
+		out = append(out, "--resume-ttl", f.ttl.String())
+	}
+	return out
+}
+
+func (f contextResumeFlags) apply(req *daemonRunRequest) {
+	req.SkipContextSave = !*f.save
+	req.ResumeContext = strings.TrimSpace(*f.resume)
+	req.ResumeMerge = strings.TrimSpace(*f.merge)
+	if *f.ttl != runtime.DefaultContextResumeTTL {
+		req.ResumeTTL = f.ttl.String()
+	}
+}
+
+func (f contextResumeFlags) context(ctx context.Context, workspace string) (context.Context, error) {
+	var req daemonRunRequest
+	f.apply(&req)
+	return withContextPersistence(ctx, workspace, !req.SkipContextSave, req.ResumeContext, req.ResumeMerge, req.ResumeTTL)
+}
+
+// withContextPersistence attaches save/resume settings for a run in
+// workspace, loading the referenced snapshot up front so a bad id fails
+// before any agent runs.
+func withContextPersistence(ctx context.Context, workspace string, save bool, resumeRef, merge, ttl string) (context.Context, error) {
+	p := runtime.ContextPersistence{Save: save}
+	switch merge = strings.TrimSpace(merge); merge {
+	case "", runtime.ContextMergeAuto, runtime.ContextMergeAll, runtime.ContextMergeFacts:
+		p.Opts.Merge = merge
+	default:
+		return ctx, fmt.Errorf("invalid --resume-merge %q (want auto|all|facts)", merge)
+	}
+	if ttl = strings.TrimSpace(ttl); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return ctx, fmt.Errorf("invalid --resume-ttl %q", ttl)
+		}
+		p.Opts.TTL = d
+	}
+	if ref := strings.TrimSpace(resumeRef); ref != "" {
+		file, err := runtime.LoadContextSnapshot(workspace, ref)
+		if err != nil {
+			return ctx, err
+		}
+		p.Resume = &file
+	}
+	return runtime.WithContextPersistence(ctx, p), nil
+}
@@ -9,6 +9,7 @@ import (
 	"sort"
 	"strings"
 
+	"deeph/internal/project"
 	"deeph/internal/typesys"
 	"gopkg.in/yaml.v3"
 )
@@ -18,6 +19,14 @@ type crewConfig struct {
 	Description string         `yaml:"description" json:"description,omitempty"`
 	Spec        string         `yaml:"spec" json:"spec"`
 	Universes   []crewUniverse `yaml:"universes" json:"universes,omitempty"`
+	Loops       []crewLoop     `yaml:"loops" json:"loops,omitempty"`
+}
+
+// crewLoop declares a loop for one agent of the crew; it takes precedence over
+// the loop in that agent's YAML.
+type crewLoop struct {
+	Agent              string `yaml:"agent" json:"agent"`
+	project.LoopConfig `yaml:",inline"`
 }
 
 type crewUniverse struct {
@@ -110,6 +119,13 @@ func cmdCrewShow(args []string) error {
 		fmt.Printf("description: %s\n", crew.Description)
 	}
 	fmt.Printf("spec: %s\n", crew.Spec)
+	for _, l := range crew.Loops {
+		max := l.MaxIterations
+		if max <= 0 {
+			max = project.DefaultLoopIterations
+		}
+		fmt.Printf("loop: %s -> %s max_iterations=%d until=%s\n", l.Agent, l.BackTo, max, describeLoopUntil(l.Until))
+	}
 	if len(crew.Universes) == 0 {
 		fmt.Println("universes: (none)")
 		return nil
@@ -277,3 +293,52 @@ func resolveAgentSpecOrCrew(workspace, raw string) (resolvedSpec string, crew *c
 	}
 	return raw, nil, nil
 }
+
+// applyCrewLoops copies the crew's loops onto the project agents so the
+// runtime picks them up like loops declared in agent YAML.
+func applyCrewLoops(p *project.Project, crew *crewConfig) error {
+	if p == nil || crew == nil || len(crew.Loops) == 0 {
+		return nil
+	}
+	agentByName := make(map[string]project.AgentConfig, len(p.Agents))
+	for _, a := range p.Agents {
+		agentByName[a.Name] = a
+	}
+	for i, l := range crew.Loops {
+		var issues []project.Issue
+		name := strings.TrimSpace(l.Agent)
+		if name == "" {
+			return fmt.Errorf("crew %q loops[%d].agent is required", crew.Name, i)
+		}
+		project.ValidateLoop(&issues, "", fmt.Sprintf("loops[%d]", i), name, l.LoopConfig, agentByName)
+		for _, is := range issues {
+			if is.Level == project.IssueError {
+				return fmt.Errorf("crew %q %s: %s", crew.Name, is.Field, is.Message)
+			}
+		}
+		for j := range p.Agents {
+			if p.Agents[j].Name == name {
+				loop := l.LoopConfig
+				p.Agents[j].Loop = &loop
+			}
+		}
+	}
+	return nil
+}
+
+func describeLoopUntil(c project.RouteCondition) string {
+	parts := []string{}
+	if f := strings.TrimSpace(c.Field); f != "" {
+		parts = append(parts, "field="+f)
+	}
+	if c.Equals != "" {
+		parts = append(parts, fmt.Sprintf("equals=%q", c.Equals))
+	}
+	if len(c.In) > 0 {
+		parts = append(parts, fmt.Sprintf("in=%v", c.In))
+	}
+	if c.Regex != "" {
+		parts = append(parts, "regex=/"+c.Regex+"/")
+	}
+	return strings.Join(parts, " ")
+}
@@ -20,6 +20,8 @@ import (
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"deeph/internal/runtime"
 )
 
 type crudComposeRuntime struct {
@@ -290,7 +292,7 @@ func findCRUDComposeFile(workspace string) (string, error) {
 			return walkErr
 		}
 		if d.IsDir() {
-			if path != workspace && shouldSkipCRUDSearchDir(d.Name()) {
+			if path != workspace && runtime.ShouldSkipWorkspaceDir(d.Name()) {
 				return filepath.SkipDir
 			}
 			return nil
@@ -324,18 +326,6 @@ func findCRUDComposeFile(workspace string) (string, error) {
 	return candidates[0].Path, nil
 }
 
-func shouldSkipCRUDSearchDir(name string) bool {
-	name = strings.TrimSpace(strings.ToLower(name))
-	if name == "" {
-		return false
-	}
-	switch name {
-	case ".git", ".deeph", "node_modules", ".next", ".turbo", "dist", "build", "coverage", "vendor", ".venv", "venv":
-		return true
-	}
-	return strings.HasPrefix(name, ".")
-}
-
 func isCRUDComposeFileName(name string) bool {
 	switch strings.ToLower(strings.TrimSpace(name)) {
 	case "docker-compose.yml", "docker-compose.yaml", "compose.yml", "compose.yaml":
@@ -15,6 +15,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"deeph/internal/project"
 	"deeph/internal/runtime"
 
 	"google.golang.org/grpc"
@@ -26,15 +27,18 @@ import (
 )
 
 const (
-	daemonServiceName   = "deeph.daemon.v1.DaemonService"
-	daemonMethodPing    = "/" + daemonServiceName + "/Ping"
-	daemonMethodRun     = "/" + daemonServiceName + "/Run"
-	daemonMethodTrace   = "/" + daemonServiceName + "/Trace"
-	daemonMethodStop    = "/" + daemonServiceName + "/Shutdown"
-	daemonTargetEnvVar  = "DEEPH_DAEMON_TARGET"
-	daemonDebugEnvVar   = "DEEPH_DAEMON_DEBUG"
-	defaultDaemonTarget = "127.0.0.1:7788"
-	defaultDaemonDialTO = 1500 * time.Millisecond
+	daemonServiceName     = "deeph.daemon.v1.DaemonService"
+	daemonMethodPing      = "/" + daemonServiceName + "/Ping"
+	daemonMethodRun       = "/" + daemonServiceName + "/Run"
+	daemonMethodTrace     = "/" + daemonServiceName + "/Trace"
+	daemonMethodStop      = "/" + daemonServiceName + "/Shutdown"
+	daemonMethodApprovals = "/" + daemonServiceName + "/Approvals"
+	daemonMethodApprove   = "/" + daemonServiceName + "/Approve"
+	daemonMethodDeny      = "/" + daemonServiceName + "/Deny"
+	daemonTargetEnvVar    = "DEEPH_DAEMON_TARGET"
+	daemonDebugEnvVar     = "DEEPH_DAEMON_DEBUG"
+	defaultDaemonTarget   = "127.0.0.1:7788"
+	defaultDaemonDialTO   = 1500 * time.Millisecond
 )
 
 var deephDaemonConnCache = struct {
@@ -65,6 +69,18 @@ type daemonRunRequest struct {
 	Multiverse          int    `json:"multiverse"`
 	JudgeAgent          string `json:"judge_agent,omitempty"`
 	JudgeMaxOutputChars int    `json:"judge_max_output_chars,omitempty"`
+	// RunID tags approvals parked by this run; ApprovalMode is "park" or "deny";
+	// anything else, including empty, denies so old clients never block on a prompt.
+	RunID        string `json:"run_id,omitempty"`
+	ApprovalMode string `json:"approval_mode,omitempty"`
+	// ExplainContext records every agent's context candidates in the report.
+	ExplainContext bool `json:"explain_context,omitempty"`
+	// ResumeContext seeds the run from a saved context (run id, prefix or
+	// "last"); SkipContextSave turns off saving this run's context.
+	ResumeContext   string `json:"resume_context,omitempty"`
+	ResumeMerge     string `json:"resume_merge,omitempty"`
+	ResumeTTL       string `json:"resume_ttl,omitempty"`
+	SkipContextSave bool   `json:"skip_context_save,omitempty"`
 }
 
 type daemonTraceRequest struct {
@@ -100,7 +116,7 @@ type daemonRunResponse struct {
 
 func cmdDaemon(args []string) error {
 	if len(args) == 0 {
-		return errors.New("daemon requires a subcommand: serve, start, status or stop")
+		return errors.New("daemon requires a subcommand: serve, start, status, stop, approvals, approve or deny")
 	}
 	switch args[0] {
 	case "serve":
@@ -111,6 +127,12 @@ func cmdDaemon(args []string) error {
 		return cmdDaemonStatus(args[1:])
 	case "stop":
 		return cmdDaemonStop(args[1:])
+	case "approvals":
+		return cmdDaemonApprovals(args[1:])
+	case "approve":
+		return cmdDaemonDecide(true, args[1:])
+	case "deny":
+		return cmdDaemonDecide(false, args[1:])
 	default:
 		return fmt.Errorf("unknown daemon subcommand %q", args[0])
 	}
@@ -119,6 +141,7 @@ func cmdDaemon(args []string) error {
 func cmdDaemonServe(args []string) error {
 	fs := flag.NewFlagSet("daemon serve", flag.ContinueOnError)
 	target := fs.String("target", deephDaemonDefaultTarget(), "daemon listen target (host:port)")
+	approvalTimeout := fs.Duration("approval-timeout", defaultDaemonApprovalTO, "deny parked tool-call approvals after this long")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
@@ -132,7 +155,7 @@ func cmdDaemonServe(args []string) error {
 	defer listener.Close()
 
 	grpcServer := grpc.NewServer()
-	svc := &deephDaemonServiceServer{grpcServer: grpcServer}
+	svc := &deephDaemonServiceServer{grpcServer: grpcServer, approvals: newDaemonApprovalQueue(*approvalTimeout)}
 	grpcServer.RegisterService(&deephDaemonServiceDesc, svc)
 
 	fmt.Printf("deephd listening on %s\n", listener.Addr().String())
@@ -337,12 +360,21 @@ func cmdTraceViaDaemon(target string, req daemonTraceRequest, jsonOut bool) erro
 	return nil
 }
 
-func cmdRunViaDaemon(target string, req daemonRunRequest, showTrace bool) error {
+func cmdRunViaDaemon(target, command string, req daemonRunRequest, showTrace bool) error {
+	interactive := isInteractiveTerminal(os.Stdin)
+	req.RunID = fmt.Sprintf("run-%d-%d", os.Getpid(), time.Now().UnixNano())
+	req.ApprovalMode = daemonRunApprovalMode(interactive)
+	if interactive {
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		defer stopWatch()
+		go watchDaemonApprovals(watchCtx, target, req.RunID)
+	}
 	resp, err := deephDaemonRun(target, req)
 	if err != nil {
 		return err
 	}
 	recordCoachCommandTransition(resp.Workspace, "run", resp.ResolvedSpec)
+	recordDaemonRun(command, req, resp)
 	if resp.Multiverse {
 		mvPlan := &multiverseOrchestrationPlan{
 			Scheduler: resp.Scheduler,
@@ -366,6 +398,20 @@ func cmdRunViaDaemon(target string, req daemonRunRequest, showTrace bool) error
 	return nil
 }
 
+// recordDaemonRun adds a daemon-executed run to the workspace run history.
+func recordDaemonRun(command string, req daemonRunRequest, resp daemonRunResponse) {
+	// Without a loadable project the default retention applies.
+	p, _ := project.Load(resp.Workspace)
+	rec := newRunRecord(command, req.AgentSpecArg, resp.ResolvedSpec, req.Input)
+	if resp.Multiverse {
+		judge := resp.Judge
+		rec.setMultiverse(&multiverseOrchestrationPlan{Scheduler: resp.Scheduler, Handoffs: resp.UniverseHandoffs}, resp.Branches, &judge)
+	} else {
+		rec.setReport(resp.Plan, resp.Report)
+	}
+	recordRun(resp.Workspace, p, rec, nil)
+}
+
 func deephDaemonInvoke(ctx context.Context, target, method string, req any, out any) error {
 	target = strings.TrimSpace(target)
 	if target == "" {
@@ -544,10 +590,14 @@ type deephDaemonService interface {
 	Run(context.Context, *structpb.Struct) (*structpb.Struct, error)
 	Trace(context.Context, *structpb.Struct) (*structpb.Struct, error)
 	Shutdown(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	Approvals(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	Approve(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	Deny(context.Context, *structpb.Struct) (*structpb.Struct, error)
 }
 
 type deephDaemonServiceServer struct {
 	grpcServer *grpc.Server
+	approvals  *daemonApprovalQueue
 }
 
 func (s *deephDaemonServiceServer) Ping(_ context.Context, _ *structpb.Struct) (*structpb.Struct, error) {
@@ -603,6 +653,13 @@ func (s *deephDaemonServiceServer) Run(ctx context.Context, in *structpb.Struct)
 	if req.Multiverse < 0 {
 		return nil, errors.New("run request multiverse must be >= 0")
 	}
+	// Without an approver gated tool calls are denied, so "deny" needs no hook.
+	if s.approvals != nil && req.ApprovalMode == daemonApprovalModePark {
+		ctx = runtime.WithApprover(ctx, s.approvals.approver(req.RunID))
+	}
+	if req.ExplainContext {
+		ctx = runtime.WithContextExplain(ctx)
+	}
 	resp, err := executeDaemonRun(ctx, req)
 	if err != nil {
 		return nil, err
@@ -622,10 +679,14 @@ func executeDaemonTrace(ctx context.Context, req daemonTraceRequest) (daemonTrac
 	if err != nil {
 		return daemonTraceResponse{}, err
 	}
+	defer eng.Close()
 	resolvedSpec, crew, err := resolveAgentSpecOrCrew(abs, req.AgentSpecArg)
 	if err != nil {
 		return daemonTraceResponse{}, err
 	}
+	if err := applyCrewLoops(p, crew); err != nil {
+		return daemonTraceResponse{}, err
+	}
 	universes, err := buildMultiverseUniverses(abs, req.AgentSpecArg, resolvedSpec, req.Input, req.Multiverse, crew)
 	if err != nil {
 		return daemonTraceResponse{}, err
@@ -669,14 +730,24 @@ func executeDaemonRun(ctx context.Context, req daemonRunRequest) (daemonRunRespo
 	if err != nil {
 		return daemonRunResponse{}, err
 	}
+	defer eng.Close()
 	resolvedSpec, crew, err := resolveAgentSpecOrCrew(abs, req.AgentSpecArg)
 	if err != nil {
 		return daemonRunResponse{}, err
 	}
+	if err := applyCrewLoops(p, crew); err != nil {
+		return daemonRunResponse{}, err
+	}
 	universes, err := buildMultiverseUniverses(abs, req.AgentSpecArg, resolvedSpec, req.Input, req.Multiverse, crew)
 	if err != nil {
 		return daemonRunResponse{}, err
 	}
+	if len(universes) <= 1 {
+		ctx, err = withContextPersistence(ctx, abs, !req.SkipContextSave, req.ResumeContext, req.ResumeMerge, req.ResumeTTL)
+		if err != nil {
+			return daemonRunResponse{}, err
+		}
+	}
 
 	resp := daemonRunResponse{
 		Workspace:    abs,
@@ -737,6 +808,18 @@ var deephDaemonServiceDesc = grpc.ServiceDesc{
 			MethodName: "Shutdown",
 			Handler:    deephDaemonShutdownHandler,
 		},
+		{
+			MethodName: "Approvals",
+			Handler:    deephDaemonApprovalsHandler,
+		},
+		{
+			MethodName: "Approve",
+			Handler:    deephDaemonApproveHandler,
+		},
+		{
+			MethodName: "Deny",
+			Handler:    deephDaemonDenyHandler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/deeph/daemon/v1/daemon.proto",
@@ -813,3 +896,57 @@ func deephDaemonShutdownHandler(srv any, ctx context.Context, dec func(any) erro
 	}
 	return interceptor(ctx, in, info, handler)
 }
+
+func deephDaemonApprovalsHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := &structpb.Struct{}
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(deephDaemonService).Approvals(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: daemonMethodApprovals,
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(deephDaemonService).Approvals(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func deephDaemonApproveHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := &structpb.Struct{}
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(deephDaemonService).Approve(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: daemonMethodApprove,
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(deephDaemonService).Approve(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func deephDaemonDenyHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := &structpb.Struct{}
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(deephDaemonService).Deny(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: daemonMethodDeny,
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(deephDaemonService).Deny(ctx, req.(*structpb.Struct))
+	}
+	return interceptor(ctx, in, info, handler)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"deeph/internal/runtime"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	daemonApprovalModePark  = "park"
+	daemonApprovalModeDeny  = "deny"
+	defaultDaemonApprovalTO = 10 * time.Minute
+)
+
+type daemonPendingApproval struct {
+	ID        string                  `json:"id"`
+	RunID     string                  `json:"run_id,omitempty"`
+	Request   runtime.ApprovalRequest `json:"request"`
+	CreatedAt time.Time               `json:"created_at"`
+
+	decision chan runtime.ApprovalDecision
+}
+
+type daemonApprovalListRequest struct {
+	RunID string `json:"run_id,omitempty"`
+}
+
+type daemonApprovalListResponse struct {
+	Pending []daemonPendingApproval `json:"pending"`
+}
+
+type daemonApprovalDecisionRequest struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// daemonApprovalQueue parks gated tool calls from daemon runs until an
+// Approve/Deny RPC arrives, the run is cancelled or the timeout denies them.
+type daemonApprovalQueue struct {
+	mu      sync.Mutex
+	seq     uint64
+	pending map[string]*daemonPendingApproval
+	timeout time.Duration
+}
+
+func newDaemonApprovalQueue(timeout time.Duration) *daemonApprovalQueue {
+	if timeout <= 0 {
+		timeout = defaultDaemonApprovalTO
+	}
+	return &daemonApprovalQueue{pending: map[string]*daemonPendingApproval{}, timeout: timeout}
+}
+
+func (q *daemonApprovalQueue) approver(runID string) runtime.Approver {
+	return func(ctx context.Context, req runtime.ApprovalRequest) (runtime.ApprovalDecision, error) {
+		q.mu.Lock()
+		q.seq++
+		p := &daemonPendingApproval{
+			ID:        "ap-" + strconv.FormatUint(q.seq, 10),
+			RunID:     runID,
+			Request:   req,
+			CreatedAt: time.Now(),
+			decision:  make(chan runtime.ApprovalDecision, 1),
+		}
+		q.pending[p.ID] = p
+		q.mu.Unlock()
+		defer q.remove(p.ID)
+
+		timer := time.NewTimer(q.timeout)
+		defer timer.Stop()
+		select {
+		case d := <-p.decision:
+			return d, nil
+		case <-timer.C:
+			return runtime.ApprovalDecision{Reason: fmt.Sprintf("no decision within %s", q.timeout)}, nil
+		case <-ctx.Done():
+			return runtime.ApprovalDecision{}, ctx.Err()
+		}
+	}
+}
+
+func (q *daemonApprovalQueue) remove(id string) {
+	q.mu.Lock()
+	delete(q.pending, id)
+	q.mu.Unlock()
+}
+
+func (q *daemonApprovalQueue) list(runID string) []daemonPendingApproval {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]daemonPendingApproval, 0, len(q.pending))
+	for _, p := range q.pending {
+		if runID != "" && p.RunID != runID {
+			continue
+		}
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+func (q *daemonApprovalQueue) resolve(id string, d runtime.ApprovalDecision) error {
+	q.mu.Lock()
+	p, ok := q.pending[strings.TrimSpace(id)]
+	if ok {
+		delete(q.pending, p.ID)
+	}
+	q.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no pending approval %q", id)
+	}
+	p.decision <- d
+	return nil
+}
+
+// daemonRunApprovalMode picks how the daemon treats gated calls for a run:
+// interactive CLI clients answer parked approvals themselves, everything else
+// is denied unless the caller asked to park.
+func daemonRunApprovalMode(interactive bool) string {
+	if interactive {
+		return daemonApprovalModePark
+	}
+	return daemonApprovalModeDeny
+}
+
+// watchDaemonApprovals polls the daemon for approvals parked by runID and
+// answers them at the terminal until ctx is cancelled.
+func watchDaemonApprovals(ctx context.Context, target, runID string) {
+	prompt := newTerminalApprover(newStdinLineReader(), os.Stderr)
+	ticker := time.NewTicker(400 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var resp daemonApprovalListResponse
+		if err := deephDaemonInvoke(ctx, target, daemonMethodApprovals, daemonApprovalListRequest{RunID: runID}, &resp); err != nil {
+			continue
+		}
+		for _, p := range resp.Pending {
+			d, err := prompt(ctx, p.Request)
+			if err != nil {
+				return
+			}
+			method := daemonMethodDeny
+			if d.Approved {
+				method = daemonMethodApprove
+			}
+			var out map[string]any
+			_ = deephDaemonInvoke(ctx, target, method, daemonApprovalDecisionRequest{ID: p.ID, Reason: d.Reason}, &out)
+		}
+	}
+}
+
+func cmdDaemonApprovals(args []string) error {
+	fs := flag.NewFlagSet("daemon approvals", flag.ContinueOnError)
+	target := fs.String("target", deephDaemonDefaultTarget(), "daemon target (host:port)")
+	runID := fs.String("run", "", "only show approvals for this run id")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var resp daemonApprovalListResponse
+	if err := deephDaemonInvoke(ctx, strings.TrimSpace(*target), daemonMethodApprovals, daemonApprovalListRequest{RunID: strings.TrimSpace(*runID)}, &resp); err != nil {
+		return err
+	}
+	if len(resp.Pending) == 0 {
+		fmt.Println("No pending approvals.")
+		return nil
+	}
+	for _, p := range resp.Pending {
+		fmt.Printf("%s  run=%s agent=%s call=%s (%s) waiting=%s\n", p.ID, coalesce(p.RunID, "-"), p.Request.Agent, approvalTarget(p.Request), p.Request.Reason, time.Since(p.CreatedAt).Round(time.Second))
+		if args := approvalArgsPreview(p.Request.Args, 300); args != "" {
+			fmt.Printf("    args: %s\n", args)
+		}
+	}
+	return nil
+}
+
+func cmdDaemonDecide(approve bool, args []string) error {
+	name := "daemon deny"
+	method := daemonMethodDeny
+	if approve {
+		name, method = "daemon approve", daemonMethodApprove
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	target := fs.String("target", deephDaemonDefaultTarget(), "daemon target (host:port)")
+	reason := fs.String("reason", "", "optional reason returned to the agent")
+	rest, err := parseFlagsLoose(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("%s requires <approval-id>", name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var out map[string]any
+	if err := deephDaemonInvoke(ctx, strings.TrimSpace(*target), method, daemonApprovalDecisionRequest{ID: rest[0], Reason: strings.TrimSpace(*reason)}, &out); err != nil {
+		return err
+	}
+	if approve {
+		fmt.Printf("approved %s\n", rest[0])
+	} else {
+		fmt.Printf("denied %s\n", rest[0])
+	}
+	return nil
+}
+
+func (s *deephDaemonServiceServer) Approvals(_ context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	req := daemonApprovalListRequest{}
+	if err := deephStructToAny(in, &req); err != nil {
+		return nil, fmt.Errorf("decode approvals request: %w", err)
+	}
+	if s.approvals == nil {
+		return deephStructFromAny(daemonApprovalListResponse{Pending: []daemonPendingApproval{}})
+	}
+	return deephStructFromAny(daemonApprovalListResponse{Pending: s.approvals.list(strings.TrimSpace(req.RunID))})
+}
+
+func (s *deephDaemonServiceServer) Approve(_ context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	return s.decide(in, true)
+}
+
+func (s *deephDaemonServiceServer) Deny(_ context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	return s.decide(in, false)
+}
+
+func (s *deephDaemonServiceServer) decide(in *structpb.Struct, approved bool) (*structpb.Struct, error) {
+	req := daemonApprovalDecisionRequest{}
+	if err := deephStructToAny(in, &req); err != nil {
+		return nil, fmt.Errorf("decode approval decision: %w", err)
+	}
+	if strings.TrimSpace(req.ID) == "" {
+		return nil, errors.New("approval decision requires id")
+	}
+	if s.approvals == nil {
+		return nil, fmt.Errorf("no pending approval %q", req.ID)
+	}
+	if err := s.approvals.resolve(req.ID, runtime.ApprovalDecision{Approved: approved, Reason: strings.TrimSpace(req.Reason)}); err != nil {
+		return nil, err
+	}
+	return deephStructFromAny(map[string]any{"ok": true, "id": req.ID, "approved": approved})
+}
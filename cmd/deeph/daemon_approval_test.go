@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"deeph/internal/runtime"
+)
+
+func TestDaemonApprovalQueueParksUntilDecision(t *testing.T) {
+	q := newDaemonApprovalQueue(time.Minute)
+	approve := q.approver("run-1")
+	done := make(chan runtime.ApprovalDecision, 1)
+	go func() {
+		d, _ := approve(context.Background(), runtime.ApprovalRequest{Agent: "coder", Skill: "writer", Reason: "writes a.txt"})
+		done <- d
+	}()
+
+	var pending []daemonPendingApproval
+	for i := 0; i < 100 && len(pending) == 0; i++ {
+		time.Sleep(5 * time.Millisecond)
+		pending = q.list("run-1")
+	}
+	if len(pending) != 1 || pending[0].Request.Skill != "writer" {
+		t.Fatalf("expected one parked approval, got %+v", pending)
+	}
+	if other := q.list("run-2"); len(other) != 0 {
+		t.Fatalf("expected run filter to hide approval, got %+v", other)
+	}
+	if err := q.resolve(pending[0].ID, runtime.ApprovalDecision{Reason: "wrong branch"}); err != nil {
+		t.Fatalf("resolve error: %v", err)
+	}
+	if d := <-done; d.Approved || d.Reason != "wrong branch" {
+		t.Fatalf("unexpected decision: %+v", d)
+	}
+	if err := q.resolve(pending[0].ID, runtime.ApprovalDecision{Approved: true}); err == nil {
+		t.Fatalf("expected resolved approval to be gone")
+	}
+
+	q = newDaemonApprovalQueue(10 * time.Millisecond)
+	d, err := q.approver("run-1")(context.Background(), runtime.ApprovalRequest{Skill: "writer"})
+	if err != nil || d.Approved || !strings.Contains(d.Reason, "no decision") {
+		t.Fatalf("expected timeout denial, got %+v err=%v", d, err)
+	}
+}
+
+func TestTerminalApproverRemembersAlways(t *testing.T) {
+	answers := []string{"a\n", "n\n"}
+	var out bytes.Buffer
+	approve := newTerminalApprover(func() (string, bool) {
+		if len(answers) == 0 {
+			return "", false
+		}
+		line := answers[0]
+		answers = answers[1:]
+		return line, true
+	}, &out)
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if d, _ := approve(ctx, runtime.ApprovalRequest{Agent: "coder", Skill: "writer", Reason: "writes a.txt"}); !d.Approved {
+			t.Fatalf("call %d: expected writer to be approved, got %+v", i, d)
+		}
+	}
+	if d, _ := approve(ctx, runtime.ApprovalRequest{Agent: "coder", Skill: "shell", Reason: "runs make"}); d.Approved {
+		t.Fatalf("expected shell to be denied, got %+v", d)
+	}
+	if n := strings.Count(out.String(), "allow?"); n != 2 {
+		t.Fatalf("expected 2 prompts, got %d:\n%s", n, out.String())
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -36,14 +37,21 @@ func cmdDiagnose(args []string) error {
 	yes := fs.Bool("yes", false, "with --fix, run the follow-up edit without asking for confirmation")
 	jsonOut := fs.Bool("json", false, "print diagnose payload as JSON instead of running")
 	inputFile := fs.String("file", "", "read the failing output or error text from a file")
+	fromRun := fs.String("from-run", "", "diagnose a recorded run (run id, id prefix, or \"last\"); extra text is appended")
+	persist := addContextResumeFlags(fs)
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
-	issue, err := readDiagnoseIssue(fs.Args(), *inputFile)
+	issue, err := diagnoseIssueFromRun(*workspace, *fromRun, fs.Args())
 	if err != nil {
 		return err
 	}
+	if issue == "" {
+		if issue, err = readDiagnoseIssue(fs.Args(), *inputFile); err != nil {
+			return err
+		}
+	}
 
 	p, abs, verr, err := loadAndValidate(*workspace)
 	if err != nil {
@@ -54,14 +62,15 @@ func cmdDiagnose(args []string) error {
 		return verr
 	}
 
+	selectedSpec := defaultDiagnoseAgentSpec(p, strings.TrimSpace(*spec))
 	cfg := diagnosescope.DefaultConfig()
+	cfg.Tokenizer = promptTokenizer(p, abs, selectedSpec)
 	scope, err := diagnosescope.BuildScope(abs, strings.TrimSpace(*baseRef), issue, cfg)
 	if err != nil {
 		return err
 	}
 	input := diagnosescope.BuildInput(scope, issue, cfg)
-	promptTokens := diagnosescope.EstimateTokens(input)
-	selectedSpec := defaultDiagnoseAgentSpec(p, strings.TrimSpace(*spec))
+	promptTokens := cfg.Tokenizer.Count(input)
 
 	if *jsonOut {
 		payload := diagnoseJSONPayload{
@@ -75,15 +84,22 @@ func cmdDiagnose(args []string) error {
 		return enc.Encode(payload)
 	}
 
-	resolvedSpec, _, err := resolveAgentSpecOrCrew(abs, selectedSpec)
+	resolvedSpec, crew, err := resolveAgentSpecOrCrew(abs, selectedSpec)
 	if err != nil {
 		return err
 	}
+	if err := applyCrewLoops(p, crew); err != nil {
+		return err
+	}
 	eng, err := runtime.New(abs, p)
 	if err != nil {
 		return err
 	}
-	ctx := context.Background()
+	defer eng.Close()
+	ctx, err := persist.context(withCLIApprover(context.Background()), abs)
+	if err != nil {
+		return err
+	}
 	recordCoachCommandTransition(abs, "diagnose", selectedSpec)
 	plan, tasks, err := eng.PlanSpec(ctx, resolvedSpec, input)
 	if err != nil {
@@ -105,22 +121,33 @@ func cmdDiagnose(args []string) error {
 			ShowTrace:   *showTrace,
 		})
 	}
+	rec := newRunRecord("diagnose", selectedSpec, resolvedSpec, input)
+	rec.setScope(scope)
 	report, err := eng.RunSpec(ctx, resolvedSpec, input)
 	stopCoach()
 	if err != nil {
+		recordRun(abs, p, rec, err)
 		return err
 	}
+	rec.setReport(plan, report)
+	recordRun(abs, p, rec, nil)
 	recordCoachRunSignals(abs, &plan, report)
 	fmt.Printf("Diagnose started=%s refs=%d working_set=%d prompt=%dt spec=%q\n", report.StartedAt.Format(time.RFC3339), len(scope.References), len(scope.WorkingSet), promptTokens, selectedSpec)
+	printContextResumed(report)
 	printExecutionReport(report)
+	printContextSaved(report)
 	fmt.Printf("\nFinished in %s\n", report.EndedAt.Sub(report.StartedAt).Round(time.Millisecond))
 	if *showCoach {
 		maybePrintCoachPostRunHint(abs, "diagnose", &plan, report)
 	}
 	if *fix {
 		editTask := buildDiagnoseFixTask(issue, diagnoseLastOutput(report))
+		resumeRunID := ""
+		if report.ContextSaved != "" {
+			resumeRunID = report.RunID
+		}
 		if !*yes {
-			if shouldRun, askErr := confirmDiagnoseFix(abs, editTask); askErr != nil {
+			if shouldRun, askErr := confirmDiagnoseFix(abs, editTask, resumeRunID); askErr != nil {
 				return askErr
 			} else if !shouldRun {
 				saveStudioRecent(abs, selectedSpec, "")
@@ -128,7 +155,7 @@ func cmdDiagnose(args []string) error {
 			}
 		}
 		fmt.Println("\n[follow-up] running deeph edit with diagnosis context")
-		if err := cmdEdit(buildDiagnoseFixEditArgs(abs, *showTrace, *showCoach, editTask)); err != nil {
+		if err := cmdEdit(buildDiagnoseFixEditArgs(abs, *showTrace, *showCoach, editTask, resumeRunID)); err != nil {
 			return err
 		}
 	}
@@ -136,6 +163,27 @@ func cmdDiagnose(args []string) error {
 	return nil
 }
 
+// diagnoseIssueFromRun builds the issue text from a recorded run, with any
+// positional text appended. It returns "" when ref is empty.
+func diagnoseIssueFromRun(workspace, ref string, args []string) (string, error) {
+	if strings.TrimSpace(ref) == "" {
+		return "", nil
+	}
+	abs, err := filepath.Abs(workspace)
+	if err != nil {
+		return "", err
+	}
+	rec, err := loadRunRecord(abs, ref)
+	if err != nil {
+		return "", err
+	}
+	issue := runRecordIssue(rec)
+	if extra := strings.TrimSpace(strings.Join(args, " ")); extra != "" {
+		issue += "\n\n" + extra
+	}
+	return issue, nil
+}
+
 func readDiagnoseIssue(args []string, filePath string) (string, error) {
 	if strings.TrimSpace(filePath) != "" {
 		b, err := os.ReadFile(strings.TrimSpace(filePath))
@@ -229,12 +277,21 @@ func buildDiagnoseFixTask(issue, diagnosis string) string {
 	return strings.TrimSpace(strings.Join(lines, "\n"))
 }
 
-func buildDiagnoseFixEditArgs(workspace string, showTrace, showCoach bool, task string) []string {
-	return buildEditRunArgs(workspace, showTrace, showCoach, task)
+// buildDiagnoseFixEditArgs builds the follow-up edit; with a saved diagnosis
+// context the edit resumes from it instead of starting from zero.
+func buildDiagnoseFixEditArgs(workspace string, showTrace, showCoach bool, task, resumeRunID string) []string {
+	if resumeRunID == "" {
+		return buildEditRunArgs(workspace, showTrace, showCoach, task)
+	}
+	return buildEditRunArgs(workspace, showTrace, showCoach, task, "--resume-context", resumeRunID)
 }
 
-func confirmDiagnoseFix(workspace, task string) (bool, error) {
-	command := "deeph edit --workspace " + workspace + " " + strconv.Quote(task)
+func confirmDiagnoseFix(workspace, task, resumeRunID string) (bool, error) {
+	command := "deeph edit --workspace " + workspace
+	if resumeRunID != "" {
+		command += " --resume-context " + resumeRunID
+	}
+	command += " " + strconv.Quote(task)
 	fmt.Println("\nSuggested follow-up:")
 	fmt.Printf("  %s\n", command)
 	if !isInteractiveTerminal(os.Stdin) {
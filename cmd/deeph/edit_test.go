@@ -12,3 +12,11 @@ func TestBuildEditRunArgs(t *testing.T) {
 		t.Fatalf("got=%v want=%v", got, want)
 	}
 }
+
+func TestBuildDiagnoseFixEditArgsResumesDiagnosisContext(t *testing.T) {
+	got := buildDiagnoseFixEditArgs("/tmp/ws", false, true, "fix nil session", "20261018-101500-512ab")
+	want := []string{"--workspace", "/tmp/ws", "--resume-context", "20261018-101500-512ab", "coder", "fix nil session"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got=%v want=%v", got, want)
+	}
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"deeph/internal/evalsuite"
+	"deeph/internal/project"
+	"deeph/internal/runtime"
+	"deeph/internal/tokenizer"
+)
+
+// evalSuiteReport is the result of one suite, as printed by --json.
+type evalSuiteReport struct {
+	Suite         string                 `json:"suite"`
+	Path          string                 `json:"path"`
+	Spec          string                 `json:"spec,omitempty"`
+	Score         float64                `json:"score"`
+	BaselineScore *float64               `json:"baseline_score,omitempty"`
+	Passed        int                    `json:"passed"`
+	Failed        int                    `json:"failed"`
+	Regressions   int                    `json:"regressions"`
+	Baseline      string                 `json:"baseline,omitempty"`
+	Updated       bool                   `json:"baseline_updated,omitempty"`
+	Cases         []evalsuite.CaseResult `json:"cases"`
+}
+
+func cmdEval(args []string) error {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	workspace := fs.String("workspace", ".", "workspace path")
+	spec := fs.String("spec", "", "run every case with this agent spec or @crew instead of the suite's")
+	only := fs.String("case", "", "comma-separated case names to run")
+	baselinePath := fs.String("baseline", "", "baseline file (default .deeph/evals/<suite>.baseline.json)")
+	updateBaseline := fs.Bool("update-baseline", false, "store this run's scores as the baseline")
+	record := fs.Bool("record", false, "call providers and record each case's cassette instead of replaying it")
+	failUnder := fs.Float64("fail-under", 0, "fail when a suite scores below this (0..1)")
+	jsonOut := fs.Bool("json", false, "print results as JSON")
+	rest, err := parseFlagsLoose(fs, args)
+	if err != nil {
+		return err
+	}
+	p, abs, verr, err := loadAndValidate(*workspace)
+	if err != nil {
+		return err
+	}
+	if verr != nil && verr.HasErrors() {
+		printValidation(verr)
+		return verr
+	}
+	paths, err := resolveEvalSuites(abs, rest)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(*baselinePath) != "" && len(paths) > 1 {
+		return errors.New("--baseline needs a single suite")
+	}
+	var reports []evalSuiteReport
+	var failures []string
+	for _, path := range paths {
+		suite, err := evalsuite.Load(path)
+		if err != nil {
+			return err
+		}
+		cases, err := filterEvalCases(suite.Cases, *only)
+		if err != nil {
+			return err
+		}
+		rep := evalSuiteReport{Suite: suite.Name, Path: path, Spec: coalesce(strings.TrimSpace(*spec), suite.Spec)}
+		for _, c := range cases {
+			if !*jsonOut {
+				fmt.Fprintf(os.Stderr, "eval %s/%s...\n", suite.Name, c.Name)
+			}
+			rep.Cases = append(rep.Cases, runEvalCase(abs, p, suite, c, strings.TrimSpace(*spec), *record))
+		}
+		rep.Score = evalsuite.MeanScore(rep.Cases)
+		for _, r := range rep.Cases {
+			if r.Passed {
+				rep.Passed++
+			} else {
+				rep.Failed++
+			}
+		}
+		rep.Baseline = coalesce(strings.TrimSpace(*baselinePath), evalsuite.BaselinePath(abs, suite.Name))
+		bl, err := evalsuite.LoadBaseline(rep.Baseline)
+		if err != nil {
+			return err
+		}
+		rep.Regressions = evalsuite.Compare(rep.Cases, bl)
+		if bl != nil {
+			rep.BaselineScore = &bl.Score
+		}
+		if *updateBaseline {
+			if err := evalsuite.SaveBaseline(rep.Baseline, evalsuite.NewBaseline(suite.Name, rep.Cases, bl, time.Now())); err != nil {
+				return err
+			}
+			rep.Updated = true
+		} else if rep.Regressions > 0 {
+			failures = append(failures, fmt.Sprintf("%s: %d regression(s)", suite.Name, rep.Regressions))
+		}
+		if *failUnder > 0 && rep.Score < *failUnder {
+			failures = append(failures, fmt.Sprintf("%s: score %.2f < %.2f", suite.Name, rep.Score, *failUnder))
+		}
+		reports = append(reports, rep)
+	}
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			return err
+		}
+	} else {
+		for i, rep := range reports {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Print(formatEvalSuiteReport(rep))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("eval failed: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// resolveEvalSuites maps suite args (paths or names under evals/) to files;
+// without args it runs every evals/*.yaml.
+func resolveEvalSuites(workspace string, args []string) ([]string, error) {
+	if len(args) == 0 {
+		var paths []string
+		for _, pattern := range []string{"*.yaml", "*.yml"} {
+			m, err := filepath.Glob(filepath.Join(workspace, "evals", pattern))
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, m...)
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no eval suites in %s", filepath.Join(workspace, "evals"))
+		}
+		sort.Strings(paths)
+		return paths, nil
+	}
+	paths := make([]string, 0, len(args))
+	for _, a := range args {
+		candidates := []string{a, filepath.Join(workspace, a)}
+		if filepath.Ext(a) == "" {
+			candidates = append(candidates, filepath.Join(workspace, "evals", a+".yaml"), filepath.Join(workspace, "evals", a+".yml"))
+		}
+		found := ""
+		for _, c := range candidates {
+			if info, err := os.Stat(c); err == nil && !info.IsDir() {
+				found = c
+				break
+			}
+		}
+		if found == "" {
+			return nil, fmt.Errorf("eval suite %q not found", a)
+		}
+		abs, err := filepath.Abs(found)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, abs)
+	}
+	return paths, nil
+}
+
+func filterEvalCases(cases []evalsuite.Case, only string) ([]evalsuite.Case, error) {
+	if strings.TrimSpace(only) == "" {
+		return cases, nil
+	}
+	want := map[string]bool{}
+	for _, name := range strings.Split(only, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			want[name] = true
+		}
+	}
+	var out []evalsuite.Case
+	for _, c := range cases {
+		if want[c.Name] {
+			out = append(out, c)
+			delete(want, c.Name)
+		}
+	}
+	if len(want) > 0 {
+		var missing []string
+		for name := range want {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return nil, fmt.Errorf("unknown case(s): %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// runEvalCase runs one case and scores its output. Errors become a failed,
+// zero-score case so the rest of the suite still runs.
+func runEvalCase(workspace string, p *project.Project, suite evalsuite.Suite, c evalsuite.Case, specOverride string, record bool) evalsuite.CaseResult {
+	start := time.Now()
+	spec := coalesce(specOverride, suite.SpecFor(c))
+	output, usage, err := executeEvalCase(workspace, p, suite, c, spec, record)
+	res := evalsuite.ScoreCase(suite, c, output, err)
+	res.Spec = spec
+	res.DurationMS = time.Since(start).Milliseconds()
+	res.Tokens = usage.TotalTokens
+	return res
+}
+
+func executeEvalCase(workspace string, p *project.Project, suite evalsuite.Suite, c evalsuite.Case, spec string, record bool) (string, runtime.TokenUsage, error) {
+	var usage runtime.TokenUsage
+	resolved, crew, err := resolveAgentSpecOrCrew(workspace, spec)
+	if err != nil {
+		return "", usage, err
+	}
+	p = evalCaseProject(workspace, p)
+	if err := applyCrewLoops(p, crew); err != nil {
+		return "", usage, err
+	}
+	caseWs := workspace
+	if c.Workspace != "" {
+		fixture, cleanup, err := copyEvalFixture(suite.Resolve(c.Workspace))
+		if err != nil {
+			return "", usage, err
+		}
+		defer cleanup()
+		caseWs = fixture
+	}
+	input := c.Input
+	if c.Diff != "" {
+		b, err := os.ReadFile(suite.Resolve(c.Diff))
+		if err != nil {
+			return "", usage, err
+		}
+		input = strings.TrimSpace(input) + "\n\n```diff\n" + strings.TrimRight(string(b), "\n") + "\n```"
+	}
+	eng, err := runtime.New(caseWs, p)
+	if err != nil {
+		return "", usage, err
+	}
+	defer eng.Close()
+	ctx := context.Background()
+	save := func() error { return nil }
+	if c.Cassette != "" {
+		path := suite.Resolve(c.Cassette)
+		if record {
+			rec := runtime.NewCassetteRecorder(resolved, eng.Redactor().Redact(input))
+			ctx = runtime.WithCassetteRecorder(ctx, rec)
+			save = func() error { return runtime.SaveCassette(path, rec.Cassette()) }
+		} else {
+			cassette, err := runtime.LoadCassette(path)
+			if err != nil {
+				return "", usage, fmt.Errorf("%w (record it with deeph eval --record)", err)
+			}
+			ctx = runtime.WithCassetteReplay(ctx, runtime.NewCassetteReplay(cassette))
+		}
+	}
+	report, err := eng.RunSpec(ctx, resolved, input)
+	if serr := save(); serr != nil && err == nil {
+		err = fmt.Errorf("save cassette: %w", serr)
+	}
+	if err != nil {
+		return "", usage, err
+	}
+	return evalCaseOutput(report, c.Agent)
+}
+
+// evalCaseProject copies p for one case, so crew loops applied to it do not
+// leak into later cases, and makes provider files configured relative to the
+// project absolute so they still resolve from a fixture copy.
+func evalCaseProject(workspace string, p *project.Project) *project.Project {
+	cp := *p
+	cp.Agents = append([]project.AgentConfig(nil), p.Agents...)
+	cp.Root.Providers = append([]project.ProviderConfig(nil), p.Root.Providers...)
+	for i := range cp.Root.Providers {
+		pc := &cp.Root.Providers[i]
+		pc.MockScript = runtime.MockScriptPath(workspace, pc.MockScript)
+		if tok := strings.TrimSpace(pc.Tokenizer); tokenizer.LooksLikePath(tok) && !filepath.IsAbs(tok) {
+			pc.Tokenizer = filepath.Join(workspace, tok)
+		}
+	}
+	return &cp
+}
+
+// copyEvalFixture copies a fixture workspace into a temp directory so the
+// checked-in fixture is never written to, and memory, artifacts and saved
+// contexts from one run do not carry over into the next.
+func copyEvalFixture(src string) (string, func(), error) {
+	if info, err := os.Stat(src); err != nil || !info.IsDir() {
+		return "", nil, fmt.Errorf("fixture workspace %s is not a directory", src)
+	}
+	dir, err := os.MkdirTemp("", "deeph-eval-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+	if err := os.CopyFS(dir, os.DirFS(src)); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("copy fixture workspace %s: %w", src, err)
+	}
+	return dir, cleanup, nil
+}
+
+// evalCaseOutput picks the scored output: the named agent's last result, or
+// the final stage's outputs.
+func evalCaseOutput(report runtime.ExecutionReport, agent string) (string, runtime.TokenUsage, error) {
+	var usage runtime.TokenUsage
+	for _, r := range report.Results {
+		usage.Add(r.Usage)
+	}
+	if agent = strings.TrimSpace(agent); agent != "" {
+		for i := len(report.Results) - 1; i >= 0; i-- {
+			if r := report.Results[i]; r.Agent == agent {
+				if r.Error != "" {
+					return r.Output, usage, fmt.Errorf("agent %s: %s", agent, r.Error)
+				}
+				return r.Output, usage, nil
+			}
+		}
+		return "", usage, fmt.Errorf("agent %q did not run", agent)
+	}
+	var parts []string
+	for _, s := range multiverseSinkReplies(report) {
+		if s.Error != "" {
+			return strings.Join(parts, "\n\n"), usage, fmt.Errorf("agent %s: %s", s.Agent, s.Error)
+		}
+		parts = append(parts, s.Text)
+	}
+	return strings.Join(parts, "\n\n"), usage, nil
+}
+
+func formatEvalSuiteReport(rep evalSuiteReport) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Suite %s spec=%q cases=%d (%s)\n", rep.Suite, rep.Spec, len(rep.Cases), rep.Path)
+	width := 4
+	for _, c := range rep.Cases {
+		width = max(width, len(c.Name))
+	}
+	fmt.Fprintf(&sb, "  %-4s  %-*s  %5s  %5s  %6s  %8s  %s\n", "", width, "CASE", "SCORE", "BASE", "DELTA", "TIME", "NOTES")
+	for _, c := range rep.Cases {
+		status := "PASS"
+		if !c.Passed {
+			status = "FAIL"
+		}
+		base, delta := "-", "-"
+		if c.BaselineScore != nil {
+			base = fmt.Sprintf("%.2f", *c.BaselineScore)
+			delta = fmt.Sprintf("%+.2f", c.Score-*c.BaselineScore)
+		}
+		var notes []string
+		if c.Regressed {
+			notes = append(notes, "REGRESSED")
+		}
+		if c.Error != "" {
+			notes = append(notes, "error: "+clipLine(c.Error, 80))
+		}
+		line := fmt.Sprintf("  %-4s  %-*s  %5.2f  %5s  %6s  %8s  %s", status, width, c.Name, c.Score, base, delta, msDuration(c.DurationMS), strings.Join(notes, " "))
+		sb.WriteString(strings.TrimRight(line, " ") + "\n")
+		for _, a := range c.Assertions {
+			if a.Passed || c.Error != "" {
+				continue
+			}
+			line := "x " + a.Check
+			if a.Detail != "" {
+				line += " (" + clipLine(a.Detail, 80) + ")"
+			}
+			fmt.Fprintf(&sb, "  %-4s  %-*s  %s\n", "", width, "", line)
+		}
+	}
+	fmt.Fprintf(&sb, "Score %.2f", rep.Score)
+	if rep.BaselineScore != nil {
+		fmt.Fprintf(&sb, " baseline=%.2f (%+.2f)", *rep.BaselineScore, rep.Score-*rep.BaselineScore)
+	}
+	fmt.Fprintf(&sb, " passed=%d/%d regressions=%d\n", rep.Passed, len(rep.Cases), rep.Regressions)
+	if rep.Updated {
+		fmt.Fprintf(&sb, "baseline updated: %s\n", rep.Baseline)
+	}
+	return sb.String()
+}
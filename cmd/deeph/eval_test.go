@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"deeph/internal/evalsuite"
+)
+
+func TestEvalScoresSuiteAndFlagsBaselineRegressions(t *testing.T) {
+	ws := t.TempDir()
+	if err := cmdQuickstart([]string{"--workspace", ws, "--provider", "local_mock", "--model", "mock-small"}); err != nil {
+		t.Fatalf("quickstart: %v", err)
+	}
+	suite := filepath.Join(ws, "evals", "smoke.yaml")
+	writeSuite := func(marker string) {
+		t.Helper()
+		body := "spec: guide\ncases:\n" +
+			"  - name: echo\n    input: explain the auth flow\n    assert:\n" +
+			"      - contains: agent=guide\n" +
+			"      - regex: 'goal: explain the \\w+ flow'\n" +
+			"      - not_contains: " + marker + "\n"
+		if err := os.MkdirAll(filepath.Dir(suite), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(suite, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeSuite("LGTM")
+	if err := cmdEval([]string{"--workspace", ws, "--update-baseline", "smoke"}); err != nil {
+		t.Fatalf("eval: %v", err)
+	}
+	bl, err := evalsuite.LoadBaseline(evalsuite.BaselinePath(ws, "smoke"))
+	if err != nil || bl == nil || bl.Cases["echo"] != 1 {
+		t.Fatalf("expected perfect baseline, got %+v (%v)", bl, err)
+	}
+
+	writeSuite("auth")
+	err = cmdEval([]string{"--workspace", ws, "smoke"})
+	if err == nil || !strings.Contains(err.Error(), "1 regression") {
+		t.Fatalf("expected regression error, got %v", err)
+	}
+}
+
+func TestEvalRecordRedactsCassetteInput(t *testing.T) {
+	ws := t.TempDir()
+	if err := cmdQuickstart([]string{"--workspace", ws, "--provider", "local_mock", "--model", "mock-small"}); err != nil {
+		t.Fatalf("quickstart: %v", err)
+	}
+	secret := "ghp_" + strings.Repeat("a1B2", 10)
+	suite := filepath.Join(ws, "evals", "secret.yaml")
+	body := "spec: guide\ncases:\n  - name: deploy\n    input: deploy with " + secret + "\n    cassette: deploy.json\n    assert:\n      - contains: agent=guide\n"
+	if err := os.MkdirAll(filepath.Dir(suite), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(suite, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmdEval([]string{"--workspace", ws, "--record", "secret"}); err != nil {
+		t.Fatalf("eval --record: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(ws, "evals", "deploy.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), secret) || !strings.Contains(string(b), "[redacted:github_token]") {
+		t.Fatalf("expected the cassette input redacted:\n%s", b)
+	}
+}
+
+func TestEvalRunsFixtureCasesInACopyWithProjectConfig(t *testing.T) {
+	ws := t.TempDir()
+	if err := cmdQuickstart([]string{"--workspace", ws, "--provider", "local_mock", "--model", "mock-small"}); err != nil {
+		t.Fatalf("quickstart: %v", err)
+	}
+	root, err := os.ReadFile(filepath.Join(ws, "deeph.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"deeph.yaml": strings.Replace(string(root), "    type: mock\n", "    type: mock\n    mock_script: mocks/script.yaml\n", 1),
+		"mocks/script.yaml": "rules:\n" +
+			"  - agent: fixer\n    turn: 1\n    tool_calls: [{name: fix_write, args: {path: notes.txt, content: fixed}}]\n" +
+			"  - agent: fixer\n    input_contains: ['\"ok\":true']\n    text: wrote notes.txt\n" +
+			"default: error\n",
+		"skills/fix_write.yaml": "name: fix_write\ntype: file_write_safe\napproval: never\nparams:\n  overwrite_default: true\n",
+		"agents/fixer.yaml":     "name: fixer\nprovider: local_mock\nskills: [fix_write]\n",
+		"evals/fx/notes.txt":    "broken\n",
+		"evals/fix.yaml": "spec: fixer\ncases:\n" +
+			"  - name: fixture\n    workspace: fx\n    input: fix the notes\n    assert:\n      - contains: wrote notes.txt\n",
+	}
+	for rel, body := range files {
+		path := filepath.Join(ws, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := cmdEval([]string{"--workspace", ws, "--fail-under", "1", "fix"}); err != nil {
+			t.Fatalf("eval run %d: %v", i+1, err)
+		}
+	}
+	if b, _ := os.ReadFile(filepath.Join(ws, "evals", "fx", "notes.txt")); string(b) != "broken\n" {
+		t.Fatalf("expected the checked-in fixture to stay untouched, got %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "evals", "fx", ".deeph")); !os.IsNotExist(err) {
+		t.Fatalf("expected no deeph state in the fixture, got %v", err)
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -12,6 +11,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"deeph/internal/capbuf"
 )
 
 const (
@@ -340,10 +341,9 @@ func runGWSCommand(cfg gwsExecConfig, args []string) error {
 
 	cmd := exec.CommandContext(ctx, cfg.Bin, args...)
 	cmd.Env = os.Environ()
-	var out cappedBuffer
-	out.max = cfg.MaxOutputBytes
-	cmd.Stdout = &out
-	cmd.Stderr = &out
+	out := capbuf.New(cfg.MaxOutputBytes)
+	cmd.Stdout = out
+	cmd.Stderr = out
 
 	err := cmd.Run()
 	if text := out.String(); text != "" {
@@ -352,7 +352,7 @@ func runGWSCommand(cfg gwsExecConfig, args []string) error {
 			fmt.Println("")
 		}
 	}
-	if out.truncated {
+	if out.Truncated() {
 		fmt.Printf("[gws] output truncated to %d bytes\n", cfg.MaxOutputBytes)
 	}
 
@@ -399,32 +399,3 @@ func gwsUsageText() string {
 	}
 	return strings.Join(lines, "\n")
 }
-
-type cappedBuffer struct {
-	buf       bytes.Buffer
-	max       int
-	truncated bool
-}
-
-func (b *cappedBuffer) Write(p []byte) (int, error) {
-	if b.max <= 0 {
-		b.truncated = true
-		return len(p), nil
-	}
-	remaining := b.max - b.buf.Len()
-	if remaining <= 0 {
-		b.truncated = true
-		return len(p), nil
-	}
-	if len(p) > remaining {
-		_, _ = b.buf.Write(p[:remaining])
-		b.truncated = true
-		return len(p), nil
-	}
-	_, _ = b.buf.Write(p)
-	return len(p), nil
-}
-
-func (b *cappedBuffer) String() string {
-	return b.buf.String()
-}
@@ -65,6 +65,12 @@ func run(args []string) error {
 		return cmdGWS(args[1:])
 	case "session":
 		return cmdSession(args[1:])
+	case "memory":
+		return cmdMemory(args[1:])
+	case "runs":
+		return cmdRuns(args[1:])
+	case "eval":
+		return cmdEval(args[1:])
 	case "crew":
 		return cmdCrew(args[1:])
 	case "skill":
@@ -101,23 +107,33 @@ func printUsage() {
 	fmt.Println("  deeph update [--owner NAME] [--repo NAME] [--tag latest|vX.Y.Z] [--check]")
 	fmt.Println("  deeph validate [--workspace DIR]")
 	fmt.Println(`  deeph review [--workspace DIR] [--spec SPEC] [--base REF|auto] [--trace] [--coach=false] [--checks=true|false] [--check-timeout 45s] [--json] [focus]`)
-	fmt.Println(`  deeph diagnose [--workspace DIR] [--spec SPEC] [--base REF] [--trace] [--coach=false] [--fix] [--yes] [--json] [--file PATH] [issue]`)
-	fmt.Println(`  deeph edit [--workspace DIR] [--trace] [--coach=false] [task]`)
-	fmt.Println(`  deeph trace [--workspace DIR] [--json] [--multiverse N] [--daemon=true|false] [--daemon-target HOST:PORT] "<agent|a+b|a>b|a+b>c|@crew|crew:name>" [input]`)
-	fmt.Println(`  deeph run [--workspace DIR] [--trace] [--coach=false] [--multiverse N] [--judge-agent SPEC] [--judge-max-output-chars N] [--daemon=true|false] [--daemon-target HOST:PORT] "<agent|a+b|a>b|a+b>c|@crew|crew:name>" [input]`)
+	fmt.Println(`  deeph diagnose [--workspace DIR] [--spec SPEC] [--base REF] [--trace] [--coach=false] [--fix] [--yes] [--json] [--file PATH] [--from-run RUN_ID|last] [--save-context=false] [--resume-context RUN_ID|last] [--resume-merge auto|all|facts] [--resume-ttl DUR] [issue]`)
+	fmt.Println(`  deeph edit [--workspace DIR] [--trace] [--coach=false] [--save-context=false] [--resume-context RUN_ID|last] [--resume-merge auto|all|facts] [--resume-ttl DUR] [task]`)
+	fmt.Println(`  deeph trace [--workspace DIR] [--json] [--context] [--multiverse N] [--daemon=true|false] [--daemon-target HOST:PORT] "<agent|a+b|a>b|a+b>c|@crew|crew:name>" [input]`)
+	fmt.Println(`  deeph run [--workspace DIR] [--trace] [--coach=false] [--explain-context] [--save-context=false] [--resume-context RUN_ID|last] [--resume-merge auto|all|facts] [--resume-ttl DUR] [--record FILE | --replay FILE] [--multiverse N] [--judge-agent SPEC] [--judge-max-output-chars N] [--daemon=true|false] [--daemon-target HOST:PORT] "<agent|a+b|a>b|a+b>c|@crew|crew:name>" [input]`)
 	fmt.Println(`  deeph chat [--workspace DIR] [--session ID] [--history-turns N] [--history-tokens N] [--trace] [--coach=false] "<agent|a+b|a>b|a+b>c>"`)
 	fmt.Println("  deeph gws [--yes|--allow-mutate] [--json] [--timeout 30s] [--max-output-bytes N] [--bin gws] [--allow-any-root] <gws args...>")
 	fmt.Println("  deeph session list [--workspace DIR]")
 	fmt.Println("  deeph session show [--workspace DIR] [--tail N] <id>")
+	fmt.Println("  deeph eval [--workspace DIR] [--spec SPEC] [--case NAMES] [--record] [--baseline FILE] [--update-baseline] [--fail-under SCORE] [--json] [suite|path]...")
+	fmt.Println("  deeph runs list [--workspace DIR] [--command C] [--limit N] [--json]")
+	fmt.Println("  deeph runs show [--workspace DIR] [--json] <run-id|last>")
+	fmt.Println("  deeph runs diff [--workspace DIR] <run-a> <run-b>")
+	fmt.Println("  deeph runs rm [--workspace DIR] [--all] [--keep N] [--older-than DUR] [run-id]...")
+	fmt.Println("  deeph memory add [--workspace DIR] [--confidence F] [--evidence TEXT] <key> <value>")
+	fmt.Println("  deeph memory list [--workspace DIR] [--json]")
+	fmt.Println("  deeph memory rm [--workspace DIR] [--source S] [--below F] [--older-than DUR] [key|prefix*]...")
 	fmt.Println("  deeph crew list [--workspace DIR]")
 	fmt.Println("  deeph crew show [--workspace DIR] <name>")
 	fmt.Println("  deeph agent create [--workspace DIR] [--force] [--provider NAME] [--model MODEL] <name>")
 	fmt.Println("  deeph provider list [--workspace DIR]")
 	fmt.Println("  deeph provider add [--workspace DIR] [--name NAME] [--model MODEL] [--set-default] [--force] deepseek")
-	fmt.Println("  deeph daemon serve [--target HOST:PORT]")
+	fmt.Println("  deeph daemon serve [--target HOST:PORT] [--approval-timeout DUR]")
 	fmt.Println("  deeph daemon start [--target HOST:PORT]")
 	fmt.Println("  deeph daemon status [--target HOST:PORT]")
 	fmt.Println("  deeph daemon stop [--target HOST:PORT]")
+	fmt.Println("  deeph daemon approvals [--target HOST:PORT] [--run RUN_ID]")
+	fmt.Println("  deeph daemon approve|deny [--target HOST:PORT] [--reason TEXT] <approval-id>")
 	fmt.Println("  deeph kit list [--workspace DIR]")
 	fmt.Println("  deeph kit add [--workspace DIR] [--force] [--provider-name NAME] [--model MODEL] [--set-default-provider] [--skip-provider] <name|git-url[#manifest.yaml]>")
 	fmt.Println("  deeph crud init [--workspace DIR] [--force] [--provider-name NAME] [--model MODEL] [--set-default-provider] [--skip-provider] [--mode backend|fullstack] [--db-kind relational|document] [--db postgres|mongodb] [--entity NAME] [--fields nome:text,cidade:text] [--containers=true|false]")
@@ -132,7 +148,7 @@ func printUsage() {
 	fmt.Println("  deeph command list [--category CAT] [--json]")
 	fmt.Println(`  deeph command explain [--json] "<command path>"`)
 	fmt.Println("  deeph skill list")
-	fmt.Println("  deeph skill add [--workspace DIR] [--force] <name>")
+	fmt.Println("  deeph skill add [--workspace DIR] [--force] [--name NAME] <name|plugin-path>")
 	fmt.Println("  deeph type list [--category CAT] [--json]")
 	fmt.Println("  deeph type explain [--json] <kind|alias>")
 }
@@ -179,9 +195,18 @@ func cmdValidate(args []string) error {
 		return err
 	}
 	printValidation(verr)
+	for _, issue := range tokenizerIssues(p, abs) {
+		fmt.Println(issue.String())
+	}
 	if verr != nil && verr.HasErrors() {
 		return verr
 	}
+	if issues := mockScriptIssues(p, abs); len(issues) > 0 {
+		for _, issue := range issues {
+			fmt.Println(issue.String())
+		}
+		return fmt.Errorf("%d mock script error(s)", len(issues))
+	}
 	fmt.Printf("Validation OK (%d agent(s), %d skill(s), %d provider(s)) in %s\n", len(p.Agents), len(p.Skills), len(p.Root.Providers), abs)
 	return nil
 }
@@ -191,6 +216,7 @@ func cmdTrace(args []string) error {
 	workspace := fs.String("workspace", ".", "workspace path")
 	jsonOut := fs.Bool("json", false, "print execution plan trace as JSON")
 	multiverse := fs.Int("multiverse", 1, "number of universes to trace (0 = all crew universes)")
+	showContext := fs.Bool("context", false, "compile each agent's starting context and show candidate scores (local only)")
 	useDaemon := fs.Bool("daemon", true, "execute via deephd (local daemon, default=true)")
 	daemonTarget := fs.String("daemon-target", deephDaemonDefaultTarget(), "deephd target (host:port)")
 	if err := fs.Parse(args); err != nil {
@@ -206,7 +232,7 @@ func cmdTrace(args []string) error {
 	if target == "" {
 		target = deephDaemonDefaultTarget()
 	}
-	if *useDaemon {
+	if *useDaemon && !*showContext {
 		if daemonConnDebugEnabled() {
 			defer maybePrintDaemonConnStats(target)
 		}
@@ -243,14 +269,21 @@ func cmdTrace(args []string) error {
 	if err != nil {
 		return err
 	}
+	defer eng.Close()
 	resolvedSpec, crew, err := resolveAgentSpecOrCrew(abs, agentSpecArg)
 	if err != nil {
 		return err
 	}
+	if err := applyCrewLoops(p, crew); err != nil {
+		return err
+	}
 	universes, err := buildMultiverseUniverses(abs, agentSpecArg, resolvedSpec, input, *multiverse, crew)
 	if err != nil {
 		return err
 	}
+	if len(universes) > 1 && *showContext {
+		return errors.New("trace --context does not support multiverse crews; trace one universe spec instead")
+	}
 	if len(universes) > 1 {
 		recordCoachCommandTransition(abs, "trace", resolvedSpec)
 		branches, mvPlan, err := traceMultiverse(context.Background(), abs, p, universes)
@@ -279,26 +312,33 @@ func cmdTrace(args []string) error {
 		return nil
 	}
 	agentSpec := resolvedSpec
-	plan, _, err := eng.PlanSpec(context.Background(), agentSpec, input)
+	plan, tasks, err := eng.PlanSpec(context.Background(), agentSpec, input)
 	if err != nil {
 		return err
 	}
 	recordCoachCommandTransition(abs, "trace", agentSpec)
+	var contexts []runtime.TaskContextPreview
+	if *showContext {
+		contexts = eng.PreviewTaskContexts(tasks, input)
+	}
 	if *jsonOut {
 		payload := struct {
-			Workspace string                `json:"workspace"`
-			Scheduler string                `json:"scheduler"`
-			Plan      runtime.ExecutionPlan `json:"plan"`
+			Workspace string                       `json:"workspace"`
+			Scheduler string                       `json:"scheduler"`
+			Plan      runtime.ExecutionPlan        `json:"plan"`
+			Contexts  []runtime.TaskContextPreview `json:"contexts,omitempty"`
 		}{
 			Workspace: abs,
 			Scheduler: "dag_channels",
 			Plan:      plan,
+			Contexts:  contexts,
 		}
 		enc := json.NewEncoder(os.Stdout)
 		enc.SetIndent("", "  ")
 		return enc.Encode(payload)
 	}
 	printTracePlanText(abs, plan)
+	printTraceContexts(contexts)
 	return nil
 }
 
@@ -307,6 +347,7 @@ func cmdEdit(args []string) error {
 	workspace := fs.String("workspace", ".", "workspace path")
 	showTrace := fs.Bool("trace", false, "print execution trace summary")
 	showCoach := fs.Bool("coach", true, "show occasional semantic tips while waiting")
+	persist := addContextResumeFlags(fs)
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
@@ -314,10 +355,12 @@ func cmdEdit(args []string) error {
 	if input == "" {
 		return errors.New("edit requires [task] describing the requested code change")
 	}
-	return cmdRun(buildEditRunArgs(*workspace, *showTrace, *showCoach, input))
+	return runCommand("edit", buildEditRunArgs(*workspace, *showTrace, *showCoach, input, persist.args()...))
 }
 
-func buildEditRunArgs(workspace string, showTrace, showCoach bool, input string) []string {
+// buildEditRunArgs maps edit onto run with the coder agent; extra run flags
+// (context save/resume) go before the agent.
+func buildEditRunArgs(workspace string, showTrace, showCoach bool, input string, extra ...string) []string {
 	args := []string{"--workspace", workspace}
 	if showTrace {
 		args = append(args, "--trace")
@@ -325,11 +368,18 @@ func buildEditRunArgs(workspace string, showTrace, showCoach bool, input string)
 	if !showCoach {
 		args = append(args, "--coach=false")
 	}
+	args = append(args, extra...)
 	args = append(args, "coder", input)
 	return args
 }
 
 func cmdRun(args []string) error {
+	return runCommand("run", args)
+}
+
+// runCommand implements run; command names the invoking command (run, edit)
+// in the run history.
+func runCommand(command string, args []string) error {
 	fs := flag.NewFlagSet("run", flag.ContinueOnError)
 	workspace := fs.String("workspace", ".", "workspace path")
 	showTrace := fs.Bool("trace", false, "print execution trace summary")
@@ -337,12 +387,18 @@ func cmdRun(args []string) error {
 	multiverse := fs.Int("multiverse", 1, "number of universes to run (0 = all crew universes)")
 	judgeAgent := fs.String("judge-agent", "", "agent spec (or @crew) used to compare multiverse branches and recommend a result")
 	judgeMaxOutputChars := fs.Int("judge-max-output-chars", 700, "max chars per branch sink output sent to the judge agent")
+	explainContext := fs.Bool("explain-context", false, "print every context candidate per agent with its score breakdown and drop reason")
+	persist := addContextResumeFlags(fs)
+	cassette := addCassetteFlags(fs)
 	useDaemon := fs.Bool("daemon", true, "execute via deephd (local daemon, default=true)")
 	daemonTarget := fs.String("daemon-target", deephDaemonDefaultTarget(), "deephd target (host:port)")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
-	rest := fs.Args()
+	rest, err := cassette.resolve(fs.Args())
+	if err != nil {
+		return err
+	}
 	if len(rest) == 0 {
 		return errors.New("run requires <agent|a+b|@crew|crew:name>")
 	}
@@ -352,7 +408,7 @@ func cmdRun(args []string) error {
 	if target == "" {
 		target = deephDaemonDefaultTarget()
 	}
-	if *useDaemon {
+	if *useDaemon && !cassette.active() {
 		if daemonConnDebugEnabled() {
 			defer maybePrintDaemonConnStats(target)
 		}
@@ -363,14 +419,16 @@ func cmdRun(args []string) error {
 			Multiverse:          *multiverse,
 			JudgeAgent:          strings.TrimSpace(*judgeAgent),
 			JudgeMaxOutputChars: *judgeMaxOutputChars,
+			ExplainContext:      *explainContext,
 		}
-		if err := cmdRunViaDaemon(target, req, *showTrace); err == nil {
+		persist.apply(&req)
+		if err := cmdRunViaDaemon(target, command, req, *showTrace); err == nil {
 			return nil
 		} else if !isDaemonUnavailableError(err) {
 			return err
 		}
 		if _, _, err := startDaemonBackground(target); err == nil {
-			if err := cmdRunViaDaemon(target, req, *showTrace); err == nil {
+			if err := cmdRunViaDaemon(target, command, req, *showTrace); err == nil {
 				return nil
 			} else if !isDaemonUnavailableError(err) {
 				return err
@@ -391,15 +449,32 @@ func cmdRun(args []string) error {
 	if err != nil {
 		return err
 	}
+	defer eng.Close()
 	resolvedSpec, crew, err := resolveAgentSpecOrCrew(abs, agentSpecArg)
 	if err != nil {
 		return err
 	}
-	ctx := context.Background()
+	if err := applyCrewLoops(p, crew); err != nil {
+		return err
+	}
+	ctx := withCLIApprover(context.Background())
+	if *explainContext {
+		ctx = runtime.WithContextExplain(ctx)
+	}
 	universes, err := buildMultiverseUniverses(abs, agentSpecArg, resolvedSpec, input, *multiverse, crew)
 	if err != nil {
 		return err
 	}
+	if len(universes) <= 1 {
+		if ctx, err = persist.context(ctx, abs); err != nil {
+			return err
+		}
+	}
+	ctx, saveCassette, err := cassette.context(ctx, agentSpecArg, eng.Redactor().Redact(input))
+	if err != nil {
+		return err
+	}
+	defer saveCassette()
 	if len(universes) > 1 {
 		// Plan the first universe for coach heuristics and trace summary.
 		plan, tasks, err := eng.PlanSpec(ctx, universes[0].Spec, universes[0].Input)
@@ -419,15 +494,17 @@ func cmdRun(args []string) error {
 				ShowTrace:   *showTrace,
 			})
 		}
+		rec := newRunRecord(command, agentSpecArg, resolvedSpec, input)
 		branches, mvPlan, err := runMultiverse(ctx, abs, p, universes)
 		if err != nil {
+			recordRun(abs, p, rec, err)
 			return err
 		}
 		stopCoach()
 		printMultiverseRunText(abs, agentSpecArg, mvPlan, branches)
+		judge := multiverseJudgeRun{}
 		if strings.TrimSpace(*judgeAgent) != "" {
 			judgeSpec, _, jerr := resolveAgentSpecOrCrew(abs, strings.TrimSpace(*judgeAgent))
-			judge := multiverseJudgeRun{}
 			if jerr != nil {
 				judge = multiverseJudgeRun{Spec: strings.TrimSpace(*judgeAgent), Error: jerr.Error()}
 			} else {
@@ -435,6 +512,8 @@ func cmdRun(args []string) error {
 			}
 			printMultiverseJudgeText(judge)
 		}
+		rec.setMultiverse(mvPlan, branches, &judge)
+		recordRun(abs, p, rec, nil)
 		// Feed coach with branch reports for post-run hints and learning.
 		for _, b := range branches {
 			if b.Error == "" {
@@ -471,11 +550,15 @@ func cmdRun(args []string) error {
 			ShowTrace:   *showTrace,
 		})
 	}
+	rec := newRunRecord(command, agentSpecArg, agentSpec, input)
 	report, err := eng.RunSpec(ctx, agentSpec, input)
 	stopCoach()
 	if err != nil {
+		recordRun(abs, p, rec, err)
 		return err
 	}
+	rec.setReport(plan, report)
+	recordRun(abs, p, rec, nil)
 	recordCoachRunSignals(abs, &plan, report)
 	printRunReportText(plan, report)
 	if *showCoach {
@@ -816,18 +899,27 @@ func cmdSkillAdd(args []string) error {
 	fs := flag.NewFlagSet("skill add", flag.ContinueOnError)
 	workspace := fs.String("workspace", ".", "workspace path")
 	force := fs.Bool("force", false, "overwrite if file exists")
+	name := fs.String("name", "", "skill name for a plugin (defaults to the manifest or described name)")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 	rest := fs.Args()
 	if len(rest) != 1 {
-		return errors.New("skill add requires <name>")
+		return errors.New("skill add requires <name|plugin-path>")
 	}
+	abs, _ := filepath.Abs(*workspace)
 	tmpl, err := catalog.Get(rest[0])
 	if err != nil {
-		return err
+		if !looksLikePluginPath(rest[0]) {
+			return err
+		}
+		outPath, desc, err := installPluginSkill(abs, rest[0], *name, *force)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Installed plugin %q (%s) into %s\n", desc.Name, coalesce(desc.Version, "unversioned"), outPath)
+		return nil
 	}
-	abs, _ := filepath.Abs(*workspace)
 	skillsDir := filepath.Join(abs, "skills")
 	if err := os.MkdirAll(skillsDir, 0o755); err != nil {
 		return err
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"deeph/internal/runtime"
+)
+
+func cmdMemory(args []string) error {
+	if len(args) == 0 {
+		return errors.New("memory requires a subcommand: add, list or rm")
+	}
+	switch args[0] {
+	case "add":
+		return cmdMemoryAdd(args[1:])
+	case "list":
+		return cmdMemoryList(args[1:])
+	case "rm":
+		return cmdMemoryRemove(args[1:])
+	default:
+		return fmt.Errorf("unknown memory subcommand %q", args[0])
+	}
+}
+
+func cmdMemoryAdd(args []string) error {
+	fs := flag.NewFlagSet("memory add", flag.ContinueOnError)
+	workspace := fs.String("workspace", ".", "workspace path")
+	confidence := fs.Float64("confidence", 1.0, "confidence 0..1")
+	evidence := fs.String("evidence", "", "where the fact comes from (file, command, decision)")
+	rest, err := parseFlagsLoose(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) < 2 {
+		return errors.New("memory add requires <key> <value>")
+	}
+	abs, err := filepath.Abs(*workspace)
+	if err != nil {
+		return err
+	}
+	entry, err := runtime.PutProjectMemory(abs, runtime.ProjectMemoryEntry{
+		Key:        rest[0],
+		Value:      strings.Join(rest[1:], " "),
+		Confidence: *confidence,
+		Source:     runtime.ProjectMemorySourceUser,
+		Evidence:   *evidence,
+	}, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Saved memory %s (confidence=%.2f) in %s\n", entry.Key, entry.Confidence, runtime.ProjectMemoryPath(abs))
+	return nil
+}
+
+func cmdMemoryList(args []string) error {
+	fs := flag.NewFlagSet("memory list", flag.ContinueOnError)
+	workspace := fs.String("workspace", ".", "workspace path")
+	jsonOut := fs.Bool("json", false, "print entries as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		return errors.New("memory list does not accept positional arguments")
+	}
+	abs, err := filepath.Abs(*workspace)
+	if err != nil {
+		return err
+	}
+	entries, err := runtime.LoadProjectMemory(abs)
+	if err != nil {
+		return err
+	}
+	if *jsonOut {
+		if entries == nil {
+			entries = []runtime.ProjectMemoryEntry{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No project memory in %s\n", runtime.ProjectMemoryPath(abs))
+		return nil
+	}
+	for _, e := range entries {
+		fmt.Printf("- %s = %q conf=%.2f source=%s updated_at=%s\n", e.Key, e.Value, e.Confidence, e.Source, e.UpdatedAt.Format(time.RFC3339))
+		if e.Evidence != "" {
+			fmt.Printf("    evidence: %s\n", e.Evidence)
+		}
+	}
+	return nil
+}
+
+func cmdMemoryRemove(args []string) error {
+	fs := flag.NewFlagSet("memory rm", flag.ContinueOnError)
+	workspace := fs.String("workspace", ".", "workspace path")
+	source := fs.String("source", "", "remove entries from this source (user, agent:<name>, or agent for any agent)")
+	below := fs.Float64("below", 0, "remove entries with confidence below this value")
+	olderThan := fs.Duration("older-than", 0, "remove entries not updated within this duration")
+	rest, err := parseFlagsLoose(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 && *source == "" && *below <= 0 && *olderThan <= 0 {
+		return errors.New("memory rm requires <key|prefix*>... or --source/--below/--older-than")
+	}
+	abs, err := filepath.Abs(*workspace)
+	if err != nil {
+		return err
+	}
+	match := memoryRemoveMatcher(rest, strings.TrimSpace(*source), *below, *olderThan, time.Now())
+	removed, err := runtime.RemoveProjectMemory(abs, match)
+	if err != nil {
+		return err
+	}
+	if len(removed) == 0 {
+		fmt.Println("No memory entries matched")
+		return nil
+	}
+	for _, e := range removed {
+		fmt.Printf("Removed memory %s\n", e.Key)
+	}
+	return nil
+}
+
+// memoryRemoveMatcher matches entries that satisfy every given selector.
+// Keys match exactly, or by prefix when they end in '*'.
+func memoryRemoveMatcher(keys []string, source string, below float64, olderThan time.Duration, now time.Time) func(runtime.ProjectMemoryEntry) bool {
+	return func(e runtime.ProjectMemoryEntry) bool {
+		if len(keys) > 0 {
+			hit := false
+			for _, k := range keys {
+				k = strings.ToLower(strings.TrimSpace(k))
+				if prefix, ok := strings.CutSuffix(k, "*"); ok {
+					hit = hit || strings.HasPrefix(e.Key, prefix)
+				} else {
+					hit = hit || e.Key == k
+				}
+			}
+			if !hit {
+				return false
+			}
+		}
+		switch {
+		case source == "":
+		case source == "agent":
+			if !strings.HasPrefix(e.Source, "agent:") {
+				return false
+			}
+		case e.Source != source:
+			return false
+		}
+		if below > 0 && e.Confidence >= below {
+			return false
+		}
+		if olderThan > 0 && now.Sub(e.UpdatedAt) < olderThan {
+			return false
+		}
+		return true
+	}
+}
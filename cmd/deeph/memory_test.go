@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"deeph/internal/runtime"
+)
+
+func TestMemoryRemoveMatcherCombinesSelectors(t *testing.T) {
+	now := time.Now()
+	entries := []runtime.ProjectMemoryEntry{
+		{Key: "arch.storage", Source: "agent:coder", Confidence: 0.3, UpdatedAt: now},
+		{Key: "arch.api", Source: runtime.ProjectMemorySourceUser, Confidence: 0.3, UpdatedAt: now},
+		{Key: "build.command", Source: "agent:planner", Confidence: 0.9, UpdatedAt: now.Add(-48 * time.Hour)},
+	}
+	cases := []struct {
+		match func(runtime.ProjectMemoryEntry) bool
+		want  []bool
+	}{
+		{memoryRemoveMatcher([]string{"arch.*"}, "", 0, 0, now), []bool{true, true, false}},
+		{memoryRemoveMatcher([]string{"arch.*"}, "agent", 0.5, 0, now), []bool{true, false, false}},
+		{memoryRemoveMatcher(nil, "", 0, 24*time.Hour, now), []bool{false, false, true}},
+		{memoryRemoveMatcher([]string{"Build.Command"}, "", 0, 0, now), []bool{false, false, true}},
+	}
+	for i, c := range cases {
+		for j, e := range entries {
+			if got := c.match(e); got != c.want[j] {
+				t.Fatalf("case %d entry %s: got %v want %v", i, e.Key, got, c.want[j])
+			}
+		}
+	}
+}
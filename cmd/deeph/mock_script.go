@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"deeph/internal/project"
+	"deeph/internal/runtime"
+)
+
+// mockScriptIssues reports mock provider scripts that cannot be loaded; the
+// engine refuses to start with them.
+func mockScriptIssues(p *project.Project, workspace string) []project.Issue {
+	var issues []project.Issue
+	for i, pc := range p.Root.Providers {
+		if pc.Type != "mock" || strings.TrimSpace(pc.MockScript) == "" {
+			continue
+		}
+		if _, err := runtime.LoadMockScript(runtime.MockScriptPath(workspace, pc.MockScript)); err != nil {
+			issues = append(issues, project.Issue{
+				Level:   project.IssueError,
+				Path:    fmt.Sprintf("%s.providers[%d]", project.RootConfigFile, i),
+				Field:   "mock_script",
+				Message: err.Error(),
+			})
+		}
+	}
+	return issues
+}
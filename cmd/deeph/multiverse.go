@@ -493,6 +493,7 @@ func traceMultiverse(ctx context.Context, workspace string, p *project.Project,
 	if err != nil {
 		return nil, nil, err
 	}
+	defer eng.Close()
 	out := make([]multiverseTraceBranch, 0, len(universes))
 	for _, u := range universes {
 		input, note, _, _ := buildMultiverseUniverseInput(u, mvPlan, nil, nil)
@@ -563,6 +564,7 @@ func runMultiverse(ctx context.Context, workspace string, p *project.Project, un
 				doneCh <- mvDone{idx: i, branch: br}
 				return
 			}
+			defer eng.Close()
 			report, err := eng.RunSpec(ctx, u.Spec, input)
 			br.DurationMS = time.Since(start).Milliseconds()
 			if err != nil {
@@ -622,6 +624,7 @@ func runMultiverseJudge(ctx context.Context, workspace string, p *project.Projec
 		out.Error = err.Error()
 		return out
 	}
+	defer eng.Close()
 	prompt := buildMultiverseJudgePrompt(sourceSpec, sourceInput, branches, maxCharsPerBranch)
 	report, err := eng.RunSpec(ctx, out.Spec, prompt)
 	if err != nil {
@@ -15,6 +15,7 @@ import (
 	"deeph/internal/project"
 	"deeph/internal/reviewscope"
 	"deeph/internal/runtime"
+	"deeph/internal/tokenizer"
 	"deeph/internal/typesys"
 )
 
@@ -26,6 +27,12 @@ type reviewJSONPayload struct {
 	Input        string            `json:"input"`
 }
 
+// reviewRunScope is what the run history keeps of a review's input scope.
+type reviewRunScope struct {
+	Scope     reviewscope.Scope `json:"scope"`
+	Preflight reviewPreflight   `json:"preflight"`
+}
+
 type reviewPreflight struct {
 	Enabled      bool                   `json:"enabled"`
 	Ran          bool                   `json:"ran"`
@@ -69,20 +76,21 @@ func cmdReview(args []string) error {
 		return verr
 	}
 
+	baseSpec := defaultReviewAgentSpec(p)
+	synthSpec := defaultReviewSynthSpec(p)
+	selectedSpecArg, useBuiltinFlow := resolveDefaultReviewTarget(abs, p, strings.TrimSpace(*spec))
+	displaySpec := reviewDisplaySpec(selectedSpecArg, baseSpec, synthSpec, useBuiltinFlow)
+
 	cfg := reviewscope.DefaultConfig()
+	cfg.Tokenizer = promptTokenizer(p, abs, coalesce(selectedSpecArg, baseSpec))
 	scope, err := reviewscope.BuildScope(abs, strings.TrimSpace(*baseRef), cfg)
 	if err != nil {
 		return err
 	}
 	preflight, preflightBlock := buildReviewPreflight(abs, *checks, parsedCheckTimeout)
 	input := reviewscope.BuildInput(scope, focus, cfg)
-	input = appendReviewPreflight(input, preflightBlock, cfg.MaxInputChars)
-	promptTokens := reviewscope.EstimateTokens(input)
-
-	baseSpec := defaultReviewAgentSpec(p)
-	synthSpec := defaultReviewSynthSpec(p)
-	selectedSpecArg, useBuiltinFlow := resolveDefaultReviewTarget(abs, p, strings.TrimSpace(*spec))
-	displaySpec := reviewDisplaySpec(selectedSpecArg, baseSpec, synthSpec, useBuiltinFlow)
+	input = appendReviewPreflight(input, preflightBlock, cfg.Tokenizer, cfg.MaxInputTokens)
+	promptTokens := cfg.Tokenizer.Count(input)
 
 	if *jsonOut {
 		payload := reviewJSONPayload{
@@ -102,7 +110,11 @@ func cmdReview(args []string) error {
 	if err != nil {
 		return err
 	}
-	ctx := context.Background()
+	if err := applyCrewLoops(p, crew); err != nil {
+		return err
+	}
+	ctx := withCLIApprover(context.Background())
+	startedAt := time.Now()
 	if branches, mvPlan, plan, tasks, err := maybeRunReviewMultiverse(ctx, abs, p, input, selectedSpecArg, displaySpec, baseSpec, synthSpec, crew, useBuiltinFlow, *showTrace, *showCoach, scope, promptTokens); err != nil {
 		return err
 	} else if len(branches) > 0 {
@@ -111,8 +123,14 @@ func cmdReview(args []string) error {
 		}
 		fmt.Printf("Review started=%s base=%q changed=%d working_set=%d prompt=%dt spec=%q branches=%d\n", time.Now().Format(time.RFC3339), scope.BaseRef, len(scope.DiffFiles), len(scope.WorkingSet), promptTokens, displaySpec, len(branches))
 		printMultiverseRunText(abs, displaySpec, mvPlan, branches)
+		rec := newRunRecord("review", displaySpec, "", input)
+		rec.StartedAt = startedAt
+		rec.setScope(reviewRunScope{Scope: scope, Preflight: preflight})
+		rec.setMultiverse(mvPlan, branches, nil)
+		recordRun(abs, p, rec, nil)
 		eng, engErr := runtime.New(abs, p)
 		if engErr == nil {
+			defer eng.Close()
 			for _, b := range branches {
 				if b.Error != "" {
 					continue
@@ -139,6 +157,7 @@ func cmdReview(args []string) error {
 	if err != nil {
 		return err
 	}
+	defer eng.Close()
 	recordCoachCommandTransition(abs, "review", displaySpec)
 	plan, tasks, err := eng.PlanSpec(ctx, resolvedSpec, input)
 	if err != nil {
@@ -160,11 +179,16 @@ func cmdReview(args []string) error {
 			ShowTrace:   *showTrace,
 		})
 	}
+	rec := newRunRecord("review", displaySpec, resolvedSpec, input)
+	rec.setScope(reviewRunScope{Scope: scope, Preflight: preflight})
 	report, err := eng.RunSpec(ctx, resolvedSpec, input)
 	stopCoach()
 	if err != nil {
+		recordRun(abs, p, rec, err)
 		return err
 	}
+	rec.setReport(plan, report)
+	recordRun(abs, p, rec, nil)
 	recordCoachRunSignals(abs, &plan, report)
 	fmt.Printf("Review started=%s base=%q changed=%d working_set=%d prompt=%dt spec=%q\n", report.StartedAt.Format(time.RFC3339), scope.BaseRef, len(scope.DiffFiles), len(scope.WorkingSet), promptTokens, displaySpec)
 	printExecutionReport(report)
@@ -320,33 +344,26 @@ func formatReviewPreflightBlock(report reviewPreflight) string {
 	return strings.Join(lines, "\n")
 }
 
-func appendReviewPreflight(input string, block string, maxChars int) string {
+func appendReviewPreflight(input string, block string, tok tokenizer.Tokenizer, maxTokens int) string {
 	input = strings.TrimSpace(input)
 	block = strings.TrimSpace(block)
 	if block == "" {
 		return input
 	}
 	joined := strings.TrimSpace(input + "\n\n" + block)
-	if maxChars <= 0 || len(joined) <= maxChars {
+	if maxTokens <= 0 || tok.Count(joined) <= maxTokens {
 		return joined
 	}
-	remaining := maxChars - len(input) - 2
-	if remaining <= 16 {
-		return input
-	}
-	block = trimReviewBlock(block, remaining)
-	return strings.TrimSpace(input + "\n\n" + block)
-}
-
-func trimReviewBlock(s string, maxChars int) string {
-	s = strings.TrimSpace(s)
-	if maxChars <= 0 || len(s) <= maxChars {
-		return s
-	}
-	if maxChars <= 3 {
-		return s[:maxChars]
+	// Counts are not additive across the join, so shrink until it fits.
+	for remaining := maxTokens - tok.Count(input) - tok.Count("..."); remaining > 4; {
+		joined = strings.TrimSpace(input + "\n\n" + strings.TrimSpace(tokenizer.Clip(tok, block, remaining)) + "...")
+		over := tok.Count(joined) - maxTokens
+		if over <= 0 {
+			return joined
+		}
+		remaining -= over
 	}
-	return strings.TrimSpace(s[:maxChars-3]) + "..."
+	return input
 }
 
 func printReviewPreflight(report reviewPreflight) {
@@ -395,6 +412,7 @@ func maybeRunReviewMultiverse(ctx context.Context, workspace string, p *project.
 	if showCoach {
 		eng, engErr := runtime.New(workspace, p)
 		if engErr == nil {
+			defer eng.Close()
 			coachPlan, coachTasks, _ = eng.PlanSpec(ctx, universes[0].Spec, universes[0].Input)
 			if coachPlan.Spec != "" {
 				stopCoach = startCoachHint(ctx, coachHintRequest{
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"deeph/internal/project"
+	"deeph/internal/tokenizer"
 )
 
 func TestDefaultReviewAgentSpecPrefersReviewerThenGuide(t *testing.T) {
@@ -130,17 +131,26 @@ func TestParseReviewCheckTimeout(t *testing.T) {
 	})
 }
 
-func TestAppendReviewPreflightRespectsMaxChars(t *testing.T) {
-	base := strings.Repeat("A", 40)
-	block := "[deterministic_checks]\nstatus: ran\noverall: pass"
-	got := appendReviewPreflight(base, block, 32)
-	if got != base {
+func TestAppendReviewPreflightRespectsTokenBudget(t *testing.T) {
+	tok := tokenizer.Heuristic()
+	base := strings.Repeat("alpha ", 20)
+	block := "[deterministic_checks]\nstatus: ran\noverall: pass\nsummary: " + strings.Repeat("ok ", 40)
+	got := appendReviewPreflight(base, block, tok, tok.Count(base)+2)
+	if got != strings.TrimSpace(base) {
 		t.Fatalf("expected unchanged base, got=%q", got)
 	}
 
-	got = appendReviewPreflight(base, block, 120)
-	if !strings.Contains(got, "[deterministic_checks]") {
-		t.Fatalf("expected block to be appended, got=%q", got)
+	got = appendReviewPreflight(base, block, tok, tok.Count(base)+20)
+	if !strings.Contains(got, "[deterministic_checks]") || !strings.HasSuffix(got, "...") {
+		t.Fatalf("expected a clipped block, got=%q", got)
+	}
+	if n := tok.Count(got); n > tok.Count(base)+20 {
+		t.Fatalf("expected at most %d tokens, got %d", tok.Count(base)+20, n)
+	}
+
+	got = appendReviewPreflight(base, block, tok, 1000)
+	if !strings.HasSuffix(got, strings.TrimSpace(block)) {
+		t.Fatalf("expected the whole block to be appended, got=%q", got)
 	}
 }
 
@@ -2,9 +2,11 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
+	"deeph/internal/project"
 	"deeph/internal/runtime"
 )
 
@@ -50,6 +52,9 @@ func printTracePlanText(workspace string, plan runtime.ExecutionPlan) {
 	}
 	for i, t := range plan.Tasks {
 		fmt.Printf("  task[%d]: stage=%d agent=%s provider=%s(%s) model=%s skills=%v startup_calls=%d context_budget=%dt context_moment=%s\n", i, t.StageIndex, t.Agent, t.Provider, t.ProviderType, t.Model, t.Skills, t.StartupCalls, t.ContextBudget, t.ContextMoment)
+		if t.ContextProfile != "" && t.ContextProfile != project.DefaultContextProfile {
+			fmt.Printf("           context_profile=%s\n", t.ContextProfile)
+		}
 		if len(t.DependsOn) > 0 {
 			fmt.Printf("           depends_on=%v\n", t.DependsOn)
 		}
@@ -71,6 +76,26 @@ func printTracePlanText(workspace string, plan runtime.ExecutionPlan) {
 				}
 			}
 		}
+		for _, p := range t.Paths {
+			fmt.Printf("           paths[%s] access=%s allow=%s deny=default+%v", p.Skill, p.Access, formatPathAllow(p.Allow), p.Deny)
+			if len(p.Exempt) > 0 {
+				fmt.Printf(" exempt=%v", p.Exempt)
+			}
+			fmt.Println()
+		}
+		for _, r := range t.Routes {
+			fmt.Printf("           route -> %s when %s\n", r.To, r.When)
+		}
+		if t.Loop != nil {
+			fmt.Printf("           loop back_to=%s until %s max_iterations=%d body=%v\n", t.Loop.BackTo, t.Loop.Until, t.Loop.MaxIterations, t.Loop.Body)
+		}
+		if t.Map != nil {
+			field := ""
+			if t.Map.Field != "" {
+				field = " field=" + t.Map.Field
+			}
+			fmt.Printf("           map over=%s%s max_items=%d concurrency=%d\n", t.Map.Over, field, t.Map.MaxItems, t.Map.Concurrency)
+		}
 		if t.ProviderType == "deepseek" && len(t.Skills) > 0 && t.ContextMoment == "tool_loop" {
 			fmt.Println("           tool_loop=enabled (deepseek chat completions -> skills)")
 		}
@@ -80,16 +105,55 @@ func printTracePlanText(workspace string, plan runtime.ExecutionPlan) {
 	}
 }
 
+// printTraceContexts lists each agent's context candidates in selection
+// order with their scores, for tuning context profiles.
+func printTraceContexts(contexts []runtime.TaskContextPreview) {
+	for _, c := range contexts {
+		fmt.Printf("\ncontext[%s]: profile=%s moment=%s tokens=%d/%dt candidates=%d\n", c.Agent, c.Profile, c.Moment, c.Tokens, c.Budget, len(c.Candidates))
+		printContextCandidates("  ", c.Candidates)
+	}
+}
+
+// printContextCandidates prints one line per candidate in selection order:
+// keep/drop with the drop reason, the score and its breakdown.
+func printContextCandidates(indent string, cands []runtime.ContextCandidateScore) {
+	for _, c := range cands {
+		status := "keep"
+		if !c.Selected {
+			status = "drop:" + c.DropReason
+		}
+		ch := ""
+		if c.Channel != "" {
+			ch = " channel=" + c.Channel
+		}
+		fmt.Printf("%s%s score=%.2f (base=%.2f recency=%.2f type=%.2f moment=%.2f) tokens=%d group=%s kind=%s moment=%s%s %s\n", indent, status, c.Score, c.Base, c.Recency, c.TypeWeight, c.MomentBoost, c.Tokens, c.Group, c.Kind, c.Moment, ch, clipLine(c.Text, 96))
+	}
+}
+
 func printRunReportText(plan runtime.ExecutionPlan, report runtime.ExecutionReport) {
 	fmt.Printf("Run started=%s parallel=%v scheduler=dag_channels input=%q\n", report.StartedAt.Format(time.RFC3339), report.Parallel, report.Input)
-	for _, r := range report.Results {
-		fmt.Printf("\n[%s] stage=%d provider=%s(%s) model=%s duration=%s context=%d/%dt dropped=%d version=%d moment=%s\n", r.Agent, r.StageIndex, r.Provider, r.ProviderType, r.Model, r.Duration.Round(time.Millisecond), r.ContextTokens, r.ContextBudget, r.ContextDropped, r.ContextVersion, r.ContextMoment)
+	printContextResumed(report)
+	printReplayStats(report)
+	for _, r := range resultsByStage(report.Results) {
+		iter := ""
+		if r.Iteration > 0 {
+			iter = fmt.Sprintf(" iteration=%d", r.Iteration)
+		}
+		if r.Skipped {
+			fmt.Printf("\n[%s] stage=%d%s skipped: %s\n", r.Agent, r.StageIndex, iter, r.SkipReason)
+			continue
+		}
+		fmt.Printf("\n[%s] stage=%d%s provider=%s(%s) model=%s duration=%s context=%d/%dt dropped=%d version=%d moment=%s\n", r.Agent, r.StageIndex, iter, r.Provider, r.ProviderType, r.Model, r.Duration.Round(time.Millisecond), r.ContextTokens, r.ContextBudget, r.ContextDropped, r.ContextVersion, r.ContextMoment)
 		if len(r.DependsOn) > 0 {
 			fmt.Printf("  depends_on=%v\n", r.DependsOn)
 		}
 		if r.ContextChannelsTotal > 0 {
 			fmt.Printf("  context_channels=%d/%d dropped=%d\n", r.ContextChannelsUsed, r.ContextChannelsTotal, r.ContextChannelsDropped)
 		}
+		if len(r.ContextExplain) > 0 {
+			fmt.Printf("  context_explain candidates=%d\n", len(r.ContextExplain))
+			printContextCandidates("    ", r.ContextExplain)
+		}
 		if r.ToolCacheHits > 0 || r.ToolCacheMisses > 0 {
 			fmt.Printf("  tool_cache hits=%d misses=%d\n", r.ToolCacheHits, r.ToolCacheMisses)
 		}
@@ -124,6 +188,32 @@ func printRunReportText(plan runtime.ExecutionPlan, report runtime.ExecutionRepo
 		if r.SkippedOutputPublish {
 			fmt.Println("  handoff_publish skipped_unconsumed_output=true")
 		}
+		for _, c := range r.Contracts {
+			fmt.Printf("  contract port=%s valid=%t attempts=%d\n", c.Port, c.Valid, r.ContractAttempts)
+			for _, v := range c.Violations {
+				fmt.Printf("    violation: %s\n", v)
+			}
+		}
+		for _, d := range r.Routes {
+			state := "skipped"
+			if d.Taken {
+				state = "taken"
+			}
+			fmt.Printf("  route -> %s %s (%s)\n", d.To, state, d.Rule)
+		}
+		if len(r.MapItems) > 0 || r.MapDropped > 0 {
+			fmt.Printf("  map items=%d dropped=%d\n", len(r.MapItems), r.MapDropped)
+			for _, m := range r.MapItems {
+				if m.Error != "" {
+					fmt.Printf("    [%d] %s failed (%s): %s\n", m.Index, m.Item, m.Duration.Round(time.Millisecond), m.Error)
+					continue
+				}
+				fmt.Printf("    [%d] %s ok (%s) context=%dt\n", m.Index, m.Item, m.Duration.Round(time.Millisecond), m.ContextTokens)
+			}
+		}
+		if r.InvalidHandoffs > 0 {
+			fmt.Printf("  handoffs_invalid=%d\n", r.InvalidHandoffs)
+		}
 		if len(r.StartupCalls) > 0 {
 			for _, c := range r.StartupCalls {
 				if c.Error != "" {
@@ -165,5 +255,69 @@ func printRunReportText(plan runtime.ExecutionPlan, report runtime.ExecutionRepo
 		}
 		fmt.Println(r.Output)
 	}
+	for _, l := range report.Loops {
+		status := "exited"
+		if !l.Exited {
+			status = "stopped: " + l.StopReason
+		}
+		fmt.Printf("\nloop %s -> %s iterations=%d/%d %s\n", l.Agent, l.BackTo, len(l.Iterations), l.MaxIterations, status)
+	}
+	if n := runtime.RedactionTotal(report.Redactions); n > 0 {
+		fmt.Printf("\nredactions=%d %s\n", n, formatRedactionCounts(report.Redactions))
+	}
+	printContextSaved(report)
 	fmt.Printf("\nFinished in %s\n", report.EndedAt.Sub(report.StartedAt).Round(time.Millisecond))
 }
+
+func printContextResumed(report runtime.ExecutionReport) {
+	if rc := report.ContextResumed; rc != nil {
+		fmt.Printf("context resumed from=%s merge=%s facts=%d events=%d artifacts=%d expired=%d goal_changed=%v\n", rc.RunID, rc.Merge, rc.Facts, rc.Events, rc.Artifacts, rc.Expired, rc.GoalChanged)
+	}
+}
+
+func printReplayStats(report runtime.ExecutionReport) {
+	if rs := report.Replay; rs != nil {
+		fmt.Printf("replay hits=%d fallbacks=%d skill_hits=%d skill_fallbacks=%d unused=%d\n", rs.Hits, rs.Fallbacks, rs.SkillHits, rs.SkillFallbacks, rs.Unused)
+	}
+}
+
+func printContextSaved(report runtime.ExecutionReport) {
+	switch {
+	case report.ContextSaved != "":
+		fmt.Printf("\ncontext saved run_id=%s (resume with --resume-context %s)\n", report.RunID, report.RunID)
+	case report.ContextSaveError != "":
+		fmt.Printf("\nwarn: context not saved: %s\n", report.ContextSaveError)
+	}
+}
+
+func formatRedactionCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%d", k, counts[k]))
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+func formatPathAllow(levels [][]string) string {
+	if len(levels) == 0 {
+		return "*"
+	}
+	parts := make([]string, 0, len(levels))
+	for _, level := range levels {
+		parts = append(parts, fmt.Sprint(level))
+	}
+	return strings.Join(parts, "&")
+}
+
+// resultsByStage orders results by stage so loop iterations, which the
+// runtime appends after the planned tasks, print where they ran.
+func resultsByStage(results []runtime.AgentRunResult) []runtime.AgentRunResult {
+	out := append([]runtime.AgentRunResult(nil), results...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].StageIndex < out[j].StageIndex })
+	return out
+}
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"deeph/internal/project"
+	"deeph/internal/runtime"
+)
+
+const (
+	runRecordVersion      = 1
+	defaultRunHistoryKeep = 100
+)
+
+// runRecord is one persisted run, diagnosis or review under
+// .deeph/runs/<id>.json. Single runs share their id with the saved context
+// snapshot, so the same id works for --resume-context.
+type runRecord struct {
+	Version    int                         `json:"version"`
+	ID         string                      `json:"id"`
+	Command    string                      `json:"command"`
+	Source     string                      `json:"source"`
+	Spec       string                      `json:"spec,omitempty"`
+	Input      string                      `json:"input"`
+	StartedAt  time.Time                   `json:"started_at"`
+	EndedAt    time.Time                   `json:"ended_at"`
+	DurationMS int64                       `json:"duration_ms"`
+	Status     string                      `json:"status"`
+	Error      string                      `json:"error,omitempty"`
+	Usage      runtime.TokenUsage          `json:"usage"`
+	Plan       *runtime.ExecutionPlan      `json:"plan,omitempty"`
+	Report     *runtime.ExecutionReport    `json:"report,omitempty"`
+	Multiverse bool                        `json:"multiverse,omitempty"`
+	Scheduler  string                      `json:"scheduler,omitempty"`
+	Handoffs   []multiverseUniverseHandoff `json:"universe_handoffs,omitempty"`
+	Branches   []multiverseRunBranch       `json:"branches,omitempty"`
+	Judge      *multiverseJudgeRun         `json:"judge,omitempty"`
+	// Scope is the command's input scope (diagnose/review scope and checks).
+	Scope json.RawMessage `json:"scope,omitempty"`
+}
+
+func newRunRecord(command, source, spec, input string) runRecord {
+	return runRecord{Command: command, Source: source, Spec: spec, Input: input, StartedAt: time.Now()}
+}
+
+// setReport records a single-universe run.
+func (r *runRecord) setReport(plan runtime.ExecutionPlan, report runtime.ExecutionReport) {
+	r.ID = report.RunID
+	r.Plan, r.Report = &plan, &report
+	r.StartedAt, r.EndedAt = report.StartedAt, report.EndedAt
+	r.Input = report.Input
+}
+
+// setMultiverse records a multiverse run and its optional judge.
+func (r *runRecord) setMultiverse(mvPlan *multiverseOrchestrationPlan, branches []multiverseRunBranch, judge *multiverseJudgeRun) {
+	r.Multiverse = true
+	if mvPlan != nil {
+		r.Scheduler = mvPlan.Scheduler
+		r.Handoffs = mvPlan.Handoffs
+	}
+	r.Branches = branches
+	if judge != nil && strings.TrimSpace(judge.Spec) != "" {
+		r.Judge = judge
+	}
+}
+
+func (r *runRecord) setScope(v any) {
+	if b, err := json.Marshal(v); err == nil {
+		r.Scope = b
+	}
+}
+
+// reports lists every execution report in the record: the run itself, each
+// branch and the judge.
+func (r runRecord) reports() []runtime.ExecutionReport {
+	var out []runtime.ExecutionReport
+	if r.Report != nil {
+		out = append(out, *r.Report)
+	}
+	for _, b := range r.Branches {
+		out = append(out, b.Report)
+	}
+	if r.Judge != nil {
+		out = append(out, r.Judge.Report)
+	}
+	return out
+}
+
+// finish fills the derived fields (id, timings, usage, status).
+func (r *runRecord) finish(err error) {
+	r.Version = runRecordVersion
+	if r.ID == "" {
+		r.ID = runtime.NewRunID(r.StartedAt)
+	}
+	if r.EndedAt.IsZero() {
+		r.EndedAt = time.Now()
+	}
+	r.DurationMS = r.EndedAt.Sub(r.StartedAt).Milliseconds()
+	r.Usage = runtime.TokenUsage{}
+	failed := 0
+	for _, rep := range r.reports() {
+		for _, res := range rep.Results {
+			r.Usage.Add(res.Usage)
+			if res.Error != "" {
+				failed++
+			}
+		}
+	}
+	for _, b := range r.Branches {
+		if b.Error != "" {
+			failed++
+		}
+	}
+	switch {
+	case err != nil:
+		r.Status, r.Error = "error", err.Error()
+	case failed > 0:
+		r.Status = "failed"
+	default:
+		r.Status = "ok"
+	}
+}
+
+// redact scrubs the fields taken from user input and errors. Reports are
+// already redacted by the engine that produced them.
+func (r *runRecord) redact(red *runtime.Redactor) {
+	r.Input = red.Redact(r.Input)
+	r.Error = red.Redact(r.Error)
+	for i := range r.Branches {
+		r.Branches[i].Universe.Input = red.Redact(r.Branches[i].Universe.Input)
+		r.Branches[i].Error = red.Redact(r.Branches[i].Error)
+	}
+	if r.Judge != nil {
+		r.Judge.Error = red.Redact(r.Judge.Error)
+		r.Judge.RawOutput = red.Redact(r.Judge.RawOutput)
+	}
+	if len(r.Scope) > 0 {
+		if b := []byte(red.Redact(string(r.Scope))); json.Valid(b) {
+			r.Scope = b
+		} else {
+			r.Scope = nil
+		}
+	}
+}
+
+func runHistoryDir(workspace string) string {
+	return filepath.Join(workspace, ".deeph", "runs")
+}
+
+// recordRun persists rec and applies the workspace retention limits. History
+// is best effort: a failure is a warning, never a failed command.
+func recordRun(workspace string, p *project.Project, rec runRecord, runErr error) {
+	cfg := project.RunHistoryConfig{}
+	if p != nil {
+		cfg = p.Root.Runs
+	}
+	if cfg.Disabled || strings.TrimSpace(workspace) == "" {
+		return
+	}
+	rec.finish(runErr)
+	rec.redact(runtime.NewRedactor(p))
+	if err := saveRunRecord(workspace, rec); err != nil {
+		fmt.Fprintf(os.Stderr, "warn: run %s not recorded: %v\n", rec.ID, err)
+		return
+	}
+	keep := cfg.Keep
+	if keep <= 0 {
+		keep = defaultRunHistoryKeep
+	}
+	_, _ = pruneRunHistory(workspace, keep, time.Duration(cfg.MaxAgeDays)*24*time.Hour, time.Now())
+}
+
+func saveRunRecord(workspace string, rec runRecord) error {
+	dir := runHistoryDir(workspace)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return runtime.WriteFileAtomic(filepath.Join(dir, rec.ID+".json"), append(b, '\n'), 0o644)
+}
+
+// listRunIDs returns recorded run ids, oldest first.
+func listRunIDs(workspace string) ([]string, error) {
+	return runtime.ListRecordIDs(runHistoryDir(workspace))
+}
+
+// resolveRunID maps a run id, unique id prefix or "last" to a recorded id.
+func resolveRunID(workspace, ref string) (string, error) {
+	ids, err := listRunIDs(workspace)
+	if err != nil {
+		return "", err
+	}
+	if len(ids) == 0 {
+		return "", fmt.Errorf("no recorded runs in %s", runHistoryDir(workspace))
+	}
+	return runtime.ResolveRecordID(ids, ref, "recorded run")
+}
+
+func loadRunRecord(workspace, ref string) (runRecord, error) {
+	id, err := resolveRunID(workspace, ref)
+	if err != nil {
+		return runRecord{}, err
+	}
+	b, err := os.ReadFile(filepath.Join(runHistoryDir(workspace), id+".json"))
+	if err != nil {
+		return runRecord{}, err
+	}
+	var rec runRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return runRecord{}, fmt.Errorf("parse run %s: %w", id, err)
+	}
+	if rec.Version > runRecordVersion {
+		return runRecord{}, fmt.Errorf("run %s has version %d; this deeph reads up to %d", id, rec.Version, runRecordVersion)
+	}
+	return rec, nil
+}
+
+// pruneRunHistory removes runs beyond the newest keep and runs older than
+// maxAge (when > 0), and returns the removed ids.
+func pruneRunHistory(workspace string, keep int, maxAge time.Duration, now time.Time) ([]string, error) {
+	ids, err := listRunIDs(workspace)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for i, id := range ids {
+		drop := keep > 0 && i < len(ids)-keep
+		if !drop && maxAge > 0 {
+			if info, err := os.Stat(filepath.Join(runHistoryDir(workspace), id+".json")); err == nil && now.Sub(info.ModTime()) > maxAge {
+				drop = true
+			}
+		}
+		if !drop {
+			continue
+		}
+		if err := os.Remove(filepath.Join(runHistoryDir(workspace), id+".json")); err != nil {
+			return removed, err
+		}
+		removed = append(removed, id)
+	}
+	return removed, nil
+}
+
+// runRecordIssue summarizes a recorded run as diagnose input: what ran, what
+// failed, and the final outputs.
+func runRecordIssue(rec runRecord) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Recorded run %s (%s %s) status=%s\n", rec.ID, rec.Command, coalesce(rec.Spec, rec.Source), rec.Status)
+	if in := strings.TrimSpace(rec.Input); in != "" {
+		fmt.Fprintf(&b, "Input: %s\n", trimForIssue(in, 600))
+	}
+	if rec.Error != "" {
+		fmt.Fprintf(&b, "Run error: %s\n", rec.Error)
+	}
+	var last string
+	for _, rep := range rec.reports() {
+		for _, r := range rep.Results {
+			if r.Error != "" {
+				fmt.Fprintf(&b, "Agent %s failed: %s\n", r.Agent, r.Error)
+			}
+			for _, c := range append(append([]runtime.SkillCallResult(nil), r.StartupCalls...), r.ToolCalls...) {
+				if c.Error != "" {
+					fmt.Fprintf(&b, "Agent %s tool %s failed: %s\n", r.Agent, c.Skill, c.Error)
+				}
+			}
+			for _, c := range r.Contracts {
+				for _, v := range c.Violations {
+					fmt.Fprintf(&b, "Agent %s contract %s violation: %s\n", r.Agent, c.Port, v)
+				}
+			}
+			if strings.TrimSpace(r.Output) != "" {
+				last = fmt.Sprintf("Last output (%s):\n%s\n", r.Agent, trimForIssue(r.Output, 2000))
+			}
+		}
+	}
+	for _, br := range rec.Branches {
+		if br.Error != "" {
+			fmt.Fprintf(&b, "Branch %s failed: %s\n", br.Universe.ID, br.Error)
+		}
+	}
+	b.WriteString(last)
+	return strings.TrimSpace(b.String())
+}
+
+func trimForIssue(s string, max int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "..."
+}
+
+func cmdRuns(args []string) error {
+	if len(args) == 0 {
+		return errors.New("runs requires a subcommand: list, show, diff or rm")
+	}
+	switch args[0] {
+	case "list":
+		return cmdRunsList(args[1:])
+	case "show":
+		return cmdRunsShow(args[1:])
+	case "diff":
+		return cmdRunsDiff(args[1:])
+	case "rm":
+		return cmdRunsRemove(args[1:])
+	default:
+		return fmt.Errorf("unknown runs subcommand %q", args[0])
+	}
+}
+
+func cmdRunsList(args []string) error {
+	fs := flag.NewFlagSet("runs list", flag.ContinueOnError)
+	workspace := fs.String("workspace", ".", "workspace path")
+	command := fs.String("command", "", "only runs of this command (run, edit, diagnose, review)")
+	limit := fs.Int("limit", 20, "max runs to print, newest first (0 = all)")
+	jsonOut := fs.Bool("json", false, "print run summaries as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(fs.Args()) != 0 {
+		return errors.New("runs list does not accept positional arguments")
+	}
+	abs, err := filepath.Abs(*workspace)
+	if err != nil {
+		return err
+	}
+	ids, err := listRunIDs(abs)
+	if err != nil {
+		return err
+	}
+	summaries := make([]runSummary, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		if *limit > 0 && len(summaries) >= *limit {
+			break
+		}
+		rec, err := loadRunRecord(abs, ids[i])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warn: %v\n", err)
+			continue
+		}
+		if c := strings.TrimSpace(*command); c != "" && rec.Command != c {
+			continue
+		}
+		summaries = append(summaries, summarizeRun(rec))
+	}
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summaries)
+	}
+	if len(summaries) == 0 {
+		fmt.Printf("No recorded runs in %s\n", runHistoryDir(abs))
+		return nil
+	}
+	for _, s := range summaries {
+		fmt.Printf("- %s %s status=%s agents=%d duration=%s tokens=%d spec=%q input=%q\n", s.ID, s.Command, s.Status, s.Agents, (time.Duration(s.DurationMS) * time.Millisecond).Round(time.Millisecond), s.Usage.TotalTokens, s.Spec, s.Input)
+	}
+	return nil
+}
+
+type runSummary struct {
+	ID         string             `json:"id"`
+	Command    string             `json:"command"`
+	Spec       string             `json:"spec"`
+	Input      string             `json:"input"`
+	Status     string             `json:"status"`
+	StartedAt  time.Time          `json:"started_at"`
+	DurationMS int64              `json:"duration_ms"`
+	Agents     int                `json:"agents"`
+	Multiverse bool               `json:"multiverse,omitempty"`
+	Usage      runtime.TokenUsage `json:"usage"`
+}
+
+func summarizeRun(rec runRecord) runSummary {
+	agents := 0
+	for _, rep := range rec.reports() {
+		agents += len(rep.Results)
+	}
+	return runSummary{
+		ID:         rec.ID,
+		Command:    rec.Command,
+		Spec:       coalesce(rec.Spec, rec.Source),
+		Input:      trimForIssue(strings.Join(strings.Fields(rec.Input), " "), 60),
+		Status:     rec.Status,
+		StartedAt:  rec.StartedAt,
+		DurationMS: rec.DurationMS,
+		Agents:     agents,
+		Multiverse: rec.Multiverse,
+		Usage:      rec.Usage,
+	}
+}
+
+func cmdRunsShow(args []string) error {
+	fs := flag.NewFlagSet("runs show", flag.ContinueOnError)
+	workspace := fs.String("workspace", ".", "workspace path")
+	jsonOut := fs.Bool("json", false, "print the full run record as JSON")
+	rest, err := parseFlagsLoose(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errors.New("runs show requires <run-id|last>")
+	}
+	abs, err := filepath.Abs(*workspace)
+	if err != nil {
+		return err
+	}
+	rec, err := loadRunRecord(abs, rest[0])
+	if err != nil {
+		return err
+	}
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rec)
+	}
+	fmt.Printf("run: %s\n", rec.ID)
+	fmt.Printf("command: %s\n", rec.Command)
+	fmt.Printf("spec: %s\n", coalesce(rec.Spec, rec.Source))
+	fmt.Printf("status: %s\n", rec.Status)
+	if rec.Error != "" {
+		fmt.Printf("error: %s\n", rec.Error)
+	}
+	fmt.Printf("started_at: %s duration=%s\n", rec.StartedAt.Format(time.RFC3339), (time.Duration(rec.DurationMS) * time.Millisecond).Round(time.Millisecond))
+	fmt.Printf("usage: calls=%d prompt=%d completion=%d total=%d\n", rec.Usage.Calls, rec.Usage.PromptTokens, rec.Usage.CompletionTokens, rec.Usage.TotalTokens)
+	if len(rec.Scope) > 0 {
+		fmt.Printf("scope: %d bytes (see --json)\n", len(rec.Scope))
+	}
+	fmt.Println()
+	switch {
+	case rec.Multiverse:
+		printMultiverseRunText(abs, rec.Source, &multiverseOrchestrationPlan{Scheduler: rec.Scheduler, Handoffs: rec.Handoffs}, rec.Branches)
+		if rec.Judge != nil {
+			printMultiverseJudgeText(*rec.Judge)
+		}
+	case rec.Report != nil:
+		plan := runtime.ExecutionPlan{}
+		if rec.Plan != nil {
+			plan = *rec.Plan
+		}
+		printRunReportText(plan, *rec.Report)
+	}
+	return nil
+}
+
+func cmdRunsRemove(args []string) error {
+	fs := flag.NewFlagSet("runs rm", flag.ContinueOnError)
+	workspace := fs.String("workspace", ".", "workspace path")
+	all := fs.Bool("all", false, "remove every recorded run")
+	keep := fs.Int("keep", 0, "keep only the newest N runs")
+	olderThan := fs.Duration("older-than", 0, "remove runs older than this duration")
+	rest, err := parseFlagsLoose(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 && !*all && *keep <= 0 && *olderThan <= 0 {
+		return errors.New("runs rm requires <run-id>... or --all/--keep/--older-than")
+	}
+	abs, err := filepath.Abs(*workspace)
+	if err != nil {
+		return err
+	}
+	var removed []string
+	for _, ref := range rest {
+		id, err := resolveRunID(abs, ref)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(filepath.Join(runHistoryDir(abs), id+".json")); err != nil {
+			return err
+		}
+		removed = append(removed, id)
+	}
+	switch {
+	case *all:
+		ids, err := listRunIDs(abs)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := os.Remove(filepath.Join(runHistoryDir(abs), id+".json")); err != nil {
+				return err
+			}
+			removed = append(removed, id)
+		}
+	case *keep > 0 || *olderThan > 0:
+		pruned, err := pruneRunHistory(abs, *keep, *olderThan, time.Now())
+		removed = append(removed, pruned...)
+		if err != nil {
+			return err
+		}
+	}
+	if len(removed) == 0 {
+		fmt.Println("No runs matched")
+		return nil
+	}
+	for _, id := range removed {
+		fmt.Printf("Removed run %s\n", id)
+	}
+	return nil
+}
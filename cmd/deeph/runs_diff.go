@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"deeph/internal/runtime"
+)
+
+// runsDiffMaxLines caps the printed output diff per agent.
+const runsDiffMaxLines = 40
+
+func cmdRunsDiff(args []string) error {
+	fs := flag.NewFlagSet("runs diff", flag.ContinueOnError)
+	workspace := fs.String("workspace", ".", "workspace path")
+	rest, err := parseFlagsLoose(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 2 {
+		return errors.New("runs diff requires <run-a> <run-b>")
+	}
+	abs, err := filepath.Abs(*workspace)
+	if err != nil {
+		return err
+	}
+	a, err := loadRunRecord(abs, rest[0])
+	if err != nil {
+		return err
+	}
+	b, err := loadRunRecord(abs, rest[1])
+	if err != nil {
+		return err
+	}
+	fmt.Print(formatRunsDiff(a, b))
+	return nil
+}
+
+// runDiffResult is one agent result keyed by branch, agent and loop iteration.
+type runDiffResult struct {
+	key string
+	res runtime.AgentRunResult
+}
+
+func runDiffResults(rec runRecord) []runDiffResult {
+	var out []runDiffResult
+	add := func(prefix string, rep runtime.ExecutionReport) {
+		for _, r := range rep.Results {
+			key := prefix + r.Agent
+			if r.Iteration > 0 {
+				key += fmt.Sprintf("#%d", r.Iteration)
+			}
+			out = append(out, runDiffResult{key: key, res: r})
+		}
+	}
+	if rec.Report != nil {
+		add("", *rec.Report)
+	}
+	for _, b := range rec.Branches {
+		add(b.Universe.ID+"/", b.Report)
+	}
+	if rec.Judge != nil {
+		add("judge/", rec.Judge.Report)
+	}
+	return out
+}
+
+func formatRunsDiff(a, b runRecord) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "runs diff %s -> %s\n", a.ID, b.ID)
+	field := func(name, x, y string) {
+		if x == y {
+			return
+		}
+		fmt.Fprintf(&sb, "  %s: %s -> %s\n", name, x, y)
+	}
+	field("command", a.Command, b.Command)
+	field("spec", coalesce(a.Spec, a.Source), coalesce(b.Spec, b.Source))
+	field("status", a.Status, b.Status)
+	if a.Input != b.Input {
+		fmt.Fprintf(&sb, "  input: %q -> %q\n", trimForIssue(a.Input, 80), trimForIssue(b.Input, 80))
+	}
+	fmt.Fprintf(&sb, "  duration: %s -> %s\n", msDuration(a.DurationMS), msDuration(b.DurationMS))
+	fmt.Fprintf(&sb, "  usage: calls %d -> %d, tokens %d -> %d\n", a.Usage.Calls, b.Usage.Calls, a.Usage.TotalTokens, b.Usage.TotalTokens)
+
+	left := runDiffResults(a)
+	right := map[string]runtime.AgentRunResult{}
+	var order []string
+	for _, r := range runDiffResults(b) {
+		right[r.key] = r.res
+		order = append(order, r.key)
+	}
+	seen := map[string]bool{}
+	for _, l := range left {
+		seen[l.key] = true
+		r, ok := right[l.key]
+		if !ok {
+			fmt.Fprintf(&sb, "\n[%s] only in %s\n", l.key, a.ID)
+			continue
+		}
+		writeResultDiff(&sb, l.key, l.res, r)
+	}
+	for _, key := range order {
+		if !seen[key] {
+			fmt.Fprintf(&sb, "\n[%s] only in %s\n", key, b.ID)
+		}
+	}
+	return sb.String()
+}
+
+func writeResultDiff(sb *strings.Builder, key string, a, b runtime.AgentRunResult) {
+	fmt.Fprintf(sb, "\n[%s]\n", key)
+	if sa, sbStatus := resultStatus(a), resultStatus(b); sa != sbStatus {
+		fmt.Fprintf(sb, "  status: %s -> %s\n", sa, sbStatus)
+	}
+	if a.Error != b.Error && b.Error != "" {
+		fmt.Fprintf(sb, "  error: %s\n", b.Error)
+	}
+	fmt.Fprintf(sb, "  duration: %s -> %s\n", a.Duration.Round(time.Millisecond), b.Duration.Round(time.Millisecond))
+	if a.ContextTokens != b.ContextTokens {
+		fmt.Fprintf(sb, "  context: %dt -> %dt\n", a.ContextTokens, b.ContextTokens)
+	}
+	if len(a.ToolCalls) != len(b.ToolCalls) {
+		fmt.Fprintf(sb, "  tool_calls: %d -> %d\n", len(a.ToolCalls), len(b.ToolCalls))
+	}
+	if a.Usage.TotalTokens != b.Usage.TotalTokens {
+		fmt.Fprintf(sb, "  tokens: %d -> %d\n", a.Usage.TotalTokens, b.Usage.TotalTokens)
+	}
+	if a.Output == b.Output {
+		sb.WriteString("  output: same\n")
+		return
+	}
+	lines := diffLines(splitOutputLines(a.Output), splitOutputLines(b.Output))
+	added, removed := 0, 0
+	for _, l := range lines {
+		switch l[0] {
+		case '+':
+			added++
+		case '-':
+			removed++
+		}
+	}
+	fmt.Fprintf(sb, "  output: changed (+%d -%d lines)\n", added, removed)
+	for i, l := range lines {
+		if i == runsDiffMaxLines {
+			fmt.Fprintf(sb, "    ... %d more\n", len(lines)-i)
+			break
+		}
+		fmt.Fprintf(sb, "    %s\n", l)
+	}
+}
+
+func resultStatus(r runtime.AgentRunResult) string {
+	switch {
+	case r.Skipped:
+		return "skipped"
+	case r.Error != "":
+		return "failed"
+	default:
+		return "ok"
+	}
+}
+
+func msDuration(ms int64) time.Duration {
+	return (time.Duration(ms) * time.Millisecond).Round(time.Millisecond)
+}
+
+func splitOutputLines(s string) []string {
+	s = strings.TrimRight(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// diffLines returns the changed lines of a against b as "- "/"+ " entries,
+// from a longest-common-subsequence alignment. Very long outputs fall back
+// to listing both sides.
+func diffLines(a, b []string) []string {
+	if len(a)*len(b) > 1<<20 {
+		out := make([]string, 0, len(a)+len(b))
+		for _, l := range a {
+			out = append(out, "- "+l)
+		}
+		for _, l := range b {
+			out = append(out, "+ "+l)
+		}
+		return out
+	}
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var out []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "- "+a[i])
+			i++
+		default:
+			out = append(out, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		out = append(out, "+ "+b[j])
+	}
+	return out
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"deeph/internal/project"
+	"deeph/internal/runtime"
+)
+
+func TestRunHistorySaveResolveAndPrune(t *testing.T) {
+	ws := t.TempDir()
+	for _, id := range []string{"20261018-100000-0001", "20261018-110000-0002", "20261018-120000-0003"} {
+		rec := newRunRecord("run", "planner", "planner", "task "+id)
+		rec.ID = id
+		rec.finish(nil)
+		if err := saveRunRecord(ws, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if id, err := resolveRunID(ws, "last"); err != nil || id != "20261018-120000-0003" {
+		t.Fatalf("last = %q, %v", id, err)
+	}
+	if id, err := resolveRunID(ws, "20261018-11"); err != nil || id != "20261018-110000-0002" {
+		t.Fatalf("prefix = %q, %v", id, err)
+	}
+	if _, err := resolveRunID(ws, "20261018-1"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Fatalf("expected ambiguous error, got %v", err)
+	}
+	rec, err := loadRunRecord(ws, "last")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Status != "ok" || rec.Version != runRecordVersion || rec.Input != "task 20261018-120000-0003" {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+
+	removed, err := pruneRunHistory(ws, 2, 0, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != "20261018-100000-0001" {
+		t.Fatalf("removed = %v", removed)
+	}
+	ids, _ := listRunIDs(ws)
+	if len(ids) != 2 {
+		t.Fatalf("ids after prune = %v", ids)
+	}
+}
+
+func TestRecordRunRedactsInputAndError(t *testing.T) {
+	ws := t.TempDir()
+	secret := "ghp_" + strings.Repeat("a1B2", 10)
+	rec := newRunRecord("run", "planner", "planner", "deploy with "+secret)
+	rec.setScope(map[string]string{"diff": "+token " + secret})
+	recordRun(ws, &project.Project{}, rec, errors.New("push rejected for "+secret))
+
+	id, err := resolveRunID(ws, "last")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(runHistoryDir(ws), id+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), secret) || !strings.Contains(string(b), "[redacted:github_token]") {
+		t.Fatalf("expected the secret redacted from the run record:\n%s", b)
+	}
+}
+
+func TestRunRecordFinishAndIssue(t *testing.T) {
+	rec := newRunRecord("run", "planner>coder", "", "fix login")
+	report := runtime.ExecutionReport{
+		RunID: "20261018-120000-0001",
+		Input: "fix login",
+		Results: []runtime.AgentRunResult{
+			{Agent: "planner", Output: "plan: patch auth", Usage: runtime.TokenUsage{Calls: 1, TotalTokens: 40}},
+			{Agent: "coder", Error: "provider timeout", Usage: runtime.TokenUsage{Calls: 1, TotalTokens: 10},
+				ToolCalls: []runtime.SkillCallResult{{Skill: "file_read", Error: "not found"}}},
+		},
+	}
+	rec.setReport(runtime.ExecutionPlan{}, report)
+	rec.finish(nil)
+	if rec.Status != "failed" || rec.Usage.TotalTokens != 50 || rec.Usage.Calls != 2 {
+		t.Fatalf("unexpected finish: status=%s usage=%+v", rec.Status, rec.Usage)
+	}
+	issue := runRecordIssue(rec)
+	for _, want := range []string{"Recorded run 20261018-120000-0001", "Agent coder failed: provider timeout", "tool file_read failed: not found", "Last output (planner)"} {
+		if !strings.Contains(issue, want) {
+			t.Fatalf("issue missing %q:\n%s", want, issue)
+		}
+	}
+}
+
+func TestDiffLinesAndFormatRunsDiff(t *testing.T) {
+	got := diffLines([]string{"a", "b", "c"}, []string{"a", "x", "c", "d"})
+	want := []string{"- b", "+ x", "+ d"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("diffLines = %v", got)
+	}
+
+	a := runRecord{ID: "run-a", Command: "run", Source: "planner", Status: "ok", Report: &runtime.ExecutionReport{
+		Results: []runtime.AgentRunResult{{Agent: "planner", Output: "one\ntwo"}},
+	}}
+	b := runRecord{ID: "run-b", Command: "run", Source: "planner", Status: "failed", Report: &runtime.ExecutionReport{
+		Results: []runtime.AgentRunResult{{Agent: "planner", Output: "one\nthree"}, {Agent: "reviewer", Error: "boom"}},
+	}}
+	out := formatRunsDiff(a, b)
+	for _, want := range []string{"status: ok -> failed", "[planner]", "output: changed (+1 -1 lines)", "- two", "+ three", "[reviewer] only in run-b"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("diff missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"deeph/internal/runtime"
+	"gopkg.in/yaml.v3"
+)
+
+// pluginManifestFiles are looked up when `deeph skill add` is given a directory
+// (a plugin kit: the executable plus a manifest describing how to start it).
+var pluginManifestFiles = []string{"deeph-plugin.yaml", "deeph-plugin.yml", "plugin.yaml", "plugin.yml"}
+
+var pluginSkillNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+type pluginManifest struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Command     []string `yaml:"command"`
+	TimeoutMS   int      `yaml:"timeout_ms"`
+	EnvAllow    []string `yaml:"env_allow"`
+}
+
+type pluginSkillFile struct {
+	Name        string         `yaml:"name"`
+	Type        string         `yaml:"type"`
+	Description string         `yaml:"description,omitempty"`
+	TimeoutMS   int            `yaml:"timeout_ms,omitempty"`
+	Params      map[string]any `yaml:"params"`
+}
+
+func looksLikePluginPath(raw string) bool {
+	if strings.ContainsRune(raw, '/') || strings.ContainsRune(raw, filepath.Separator) || strings.HasPrefix(raw, ".") {
+		return true
+	}
+	_, err := os.Stat(raw)
+	return err == nil
+}
+
+// installPluginSkill resolves a plugin executable or plugin kit directory, runs
+// the describe handshake and writes skills/<name>.yaml with type: plugin.
+func installPluginSkill(workspace, src, nameOverride string, force bool) (string, runtime.PluginDescription, error) {
+	srcAbs, err := filepath.Abs(src)
+	if err != nil {
+		return "", runtime.PluginDescription{}, err
+	}
+	st, err := os.Stat(srcAbs)
+	if err != nil {
+		return "", runtime.PluginDescription{}, fmt.Errorf("plugin path %q: %w", src, err)
+	}
+	manifest := pluginManifest{}
+	if st.IsDir() {
+		if manifest, err = loadPluginManifest(srcAbs); err != nil {
+			return "", runtime.PluginDescription{}, err
+		}
+	} else {
+		if st.Mode()&0o111 == 0 {
+			return "", runtime.PluginDescription{}, fmt.Errorf("plugin %s is not executable (chmod +x, or use a plugin directory with a deeph-plugin.yaml command)", srcAbs)
+		}
+		manifest.Command = []string{srcAbs}
+	}
+	for i, arg := range manifest.Command {
+		manifest.Command[i] = workspaceRelativePath(workspace, arg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	desc, err := runtime.DescribePlugin(ctx, workspace, manifest.Command, manifest.EnvAllow)
+	if err != nil {
+		return "", runtime.PluginDescription{}, fmt.Errorf("plugin handshake failed: %w", err)
+	}
+
+	name := strings.TrimSpace(coalesce(nameOverride, manifest.Name, desc.Name))
+	if !pluginSkillNamePattern.MatchString(name) {
+		return "", desc, fmt.Errorf("invalid plugin skill name %q (use letters, digits, _ or -; override with --name)", name)
+	}
+	params := map[string]any{"command": manifest.Command}
+	if len(manifest.EnvAllow) > 0 {
+		params["env_allow"] = manifest.EnvAllow
+	}
+	b, err := yaml.Marshal(pluginSkillFile{
+		Name:        name,
+		Type:        "plugin",
+		Description: coalesce(manifest.Description, desc.Description),
+		TimeoutMS:   manifest.TimeoutMS,
+		Params:      params,
+	})
+	if err != nil {
+		return "", desc, err
+	}
+	skillsDir := filepath.Join(workspace, "skills")
+	if err := os.MkdirAll(skillsDir, 0o755); err != nil {
+		return "", desc, err
+	}
+	outPath := filepath.Join(skillsDir, name+".yaml")
+	if !force {
+		if _, err := os.Stat(outPath); err == nil {
+			return "", desc, fmt.Errorf("%s already exists (use --force to overwrite)", outPath)
+		}
+	}
+	if err := os.WriteFile(outPath, b, 0o644); err != nil {
+		return "", desc, err
+	}
+	return outPath, desc, nil
+}
+
+func loadPluginManifest(dir string) (pluginManifest, error) {
+	for _, name := range pluginManifestFiles {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		var m pluginManifest
+		if err := yaml.Unmarshal(b, &m); err != nil {
+			return pluginManifest{}, fmt.Errorf("parse %s: %w", filepath.Join(dir, name), err)
+		}
+		if len(m.Command) == 0 || strings.TrimSpace(m.Command[0]) == "" {
+			return pluginManifest{}, fmt.Errorf("%s: command is required", filepath.Join(dir, name))
+		}
+		// Files shipped with the kit (the executable, or a script passed to an
+		// interpreter) are referenced relative to the manifest.
+		for i, arg := range m.Command {
+			if filepath.IsAbs(arg) || strings.HasPrefix(arg, "-") {
+				continue
+			}
+			if local := filepath.Join(dir, arg); fileExists(local) || (i == 0 && strings.ContainsRune(arg, '/')) {
+				m.Command[i] = local
+			}
+		}
+		return m, nil
+	}
+	return pluginManifest{}, fmt.Errorf("no plugin manifest in %s (expected %s)", dir, strings.Join(pluginManifestFiles, " or "))
+}
+
+// workspaceRelativePath keeps skill YAML portable when the plugin lives inside
+// the workspace; plugins run with the workspace as working directory.
+func workspaceRelativePath(workspace, p string) string {
+	if !filepath.IsAbs(p) {
+		return p
+	}
+	rel, err := filepath.Rel(workspace, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return p
+	}
+	return "./" + filepath.ToSlash(rel)
+}
+
+func fileExists(path string) bool {
+	st, err := os.Stat(path)
+	return err == nil && !st.IsDir()
+}
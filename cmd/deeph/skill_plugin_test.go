@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSkillPluginHelperProcess is not a real test: with DEEPH_SKILL_PLUGIN_HELPER=1
+// the test binary answers the plugin describe handshake.
+func TestSkillPluginHelperProcess(t *testing.T) {
+	if os.Getenv("DEEPH_SKILL_PLUGIN_HELPER") != "1" {
+		t.Skip("helper process")
+	}
+	sc := bufio.NewScanner(os.Stdin)
+	for sc.Scan() {
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		if json.Unmarshal(sc.Bytes(), &msg) != nil || msg.Method != "describe" {
+			continue
+		}
+		b, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": map[string]any{
+			"name": "jira", "description": "Query Jira issues", "version": "0.2.0",
+		}})
+		fmt.Fprintln(os.Stdout, string(b))
+	}
+	os.Exit(0)
+}
+
+func TestInstallPluginSkillFromKitDirectory(t *testing.T) {
+	t.Setenv("DEEPH_SKILL_PLUGIN_HELPER", "1")
+	ws := t.TempDir()
+	kitDir := filepath.Join(t.TempDir(), "jira-plugin")
+	if err := os.MkdirAll(kitDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := fmt.Sprintf("name: jira\ncommand: [%q, \"-test.run=^TestSkillPluginHelperProcess$\"]\nenv_allow: [DEEPH_SKILL_PLUGIN_HELPER]\ntimeout_ms: 20000\n", os.Args[0])
+	if err := os.WriteFile(filepath.Join(kitDir, "deeph-plugin.yaml"), []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	outPath, desc, err := installPluginSkill(ws, kitDir, "", false)
+	if err != nil {
+		t.Fatalf("installPluginSkill error: %v", err)
+	}
+	if desc.Version != "0.2.0" || outPath != filepath.Join(ws, "skills", "jira.yaml") {
+		t.Fatalf("unexpected install: path=%s desc=%+v", outPath, desc)
+	}
+	b, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"type: plugin", "description: Query Jira issues", "timeout_ms: 20000", "DEEPH_SKILL_PLUGIN_HELPER"} {
+		if !strings.Contains(string(b), want) {
+			t.Fatalf("expected %q in skill file:\n%s", want, b)
+		}
+	}
+	if _, _, err := installPluginSkill(ws, kitDir, "", false); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected existing skill to require --force, got %v", err)
+	}
+	if _, _, err := installPluginSkill(ws, kitDir, "bad name", true); err == nil {
+		t.Fatalf("expected invalid --name to be rejected")
+	}
+}
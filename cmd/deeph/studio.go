@@ -779,17 +779,18 @@ func studioShowReviewWorkingSet(workspace, baseRef, focus string) error {
 	if verr != nil && verr.HasErrors() {
 		return verr
 	}
+	baseSpec := defaultReviewAgentSpec(p)
+	synthSpec := defaultReviewSynthSpec(p)
+	selectedSpecArg, useBuiltinFlow := resolveDefaultReviewTarget(abs, p, "")
+	displaySpec := reviewDisplaySpec(selectedSpecArg, baseSpec, synthSpec, useBuiltinFlow)
 	cfg := reviewscope.DefaultConfig()
+	cfg.Tokenizer = promptTokenizer(p, abs, coalesce(selectedSpecArg, baseSpec))
 	scope, err := reviewscope.BuildScope(abs, baseRef, cfg)
 	if err != nil {
 		return err
 	}
 	input := reviewscope.BuildInput(scope, focus, cfg)
-	promptTokens := reviewscope.EstimateTokens(input)
-	baseSpec := defaultReviewAgentSpec(p)
-	synthSpec := defaultReviewSynthSpec(p)
-	selectedSpecArg, useBuiltinFlow := resolveDefaultReviewTarget(abs, p, "")
-	displaySpec := reviewDisplaySpec(selectedSpecArg, baseSpec, synthSpec, useBuiltinFlow)
+	promptTokens := cfg.Tokenizer.Count(input)
 
 	printReviewScope(scope, displaySpec, promptTokens)
 	if len(scope.WorkingSet) == 0 {
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"deeph/internal/project"
+	"deeph/internal/runtime"
+	"deeph/internal/tokenizer"
+)
+
+// promptTokenizer resolves the tokenizer of the first agent in spec without
+// building an engine, for commands that only report prompt sizes.
+func promptTokenizer(p *project.Project, workspace, spec string) tokenizer.Tokenizer {
+	name := strings.TrimSpace(spec)
+	if i := strings.IndexAny(name, "+>,@ "); i >= 0 {
+		name = name[:i]
+	}
+	providerName := p.Root.DefaultProvider
+	model := ""
+	for _, a := range p.Agents {
+		if a.Name == name {
+			providerName = coalesce(a.Provider, providerName)
+			model = a.Model
+			break
+		}
+	}
+	for _, pc := range p.Root.Providers {
+		if pc.Name != providerName {
+			continue
+		}
+		tok, err := tokenizer.Resolve(workspace, pc.Tokenizer, pc.Type, coalesce(model, pc.Model), tokenizer.SearchDirs(workspace))
+		if err == nil {
+			return tok
+		}
+		break
+	}
+	return tokenizer.Heuristic()
+}
+
+// chatTokenizer budgets chat history with the tokenizer of the first agent
+// that receives the turn.
+func chatTokenizer(eng *runtime.Engine, tasks []runtime.Task) tokenizer.Tokenizer {
+	if eng == nil || len(tasks) == 0 {
+		return tokenizer.Heuristic()
+	}
+	return eng.TokenizerForAgent(tasks[0].Agent.Name)
+}
+
+// tokenizerIssues warns about provider tokenizers that cannot be loaded; runs
+// fall back to the heuristic for them.
+func tokenizerIssues(p *project.Project, workspace string) []project.Issue {
+	var issues []project.Issue
+	for i, pc := range p.Root.Providers {
+		if strings.TrimSpace(pc.Tokenizer) == "" {
+			continue
+		}
+		if _, err := tokenizer.Resolve(workspace, pc.Tokenizer, pc.Type, pc.Model, tokenizer.SearchDirs(workspace)); err != nil {
+			issues = append(issues, project.Issue{
+				Level:   project.IssueWarning,
+				Path:    fmt.Sprintf("%s.providers[%d]", project.RootConfigFile, i),
+				Field:   "tokenizer",
+				Message: err.Error() + "; falling back to the heuristic",
+			})
+		}
+	}
+	return issues
+}
@@ -0,0 +1,45 @@
+// Package capbuf provides an io.Writer that keeps at most a fixed number of
+// bytes and records whether anything was dropped. It is used to bound the
+// output captured from child processes.
+package capbuf
+
+import "bytes"
+
+// Buffer accepts every write but stores only the first Max bytes. Writes never
+// fail, so a chatty child process is not killed by a short write.
+type Buffer struct {
+	Max       int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+// New returns a Buffer that keeps at most max bytes.
+func New(max int) *Buffer {
+	return &Buffer{Max: max}
+}
+
+func (b *Buffer) Write(p []byte) (int, error) {
+	remaining := b.Max - b.buf.Len()
+	if remaining <= 0 {
+		if len(p) > 0 {
+			b.truncated = true
+		}
+		return len(p), nil
+	}
+	if len(p) > remaining {
+		_, _ = b.buf.Write(p[:remaining])
+		b.truncated = true
+		return len(p), nil
+	}
+	_, _ = b.buf.Write(p)
+	return len(p), nil
+}
+
+// Truncated reports whether any written bytes were dropped.
+func (b *Buffer) Truncated() bool {
+	return b.truncated
+}
+
+func (b *Buffer) String() string {
+	return b.buf.String()
+}
@@ -0,0 +1,30 @@
+package capbuf
+
+import "testing"
+
+func TestBufferKeepsPrefixAndFlagsTruncation(t *testing.T) {
+	b := New(5)
+	if n, err := b.Write([]byte("abc")); n != 3 || err != nil {
+		t.Fatalf("write = %d, %v", n, err)
+	}
+	if b.Truncated() {
+		t.Fatalf("truncated after fitting write")
+	}
+	if n, err := b.Write([]byte("defg")); n != 4 || err != nil {
+		t.Fatalf("write = %d, %v", n, err)
+	}
+	if got := b.String(); got != "abcde" {
+		t.Fatalf("String() = %q, want abcde", got)
+	}
+	if !b.Truncated() {
+		t.Fatalf("expected truncation")
+	}
+}
+
+func TestBufferWithZeroMaxDropsEverything(t *testing.T) {
+	b := New(0)
+	_, _ = b.Write([]byte("x"))
+	if b.String() != "" || !b.Truncated() {
+		t.Fatalf("got %q truncated=%v", b.String(), b.Truncated())
+	}
+}
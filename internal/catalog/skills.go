@@ -51,6 +51,28 @@ type: file_read_range
 description: Reads a specific line range from a local file (lower token cost than full reads)
 params:
   max_bytes: 32768
+`,
+	},
+	"artifact_read": {
+		Name:        "artifact_read",
+		Description: "Pages through a context artifact (full tool output or handoff) by ID and line range",
+		Filename:    "artifact_read.yaml",
+		Content: `name: artifact_read
+type: artifact_read
+description: Reads the full content behind an artifact id from the compiled context, by line range
+params:
+  max_bytes: 32768
+`,
+	},
+	"memory_write": {
+		Name:        "memory_write",
+		Description: "Records a long-lived project fact (build command, convention, decision) for future runs",
+		Filename:    "memory_write.yaml",
+		Content: `name: memory_write
+type: memory_write
+description: Records a durable fact about this project (key, value, confidence, evidence) that later runs see in context
+params:
+  max_confidence: 0.9
 `,
 	},
 	"file_write_safe": {
@@ -60,11 +82,102 @@ params:
 		Content: `name: file_write_safe
 type: file_write_safe
 description: Writes a text file inside the workspace (relative path only, no overwrite by default)
+approval: mutating   # ask before tool-loop writes (non-interactive runs deny); set never to allow
+deny_paths:          # added to the default deny list (.git, .env*, key files)
+  - deeph.yaml
+  - go.sum
 params:
   max_bytes: 131072
   create_dirs: true
   create_if_missing: true
   overwrite_default: false
+`,
+	},
+	"command_exec": {
+		Name:        "command_exec",
+		Description: "Runs allowlisted build/test commands inside the workspace (timeout, capped output, scrubbed env)",
+		Filename:    "command_exec.yaml",
+		Content: `name: command_exec
+type: command_exec
+description: Runs allowlisted build/test commands inside the workspace (no shell)
+timeout_ms: 120000
+# approval: mutating   # ask before each tool-loop command
+params:
+  allow:
+    - go build
+    - go test
+    - go vet
+  max_output_bytes: 65536
+  network: "off"
+  env_allow: []
+`,
+	},
+	"code_search": {
+		Name:        "code_search",
+		Description: "Searches workspace code (regex/literal, .gitignore-aware) and looks up Go symbols",
+		Filename:    "code_search.yaml",
+		Content: `name: code_search
+type: code_search
+description: Finds code in the workspace by regex/literal text or Go symbol (declarations, references, importers)
+params:
+  max_results: 50
+  max_file_bytes: 1048576
+  max_symbol_files: 20
+`,
+	},
+	"repo_map": {
+		Name:        "repo_map",
+		Description: "Lists the workspace as a budgeted tree with language, size and Go/TS symbol outlines",
+		Filename:    "repo_map.yaml",
+		Content: `name: repo_map
+type: repo_map
+description: Shows a .gitignore-aware tree of the workspace with per-file language, size and code outlines
+params:
+  max_depth: 4
+  max_entries: 300
+  max_chars: 12000
+  outline_files: 40
+`,
+	},
+	"git": {
+		Name:        "git",
+		Description: "Read-only git inspection (log, show, blame, diff, status) with output limits",
+		Filename:    "git.yaml",
+		Content: `name: git
+type: git
+description: Read-only git history for the workspace (log, show, blame, diff, status)
+timeout_ms: 10000
+params:
+  max_output_bytes: 32768
+`,
+	},
+	"mcp_stdio": {
+		Name:        "mcp_stdio",
+		Description: "Connects to a local MCP server over stdio and exposes its tools",
+		Filename:    "mcp_stdio.yaml",
+		Content: `name: mcp_stdio
+type: mcp
+description: Tools from a local MCP server (each tool is exposed as mcp_stdio__<tool>)
+timeout_ms: 30000
+params:
+  command: ["npx", "-y", "@modelcontextprotocol/server-filesystem", "."]
+  # tools: [read_file, list_directory]   # optional allowlist
+  env_allow: []
+  max_bytes: 65536
+`,
+	},
+	"mcp_http": {
+		Name:        "mcp_http",
+		Description: "Connects to a remote MCP server over streamable HTTP and exposes its tools",
+		Filename:    "mcp_http.yaml",
+		Content: `name: mcp_http
+type: mcp
+description: Tools from a remote MCP server (each tool is exposed as mcp_http__<tool>)
+url: http://127.0.0.1:8080/mcp
+timeout_ms: 30000
+headers: {}
+params:
+  max_bytes: 65536
 `,
 	},
 	"http_request": {
@@ -75,9 +188,24 @@ params:
 type: http
 description: Makes an HTTP request (safe defaults; user controls URL)
 method: GET
+approval: mutating   # GET/HEAD run freely; other methods need approval
 timeout_ms: 5000
+# headers:
+#   Authorization: "Bearer ${env:API_TOKEN}"   # resolved at execution, redacted from traces; needs allow_hosts
 params:
   max_bytes: 65536
+  allow_methods: [GET]
+  # allow_hosts: [api.example.com, "*.example.org"]
+  # allow_url_prefixes: ["https://api.github.com/repos/"]
+  # allow_private_networks: false   # RFC1918 and link-local targets are blocked by default
+# Fixed endpoint: declare args and reference them as {{args.name}} in url/body_template.
+# url: "https://api.example.com/items/{{args.id}}"
+# args_schema:
+#   type: object
+#   properties:
+#     id: {type: string, minLength: 1}
+#   required: [id]
+#   additionalProperties: false
 `,
 	},
 }
@@ -196,6 +196,9 @@ var docs = []Doc{
 			"deeph validate",
 			"deeph validate --workspace ./myproj",
 		},
+		Notes: []string{
+			"Also loads each mock provider's `mock_script` and fails when a script is missing or invalid.",
+		},
 	},
 	{
 		Path:     "review",
@@ -227,19 +230,22 @@ var docs = []Doc{
 		Category: "execution",
 		Summary:  "Analyze an error, panic, stack trace, or failing output against a compact workspace scope",
 		Usage: []string{
-			`deeph diagnose [--workspace DIR] [--spec SPEC] [--base REF] [--trace] [--coach=false] [--fix] [--yes] [--json] [--file PATH] [issue]`,
+			`deeph diagnose [--workspace DIR] [--spec SPEC] [--base REF] [--trace] [--coach=false] [--fix] [--yes] [--json] [--file PATH] [--from-run RUN_ID|last] [--save-context=false] [--resume-context RUN_ID|last] [--resume-merge auto|all|facts] [--resume-ttl DUR] [issue]`,
 		},
 		Examples: []string{
 			`deeph diagnose "panic: nil pointer dereference in cmd/main.go:42"`,
 			`go test ./... 2>&1 | deeph diagnose`,
 			`deeph diagnose --file /tmp/build.log`,
 			`deeph diagnose --fix "panic: nil pointer dereference in cmd/main.go:42"`,
+			`deeph diagnose --from-run last`,
 		},
 		Notes: []string{
 			"Builds a compact workspace scope from referenced files in the error text plus a small same-package expansion.",
 			"If `diagnoser` exists, it is the default agent; otherwise falls back to `reviewer` and then `guide`.",
 			"`--json` prints the generated diagnose scope and payload instead of running the agent.",
 			"`--fix` proposes a follow-up `deeph edit`; add `--yes` to run that edit immediately after diagnosis.",
+			"`--from-run` diagnoses a recorded run (see `deeph runs list`): its input, agent and tool errors, contract violations and last output become the issue text.",
+			"The follow-up edit resumes the diagnosis context (`--resume-context <run-id>`), so the coder starts from what the diagnosis found.",
 		},
 	},
 	{
@@ -247,14 +253,16 @@ var docs = []Doc{
 		Category: "execution",
 		Summary:  "Run the default `coder` agent with a focused code-editing task",
 		Usage: []string{
-			`deeph edit [--workspace DIR] [--trace] [--coach=false] [task]`,
+			`deeph edit [--workspace DIR] [--trace] [--coach=false] [--save-context=false] [--resume-context RUN_ID|last] [--resume-merge auto|all|facts] [--resume-ttl DUR] [task]`,
 		},
 		Examples: []string{
 			`deeph edit "analyze cmd/main.go and add two helper functions"`,
 			`deeph edit --trace "refactor the handler and keep behavior unchanged"`,
+			`deeph edit --resume-context last "apply the fix the diagnosis proposed"`,
 		},
 		Notes: []string{
 			"Thin shortcut over `deeph run coder ...` for the common editing path.",
+			"Accepts the `run` context flags; `--resume-context last` continues from the previous run's context.",
 			"Best used after `deeph quickstart`, which scaffolds the default `coder` agent and file skills.",
 		},
 	},
@@ -263,19 +271,21 @@ var docs = []Doc{
 		Category: "execution",
 		Summary:  "Show execution plan, stages, channels and handoffs before running",
 		Usage: []string{
-			`deeph trace [--workspace DIR] [--json] [--multiverse N] [--daemon=true|false] [--daemon-target HOST:PORT] "<agent|a+b|a>b|a+b>c|@crew|crew:name>" [input]`,
+			`deeph trace [--workspace DIR] [--json] [--context] [--multiverse N] [--daemon=true|false] [--daemon-target HOST:PORT] "<agent|a+b|a>b|a+b>c|@crew|crew:name>" [input]`,
 		},
 		Examples: []string{
 			`deeph trace guide "teste"`,
 			`deeph trace "planner+reader>coder>reviewer" "implemente X"`,
 			`deeph trace --json "planner+coder>reviewer" "debug"`,
 			`deeph trace --multiverse 0 @reviewpack "task"`,
+			`deeph trace --context "planner>coder" "task"`,
 			`deeph trace --daemon @reviewpack "task"`,
 			`deeph trace --daemon=false guide "task"`,
 		},
 		Notes: []string{
 			"`--json` is useful for automation, UI integration and logs.",
 			"`--multiverse N` traces N universes (or all crew universes with `--multiverse 0`).",
+			"`--context` compiles each agent's starting context locally and lists every candidate's score under its context profile.",
 			"Crew universes can declare `depends_on` to create multiverse channels (`u1.result -> u2.context`) shown in the trace.",
 			"`--daemon` defaults to `true` and forwards the request to a local `deephd` gRPC daemon.",
 			"If daemon is unavailable, deepH tries to start it and falls back to local execution when needed.",
@@ -288,12 +298,16 @@ var docs = []Doc{
 		Category: "execution",
 		Summary:  "Run one or more agents with DAG/channels orchestration",
 		Usage: []string{
-			`deeph run [--workspace DIR] [--trace] [--coach=false] [--multiverse N] [--judge-agent SPEC] [--judge-max-output-chars N] [--daemon=true|false] [--daemon-target HOST:PORT] "<agent|a+b|a>b|a+b>c|@crew|crew:name>" [input]`,
+			`deeph run [--workspace DIR] [--trace] [--coach=false] [--explain-context] [--save-context=false] [--resume-context RUN_ID|last] [--resume-merge auto|all|facts] [--resume-ttl DUR] [--record FILE | --replay FILE] [--multiverse N] [--judge-agent SPEC] [--judge-max-output-chars N] [--daemon=true|false] [--daemon-target HOST:PORT] "<agent|a+b|a>b|a+b>c|@crew|crew:name>" [input]`,
 		},
 		Examples: []string{
 			`deeph run guide "teste"`,
 			`deeph run "planner+reader>coder>reviewer" "crie feature X"`,
 			`deeph run --trace "a+b>c" "task"`,
+			`deeph run --explain-context "planner>coder" "task"`,
+			`deeph run --resume-context last "planner>coder" "continue with the fix"`,
+			`deeph run --record .deeph/cassettes/login.json "planner>coder" "fix login"`,
+			`deeph run --replay .deeph/cassettes/login.json`,
 			`deeph run --multiverse 0 @reviewpack "task"`,
 			`deeph run --multiverse 0 --judge-agent guide @reviewpack "task"`,
 			`deeph run --daemon guide "task"`,
@@ -301,6 +315,11 @@ var docs = []Doc{
 		},
 		Notes: []string{
 			"Prints context, channel, handoff and tool budget metrics per agent.",
+			"Every run is recorded under `.deeph/runs/<run-id>.json`; browse with `deeph runs list|show|diff`.",
+			"Each single-universe run saves its context (goal, facts, events, artifact refs and agent results) to `.deeph/contexts/<run-id>.json`; the newest 20 are kept.",
+			"`--resume-context` seeds the run from a saved context: facts older than `--resume-ttl` are dropped and the rest decay in confidence; with `--resume-merge auto` a changed goal keeps only facts and artifacts (at lower confidence), `all` restores everything and `facts` never restores events.",
+			"`--record FILE` writes every provider request/response and skill result to a cassette; `--replay FILE` serves them back by request fingerprint (falling back to the agent's next recorded response when a prompt change altered the request) so the run reproduces offline. Without an agent spec, replay reruns the cassette's spec and input. Both run in-process, never via deephd.",
+			"`--explain-context` lists every context candidate per agent with its score breakdown (base, recency, type weight, moment boost) and drop reason (`budget`, `group_cap`, `channel`); the JSON report carries it as `ContextExplain`.",
 			"`--multiverse` runs multiple universes and prints branch outputs plus a sink-output fingerprint consensus.",
 			"Crew universes with `depends_on` run with a multiverse DAG/channels scheduler and can contribute compact handoffs to downstream universes.",
 			"`--judge-agent` runs a follow-up comparison agent over multiverse branch summaries (reconcile/judge step).",
@@ -318,14 +337,14 @@ var docs = []Doc{
 		Category: "execution",
 		Summary:  "Run the local `deephd` gRPC daemon in foreground",
 		Usage: []string{
-			"deeph daemon serve [--target HOST:PORT]",
+			"deeph daemon serve [--target HOST:PORT] [--approval-timeout DUR]",
 		},
 		Examples: []string{
 			"deeph daemon serve",
 			"deeph daemon serve --target 127.0.0.1:7788",
 		},
 		Notes: []string{
-			"Serves Ping/Trace/Run/Shutdown gRPC methods over HTTP/2 with protobuf structs.",
+			"Serves Ping/Trace/Run/Shutdown/Approvals/Approve/Deny gRPC methods over HTTP/2 with protobuf structs.",
 			"Use `deeph run --daemon ...` or `deeph trace --daemon ...` to send requests to this process.",
 		},
 	},
@@ -366,6 +385,42 @@ var docs = []Doc{
 			"deeph daemon stop",
 		},
 	},
+	{
+		Path:     "daemon approvals",
+		Category: "execution",
+		Summary:  "List tool calls parked by daemon runs waiting for approval",
+		Usage: []string{
+			"deeph daemon approvals [--target HOST:PORT] [--run RUN_ID]",
+		},
+		Examples: []string{
+			"deeph daemon approvals",
+		},
+		Notes: []string{
+			"Only skills with `approval: always|mutating` are gated; parked calls are denied after `--approval-timeout` of `daemon serve`.",
+		},
+	},
+	{
+		Path:     "daemon approve",
+		Category: "execution",
+		Summary:  "Approve a parked tool call",
+		Usage: []string{
+			"deeph daemon approve [--target HOST:PORT] [--reason TEXT] <approval-id>",
+		},
+		Examples: []string{
+			"deeph daemon approve ap-3",
+		},
+	},
+	{
+		Path:     "daemon deny",
+		Category: "execution",
+		Summary:  "Deny a parked tool call; the agent receives the reason as a tool error",
+		Usage: []string{
+			"deeph daemon deny [--target HOST:PORT] [--reason TEXT] <approval-id>",
+		},
+		Examples: []string{
+			`deeph daemon deny --reason "wrong branch" ap-3`,
+		},
+	},
 	{
 		Path:     "chat",
 		Category: "execution",
@@ -463,13 +518,19 @@ var docs = []Doc{
 	{
 		Path:     "skill add",
 		Category: "skills",
-		Summary:  "Install a skill template YAML into skills/",
+		Summary:  "Install a skill template YAML (or an external plugin) into skills/",
 		Usage: []string{
-			"deeph skill add [--workspace DIR] [--force] <name>",
+			"deeph skill add [--workspace DIR] [--force] [--name NAME] <name|plugin-path>",
 		},
 		Examples: []string{
 			"deeph skill add echo",
 			"deeph skill add file_read_range",
+			"deeph skill add command_exec",
+			"deeph skill add code_search",
+			"deeph skill add repo_map",
+			"deeph skill add git",
+			"deeph skill add mcp_stdio",
+			"deeph skill add ./plugins/jira",
 		},
 	},
 	{
@@ -714,6 +775,134 @@ var docs = []Doc{
 			"Reads sessions/<id>.meta.json and sessions/<id>.jsonl.",
 		},
 	},
+	{
+		Path:     "eval",
+		Category: "execution",
+		Summary:  "Score an agent spec or crew against a suite of cases and compare with a baseline",
+		Usage: []string{
+			"deeph eval [--workspace DIR] [--spec SPEC] [--case NAMES] [--record] [--baseline FILE] [--update-baseline] [--fail-under SCORE] [--json] [suite|path]...",
+		},
+		Examples: []string{
+			"deeph eval",
+			"deeph eval --update-baseline review",
+			"deeph eval --spec @reviewflow --case nil-session review",
+			"deeph eval --record review",
+			"deeph eval --json --fail-under 0.8 evals/review.yaml",
+		},
+		Notes: []string{
+			"Suites live in `evals/<name>.yaml` (`spec`, optional `pass_score`, `cases`); without arguments every suite runs.",
+			"A case has `input` and optionally `spec`, `agent` (whose output is scored; default the final stage), `workspace` (fixture dir for file tools, copied to a temp dir per run), `diff` (patch appended to the input) and `cassette` (replayed recording).",
+			"Assertions: `contains`, `not_contains`, `regex`, `mentions_file`, `severity`, `min_findings`, `max_findings`, `json_path` (a dot path such as `findings.0.severity`, + `equals`), each with an optional `weight`; severity and findings use the review findings parser.",
+			"The case score is the weighted share of passed assertions; the suite score is the mean. Scores are compared with `.deeph/evals/<suite>.baseline.json` and a lower case score is a regression (non-zero exit) unless `--update-baseline` is set.",
+			"`--record` calls providers and writes each case's cassette; later runs replay them offline. Cases without a cassette call the configured provider (the mock provider works for smoke suites).",
+		},
+	},
+	{
+		Path:     "runs list",
+		Category: "runs",
+		Summary:  "List recorded runs, diagnoses and reviews, newest first",
+		Usage: []string{
+			"deeph runs list [--workspace DIR] [--command C] [--limit N] [--json]",
+		},
+		Examples: []string{
+			"deeph runs list",
+			"deeph runs list --command diagnose --limit 5",
+		},
+		Notes: []string{
+			"`run`, `edit`, `diagnose` and `review` record plan, report, multiverse branches, judge decision, scope, timings and token usage in .deeph/runs/<run-id>.json.",
+			"Retention: `runs.keep` (default 100) and `runs.max_age_days` in deeph.yaml; `runs.disabled: true` turns recording off.",
+		},
+	},
+	{
+		Path:     "runs show",
+		Category: "runs",
+		Summary:  "Print a recorded run like it was printed when it ran",
+		Usage: []string{
+			"deeph runs show [--workspace DIR] [--json] <run-id|last>",
+		},
+		Examples: []string{
+			"deeph runs show last",
+			"deeph runs show --json 20261018-1530",
+		},
+		Notes: []string{
+			"Run ids accept a unique prefix; `last` is the newest run.",
+			"`--json` prints the full record, including the diagnose/review scope.",
+		},
+	},
+	{
+		Path:     "runs diff",
+		Category: "runs",
+		Summary:  "Compare two recorded runs agent by agent",
+		Usage: []string{
+			"deeph runs diff [--workspace DIR] <run-a> <run-b>",
+		},
+		Examples: []string{
+			"deeph runs diff 20261018-1530 last",
+		},
+		Notes: []string{
+			"Shows status, duration, context, tool call and token changes per agent plus a line diff of changed outputs.",
+		},
+	},
+	{
+		Path:     "runs rm",
+		Category: "runs",
+		Summary:  "Remove recorded runs",
+		Usage: []string{
+			"deeph runs rm [--workspace DIR] [--all] [--keep N] [--older-than DUR] [run-id]...",
+		},
+		Examples: []string{
+			"deeph runs rm last",
+			"deeph runs rm --keep 20",
+			"deeph runs rm --older-than 168h",
+		},
+	},
+	{
+		Path:     "memory add",
+		Category: "memory",
+		Summary:  "Add or replace a long-lived project fact that every run sees in context",
+		Usage: []string{
+			"deeph memory add [--workspace DIR] [--confidence F] [--evidence TEXT] <key> <value>",
+		},
+		Examples: []string{
+			`deeph memory add build.command "go build ./... && go test ./..."`,
+			`deeph memory add --evidence docs/adr/004.md arch.storage "sessions are append-only JSONL files"`,
+		},
+		Notes: []string{
+			"Entries live in .deeph/memory.json as `memory/fact` items with source, confidence and evidence.",
+			"Each run seeds the strongest 24 entries into the context bus as `memory.<key>` facts at the discovery moment.",
+			"Agents write entries with the `memory_write` skill (source `agent:<name>`); they cannot overwrite user entries.",
+		},
+	},
+	{
+		Path:     "memory list",
+		Category: "memory",
+		Summary:  "List project memory entries with source and confidence",
+		Usage: []string{
+			"deeph memory list [--workspace DIR] [--json]",
+		},
+		Examples: []string{
+			"deeph memory list",
+			"deeph memory list --json",
+		},
+	},
+	{
+		Path:     "memory rm",
+		Category: "memory",
+		Summary:  "Remove or prune project memory entries",
+		Usage: []string{
+			"deeph memory rm [--workspace DIR] [--source S] [--below F] [--older-than DUR] [key|prefix*]...",
+		},
+		Examples: []string{
+			"deeph memory rm build.command",
+			`deeph memory rm "arch.*"`,
+			"deeph memory rm --source agent --below 0.5",
+			"deeph memory rm --older-than 720h",
+		},
+		Notes: []string{
+			"Selectors combine: an entry is removed only when it matches all of them.",
+			"`--source agent` matches every agent-written entry; `--source user` only entries added by hand.",
+		},
+	},
 	{
 		Path:     "type list",
 		Category: "types",
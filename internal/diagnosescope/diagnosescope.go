@@ -11,10 +11,14 @@ import (
 	"strings"
 
 	"deeph/internal/reviewscope"
+	"deeph/internal/tokenizer"
 )
 
 type Config struct {
-	MaxInputChars      int
+	// MaxInputTokens bounds BuildInput as counted by Tokenizer (the heuristic
+	// when nil).
+	MaxInputTokens     int
+	Tokenizer          tokenizer.Tokenizer
 	MaxExcerptChars    int
 	MaxIssueChars      int
 	MaxReferencedFiles int
@@ -51,7 +55,7 @@ var fileRefPattern = regexp.MustCompile(`(?m)([A-Za-z0-9_./-]+\.(?:go|py|ts|tsx|
 
 func DefaultConfig() Config {
 	return Config{
-		MaxInputChars:      3400,
+		MaxInputTokens:     1100,
 		MaxExcerptChars:    420,
 		MaxIssueChars:      1000,
 		MaxReferencedFiles: 4,
@@ -114,26 +118,26 @@ func BuildScope(workspace, baseRef, issue string, cfg Config) (Scope, error) {
 }
 
 func BuildInput(scope Scope, issue string, cfg Config) string {
-	p := &promptBuilder{max: cfg.MaxInputChars}
-	p.addLine("[diagnose_scope]")
-	p.addLine("strategy: error_aware_workspace")
-	p.addLine("workspace: " + scope.Workspace)
+	p := &reviewscope.PromptBuilder{Tok: cfg.Tokenizer, Max: cfg.MaxInputTokens}
+	p.AddLine("[diagnose_scope]")
+	p.AddLine("strategy: error_aware_workspace")
+	p.AddLine("workspace: " + scope.Workspace)
 	if scope.BaseRef != "" {
-		p.addLine("base_ref: " + scope.BaseRef)
+		p.AddLine("base_ref: " + scope.BaseRef)
 	}
-	p.addLine(fmt.Sprintf("referenced_files: %d", scope.ReferencedFiles))
-	p.addLine(fmt.Sprintf("working_set_files: %d", len(scope.WorkingSet)))
+	p.AddLine(fmt.Sprintf("referenced_files: %d", scope.ReferencedFiles))
+	p.AddLine(fmt.Sprintf("working_set_files: %d", len(scope.WorkingSet)))
 	if len(scope.DiffFiles) > 0 {
-		p.addLine(fmt.Sprintf("diff_files: %d", len(scope.DiffFiles)))
+		p.AddLine(fmt.Sprintf("diff_files: %d", len(scope.DiffFiles)))
 	}
-	p.addLine("issue_summary: " + trimInline(scope.IssueSummary, 220))
-	p.addLine("instruction: identify the most likely root cause, affected files, minimum safe fix, and tests or validation steps. if evidence is incomplete, say what is hypothesis vs what is directly supported by the error output.")
-	p.addLine("preferred_output: root_cause, likely_files, fix_plan, validation, residual_risks.")
+	p.AddLine("issue_summary: " + trimInline(scope.IssueSummary, 220))
+	p.AddLine("instruction: identify the most likely root cause, affected files, minimum safe fix, and tests or validation steps. if evidence is incomplete, say what is hypothesis vs what is directly supported by the error output.")
+	p.AddLine("preferred_output: root_cause, likely_files, fix_plan, validation, residual_risks.")
 	if trimmedIssue := trimBlock(issue, cfg.MaxIssueChars); trimmedIssue != "" {
-		_ = p.addBlock("[issue]", trimmedIssue)
+		_ = p.AddBlock("[issue]", trimmedIssue)
 	}
 	if len(scope.References) > 0 {
-		p.addLine("references:")
+		p.AddLine("references:")
 		for _, ref := range scope.References {
 			line := "- " + ref.Path
 			if ref.Line > 0 {
@@ -142,15 +146,15 @@ func BuildInput(scope Scope, issue string, cfg Config) string {
 			if strings.TrimSpace(ref.Source) != "" {
 				line += " source=" + ref.Source
 			}
-			if !p.addLine(line) {
+			if !p.AddLine(line) {
 				break
 			}
 		}
 	}
 	if len(scope.WorkingSet) > 0 {
-		p.addLine("working_set:")
+		p.AddLine("working_set:")
 		for _, file := range scope.WorkingSet {
-			if !p.addLine(fmt.Sprintf("- %s reason=%s", file.Path, file.Reason)) {
+			if !p.AddLine(fmt.Sprintf("- %s reason=%s", file.Path, file.Reason)) {
 				break
 			}
 		}
@@ -160,7 +164,7 @@ func BuildInput(scope Scope, issue string, cfg Config) string {
 		if strings.TrimSpace(excerpt) == "" {
 			continue
 		}
-		if !p.addBlock(fmt.Sprintf("[excerpt %s]", ref.Path), excerpt) {
+		if !p.AddBlock(fmt.Sprintf("[excerpt %s]", ref.Path), excerpt) {
 			break
 		}
 	}
@@ -172,17 +176,13 @@ func BuildInput(scope Scope, issue string, cfg Config) string {
 		if strings.TrimSpace(excerpt) == "" {
 			continue
 		}
-		if !p.addBlock(fmt.Sprintf("[excerpt %s]", file.Path), excerpt) {
+		if !p.AddBlock(fmt.Sprintf("[excerpt %s]", file.Path), excerpt) {
 			break
 		}
 	}
 	return strings.TrimSpace(p.String())
 }
 
-func EstimateTokens(text string) int {
-	return reviewscope.EstimateTokens(text)
-}
-
 func extractReferences(workspace, issue string, limit int) []Reference {
 	matches := fileRefPattern.FindAllStringSubmatch(issue, -1)
 	if len(matches) == 0 {
@@ -412,46 +412,6 @@ func mergeReasons(existing, incoming string) string {
 	return existing + ", " + incoming
 }
 
-type promptBuilder struct {
-	max int
-	b   strings.Builder
-}
-
-func (p *promptBuilder) addLine(line string) bool {
-	line = strings.TrimRight(line, "\n")
-	if p.max > 0 && p.b.Len()+len(line)+1 > p.max {
-		return false
-	}
-	p.b.WriteString(line)
-	p.b.WriteByte('\n')
-	return true
-}
-
-func (p *promptBuilder) addBlock(header, body string) bool {
-	header = strings.TrimSpace(header)
-	body = strings.TrimSpace(body)
-	if header == "" || body == "" {
-		return true
-	}
-	remaining := p.max - p.b.Len()
-	overhead := len(header) + len("\n```text\n\n```\n")
-	if p.max > 0 && remaining <= overhead+16 {
-		return false
-	}
-	if p.max > 0 && len(body) > remaining-overhead {
-		body = strings.TrimSpace(body[:remaining-overhead-3]) + "..."
-	}
-	p.b.WriteString(header)
-	p.b.WriteString("\n```text\n")
-	p.b.WriteString(body)
-	p.b.WriteString("\n```\n")
-	return true
-}
-
-func (p *promptBuilder) String() string {
-	return p.b.String()
-}
-
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -0,0 +1,455 @@
+package evalsuite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"deeph/internal/jsonpath"
+	"deeph/internal/reviewfindings"
+)
+
+// Suite is an evaluation suite file (evals/<name>.yaml): an agent spec or
+// crew and the cases it must pass.
+type Suite struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Spec is the default agent spec or @crew for cases without their own.
+	Spec string `yaml:"spec" json:"spec"`
+	// PassScore is the case score needed to pass (default 1: every assertion).
+	PassScore float64 `yaml:"pass_score,omitempty" json:"pass_score,omitempty"`
+	Cases     []Case  `yaml:"cases" json:"cases"`
+	// Path is the suite file; relative case paths resolve against its directory.
+	Path string `yaml:"-" json:"path"`
+}
+
+type Case struct {
+	Name  string `yaml:"name" json:"name"`
+	Spec  string `yaml:"spec,omitempty" json:"spec,omitempty"`
+	Input string `yaml:"input" json:"input"`
+	// Workspace is a fixture directory the agents see instead of the project
+	// workspace; each run works on a temporary copy.
+	Workspace string `yaml:"workspace,omitempty" json:"workspace,omitempty"`
+	// Diff is a patch file appended to the input as a ```diff block.
+	Diff string `yaml:"diff,omitempty" json:"diff,omitempty"`
+	// Cassette is a recorded run replayed instead of calling providers.
+	Cassette string `yaml:"cassette,omitempty" json:"cassette,omitempty"`
+	// Agent selects whose output is scored; default is the final stage.
+	Agent  string      `yaml:"agent,omitempty" json:"agent,omitempty"`
+	Assert []Assertion `yaml:"assert" json:"assert"`
+}
+
+// Assertion is one check on a case output. Exactly one check is set;
+// Equals applies to JSONPath.
+type Assertion struct {
+	Contains     string  `yaml:"contains,omitempty" json:"contains,omitempty"`
+	NotContains  string  `yaml:"not_contains,omitempty" json:"not_contains,omitempty"`
+	Regex        string  `yaml:"regex,omitempty" json:"regex,omitempty"`
+	MentionsFile string  `yaml:"mentions_file,omitempty" json:"mentions_file,omitempty"`
+	Severity     string  `yaml:"severity,omitempty" json:"severity,omitempty"`
+	MinFindings  *int    `yaml:"min_findings,omitempty" json:"min_findings,omitempty"`
+	MaxFindings  *int    `yaml:"max_findings,omitempty" json:"max_findings,omitempty"`
+	JSONPath     string  `yaml:"json_path,omitempty" json:"json_path,omitempty"`
+	Equals       any     `yaml:"equals,omitempty" json:"equals,omitempty"`
+	Weight       float64 `yaml:"weight,omitempty" json:"weight,omitempty"`
+}
+
+// Load reads and validates a suite file.
+func Load(path string) (Suite, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Suite{}, err
+	}
+	var s Suite
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		return Suite{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	s.Path = path
+	if strings.TrimSpace(s.Name) == "" {
+		s.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := s.validate(); err != nil {
+		return Suite{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s Suite) validate() error {
+	if len(s.Cases) == 0 {
+		return errors.New("suite has no cases")
+	}
+	if s.PassScore < 0 || s.PassScore > 1 {
+		return fmt.Errorf("pass_score must be within 0..1, got %v", s.PassScore)
+	}
+	seen := map[string]bool{}
+	for i, c := range s.Cases {
+		name := strings.TrimSpace(c.Name)
+		if name == "" {
+			return fmt.Errorf("cases[%d].name is required", i)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate case %q", name)
+		}
+		seen[name] = true
+		if strings.TrimSpace(coalesce(c.Spec, s.Spec)) == "" {
+			return fmt.Errorf("case %q has no spec (set spec on the suite or the case)", name)
+		}
+		if len(c.Assert) == 0 {
+			return fmt.Errorf("case %q has no assertions", name)
+		}
+		for j, a := range c.Assert {
+			if err := a.validate(); err != nil {
+				return fmt.Errorf("case %q assert[%d]: %w", name, j, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (a Assertion) validate() error {
+	set := 0
+	for _, v := range []bool{a.Contains != "", a.NotContains != "", a.Regex != "", a.MentionsFile != "", a.Severity != "", a.MinFindings != nil, a.MaxFindings != nil, a.JSONPath != ""} {
+		if v {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("expected exactly one of contains, not_contains, regex, mentions_file, severity, min_findings, max_findings, json_path (got %d)", set)
+	}
+	if a.Equals != nil && a.JSONPath == "" {
+		return errors.New("equals requires json_path")
+	}
+	if a.Weight < 0 {
+		return errors.New("weight must be >= 0")
+	}
+	if a.Regex != "" {
+		if _, err := regexp.Compile(a.Regex); err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+	}
+	if a.JSONPath != "" {
+		if err := jsonpath.Check(a.JSONPath); err != nil {
+			return fmt.Errorf("invalid json_path: %w", err)
+		}
+	}
+	return nil
+}
+
+// SpecFor returns the case spec, defaulting to the suite spec.
+func (s Suite) SpecFor(c Case) string {
+	return strings.TrimSpace(coalesce(c.Spec, s.Spec))
+}
+
+// Resolve makes a case-relative path absolute against the suite directory.
+func (s Suite) Resolve(p string) string {
+	p = strings.TrimSpace(p)
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(filepath.Dir(s.Path), p)
+}
+
+// AssertionResult is the outcome of one assertion.
+type AssertionResult struct {
+	Check  string  `json:"check"`
+	Passed bool    `json:"passed"`
+	Weight float64 `json:"weight"`
+	Detail string  `json:"detail,omitempty"`
+}
+
+// CaseResult is a scored case.
+type CaseResult struct {
+	Name       string            `json:"name"`
+	Spec       string            `json:"spec"`
+	Score      float64           `json:"score"`
+	Passed     bool              `json:"passed"`
+	Error      string            `json:"error,omitempty"`
+	DurationMS int64             `json:"duration_ms"`
+	Tokens     int               `json:"tokens,omitempty"`
+	Assertions []AssertionResult `json:"assertions"`
+	// Baseline comparison, when a baseline exists for the case.
+	BaselineScore *float64 `json:"baseline_score,omitempty"`
+	Regressed     bool     `json:"regressed,omitempty"`
+}
+
+// ScoreCase checks output against every assertion of c. The score is the
+// weighted share of passed assertions; a run error scores 0.
+func ScoreCase(s Suite, c Case, output string, runErr error) CaseResult {
+	res := CaseResult{Name: c.Name, Spec: s.SpecFor(c)}
+	if runErr != nil {
+		res.Error = runErr.Error()
+	}
+	findings, _ := reviewfindings.Parse(output)
+	var total, passed float64
+	for _, a := range c.Assert {
+		r := Check(a, output, findings)
+		if runErr != nil {
+			r.Passed, r.Detail = false, "run failed"
+		}
+		total += r.Weight
+		if r.Passed {
+			passed += r.Weight
+		}
+		res.Assertions = append(res.Assertions, r)
+	}
+	if total > 0 {
+		res.Score = round2(passed / total)
+	}
+	pass := s.PassScore
+	if pass == 0 {
+		pass = 1
+	}
+	res.Passed = runErr == nil && res.Score >= pass
+	return res
+}
+
+// Check evaluates one assertion. findings is the parsed review report of
+// output, if any.
+func Check(a Assertion, output string, findings *reviewfindings.Report) AssertionResult {
+	r := AssertionResult{Weight: a.Weight}
+	if r.Weight == 0 {
+		r.Weight = 1
+	}
+	lower := strings.ToLower(output)
+	switch {
+	case a.Contains != "":
+		r.Check = fmt.Sprintf("contains %q", a.Contains)
+		r.Passed = strings.Contains(lower, strings.ToLower(a.Contains))
+	case a.NotContains != "":
+		r.Check = fmt.Sprintf("not_contains %q", a.NotContains)
+		r.Passed = !strings.Contains(lower, strings.ToLower(a.NotContains))
+	case a.Regex != "":
+		r.Check = fmt.Sprintf("regex %s", a.Regex)
+		re, err := regexp.Compile(a.Regex)
+		if err != nil {
+			r.Detail = err.Error()
+			return r
+		}
+		r.Passed = re.MatchString(output)
+	case a.MentionsFile != "":
+		r.Check = fmt.Sprintf("mentions_file %s", a.MentionsFile)
+		want := filepath.ToSlash(strings.TrimSpace(a.MentionsFile))
+		r.Passed = strings.Contains(output, want)
+		for _, f := range findingsOf(findings) {
+			r.Passed = r.Passed || strings.HasPrefix(filepath.ToSlash(f.File), want)
+		}
+	case a.Severity != "":
+		r.Check = fmt.Sprintf("severity %s", a.Severity)
+		want := normalizeSeverity(a.Severity)
+		var got []string
+		for _, f := range findingsOf(findings) {
+			got = append(got, normalizeSeverity(f.Severity))
+			r.Passed = r.Passed || normalizeSeverity(f.Severity) == want
+		}
+		switch {
+		case r.Passed:
+		case len(got) == 0:
+			r.Detail = "no findings parsed"
+		default:
+			r.Detail = "severities: " + strings.Join(got, ",")
+		}
+	case a.MinFindings != nil || a.MaxFindings != nil:
+		n := len(findingsOf(findings))
+		if a.MinFindings != nil {
+			r.Check = fmt.Sprintf("min_findings %d", *a.MinFindings)
+			r.Passed = n >= *a.MinFindings
+		} else {
+			r.Check = fmt.Sprintf("max_findings %d", *a.MaxFindings)
+			r.Passed = n <= *a.MaxFindings
+		}
+		if !r.Passed {
+			r.Detail = fmt.Sprintf("found %d", n)
+		}
+	case a.JSONPath != "":
+		r.Check = "json_path " + a.JSONPath
+		if a.Equals != nil {
+			r.Check += fmt.Sprintf(" == %v", a.Equals)
+		}
+		_, doc, err := jsonpath.Extract(output)
+		if err != nil {
+			r.Detail = err.Error()
+			return r
+		}
+		v, ok := jsonpath.Lookup(doc, a.JSONPath)
+		if !ok {
+			r.Detail = "not found"
+			return r
+		}
+		r.Passed = a.Equals == nil || jsonEqual(v, a.Equals)
+		if !r.Passed {
+			r.Detail = fmt.Sprintf("got %v", v)
+		}
+	}
+	return r
+}
+
+func findingsOf(r *reviewfindings.Report) []reviewfindings.Finding {
+	if r == nil {
+		return nil
+	}
+	return r.Findings
+}
+
+// normalizeSeverity maps p0..p3 onto critical/high/medium/low.
+func normalizeSeverity(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "p0":
+		return "critical"
+	case "p1":
+		return "high"
+	case "p2":
+		return "medium"
+	case "p3":
+		return "low"
+	}
+	return s
+}
+
+// jsonEqual compares a decoded JSON value with a YAML-decoded expectation;
+// numbers compare by value.
+func jsonEqual(got, want any) bool {
+	if g, ok := toFloat(got); ok {
+		w, ok := toFloat(want)
+		return ok && g == w
+	}
+	if gs, ok := got.(string); ok {
+		ws, ok := want.(string)
+		return ok && gs == ws
+	}
+	gb, err1 := json.Marshal(got)
+	wb, err2 := json.Marshal(want)
+	if err1 != nil || err2 != nil {
+		return reflect.DeepEqual(got, want)
+	}
+	return string(gb) == string(wb)
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// Baseline is the stored score of every case of a suite.
+type Baseline struct {
+	Suite     string             `json:"suite"`
+	UpdatedAt time.Time          `json:"updated_at"`
+	Score     float64            `json:"score"`
+	Cases     map[string]float64 `json:"cases"`
+}
+
+// BaselinePath is where a suite's baseline lives in a workspace.
+func BaselinePath(workspace, suite string) string {
+	return filepath.Join(workspace, ".deeph", "evals", suite+".baseline.json")
+}
+
+// LoadBaseline reads a baseline; a missing file is not an error.
+func LoadBaseline(path string) (*Baseline, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var bl Baseline
+	if err := json.Unmarshal(b, &bl); err != nil {
+		return nil, fmt.Errorf("parse baseline %s: %w", path, err)
+	}
+	return &bl, nil
+}
+
+func SaveBaseline(path string, bl Baseline) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(bl, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// NewBaseline captures results as a baseline. Cases of prev that did not
+// run this time (a --case subset) keep their stored scores.
+func NewBaseline(suite string, results []CaseResult, prev *Baseline, now time.Time) Baseline {
+	bl := Baseline{Suite: suite, UpdatedAt: now.UTC(), Cases: map[string]float64{}}
+	if prev != nil {
+		for name, score := range prev.Cases {
+			bl.Cases[name] = score
+		}
+	}
+	for _, r := range results {
+		bl.Cases[r.Name] = r.Score
+	}
+	sum := 0.0
+	for _, score := range bl.Cases {
+		sum += score
+	}
+	if len(bl.Cases) > 0 {
+		bl.Score = round2(sum / float64(len(bl.Cases)))
+	}
+	return bl
+}
+
+// Compare annotates results with their baseline scores and returns how many
+// regressed (scored lower than the baseline).
+func Compare(results []CaseResult, bl *Baseline) int {
+	if bl == nil {
+		return 0
+	}
+	regressions := 0
+	for i := range results {
+		base, ok := bl.Cases[results[i].Name]
+		if !ok {
+			continue
+		}
+		results[i].BaselineScore = &base
+		if results[i].Score < base-1e-9 {
+			results[i].Regressed = true
+			regressions++
+		}
+	}
+	return regressions
+}
+
+// MeanScore is the suite score: the mean case score.
+func MeanScore(results []CaseResult) float64 {
+	if len(results) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, r := range results {
+		sum += r.Score
+	}
+	return round2(sum / float64(len(results)))
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func coalesce(vals ...string) string {
+	for _, v := range vals {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package evalsuite
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestScoreCaseAssertions(t *testing.T) {
+	output := "## Findings\n- [high] auth/session.go:88: nil session dereference\n- [p2] auth/login.go: missing rate limit\n"
+	s := Suite{Spec: "reviewer", PassScore: 0.7}
+	c := Case{Name: "session", Assert: []Assertion{
+		{MentionsFile: "auth/session.go"},
+		{Severity: "high"},
+		{Severity: "medium"},
+		{MinFindings: intPtr(2)},
+		{Contains: "NIL SESSION"},
+		{NotContains: "LGTM"},
+		{Regex: `rate\s+limit`},
+		{Severity: "critical", Weight: 3},
+	}}
+	res := ScoreCase(s, c, output, nil)
+	if len(res.Assertions) != 8 {
+		t.Fatalf("assertions=%d", len(res.Assertions))
+	}
+	for i, r := range res.Assertions[:7] {
+		if !r.Passed {
+			t.Fatalf("assertion %d (%s) failed: %s", i, r.Check, r.Detail)
+		}
+	}
+	if res.Assertions[7].Passed || res.Score != 0.7 || !res.Passed {
+		t.Fatalf("unexpected score: %+v", res)
+	}
+
+	failed := ScoreCase(s, c, output, errors.New("provider down"))
+	if failed.Passed || failed.Score != 0 || failed.Error == "" {
+		t.Fatalf("expected run error to fail the case, got %+v", failed)
+	}
+}
+
+func TestJSONPathAssertion(t *testing.T) {
+	output := "Result:\n```json\n{\"findings\":[{\"severity\":\"high\",\"line\":42}],\"summary\":\"ok\"}\n```"
+	for _, tc := range []struct {
+		a    Assertion
+		want bool
+	}{
+		{Assertion{JSONPath: "findings.0.severity", Equals: "high"}, true},
+		{Assertion{JSONPath: "findings.0.line", Equals: 42}, true},
+		{Assertion{JSONPath: "summary"}, true},
+		{Assertion{JSONPath: "findings.1.severity"}, false},
+		{Assertion{JSONPath: "findings.0.severity", Equals: "low"}, false},
+	} {
+		if got := Check(tc.a, output, nil).Passed; got != tc.want {
+			t.Fatalf("%s: got %v want %v", tc.a.JSONPath, got, tc.want)
+		}
+	}
+}
+
+func TestLoadValidatesSuiteAndBaselineCompare(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bad.yaml")
+	if err := os.WriteFile(path, []byte("spec: guide\ncases:\n  - name: a\n    input: x\n    assert:\n      - contains: x\n        regex: y\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatalf("expected error for assertion with two checks")
+	}
+
+	results := []CaseResult{{Name: "a", Score: 0.5}, {Name: "b", Score: 1}, {Name: "new", Score: 0}}
+	bl := &Baseline{Cases: map[string]float64{"a": 1, "b": 1}}
+	if n := Compare(results, bl); n != 1 || !results[0].Regressed || results[1].Regressed || results[2].BaselineScore != nil {
+		t.Fatalf("unexpected compare: n=%d %+v", n, results)
+	}
+	if got := MeanScore(results); got != 0.5 {
+		t.Fatalf("mean=%v", got)
+	}
+}
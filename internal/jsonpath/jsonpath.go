@@ -0,0 +1,92 @@
+// Package jsonpath reads JSON out of agent output and resolves dot paths such
+// as findings.0.severity in it. Routes, maps, loops, output contracts and eval
+// assertions share it, so a path means the same thing everywhere.
+package jsonpath
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Extract parses output as JSON, or else the first fenced block or the
+// outermost embedded object/array in it. It returns the JSON text it used and
+// the decoded value.
+func Extract(output string) (string, any, error) {
+	s := strings.TrimSpace(output)
+	var value any
+	if err := json.Unmarshal([]byte(s), &value); err == nil {
+		return s, value, nil
+	}
+	if i := strings.Index(s, "```"); i >= 0 {
+		body := s[i+3:]
+		if nl := strings.IndexByte(body, '\n'); nl >= 0 {
+			body = body[nl+1:]
+		}
+		if end := strings.Index(body, "```"); end >= 0 {
+			body = body[:end]
+		}
+		body = strings.TrimSpace(body)
+		if err := json.Unmarshal([]byte(body), &value); err == nil {
+			return body, value, nil
+		}
+	}
+	if start := strings.IndexAny(s, "{["); start >= 0 {
+		closer := "}"
+		if s[start] == '[' {
+			closer = "]"
+		}
+		if end := strings.LastIndex(s, closer); end > start {
+			candidate := s[start : end+1]
+			if err := json.Unmarshal([]byte(candidate), &value); err == nil {
+				return candidate, value, nil
+			}
+		}
+	}
+	if s == "" {
+		return "", nil, errors.New("output is empty; expected JSON")
+	}
+	return "", nil, errors.New("output is not valid JSON")
+}
+
+// Check reports whether path is a well-formed dot path: non-empty segments
+// separated by dots, where a segment indexes an array when it is a number.
+func Check(path string) error {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return errors.New("path is empty")
+	}
+	for _, part := range strings.Split(path, ".") {
+		if part == "" {
+			return fmt.Errorf("path %q has an empty segment", path)
+		}
+	}
+	return nil
+}
+
+// Lookup resolves path in a decoded JSON value. Object segments are keys and
+// array segments are zero-based indexes: findings.0.severity.
+func Lookup(value any, path string) (any, bool) {
+	cur := value
+	for _, part := range strings.Split(strings.TrimSpace(path), ".") {
+		switch x := cur.(type) {
+		case map[string]any:
+			v, ok := x[part]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(x) {
+				return nil, false
+			}
+			cur = x[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
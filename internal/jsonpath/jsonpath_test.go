@@ -0,0 +1,50 @@
+package jsonpath
+
+import "testing"
+
+func TestExtractFindsWholeFencedAndEmbeddedJSON(t *testing.T) {
+	for _, output := range []string{
+		`{"ok":true}`,
+		"Here you go:\n```json\n{\"ok\":true}\n```\nthanks",
+		`Result: {"ok":true} (done)`,
+	} {
+		raw, v, err := Extract(output)
+		if err != nil {
+			t.Fatalf("Extract(%q): %v", output, err)
+		}
+		if m, ok := v.(map[string]any); !ok || m["ok"] != true || raw != `{"ok":true}` {
+			t.Fatalf("Extract(%q) = %q, %v", output, raw, v)
+		}
+	}
+	if _, _, err := Extract("no json here"); err == nil {
+		t.Fatal("expected an error for output without JSON")
+	}
+}
+
+func TestLookupDotPath(t *testing.T) {
+	_, doc, err := Extract(`{"summary":"ok","findings":[{"severity":"high","line":42}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		path string
+		want any
+		ok   bool
+	}{
+		{"findings.0.severity", "high", true},
+		{"findings.0.line", float64(42), true},
+		{"summary", "ok", true},
+		{"findings.1.severity", nil, false},
+		{"findings.x", nil, false},
+		{"summary.text", nil, false},
+	}
+	for _, tc := range cases {
+		got, ok := Lookup(doc, tc.path)
+		if ok != tc.ok || got != tc.want {
+			t.Fatalf("Lookup(%q) = %v, %v; want %v, %v", tc.path, got, ok, tc.want, tc.ok)
+		}
+	}
+	if err := Check("findings..severity"); err == nil {
+		t.Fatal("expected an empty segment to be rejected")
+	}
+}
@@ -0,0 +1,444 @@
+// Package jsonschema implements the subset of JSON Schema that deeph uses for
+// skill argument schemas: type, properties, required, additionalProperties,
+// items, enum, const, string/number/array bounds and pattern. Annotation
+// keywords (description, title, default, examples, format) are accepted and
+// ignored; composition keywords are rejected by Check so a schema never
+// silently promises more than Validate enforces.
+package jsonschema
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var validTypes = map[string]struct{}{
+	"object":  {},
+	"array":   {},
+	"string":  {},
+	"number":  {},
+	"integer": {},
+	"boolean": {},
+	"null":    {},
+}
+
+var annotationKeywords = map[string]struct{}{
+	"$schema":     {},
+	"$id":         {},
+	"$comment":    {},
+	"title":       {},
+	"description": {},
+	"default":     {},
+	"examples":    {},
+	"format":      {},
+	"deprecated":  {},
+	"readOnly":    {},
+	"writeOnly":   {},
+}
+
+var validationKeywords = map[string]struct{}{
+	"type":                 {},
+	"properties":           {},
+	"required":             {},
+	"additionalProperties": {},
+	"items":                {},
+	"enum":                 {},
+	"const":                {},
+	"minimum":              {},
+	"maximum":              {},
+	"exclusiveMinimum":     {},
+	"exclusiveMaximum":     {},
+	"minLength":            {},
+	"maxLength":            {},
+	"pattern":              {},
+	"minItems":             {},
+	"maxItems":             {},
+	"minProperties":        {},
+	"maxProperties":        {},
+}
+
+// Violation is one reason a value does not satisfy a schema. Path is a
+// JSON-pointer-like location ("" for the root, "/items/0/name" below it).
+type Violation struct {
+	Path    string
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Path == "" {
+		return v.Message
+	}
+	return v.Path + ": " + v.Message
+}
+
+// Check reports problems with the schema itself, keyed by schema location.
+func Check(schema map[string]any) []Violation {
+	var out []Violation
+	checkSchema(schema, "", &out)
+	return out
+}
+
+func checkSchema(schema map[string]any, path string, out *[]Violation) {
+	add := func(field, msg string) {
+		*out = append(*out, Violation{Path: path + "/" + field, Message: msg})
+	}
+	keys := make([]string, 0, len(schema))
+	for k := range schema {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := schema[k]
+		if _, ok := annotationKeywords[k]; ok {
+			continue
+		}
+		if _, ok := validationKeywords[k]; !ok {
+			add(k, "unsupported keyword")
+			continue
+		}
+		switch k {
+		case "type":
+			types, ok := typeList(v)
+			if !ok || len(types) == 0 {
+				add(k, "must be a type name or a list of type names")
+				continue
+			}
+			for _, t := range types {
+				if _, ok := validTypes[t]; !ok {
+					add(k, fmt.Sprintf("unknown type %q", t))
+				}
+			}
+		case "properties":
+			props, ok := v.(map[string]any)
+			if !ok {
+				add(k, "must be an object")
+				continue
+			}
+			names := make([]string, 0, len(props))
+			for name := range props {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				sub, ok := props[name].(map[string]any)
+				if !ok {
+					add(k+"/"+name, "must be a schema object")
+					continue
+				}
+				checkSchema(sub, path+"/properties/"+name, out)
+			}
+		case "required":
+			if _, ok := stringList(v); !ok {
+				add(k, "must be a list of property names")
+			}
+		case "additionalProperties":
+			switch x := v.(type) {
+			case bool:
+			case map[string]any:
+				checkSchema(x, path+"/additionalProperties", out)
+			default:
+				add(k, "must be a boolean or a schema object")
+			}
+		case "items":
+			sub, ok := v.(map[string]any)
+			if !ok {
+				add(k, "must be a schema object")
+				continue
+			}
+			checkSchema(sub, path+"/items", out)
+		case "enum":
+			if list, ok := v.([]any); !ok || len(list) == 0 {
+				add(k, "must be a non-empty list")
+			}
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum":
+			if _, ok := number(v); !ok {
+				add(k, "must be a number")
+			}
+		case "minLength", "maxLength", "minItems", "maxItems", "minProperties", "maxProperties":
+			if n, ok := number(v); !ok || n < 0 || n != math.Trunc(n) {
+				add(k, "must be a non-negative integer")
+			}
+		case "pattern":
+			s, ok := v.(string)
+			if !ok {
+				add(k, "must be a string")
+				continue
+			}
+			if _, err := regexp.Compile(s); err != nil {
+				add(k, "invalid regular expression: "+err.Error())
+			}
+		}
+	}
+}
+
+// Validate reports every way value fails to satisfy schema. The schema is
+// assumed to have passed Check; malformed keywords are skipped.
+func Validate(schema map[string]any, value any) []Violation {
+	var out []Violation
+	validate(schema, value, "", &out)
+	return out
+}
+
+func validate(schema map[string]any, value any, path string, out *[]Violation) {
+	add := func(msg string) {
+		*out = append(*out, Violation{Path: path, Message: msg})
+	}
+	if raw, ok := schema["type"]; ok {
+		if types, ok := typeList(raw); ok && len(types) > 0 && !matchesAnyType(types, value) {
+			add(fmt.Sprintf("expected %s, got %s", strings.Join(types, " or "), typeName(value)))
+			return
+		}
+	}
+	if raw, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, candidate := range raw {
+			if equal(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add(fmt.Sprintf("must be one of %s", describeValues(raw)))
+		}
+	}
+	if c, ok := schema["const"]; ok && !equal(c, value) {
+		add(fmt.Sprintf("must equal %s", describeValues([]any{c})))
+	}
+
+	switch x := value.(type) {
+	case string:
+		length := float64(len([]rune(x)))
+		if n, ok := number(schema["minLength"]); ok && length < n {
+			add(fmt.Sprintf("must be at least %d characters", int(n)))
+		}
+		if n, ok := number(schema["maxLength"]); ok && length > n {
+			add(fmt.Sprintf("must be at most %d characters", int(n)))
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err == nil && !re.MatchString(x) {
+				add(fmt.Sprintf("must match pattern %q", p))
+			}
+		}
+	case []any:
+		if n, ok := number(schema["minItems"]); ok && float64(len(x)) < n {
+			add(fmt.Sprintf("must have at least %d items", int(n)))
+		}
+		if n, ok := number(schema["maxItems"]); ok && float64(len(x)) > n {
+			add(fmt.Sprintf("must have at most %d items", int(n)))
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range x {
+				validate(items, item, fmt.Sprintf("%s/%d", path, i), out)
+			}
+		}
+	case map[string]any:
+		validateObject(schema, x, path, out)
+	default:
+		if n, ok := number(value); ok {
+			if min, ok := number(schema["minimum"]); ok && n < min {
+				add(fmt.Sprintf("must be >= %v", min))
+			}
+			if max, ok := number(schema["maximum"]); ok && n > max {
+				add(fmt.Sprintf("must be <= %v", max))
+			}
+			if min, ok := number(schema["exclusiveMinimum"]); ok && n <= min {
+				add(fmt.Sprintf("must be > %v", min))
+			}
+			if max, ok := number(schema["exclusiveMaximum"]); ok && n >= max {
+				add(fmt.Sprintf("must be < %v", max))
+			}
+		}
+	}
+}
+
+func validateObject(schema map[string]any, obj map[string]any, path string, out *[]Violation) {
+	if n, ok := number(schema["minProperties"]); ok && float64(len(obj)) < n {
+		*out = append(*out, Violation{Path: path, Message: fmt.Sprintf("must have at least %d properties", int(n))})
+	}
+	if n, ok := number(schema["maxProperties"]); ok && float64(len(obj)) > n {
+		*out = append(*out, Violation{Path: path, Message: fmt.Sprintf("must have at most %d properties", int(n))})
+	}
+	required, _ := stringList(schema["required"])
+	for _, name := range required {
+		if _, ok := obj[name]; !ok {
+			*out = append(*out, Violation{Path: path + "/" + name, Message: "is required"})
+		}
+	}
+	props, _ := schema["properties"].(map[string]any)
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if sub, ok := props[k].(map[string]any); ok {
+			validate(sub, obj[k], path+"/"+k, out)
+			continue
+		}
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				*out = append(*out, Violation{Path: path + "/" + k, Message: "is not an allowed property"})
+			}
+		case map[string]any:
+			validate(extra, obj[k], path+"/"+k, out)
+		}
+	}
+}
+
+// ApplyDefaults returns a copy of obj with top-level property defaults filled
+// in for keys the caller did not supply.
+func ApplyDefaults(schema map[string]any, obj map[string]any) map[string]any {
+	props, _ := schema["properties"].(map[string]any)
+	out := make(map[string]any, len(obj)+len(props))
+	for k, v := range obj {
+		out[k] = v
+	}
+	for name, raw := range props {
+		sub, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		if def, ok := sub["default"]; ok {
+			if _, present := out[name]; !present {
+				out[name] = def
+			}
+		}
+	}
+	return out
+}
+
+// Properties returns the names declared under the schema's top-level properties.
+func Properties(schema map[string]any) []string {
+	props, _ := schema["properties"].(map[string]any)
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func typeList(v any) ([]string, bool) {
+	if s, ok := v.(string); ok {
+		return []string{s}, true
+	}
+	return stringList(v)
+}
+
+func stringList(v any) ([]string, bool) {
+	switch x := v.(type) {
+	case []string:
+		return x, true
+	case []any:
+		out := make([]string, 0, len(x))
+		for _, item := range x {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			out = append(out, s)
+		}
+		return out, true
+	default:
+		return nil, false
+	}
+}
+
+// number accepts every numeric type YAML and JSON decoding can produce.
+func number(v any) (float64, bool) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	default:
+		return 0, false
+	}
+}
+
+func matchesAnyType(types []string, value any) bool {
+	for _, t := range types {
+		if matchesType(t, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesType(t string, value any) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := number(value)
+		return ok
+	case "integer":
+		n, ok := number(value)
+		return ok && n == math.Trunc(n) && !math.IsInf(n, 0)
+	default:
+		return false
+	}
+}
+
+func typeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	if _, ok := number(value); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func equal(a, b any) bool {
+	if na, ok := number(a); ok {
+		nb, ok := number(b)
+		return ok && na == nb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func describeValues(values []any) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			parts = append(parts, fmt.Sprintf("%q", s))
+			continue
+		}
+		parts = append(parts, fmt.Sprint(v))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,83 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func mustDecode(t *testing.T, raw string) map[string]any {
+	t.Helper()
+	var out map[string]any
+	if err := json.Unmarshal([]byte(raw), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return out
+}
+
+func TestCheckRejectsUnsupportedAndMalformedKeywords(t *testing.T) {
+	schema := mustDecode(t, `{
+		"type": "object",
+		"description": "ok",
+		"properties": {
+			"a": {"type": "strng"},
+			"b": {"oneOf": [{"type": "string"}]},
+			"c": {"type": "string", "pattern": "("}
+		},
+		"required": "a"
+	}`)
+	got := []string{}
+	for _, v := range Check(schema) {
+		got = append(got, v.String())
+	}
+	joined := strings.Join(got, "\n")
+	for _, want := range []string{
+		`/properties/a/type: unknown type "strng"`,
+		"/properties/b/oneOf: unsupported keyword",
+		"/properties/c/pattern: invalid regular expression",
+		"/required: must be a list of property names",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("expected %q in:\n%s", want, joined)
+		}
+	}
+}
+
+func TestValidateReportsViolations(t *testing.T) {
+	schema := mustDecode(t, `{
+		"type": "object",
+		"properties": {
+			"repo": {"type": "string", "pattern": "^[a-z]+/[a-z]+$"},
+			"state": {"type": "string", "enum": ["open", "closed"], "default": "open"},
+			"limit": {"type": "integer", "minimum": 1, "maximum": 50},
+			"labels": {"type": "array", "items": {"type": "string"}, "maxItems": 2}
+		},
+		"required": ["repo"],
+		"additionalProperties": false
+	}`)
+	if v := Validate(schema, mustDecode(t, `{"repo":"a/b","limit":10,"labels":["x"]}`)); len(v) != 0 {
+		t.Fatalf("expected valid args, got %v", v)
+	}
+	got := Validate(schema, mustDecode(t, `{"state":"merged","limit":2.5,"labels":["x",1,"z"],"extra":true}`))
+	joined := ""
+	for _, v := range got {
+		joined += v.String() + "\n"
+	}
+	for _, want := range []string{
+		"/repo: is required",
+		`/state: must be one of "open", "closed"`,
+		"/limit: expected integer, got number",
+		"/labels: must have at most 2 items",
+		"/labels/1: expected string, got number",
+		"/extra: is not an allowed property",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("expected %q in:\n%s", want, joined)
+		}
+	}
+
+	withDefaults := ApplyDefaults(schema, map[string]any{"repo": "a/b"})
+	if withDefaults["state"] != "open" {
+		t.Fatalf("expected default to be applied, got %#v", withDefaults)
+	}
+}
@@ -35,13 +35,19 @@ func Load(workspace string) (*Project, error) {
 	if err != nil {
 		return nil, err
 	}
+	profiles, profileFiles, err := loadDir[ContextProfileConfig](filepath.Join(workspace, "profiles"))
+	if err != nil {
+		return nil, err
+	}
 
 	return &Project{
-		Root:       root,
-		Agents:     agents,
-		Skills:     skills,
-		AgentFiles: agentFiles,
-		SkillFiles: skillFiles,
+		Root:         root,
+		Agents:       agents,
+		Skills:       skills,
+		AgentFiles:   agentFiles,
+		SkillFiles:   skillFiles,
+		Profiles:     profiles,
+		ProfileFiles: profileFiles,
 	}, nil
 }
 
@@ -87,5 +93,6 @@ func loadDir[T any](dir string) ([]T, map[string]string, error) {
 	return items, files, nil
 }
 
-func (a AgentConfig) GetName() string { return a.Name }
-func (s SkillConfig) GetName() string { return s.Name }
+func (a AgentConfig) GetName() string          { return a.Name }
+func (s SkillConfig) GetName() string          { return s.Name }
+func (c ContextProfileConfig) GetName() string { return c.Name }
@@ -2,12 +2,52 @@ package project
 
 import (
 	"fmt"
+	"strings"
 )
 
 type RootConfig struct {
 	Version         int              `yaml:"version"`
 	DefaultProvider string           `yaml:"default_provider"`
 	Providers       []ProviderConfig `yaml:"providers"`
+	Redaction       RedactionConfig  `yaml:"redaction"`
+	// ContextProfiles are named context weight profiles; agents pick one with
+	// metadata.context_profile. A profile named "default" applies to the rest.
+	ContextProfiles []ContextProfileConfig `yaml:"context_profiles"`
+	// Runs tunes the run history kept under .deeph/runs.
+	Runs RunHistoryConfig `yaml:"runs"`
+}
+
+// RunHistoryConfig sets how many recorded runs a workspace keeps. Zero
+// values use the defaults (keep 100, no age limit).
+type RunHistoryConfig struct {
+	Disabled   bool `yaml:"disabled"`
+	Keep       int  `yaml:"keep"`
+	MaxAgeDays int  `yaml:"max_age_days"`
+}
+
+// ContextProfileConfig overrides the context compiler's weights. Categories
+// re-weight every kind of the category that has no kind-specific default;
+// Types set single kinds; Moments map a moment to kind or "cat:<category>"
+// boosts applied while an agent is in that moment.
+type ContextProfileConfig struct {
+	Name             string                        `yaml:"name"`
+	Description      string                        `yaml:"description"`
+	Categories       map[string]float64            `yaml:"categories"`
+	Types            map[string]float64            `yaml:"types"`
+	Moments          map[string]map[string]float64 `yaml:"moments"`
+	MatchMomentBoost *float64                      `yaml:"match_moment_boost"`
+}
+
+// RedactionConfig tunes secret redaction of tool results, outputs, traces and
+// chat sessions. Known key formats and secret-looking env vars are always covered.
+type RedactionConfig struct {
+	Disabled bool `yaml:"disabled"`
+	// Env lists extra env vars whose values must never leave the process.
+	Env []string `yaml:"env"`
+	// Patterns are extra regular expressions to redact.
+	Patterns []string `yaml:"patterns"`
+	// HighEntropy toggles redaction of long random-looking tokens (default true).
+	HighEntropy *bool `yaml:"high_entropy"`
 }
 
 type ProviderConfig struct {
@@ -21,6 +61,12 @@ type ProviderConfig struct {
 	GRPCTarget   string            `yaml:"grpc_target"`
 	GRPCMethod   string            `yaml:"grpc_method"`
 	GRPCInsecure bool              `yaml:"grpc_insecure"`
+	// Tokenizer overrides how prompt tokens are counted: "heuristic", a
+	// vocabulary name in .deeph/tokenizers, or a vocabulary file path.
+	Tokenizer string `yaml:"tokenizer"`
+	// MockScript is a workspace-relative YAML file of rules that script a
+	// mock provider's responses (text, tool calls, errors, delays).
+	MockScript string `yaml:"mock_script"`
 }
 
 type AgentConfig struct {
@@ -36,6 +82,63 @@ type AgentConfig struct {
 	StartupCalls   []SkillCall         `yaml:"startup_calls"`
 	TimeoutMS      int                 `yaml:"timeout_ms"`
 	Metadata       map[string]string   `yaml:"metadata"`
+	// AllowPaths/DenyPaths scope every file skill the agent uses; WritePaths
+	// further narrows file_write_safe. Globs are workspace-relative.
+	AllowPaths []string `yaml:"allow_paths"`
+	DenyPaths  []string `yaml:"deny_paths"`
+	WritePaths []string `yaml:"write_paths"`
+	// Routes gate this agent's successors on its output.
+	Routes []RouteConfig `yaml:"routes"`
+	// Loop re-runs the agents from BackTo through this one until its output
+	// meets Until.
+	Loop *LoopConfig `yaml:"loop"`
+	// Map fans this agent out into one instance per item of an upstream list.
+	Map *MapConfig `yaml:"map"`
+}
+
+// MapConfig runs one instance of the agent per item of a list: a JSON array
+// in the output of the upstream agent Over (at the dot path Field when set),
+// or the files changed in the workspace when Over is "changed_files". Each
+// instance gets the item as its own input and budget; at most Concurrency
+// instances run at once and only the first MaxItems items are mapped.
+// Successors receive every instance output on its own handoff channel.
+type MapConfig struct {
+	Over        string `yaml:"over"`
+	Field       string `yaml:"field"`
+	BaseRef     string `yaml:"base_ref"`
+	MaxItems    int    `yaml:"max_items"`
+	Concurrency int    `yaml:"concurrency"`
+}
+
+// LoopConfig closes a bounded cycle over the spec: after this agent runs, the
+// body (BackTo and everything between it and this agent) runs again with this
+// agent's output handed back to BackTo, until Until holds on the output or
+// MaxIterations (default 3) iterations have run.
+type LoopConfig struct {
+	BackTo        string         `yaml:"back_to"`
+	Until         RouteCondition `yaml:"until"`
+	MaxIterations int            `yaml:"max_iterations"`
+}
+
+// RouteConfig activates successor To when the condition holds. Successors
+// named by any route run only if one of their routes is taken; the others
+// always run. Default routes are taken when no other route matched.
+type RouteConfig struct {
+	To      string         `yaml:"to"`
+	When    RouteCondition `yaml:"when"`
+	Default bool           `yaml:"default"`
+}
+
+// RouteCondition is evaluated over the upstream output. Field is a dot path
+// into the output parsed as JSON; without equals/in/regex it must be truthy.
+// Regex alone matches the raw output. Choice matches when a router agent
+// answered with the route target's name.
+type RouteCondition struct {
+	Regex  string   `yaml:"regex"`
+	Field  string   `yaml:"field"`
+	Equals string   `yaml:"equals"`
+	In     []string `yaml:"in"`
+	Choice bool     `yaml:"choice"`
 }
 
 type AgentIOConfig struct {
@@ -54,6 +157,9 @@ type IOPortConfig struct {
 	Required        bool    `yaml:"required"`
 	MaxTokens       int     `yaml:"max_tokens"`
 	Description     string  `yaml:"description"`
+	// Schema is an optional JSON Schema (in YAML) the agent output must satisfy
+	// on this output port; invalid output is retried (metadata.contract_retries).
+	Schema map[string]any `yaml:"schema"`
 }
 
 type SkillCall struct {
@@ -70,6 +176,18 @@ type SkillConfig struct {
 	Headers     map[string]string `yaml:"headers"`
 	TimeoutMS   int               `yaml:"timeout_ms"`
 	Params      map[string]any    `yaml:"params"`
+	// ArgsSchema is a JSON Schema (written in YAML) for the tool arguments. When
+	// set it replaces the built-in parameter schema and is enforced before Execute.
+	ArgsSchema map[string]any `yaml:"args_schema"`
+	// BodyTemplate is the http request body; {{args.name}} expands to the JSON
+	// encoding of that argument.
+	BodyTemplate string `yaml:"body_template"`
+	// Approval gates tool-loop calls: always, mutating or never (default).
+	Approval string `yaml:"approval"`
+	// AllowPaths/DenyPaths scope file skills on top of the agent's policy;
+	// "!glob" in DenyPaths lifts a default protected path.
+	AllowPaths []string `yaml:"allow_paths"`
+	DenyPaths  []string `yaml:"deny_paths"`
 }
 
 type Project struct {
@@ -78,6 +196,31 @@ type Project struct {
 	Skills     []SkillConfig
 	AgentFiles map[string]string
 	SkillFiles map[string]string
+	// Profiles are context profiles loaded from profiles/*.yaml.
+	Profiles     []ContextProfileConfig
+	ProfileFiles map[string]string
+}
+
+// ContextProfiles returns the profiles declared in deeph.yaml followed by
+// those in profiles/.
+func (p *Project) ContextProfiles() []ContextProfileConfig {
+	out := append([]ContextProfileConfig(nil), p.Root.ContextProfiles...)
+	return append(out, p.Profiles...)
+}
+
+// ContextProfileFor returns the profile an agent compiles its context with:
+// metadata.context_profile, else the "default" profile, else false.
+func (p *Project) ContextProfileFor(agent AgentConfig) (ContextProfileConfig, bool) {
+	name := strings.TrimSpace(agent.Metadata["context_profile"])
+	if name == "" {
+		name = DefaultContextProfile
+	}
+	for _, prof := range p.ContextProfiles() {
+		if prof.Name == name {
+			return prof, true
+		}
+	}
+	return ContextProfileConfig{}, false
 }
 
 type IssueLevel string
@@ -3,10 +3,14 @@ package project
 import (
 	"fmt"
 	"math"
+	"net/url"
+	pathpkg "path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 
+	"deeph/internal/jsonschema"
 	"deeph/internal/typesys"
 )
 
@@ -26,7 +30,15 @@ var validSkillTypes = map[string]struct{}{
 	"file_read":       {},
 	"file_read_range": {},
 	"file_write_safe": {},
+	"artifact_read":   {},
+	"memory_write":    {},
 	"http":            {},
+	"command_exec":    {},
+	"code_search":     {},
+	"repo_map":        {},
+	"git":             {},
+	"mcp":             {},
+	"plugin":          {},
 }
 
 func Validate(p *Project) *ValidationError {
@@ -72,6 +84,9 @@ func Validate(p *Project) *ValidationError {
 		if pc.Type == "deepseek" && strings.TrimSpace(pc.BaseURL) == "" {
 			issues = append(issues, Issue{Level: IssueWarning, Path: path, Field: "base_url", Message: "empty value defaults to https://api.deepseek.com at runtime"})
 		}
+		if strings.TrimSpace(pc.MockScript) != "" && pc.Type != "mock" {
+			issues = append(issues, Issue{Level: IssueWarning, Path: path, Field: "mock_script", Message: "is only used by mock providers"})
+		}
 	}
 
 	if p.Root.DefaultProvider != "" {
@@ -106,11 +121,46 @@ func Validate(p *Project) *ValidationError {
 		if sc.Type == "http" && strings.TrimSpace(sc.Method) == "" {
 			issues = append(issues, Issue{Level: IssueWarning, Path: path, Field: "method", Message: "empty method defaults to GET"})
 		}
+		if sc.Type == "http" {
+			validateHTTPSkillPolicy(&issues, path, sc)
+		}
+		validateSkillArgsSchema(&issues, path, sc)
+		switch strings.ToLower(strings.TrimSpace(sc.Approval)) {
+		case "", "always", "mutating", "never":
+		default:
+			issues = append(issues, Issue{Level: IssueError, Path: path, Field: "approval", Message: "must be always, mutating or never"})
+		}
+		validatePathPatterns(&issues, path, "allow_paths", sc.AllowPaths, false)
+		validatePathPatterns(&issues, path, "deny_paths", sc.DenyPaths, true)
+		if _, ok := pathScopedSkillTypes[sc.Type]; !ok && len(sc.AllowPaths)+len(sc.DenyPaths) > 0 {
+			issues = append(issues, Issue{Level: IssueWarning, Path: path, Field: "allow_paths", Message: "path policies only apply to file_read, file_read_range, file_write_safe, code_search, repo_map and git skills"})
+		}
 		if sc.Type == "file_read" || sc.Type == "file_read_range" || sc.Type == "file_write_safe" {
 			if maxBytes, ok := intParam(sc.Params, "max_bytes"); ok && maxBytes <= 0 {
 				issues = append(issues, Issue{Level: IssueError, Path: path, Field: "params.max_bytes", Message: "must be > 0"})
 			}
 		}
+		if sc.Type == "command_exec" {
+			validateCommandExecSkill(&issues, path, sc)
+		}
+		if sc.Type == "mcp" {
+			validateMCPSkill(&issues, path, sc)
+		}
+		if sc.Type == "plugin" {
+			validatePluginSkill(&issues, path, sc)
+		}
+		if sc.Type == "git" {
+			if maxBytes, ok := intParam(sc.Params, "max_output_bytes"); ok && maxBytes <= 0 {
+				issues = append(issues, Issue{Level: IssueError, Path: path, Field: "params.max_output_bytes", Message: "must be > 0"})
+			}
+		}
+		if sc.Type == "code_search" || sc.Type == "repo_map" {
+			for _, key := range []string{"max_results", "max_file_bytes", "max_symbol_files", "max_depth", "max_entries", "max_chars", "outline_files"} {
+				if v, ok := intParam(sc.Params, key); ok && v <= 0 {
+					issues = append(issues, Issue{Level: IssueError, Path: path, Field: "params." + key, Message: "must be > 0"})
+				}
+			}
+		}
 	}
 
 	seenAgents := map[string]struct{}{}
@@ -171,6 +221,9 @@ func Validate(p *Project) *ValidationError {
 				issues = append(issues, Issue{Level: IssueError, Path: path, Field: fmt.Sprintf("startup_calls[%d].skill", i), Message: "references unknown skill"})
 			}
 		}
+		validatePathPatterns(&issues, path, "allow_paths", ac.AllowPaths, false)
+		validatePathPatterns(&issues, path, "deny_paths", ac.DenyPaths, true)
+		validatePathPatterns(&issues, path, "write_paths", ac.WritePaths, false)
 		validateAgentIO(&issues, path, ac)
 		validateAgentDependsOnPorts(&issues, path, ac)
 		if metadataBool(ac.Metadata, "strict_types") && len(ac.IO.Inputs) == 0 && len(ac.IO.Outputs) == 0 {
@@ -192,6 +245,13 @@ func Validate(p *Project) *ValidationError {
 			}
 		}
 		validateAgentDependsOnPortsRefs(&issues, path, ac, agentByName)
+		validateAgentRoutes(&issues, path, ac, agentByName)
+		if ac.Loop != nil {
+			ValidateLoop(&issues, path, "loop", ac.Name, *ac.Loop, agentByName)
+		}
+		if ac.Map != nil {
+			validateAgentMap(&issues, path, ac, agentByName)
+		}
 	}
 	for _, cycle := range findAgentDependencyCycles(agentByName) {
 		if len(cycle) == 0 {
@@ -210,6 +270,42 @@ func Validate(p *Project) *ValidationError {
 		})
 	}
 
+	for i, raw := range p.Root.Redaction.Patterns {
+		if _, err := regexp.Compile(raw); err != nil {
+			issues = append(issues, Issue{Level: IssueError, Path: RootConfigFile, Field: fmt.Sprintf("redaction.patterns[%d]", i), Message: "invalid regular expression: " + err.Error()})
+		}
+	}
+	for i, name := range p.Root.Redaction.Env {
+		if strings.TrimSpace(name) == "" {
+			issues = append(issues, Issue{Level: IssueError, Path: RootConfigFile, Field: fmt.Sprintf("redaction.env[%d]", i), Message: "env var name cannot be empty"})
+		}
+	}
+	if p.Root.Redaction.Disabled {
+		issues = append(issues, Issue{Level: IssueWarning, Path: RootConfigFile, Field: "redaction.disabled", Message: "secret redaction is off; tool results and outputs are stored and printed verbatim"})
+	}
+
+	if p.Root.Runs.Keep < 0 {
+		issues = append(issues, Issue{Level: IssueError, Path: RootConfigFile, Field: "runs.keep", Message: "must be >= 0 (0 uses the default)"})
+	}
+	if p.Root.Runs.MaxAgeDays < 0 {
+		issues = append(issues, Issue{Level: IssueError, Path: RootConfigFile, Field: "runs.max_age_days", Message: "must be >= 0 (0 keeps runs of any age)"})
+	}
+
+	profileNames := validateContextProfiles(&issues, p)
+	for _, ac := range p.Agents {
+		name := strings.TrimSpace(ac.Metadata["context_profile"])
+		if name == "" {
+			continue
+		}
+		if _, ok := profileNames[name]; !ok {
+			path := p.AgentFiles[ac.Name]
+			if path == "" {
+				path = filepath.Join("agents", ac.Name+".yaml")
+			}
+			issues = append(issues, Issue{Level: IssueError, Path: path, Field: "metadata.context_profile", Message: fmt.Sprintf("references unknown context profile %q", name)})
+		}
+	}
+
 	if len(p.Agents) > 0 && len(p.Root.Providers) == 0 {
 		issues = append(issues, Issue{Level: IssueError, Path: RootConfigFile, Field: "providers", Message: "at least one provider is required when agents exist"})
 	}
@@ -220,6 +316,279 @@ func Validate(p *Project) *ValidationError {
 	return &ValidationError{Issues: issues}
 }
 
+func validateCommandExecSkill(issues *[]Issue, path string, sc SkillConfig) {
+	var allow []any
+	switch v := sc.Params["allow"].(type) {
+	case []any:
+		allow = v
+	case []string:
+		for _, entry := range v {
+			allow = append(allow, entry)
+		}
+	}
+	if len(allow) == 0 {
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "params.allow", Message: "command_exec requires a non-empty list of allowed command prefixes (example: \"go test\")"})
+	}
+	for i, raw := range allow {
+		entry, ok := raw.(string)
+		if !ok || strings.TrimSpace(entry) == "" {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: fmt.Sprintf("params.allow[%d]", i), Message: "must be a non-empty string"})
+			continue
+		}
+		fields := strings.Fields(entry)
+		switch fields[0] {
+		case "sh", "bash", "zsh", "cmd", "cmd.exe", "powershell", "pwsh", "env", "sudo":
+			*issues = append(*issues, Issue{Level: IssueWarning, Path: path, Field: fmt.Sprintf("params.allow[%d]", i), Message: "allowlisting a shell or launcher permits arbitrary commands"})
+		}
+		if len(fields) == 1 {
+			*issues = append(*issues, Issue{Level: IssueWarning, Path: path, Field: fmt.Sprintf("params.allow[%d]", i), Message: "single-token entry allows every subcommand; prefer e.g. \"go test\" over \"go\""})
+		}
+	}
+	if maxBytes, ok := intParam(sc.Params, "max_output_bytes"); ok && maxBytes <= 0 {
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "params.max_output_bytes", Message: "must be > 0"})
+	}
+	if raw, ok := sc.Params["network"]; ok {
+		v, _ := raw.(string)
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "on", "off":
+		default:
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "params.network", Message: "must be on or off"})
+		}
+	}
+	if raw, ok := sc.Params["kind"]; ok {
+		v, _ := raw.(string)
+		if _, ok := typesys.NormalizeKind(v); !ok {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "params.kind", Message: "unknown type kind"})
+		}
+	}
+}
+
+var envSecretRefPattern = regexp.MustCompile(`\$\{env:([^}]*)\}`)
+var envSecretNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func validateHTTPSkillPolicy(issues *[]Issue, path string, sc SkillConfig) {
+	hasHosts := len(stringListValue(sc.Params["allow_hosts"])) > 0
+	hasPrefixes := len(stringListValue(sc.Params["allow_url_prefixes"])) > 0
+	if !hasHosts && !hasPrefixes {
+		secretHeader := false
+		for _, v := range sc.Headers {
+			secretHeader = secretHeader || envSecretRefPattern.MatchString(v)
+		}
+		if secretHeader {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "params.allow_hosts", Message: "http skill sends ${env:...} secrets in headers but has no egress allowlist; set params.allow_hosts or params.allow_url_prefixes"})
+		} else {
+			*issues = append(*issues, Issue{Level: IssueWarning, Path: path, Field: "params.allow_hosts", Message: "unrestricted http skill: the model can reach any public host; set params.allow_hosts or params.allow_url_prefixes"})
+		}
+	}
+	for i, h := range stringListValue(sc.Params["allow_hosts"]) {
+		h = strings.TrimSpace(h)
+		if h == "" || strings.Contains(h, "/") || strings.Contains(h, "://") {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: fmt.Sprintf("params.allow_hosts[%d]", i), Message: "must be a host name such as api.github.com or *.example.com"})
+		}
+	}
+	for i, prefix := range stringListValue(sc.Params["allow_url_prefixes"]) {
+		u, err := url.Parse(strings.TrimSpace(prefix))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: fmt.Sprintf("params.allow_url_prefixes[%d]", i), Message: "must be an absolute http(s) URL prefix"})
+		}
+	}
+	for i, m := range stringListValue(sc.Params["allow_methods"]) {
+		switch strings.ToUpper(strings.TrimSpace(m)) {
+		case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS":
+		default:
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: fmt.Sprintf("params.allow_methods[%d]", i), Message: "unknown HTTP method"})
+		}
+	}
+	checkRefs := func(field, value string) {
+		for _, m := range envSecretRefPattern.FindAllStringSubmatch(value, -1) {
+			if !envSecretNamePattern.MatchString(m[1]) {
+				*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field, Message: fmt.Sprintf("invalid secret reference ${env:%s}", m[1])})
+			}
+		}
+	}
+	checkRefs("url", sc.URL)
+	for k, v := range sc.Headers {
+		checkRefs("headers."+k, v)
+		switch strings.ToLower(k) {
+		case "authorization", "proxy-authorization", "x-api-key", "api-key", "cookie":
+			if strings.TrimSpace(v) != "" && !envSecretRefPattern.MatchString(v) {
+				*issues = append(*issues, Issue{Level: IssueWarning, Path: path, Field: "headers." + k, Message: "looks like a hardcoded secret; use ${env:NAME} so it is resolved at execution and redacted from traces"})
+			}
+		}
+	}
+}
+
+// argTemplatePattern matches {{args.name}} placeholders in http url/body templates.
+var argTemplatePattern = regexp.MustCompile(`\{\{\s*args\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+func validateSkillArgsSchema(issues *[]Issue, path string, sc SkillConfig) {
+	if len(sc.ArgsSchema) > 0 {
+		if sc.Type == "mcp" {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "args_schema", Message: "is not supported for mcp skills (tool schemas come from the server)"})
+		}
+		if t, _ := sc.ArgsSchema["type"].(string); t != "object" {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "args_schema.type", Message: "must be object (tool arguments are a JSON object)"})
+		}
+		for _, v := range jsonschema.Check(sc.ArgsSchema) {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "args_schema" + strings.ReplaceAll(v.Path, "/", "."), Message: v.Message})
+		}
+		if sc.Type == "http" && strings.TrimSpace(sc.URL) == "" {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "url", Message: "is required when args_schema is set (the model no longer supplies the url)"})
+		}
+	}
+	if strings.TrimSpace(sc.BodyTemplate) != "" && sc.Type != "http" {
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "body_template", Message: "is only supported for http skills"})
+	}
+	declared := map[string]struct{}{}
+	for _, name := range jsonschema.Properties(sc.ArgsSchema) {
+		declared[name] = struct{}{}
+	}
+	checkTemplate := func(field, value string) {
+		for _, m := range argTemplatePattern.FindAllStringSubmatch(value, -1) {
+			if len(sc.ArgsSchema) == 0 {
+				*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field, Message: fmt.Sprintf("{{args.%s}} requires args_schema", m[1])})
+				return
+			}
+			if _, ok := declared[m[1]]; !ok {
+				*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field, Message: fmt.Sprintf("{{args.%s}} is not declared in args_schema.properties", m[1])})
+			}
+		}
+	}
+	checkTemplate("url", sc.URL)
+	checkTemplate("body_template", sc.BodyTemplate)
+}
+
+func stringListValue(v any) []string {
+	switch x := v.(type) {
+	case []string:
+		return x
+	case []any:
+		out := make([]string, 0, len(x))
+		for _, item := range x {
+			out = append(out, fmt.Sprint(item))
+		}
+		return out
+	case string:
+		if strings.TrimSpace(x) == "" {
+			return nil
+		}
+		return strings.Split(x, ",")
+	default:
+		return nil
+	}
+}
+
+var pathScopedSkillTypes = map[string]struct{}{
+	"file_read":       {},
+	"file_read_range": {},
+	"file_write_safe": {},
+	"code_search":     {},
+	"repo_map":        {},
+	"git":             {},
+}
+
+// validatePathPatterns checks workspace-relative path globs; "!" exemptions
+// are only meaningful in deny_paths.
+func validatePathPatterns(issues *[]Issue, path, field string, patterns []string, allowNegation bool) {
+	for i, raw := range patterns {
+		f := fmt.Sprintf("%s[%d]", field, i)
+		pat := strings.TrimSpace(raw)
+		if strings.HasPrefix(pat, "!") {
+			if !allowNegation {
+				*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: f, Message: "\"!\" exemptions are only allowed in deny_paths"})
+				continue
+			}
+			pat = strings.TrimPrefix(pat, "!")
+		}
+		if pat == "" {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: f, Message: "pattern cannot be empty"})
+			continue
+		}
+		if filepath.IsAbs(pat) || strings.HasPrefix(pat, "/") {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: f, Message: "must be workspace-relative"})
+			continue
+		}
+		for _, seg := range strings.Split(filepath.ToSlash(pat), "/") {
+			if seg == ".." {
+				*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: f, Message: "must not contain \"..\""})
+				break
+			}
+			if _, err := pathpkg.Match(seg, ""); err != nil {
+				*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: f, Message: fmt.Sprintf("invalid glob segment %q", seg)})
+				break
+			}
+		}
+	}
+}
+
+func validatePluginSkill(issues *[]Issue, path string, sc SkillConfig) {
+	switch v := sc.Params["command"].(type) {
+	case string:
+		if strings.TrimSpace(v) != "" {
+			return
+		}
+	case []any:
+		if len(v) > 0 {
+			return
+		}
+	case []string:
+		if len(v) > 0 {
+			return
+		}
+	case nil:
+	default:
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "params.command", Message: "must be a string or a list of strings"})
+		return
+	}
+	*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "params.command", Message: "plugin skill requires the executable to run"})
+}
+
+func validateMCPSkill(issues *[]Issue, path string, sc SkillConfig) {
+	hasURL := strings.TrimSpace(sc.URL) != ""
+	hasCommand := false
+	switch v := sc.Params["command"].(type) {
+	case string:
+		hasCommand = strings.TrimSpace(v) != ""
+	case []any:
+		hasCommand = len(v) > 0
+	case []string:
+		hasCommand = len(v) > 0
+	case nil:
+	default:
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "params.command", Message: "must be a string or a list of strings"})
+	}
+	switch {
+	case !hasURL && !hasCommand:
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "url", Message: "mcp skill requires url (streamable HTTP) or params.command (stdio)"})
+	case hasURL && hasCommand:
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "url", Message: "set either url or params.command, not both"})
+	case hasURL:
+		if u, err := url.Parse(sc.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "url", Message: "must be an absolute http(s) URL"})
+		}
+	}
+	if raw, ok := sc.Params["tools"]; ok {
+		valid := true
+		switch v := raw.(type) {
+		case []any:
+			for _, item := range v {
+				if s, ok := item.(string); !ok || strings.TrimSpace(s) == "" {
+					valid = false
+				}
+			}
+		case []string:
+		default:
+			valid = false
+		}
+		if !valid {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "params.tools", Message: "must be a list of tool names"})
+		}
+	}
+	if maxBytes, ok := intParam(sc.Params, "max_bytes"); ok && maxBytes <= 0 {
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "params.max_bytes", Message: "must be > 0"})
+	}
+}
+
 func findAgentDependencyCycles(agentByName map[string]AgentConfig) [][]string {
 	if len(agentByName) == 0 {
 		return nil
@@ -522,6 +891,19 @@ func validateIOPorts(issues *[]Issue, path, fieldPrefix string, ports []IOPortCo
 			}
 		}
 
+		if len(p.Schema) > 0 {
+			if isInput {
+				*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: portField + ".schema", Message: "schema contracts are only supported on io.outputs"})
+			} else {
+				for _, v := range jsonschema.Check(p.Schema) {
+					*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: portField + ".schema" + strings.ReplaceAll(v.Path, "/", "."), Message: v.Message})
+				}
+				if !portProducesJSON(p.Produces) {
+					*issues = append(*issues, Issue{Level: IssueWarning, Path: path, Field: portField + ".produces", Message: "schema contract set but produces has no json/* or contract/* kind"})
+				}
+			}
+		}
+
 		kinds := p.Accepts
 		kindField := ".accepts"
 		if !isInput {
@@ -540,6 +922,164 @@ func validateIOPorts(issues *[]Issue, path, fieldPrefix string, ports []IOPortCo
 	}
 }
 
+func validateAgentRoutes(issues *[]Issue, path string, ac AgentConfig, agentByName map[string]AgentConfig) {
+	defaults := 0
+	for i, r := range ac.Routes {
+		field := fmt.Sprintf("routes[%d]", i)
+		to := strings.TrimSpace(r.To)
+		switch {
+		case to == "":
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".to", Message: "is required"})
+		case to == ac.Name:
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".to", Message: "agent cannot route to itself"})
+		default:
+			if _, ok := agentByName[to]; !ok {
+				*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".to", Message: "references unknown agent"})
+			}
+		}
+		w := r.When
+		hasWhen := w.Regex != "" || w.Field != "" || w.Equals != "" || len(w.In) > 0 || w.Choice
+		if r.Default {
+			defaults++
+			if hasWhen {
+				*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".when", Message: "default routes cannot have a condition"})
+			}
+			continue
+		}
+		if !hasWhen {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".when", Message: "needs regex, field or choice (or default: true)"})
+			continue
+		}
+		if w.Choice && (w.Regex != "" || w.Field != "" || w.Equals != "" || len(w.In) > 0) {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".when.choice", Message: "cannot be combined with regex/field conditions"})
+		}
+		if strings.TrimSpace(w.Field) == "" && (w.Equals != "" || len(w.In) > 0) {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".when", Message: "equals/in require field"})
+		}
+		if w.Equals != "" && len(w.In) > 0 {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".when", Message: "use either equals or in, not both"})
+		}
+		if w.Regex != "" {
+			if _, err := regexp.Compile(w.Regex); err != nil {
+				*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".when.regex", Message: "invalid regular expression: " + err.Error()})
+			}
+		}
+	}
+	if defaults > 1 {
+		*issues = append(*issues, Issue{Level: IssueWarning, Path: path, Field: "routes", Message: "more than one default route; all of them are taken when nothing else matches"})
+	}
+}
+
+// DefaultLoopIterations applies when loop.max_iterations is unset;
+// MaxLoopIterations caps it.
+const (
+	DefaultLoopIterations = 3
+	MaxLoopIterations     = 20
+)
+
+// ValidateLoop checks a loop declared on agent (in its YAML or by a crew).
+func ValidateLoop(issues *[]Issue, path, field, agent string, lc LoopConfig, agentByName map[string]AgentConfig) {
+	backTo := strings.TrimSpace(lc.BackTo)
+	if backTo == "" {
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".back_to", Message: "is required"})
+	} else if _, ok := agentByName[backTo]; !ok {
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".back_to", Message: "references unknown agent"})
+	}
+	if _, ok := agentByName[agent]; !ok && agent != "" {
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".agent", Message: "references unknown agent"})
+	}
+	u := lc.Until
+	switch {
+	case u.Choice:
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".until.choice", Message: "loop exit conditions support field/regex only"})
+	case u.Regex == "" && strings.TrimSpace(u.Field) == "":
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".until", Message: "needs field or regex"})
+	case strings.TrimSpace(u.Field) == "" && (u.Equals != "" || len(u.In) > 0):
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".until", Message: "equals/in require field"})
+	}
+	if u.Regex != "" {
+		if _, err := regexp.Compile(u.Regex); err != nil {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".until.regex", Message: "invalid regular expression: " + err.Error()})
+		}
+	}
+	switch {
+	case lc.MaxIterations < 0:
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".max_iterations", Message: "must be >= 0 (0 uses the default of 3)"})
+	case lc.MaxIterations > MaxLoopIterations:
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + ".max_iterations", Message: fmt.Sprintf("must be <= %d", MaxLoopIterations)})
+	}
+}
+
+// MapOverChangedFiles maps an agent over the files changed in the workspace.
+const MapOverChangedFiles = "changed_files"
+
+// DefaultMapItems and DefaultMapConcurrency apply when map.max_items and
+// map.concurrency are unset; MaxMapItems caps the fan-out.
+const (
+	DefaultMapItems       = 16
+	DefaultMapConcurrency = 4
+	MaxMapItems           = 128
+)
+
+func validateAgentMap(issues *[]Issue, path string, ac AgentConfig, agentByName map[string]AgentConfig) {
+	m := *ac.Map
+	over := strings.TrimSpace(m.Over)
+	switch {
+	case over == "":
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "map.over", Message: "is required (upstream agent or changed_files)"})
+	case over == MapOverChangedFiles:
+		if strings.TrimSpace(m.Field) != "" {
+			*issues = append(*issues, Issue{Level: IssueWarning, Path: path, Field: "map.field", Message: "ignored when mapping over changed_files"})
+		}
+	case over == ac.Name:
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "map.over", Message: "cannot map over the agent's own output"})
+	default:
+		up, ok := agentByName[over]
+		if !ok {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "map.over", Message: "references unknown agent"})
+		} else if len(up.IO.Outputs) > 0 && !agentProducesJSON(up) {
+			*issues = append(*issues, Issue{Level: IssueWarning, Path: path, Field: "map.over", Message: "upstream agent declares no json output port (map expects a json/array)"})
+		}
+		if strings.TrimSpace(m.BaseRef) != "" {
+			*issues = append(*issues, Issue{Level: IssueWarning, Path: path, Field: "map.base_ref", Message: "only used when mapping over changed_files"})
+		}
+	}
+	switch {
+	case m.MaxItems < 0:
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "map.max_items", Message: fmt.Sprintf("must be >= 0 (0 uses the default of %d)", DefaultMapItems)})
+	case m.MaxItems > MaxMapItems:
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "map.max_items", Message: fmt.Sprintf("must be <= %d", MaxMapItems)})
+	}
+	if m.Concurrency < 0 {
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "map.concurrency", Message: fmt.Sprintf("must be >= 0 (0 uses the default of %d)", DefaultMapConcurrency)})
+	}
+	if ac.Loop != nil {
+		*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: "map", Message: "a mapped agent cannot close a loop"})
+	}
+}
+
+func agentProducesJSON(ac AgentConfig) bool {
+	for _, out := range ac.IO.Outputs {
+		if portProducesJSON(out.Produces) {
+			return true
+		}
+	}
+	return false
+}
+
+func portProducesJSON(kinds []string) bool {
+	for _, raw := range kinds {
+		k, ok := typesys.NormalizeKind(raw)
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(k.String(), "json/") || strings.HasPrefix(k.String(), "contract/") {
+			return true
+		}
+	}
+	return false
+}
+
 func normalizePortMergePolicy(raw string) (string, bool) {
 	s := strings.ToLower(strings.TrimSpace(raw))
 	switch s {
@@ -577,3 +1117,83 @@ func intParam(params map[string]any, key string) (int, bool) {
 		return 0, false
 	}
 }
+
+// DefaultContextProfile is the profile name applied to agents without
+// metadata.context_profile.
+const DefaultContextProfile = "default"
+
+var validContextMoments = map[string]struct{}{
+	"general":   {},
+	"plan":      {},
+	"discovery": {},
+	"tool_loop": {},
+	"synthesis": {},
+	"validate":  {},
+}
+
+// validateContextProfiles checks profile names and that every weight key is a
+// known kind, category or moment. It returns the declared profile names.
+func validateContextProfiles(issues *[]Issue, p *Project) map[string]struct{} {
+	categories := map[string]struct{}{}
+	for _, c := range typesys.Categories() {
+		categories[c] = struct{}{}
+	}
+	names := map[string]struct{}{}
+	check := func(path, field string, prof ContextProfileConfig) {
+		if strings.TrimSpace(prof.Name) == "" {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + "name", Message: "is required"})
+			return
+		}
+		if _, ok := names[prof.Name]; ok {
+			*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + "name", Message: "duplicate context profile name"})
+		}
+		names[prof.Name] = struct{}{}
+		for _, cat := range sortedKeys(prof.Categories) {
+			if _, ok := categories[cat]; !ok {
+				*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + "categories." + cat, Message: "unknown type category"})
+			}
+		}
+		for _, kind := range sortedKeys(prof.Types) {
+			if _, ok := typesys.Lookup(kind); !ok {
+				*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + "types." + kind, Message: "unknown kind"})
+			}
+		}
+		for _, moment := range sortedKeys(prof.Moments) {
+			if _, ok := validContextMoments[moment]; !ok {
+				*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + "moments." + moment, Message: "unknown context moment (use general, plan, discovery, tool_loop, synthesis or validate)"})
+				continue
+			}
+			for _, key := range sortedKeys(prof.Moments[moment]) {
+				if cat, ok := strings.CutPrefix(key, "cat:"); ok {
+					if _, known := categories[cat]; !known {
+						*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + "moments." + moment + "." + key, Message: "unknown type category"})
+					}
+					continue
+				}
+				if _, ok := typesys.Lookup(key); !ok {
+					*issues = append(*issues, Issue{Level: IssueError, Path: path, Field: field + "moments." + moment + "." + key, Message: "unknown kind (use a kind or cat:<category>)"})
+				}
+			}
+		}
+	}
+	for i, prof := range p.Root.ContextProfiles {
+		check(RootConfigFile, fmt.Sprintf("context_profiles[%d].", i), prof)
+	}
+	for _, prof := range p.Profiles {
+		path := p.ProfileFiles[prof.Name]
+		if path == "" {
+			path = filepath.Join("profiles", prof.Name+".yaml")
+		}
+		check(path, "", prof)
+	}
+	return names
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
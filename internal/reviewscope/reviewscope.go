@@ -14,10 +14,15 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+
+	"deeph/internal/tokenizer"
 )
 
 type Config struct {
-	MaxInputChars            int
+	// MaxInputTokens bounds BuildInput as counted by Tokenizer (the heuristic
+	// when nil); callers set Tokenizer to the target model's.
+	MaxInputTokens           int
+	Tokenizer                tokenizer.Tokenizer
 	MaxExcerptChars          int
 	MaxChangedExcerptFiles   int
 	MaxWorkingSetFiles       int
@@ -88,7 +93,7 @@ var ErrNoReviewChanges = errors.New("review requires local git changes or untrac
 
 func DefaultConfig() Config {
 	return Config{
-		MaxInputChars:            3600,
+		MaxInputTokens:           1200,
 		MaxExcerptChars:          420,
 		MaxChangedExcerptFiles:   5,
 		MaxWorkingSetFiles:       14,
@@ -111,16 +116,10 @@ func BuildScope(workspace, baseRef string, cfg Config) (Scope, error) {
 	if err != nil {
 		return Scope{}, err
 	}
-	diffText, effectiveBase, err := gitRelativeDiff(workspace, baseRef)
-	if err != nil {
-		return Scope{}, err
-	}
-	changed := ParseUnifiedDiff(diffText)
-	untracked, err := gitUntrackedFiles(workspace)
+	changed, effectiveBase, err := ChangedFiles(workspace, baseRef)
 	if err != nil {
 		return Scope{}, err
 	}
-	seen := make(map[string]struct{}, len(changed))
 	scope := Scope{
 		Workspace:  workspace,
 		BaseRef:    effectiveBase,
@@ -128,64 +127,86 @@ func BuildScope(workspace, baseRef string, cfg Config) (Scope, error) {
 		DiffFiles:  changed,
 	}
 	for _, file := range scope.DiffFiles {
-		seen[file.Path] = struct{}{}
 		scope.AddedLines += file.Added
 		scope.DeletedLines += file.Deleted
 		if isGoSourcePath(file.Path) {
 			scope.GoChanged++
 		}
 	}
+	if err := expandWorkingSet(&scope, cfg, goIndex); err != nil {
+		return Scope{}, err
+	}
+	return scope, nil
+}
+
+// ChangedFiles lists the files changed relative to baseRef ("auto" or empty
+// picks a base like BuildScope does), untracked files included, without
+// indexing the Go workspace. It returns ErrNoReviewChanges when nothing changed.
+func ChangedFiles(workspace, baseRef string) ([]ChangedFile, string, error) {
+	diffText, effectiveBase, err := gitRelativeDiff(workspace, baseRef)
+	if err != nil {
+		return nil, "", err
+	}
+	changed := ParseUnifiedDiff(diffText)
+	untracked, err := gitUntrackedFiles(workspace)
+	if err != nil {
+		return nil, "", err
+	}
+	seen := make(map[string]struct{}, len(changed))
+	for _, file := range changed {
+		seen[file.Path] = struct{}{}
+	}
 	for _, path := range untracked {
 		if _, ok := seen[path]; ok {
 			continue
 		}
-		scope.DiffFiles = append(scope.DiffFiles, ChangedFile{Path: path, Status: "?"})
+		changed = append(changed, ChangedFile{Path: path, Status: "?"})
 		seen[path] = struct{}{}
-		if isGoSourcePath(path) {
-			scope.GoChanged++
-		}
 	}
-	if len(scope.DiffFiles) == 0 {
-		return Scope{}, ErrNoReviewChanges
-	}
-	if err := expandWorkingSet(&scope, cfg, goIndex); err != nil {
-		return Scope{}, err
+	if len(changed) == 0 {
+		return nil, "", ErrNoReviewChanges
 	}
-	return scope, nil
+	return changed, effectiveBase, nil
+}
+
+// Excerpt renders the lines around a changed file's hunks, numbered, in at
+// most maxChars characters.
+func Excerpt(workspace string, file ChangedFile, maxChars int) string {
+	return buildExcerpt(workspace, file.Path, file.Hunks, maxChars)
 }
 
 func BuildInput(scope Scope, focus string, cfg Config) string {
-	p := &promptBuilder{max: cfg.MaxInputChars}
-	p.addLine("[review_scope]")
-	p.addLine("strategy: diff_aware_go")
-	p.addLine("workspace: " + scope.Workspace)
-	p.addLine("base_ref: " + scope.BaseRef)
+	p := &PromptBuilder{Tok: cfg.Tokenizer, Max: cfg.MaxInputTokens}
+	p.AddLine("[review_scope]")
+	p.AddLine("strategy: diff_aware_go")
+	p.AddLine("workspace: " + scope.Workspace)
+	p.AddLine("base_ref: " + scope.BaseRef)
 	if scope.ModulePath != "" {
-		p.addLine("module: " + scope.ModulePath)
+		p.AddLine("module: " + scope.ModulePath)
 	}
-	p.addLine(fmt.Sprintf("changed_files: %d", len(scope.DiffFiles)))
-	p.addLine(fmt.Sprintf("working_set_files: %d", len(scope.WorkingSet)))
-	p.addLine(fmt.Sprintf("line_delta: +%d -%d", scope.AddedLines, scope.DeletedLines))
+	p.AddLine(fmt.Sprintf("changed_files: %d", len(scope.DiffFiles)))
+	p.AddLine(fmt.Sprintf("working_set_files: %d", len(scope.WorkingSet)))
+	p.AddLine(fmt.Sprintf("line_delta: +%d -%d", scope.AddedLines, scope.DeletedLines))
 	if scope.SymbolContext > 0 {
-		p.addLine(fmt.Sprintf("symbol_context_files: %d", scope.SymbolContext))
+		p.AddLine(fmt.Sprintf("symbol_context_files: %d", scope.SymbolContext))
 	}
 	if strings.TrimSpace(focus) != "" {
-		p.addLine("review_focus: " + trimFocusLine(focus, 220))
+		p.AddLine("review_focus: " + trimFocusLine(focus, 220))
 	}
-	p.addLine("instruction: findings first. prioritize bugs, regressions, missing tests, concurrency, context cancellation, nil/pointer mistakes, API drift, resource leaks, and risky assumptions. cite file paths and explain impact. if no issues, say that explicitly and mention residual risks.")
-	p.addLine("preferred_output: use compact structured sections when practical. findings should include severity, file, title, impact, and optional evidence. if no convincing issue exists, say `no_issues: true` and list residual risks or testing gaps.")
-	p.addLine("semantic_expansion: prefer files that declare or reference changed top-level Go symbols before generic package context.")
-	p.addLine("changed:")
+	p.AddLine("instruction: findings first. prioritize bugs, regressions, missing tests, concurrency, context cancellation, nil/pointer mistakes, API drift, resource leaks, and risky assumptions. cite file paths and explain impact. if no issues, say that explicitly and mention residual risks.")
+	p.AddLine("preferred_output: use compact structured sections when practical. findings should include severity, file, title, impact, and optional evidence. if no convincing issue exists, say `no_issues: true` and list residual risks or testing gaps.")
+	p.AddLine("semantic_expansion: prefer files that declare or reference changed top-level Go symbols before generic package context.")
+	p.AddLine("changed:")
 	for _, file := range scope.DiffFiles {
 		line := fmt.Sprintf("- %s %s +%d -%d hunks=%d", file.Status, file.Path, file.Added, file.Deleted, len(file.Hunks))
-		if !p.addLine(line) {
+		if !p.AddLine(line) {
 			break
 		}
 	}
-	p.addLine("working_set:")
+	p.AddLine("working_set:")
 	for _, file := range scope.WorkingSet {
 		line := fmt.Sprintf("- %s reason=%s", file.Path, file.Reason)
-		if !p.addLine(line) {
+		if !p.AddLine(line) {
 			break
 		}
 	}
@@ -207,7 +228,7 @@ func BuildInput(scope Scope, focus string, cfg Config) string {
 		if strings.TrimSpace(excerpt) == "" {
 			continue
 		}
-		if !p.addBlock(fmt.Sprintf("[excerpt %s]", file.Path), excerpt) {
+		if !p.AddBlock(fmt.Sprintf("[excerpt %s]", file.Path), excerpt) {
 			break
 		}
 		excerptsAdded++
@@ -215,14 +236,6 @@ func BuildInput(scope Scope, focus string, cfg Config) string {
 	return strings.TrimSpace(p.String())
 }
 
-func EstimateTokens(text string) int {
-	text = strings.TrimSpace(text)
-	if text == "" {
-		return 0
-	}
-	return max(1, (len(text)+3)/4)
-}
-
 func ParseUnifiedDiff(diffText string) []ChangedFile {
 	lines := strings.Split(strings.ReplaceAll(diffText, "\r\n", "\n"), "\n")
 	out := make([]ChangedFile, 0)
@@ -1325,25 +1338,41 @@ func trimFocusLine(s string, maxChars int) string {
 	return s[:maxChars-3] + "..."
 }
 
-type promptBuilder struct {
-	max int
+// PromptBuilder appends lines and fenced blocks while the prompt stays within
+// Max tokens as counted by Tok (the heuristic when nil). Max <= 0 is unbounded.
+type PromptBuilder struct {
+	Tok tokenizer.Tokenizer
+	Max int
 	b   strings.Builder
 }
 
-func (p *promptBuilder) addLine(line string) bool {
+func (p *PromptBuilder) tokenizer() tokenizer.Tokenizer {
+	if p.Tok == nil {
+		return tokenizer.Heuristic()
+	}
+	return p.Tok
+}
+
+func (p *PromptBuilder) fits(extra string) bool {
+	return p.Max <= 0 || p.tokenizer().Count(p.b.String()+extra) <= p.Max
+}
+
+// AddLine appends line and reports whether it fit.
+func (p *PromptBuilder) AddLine(line string) bool {
 	if p == nil {
 		return false
 	}
-	line = strings.TrimRight(line, "\n")
-	if p.max > 0 && p.b.Len()+len(line)+1 > p.max {
+	line = strings.TrimRight(line, "\n") + "\n"
+	if !p.fits(line) {
 		return false
 	}
 	p.b.WriteString(line)
-	p.b.WriteByte('\n')
 	return true
 }
 
-func (p *promptBuilder) addBlock(header, body string) bool {
+// AddBlock appends a fenced block, clipping body to the remaining budget. It
+// reports false when not even a short body fits.
+func (p *PromptBuilder) AddBlock(header, body string) bool {
 	if p == nil {
 		return false
 	}
@@ -1352,22 +1381,27 @@ func (p *promptBuilder) addBlock(header, body string) bool {
 	if header == "" || body == "" {
 		return true
 	}
-	remaining := p.max - p.b.Len()
-	overhead := len(header) + len("\n```text\n\n```\n")
-	if p.max > 0 && remaining <= overhead+16 {
-		return false
+	open, closing := header+"\n```text\n", "\n```\n"
+	if p.fits(open + body + closing) {
+		p.b.WriteString(open + body + closing)
+		return true
 	}
-	if p.max > 0 && len(body) > remaining-overhead {
-		body = strings.TrimSpace(body[:remaining-overhead-3]) + "..."
+	// Counts are not additive across the fence, so shrink until it fits.
+	tok := p.tokenizer()
+	prefix := p.b.String() + open
+	for remaining := p.Max - tok.Count(prefix+closing) - tok.Count("..."); remaining >= 4; {
+		clipped := strings.TrimSpace(tokenizer.Clip(tok, body, remaining)) + "..."
+		over := tok.Count(prefix+clipped+closing) - p.Max
+		if over <= 0 {
+			p.b.WriteString(open + clipped + closing)
+			return true
+		}
+		remaining -= over
 	}
-	p.b.WriteString(header)
-	p.b.WriteString("\n```text\n")
-	p.b.WriteString(body)
-	p.b.WriteString("\n```\n")
-	return true
+	return false
 }
 
-func (p *promptBuilder) String() string {
+func (p *PromptBuilder) String() string {
 	if p == nil {
 		return ""
 	}
@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"deeph/internal/tokenizer"
 )
 
 func TestParseUnifiedDiffCapturesFilesAndHunks(t *testing.T) {
@@ -102,6 +104,35 @@ func TestBuildScopeIncludesGoNeighbors(t *testing.T) {
 	}
 }
 
+// byteTokenizer counts one token per byte, far above the heuristic.
+type byteTokenizer struct{}
+
+func (byteTokenizer) Name() string          { return "bytes" }
+func (byteTokenizer) Count(text string) int { return len(text) }
+
+func TestPromptBuilderBudgetsByTokenizer(t *testing.T) {
+	body := strings.Repeat("func handler() error { return nil }\n", 40)
+	for _, tok := range []tokenizer.Tokenizer{nil, byteTokenizer{}} {
+		p := &PromptBuilder{Tok: tok, Max: 300}
+		for i := 0; i < 5; i++ {
+			p.AddLine("working_set: service/user.go reason=diff")
+		}
+		if !p.AddBlock("[excerpt service/user.go]", body) {
+			t.Fatalf("%v: expected a clipped block to fit", tok)
+		}
+		count := tokenizer.Heuristic()
+		if tok != nil {
+			count = tok
+		}
+		if n := count.Count(p.String()); n > 300 {
+			t.Fatalf("%v: prompt counts %d tokens, budget 300", tok, n)
+		}
+		if !strings.Contains(p.String(), "...") {
+			t.Fatalf("%v: expected the block to be clipped:\n%s", tok, p.String())
+		}
+	}
+}
+
 func TestBuildInputIncludesScopeAndExcerpt(t *testing.T) {
 	ws := t.TempDir()
 	rel := filepath.Join("service", "user.go")
@@ -323,6 +354,47 @@ func TestBuildScopeAutoFallsBackToLastCommitWhenTreeIsClean(t *testing.T) {
 	}
 }
 
+func TestLookupGoSymbolFindsDeclarationsReferencesAndImporters(t *testing.T) {
+	ws := t.TempDir()
+	writeReviewFile(t, filepath.Join(ws, "go.mod"), "module example.com/app\n\ngo 1.24.0\n")
+	writeReviewFile(t, filepath.Join(ws, "internal", "store", "store.go"), "package store\n\ntype Client struct{}\n\nfunc (c *Client) Save() {}\n")
+	writeReviewFile(t, filepath.Join(ws, "internal", "store", "open.go"), "package store\n\nfunc Open() *Client { return &Client{} }\n")
+	writeReviewFile(t, filepath.Join(ws, "service", "user.go"), "package service\n\nimport \"example.com/app/internal/store\"\n\nfunc Run() { store.Open().Save() }\n")
+	writeReviewFile(t, filepath.Join(ws, "cmd", "app", "main.go"), "package main\n\nfunc main() {}\n")
+
+	locs, err := LookupGoSymbol(ws, "store.Client")
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if len(locs) != 1 {
+		t.Fatalf("locations=%+v", locs)
+	}
+	loc := locs[0]
+	if loc.Symbol != "Client" || loc.Package != "internal/store" || loc.ImportPath != "example.com/app/internal/store" {
+		t.Fatalf("unexpected location: %+v", loc)
+	}
+	if strings.Join(loc.DeclaredIn, ",") != "internal/store/store.go" {
+		t.Fatalf("declared_in=%v", loc.DeclaredIn)
+	}
+	if strings.Join(loc.ReferencedBy, ",") != "internal/store/open.go" {
+		t.Fatalf("referenced_by=%v", loc.ReferencedBy)
+	}
+	if strings.Join(loc.ImportedBy, ",") != "service" {
+		t.Fatalf("imported_by=%v", loc.ImportedBy)
+	}
+
+	methods, err := LookupGoSymbol(ws, "Client.Save")
+	if err != nil {
+		t.Fatalf("lookup method: %v", err)
+	}
+	if len(methods) != 1 || strings.Join(methods[0].ReferencedBy, ",") != "service/user.go" {
+		t.Fatalf("method lookup=%+v", methods)
+	}
+	if missing, _ := LookupGoSymbol(ws, "DoesNotExist"); len(missing) != 0 {
+		t.Fatalf("expected no matches, got %+v", missing)
+	}
+}
+
 func writeReviewFile(t *testing.T, path, body string) {
 	t.Helper()
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
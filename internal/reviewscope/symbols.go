@@ -0,0 +1,136 @@
+package reviewscope
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SymbolLocation describes where a Go symbol is declared inside a workspace and
+// which files and packages depend on it.
+type SymbolLocation struct {
+	Symbol       string   `json:"symbol"`
+	Package      string   `json:"package"`
+	ImportPath   string   `json:"import_path,omitempty"`
+	DeclaredIn   []string `json:"declared_in"`
+	ReferencedBy []string `json:"referenced_by,omitempty"`
+	ImportedBy   []string `json:"imported_by,omitempty"`
+}
+
+// LookupGoSymbol resolves a declared Go symbol using the same AST index that
+// BuildScope relies on. symbol may be a bare name ("BuildScope"), a method
+// ("Engine.Run") or a package-qualified name ("reviewscope.BuildScope").
+func LookupGoSymbol(workspace, symbol string) ([]SymbolLocation, error) {
+	symbol = strings.TrimSpace(symbol)
+	if symbol == "" {
+		return nil, nil
+	}
+	modulePath := readGoModulePath(workspace)
+	index, err := buildGoWorkspaceIndex(workspace, modulePath)
+	if err != nil {
+		return nil, err
+	}
+	return lookupGoSymbol(index, modulePath, symbol), nil
+}
+
+func lookupGoSymbol(index *goWorkspaceIndex, modulePath, symbol string) []SymbolLocation {
+	if index == nil {
+		return nil
+	}
+	pkgFilter := ""
+	matches := symbolDeclaringDirs(index, symbol, "")
+	if len(matches) == 0 {
+		if qualifier, rest, ok := strings.Cut(symbol, "."); ok && rest != "" {
+			pkgFilter, symbol = qualifier, rest
+			matches = symbolDeclaringDirs(index, symbol, pkgFilter)
+		}
+	}
+	out := make([]SymbolLocation, 0, len(matches))
+	for _, dir := range matches {
+		declared := append([]string(nil), index.PackageSymbolFiles[dir][symbol]...)
+		loc := SymbolLocation{
+			Symbol:     symbol,
+			Package:    filepath.ToSlash(dir),
+			ImportPath: packageImportPath(modulePath, dir),
+			DeclaredIn: declared,
+			ImportedBy: toSlashAll(reverseImportDirs(index, dir)),
+		}
+		loc.ReferencedBy = symbolReferences(index, loc, dir)
+		for i := range loc.DeclaredIn {
+			loc.DeclaredIn[i] = filepath.ToSlash(loc.DeclaredIn[i])
+		}
+		out = append(out, loc)
+	}
+	return out
+}
+
+func symbolDeclaringDirs(index *goWorkspaceIndex, symbol, pkgFilter string) []string {
+	var dirs []string
+	for dir, bySymbol := range index.PackageSymbolFiles {
+		if _, ok := bySymbol[symbol]; !ok {
+			continue
+		}
+		if pkgFilter != "" && filepath.Base(dir) != pkgFilter {
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// symbolReferences lists files (outside the declaring ones) that mention the symbol.
+// Package-level names are matched through import selectors; methods can only be
+// matched by identifier, so they are searched in the declaring and importing packages.
+func symbolReferences(index *goWorkspaceIndex, loc SymbolLocation, dir string) []string {
+	name := loc.Symbol
+	isMethod := false
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+		isMethod = true
+	}
+	declared := make(map[string]struct{}, len(loc.DeclaredIn))
+	for _, path := range loc.DeclaredIn {
+		declared[path] = struct{}{}
+	}
+	seen := map[string]struct{}{}
+	add := func(path string) {
+		if _, ok := declared[path]; ok {
+			return
+		}
+		seen[path] = struct{}{}
+	}
+	for _, path := range packageFiles(index, dir) {
+		if _, ok := index.FileRefs[path].IdentifierRefs[name]; ok {
+			add(path)
+		}
+	}
+	if isMethod {
+		for _, importer := range reverseImportDirs(index, dir) {
+			for _, path := range packageFiles(index, importer) {
+				if _, ok := index.FileRefs[path].IdentifierRefs[name]; ok {
+					add(path)
+				}
+			}
+		}
+	} else if loc.ImportPath != "" {
+		for path, refs := range index.FileRefs {
+			if _, ok := refs.ImportedSelectorRefs[loc.ImportPath][name]; ok {
+				add(path)
+			}
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for path := range seen {
+		out = append(out, filepath.ToSlash(path))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func toSlashAll(items []string) []string {
+	for i := range items {
+		items[i] = filepath.ToSlash(items[i])
+	}
+	return items
+}
@@ -0,0 +1,140 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"deeph/internal/project"
+)
+
+const (
+	ApprovalAlways   = "always"
+	ApprovalMutating = "mutating"
+	ApprovalNever    = "never"
+)
+
+// ApprovalRequest describes a tool call that needs a human decision.
+type ApprovalRequest struct {
+	Agent     string         `json:"agent"`
+	Skill     string         `json:"skill"`
+	SkillType string         `json:"skill_type"`
+	Tool      string         `json:"tool,omitempty"`
+	CallID    string         `json:"call_id,omitempty"`
+	Args      map[string]any `json:"args,omitempty"`
+	Reason    string         `json:"reason"`
+}
+
+type ApprovalDecision struct {
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Approver decides gated tool calls. It may block (a CLI prompt, a daemon
+// waiting for an approve/deny RPC) until ctx is done.
+type Approver func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error)
+
+type approverContextKey struct{}
+
+// WithApprover attaches an approver to ctx for flows that create several
+// engines (multiverse branches, judges). An approver set on the Engine wins.
+func WithApprover(ctx context.Context, a Approver) context.Context {
+	return context.WithValue(ctx, approverContextKey{}, a)
+}
+
+// SetApprover installs the approval hook for gated tool calls. Without one,
+// calls that require approval are denied.
+func (e *Engine) SetApprover(a Approver) {
+	e.approverMu.Lock()
+	defer e.approverMu.Unlock()
+	e.approver = a
+}
+
+func (e *Engine) approverFor(ctx context.Context) Approver {
+	e.approverMu.RLock()
+	a := e.approver
+	e.approverMu.RUnlock()
+	if a != nil {
+		return a
+	}
+	a, _ = ctx.Value(approverContextKey{}).(Approver)
+	return a
+}
+
+// skillApprovalPolicy returns the configured policy; skills without one run
+// ungated, as before approval gates existed.
+func skillApprovalPolicy(cfg project.SkillConfig) string {
+	switch p := strings.ToLower(strings.TrimSpace(cfg.Approval)); p {
+	case ApprovalAlways, ApprovalMutating:
+		return p
+	default:
+		return ApprovalNever
+	}
+}
+
+// skillCallMutation reports why a call may change state outside the model's
+// context, or "" for read-only calls. Unknown external tools count as mutating.
+func skillCallMutation(cfg project.SkillConfig, args map[string]any) string {
+	switch cfg.Type {
+	case "file_write_safe":
+		return "writes " + coalesce(anyString(args["path"]), "a workspace file")
+	case "command_exec":
+		return "runs " + coalesce(anyString(args["command"]), "a command")
+	case "memory_write":
+		return "records project memory " + coalesce(anyString(args["key"]), "an entry")
+	case "http":
+		method := strings.ToUpper(coalesce(cfg.Method, "GET"))
+		if len(cfg.ArgsSchema) == 0 {
+			method = strings.ToUpper(coalesce(anyString(args["method"]), method))
+		}
+		switch method {
+		case "GET", "HEAD", "OPTIONS":
+			return ""
+		}
+		return "sends HTTP " + method
+	case "mcp", "plugin":
+		return "calls external " + cfg.Type + " tool"
+	default:
+		return ""
+	}
+}
+
+// checkToolCallApproval enforces the skill's approval policy. It returns the
+// recorded outcome ("" when the call is not gated) and an error when denied.
+func (e *Engine) checkToolCallApproval(ctx context.Context, agent project.AgentConfig, cfg project.SkillConfig, tc LLMToolCall, tool string, args map[string]any) (string, error) {
+	reason := ""
+	switch skillApprovalPolicy(cfg) {
+	case ApprovalNever:
+		return "", nil
+	case ApprovalMutating:
+		if reason = skillCallMutation(cfg, args); reason == "" {
+			return "", nil
+		}
+	case ApprovalAlways:
+		reason = coalesce(skillCallMutation(cfg, args), "skill requires approval for every call")
+	}
+	approver := e.approverFor(ctx)
+	if approver == nil {
+		return "denied", fmt.Errorf("approval required (%s) but this run is non-interactive; denied", reason)
+	}
+	decision, err := approver(ctx, ApprovalRequest{
+		Agent:     agent.Name,
+		Skill:     cfg.Name,
+		SkillType: cfg.Type,
+		Tool:      tool,
+		CallID:    tc.ID,
+		Args:      args,
+		Reason:    reason,
+	})
+	if err != nil {
+		return "denied", fmt.Errorf("approval failed: %w", err)
+	}
+	if !decision.Approved {
+		msg := "denied by user"
+		if r := strings.TrimSpace(decision.Reason); r != "" {
+			msg += ": " + r
+		}
+		return "denied", fmt.Errorf("approval %s", msg)
+	}
+	return "approved", nil
+}
@@ -0,0 +1,97 @@
+package runtime
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"deeph/internal/project"
+)
+
+func newApprovalTestEngine(t *testing.T) (*Engine, project.AgentConfig, string) {
+	t.Helper()
+	ws := t.TempDir()
+	p := &project.Project{
+		Root: project.RootConfig{Providers: []project.ProviderConfig{{Name: "local", Type: "mock"}}},
+		Skills: []project.SkillConfig{
+			{Name: "writer", Type: "file_write_safe", Approval: "mutating"},
+			{Name: "reader", Type: "file_read", Approval: "mutating"},
+			{Name: "remember", Type: "memory_write", Approval: "mutating"},
+			{Name: "shout", Type: "echo", Approval: "always"},
+		},
+		Agents: []project.AgentConfig{{Name: "coder", Provider: "local", Skills: []string{"writer", "reader", "remember", "shout"}}},
+	}
+	eng, err := New(ws, p)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	t.Cleanup(func() { _ = eng.Close() })
+	return eng, p.Agents[0], ws
+}
+
+func TestToolCallApprovalDeniesWithoutApprover(t *testing.T) {
+	eng, agent, ws := newApprovalTestEngine(t)
+	callTrace, msg := eng.executeToolCall(context.Background(), newToolBroker(), agent, "", LLMToolCall{
+		ID: "call_1", Name: "writer", Arguments: `{"path":"out.txt","content":"hi"}`,
+	})
+	if callTrace.Approval != "denied" || !strings.Contains(callTrace.Error, "non-interactive") {
+		t.Fatalf("expected non-interactive denial, got approval=%q err=%q", callTrace.Approval, callTrace.Error)
+	}
+	if !strings.Contains(msg.Content, `"ok":false`) {
+		t.Fatalf("expected error tool message, got %s", msg.Content)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "out.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected denied write not to happen, stat err=%v", err)
+	}
+
+	callTrace, _ = eng.executeToolCall(context.Background(), newToolBroker(), agent, "", LLMToolCall{
+		ID: "call_mem", Name: "remember", Arguments: `{"key":"build","value":"make"}`,
+	})
+	if callTrace.Approval != "denied" {
+		t.Fatalf("expected memory_write to be gated as mutating, got approval=%q err=%q", callTrace.Approval, callTrace.Error)
+	}
+	if entries, _ := LoadProjectMemory(ws); len(entries) != 0 {
+		t.Fatalf("expected denied memory_write not to persist, got %+v", entries)
+	}
+
+	if err := os.WriteFile(filepath.Join(ws, "in.txt"), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	callTrace, _ = eng.executeToolCall(context.Background(), newToolBroker(), agent, "", LLMToolCall{
+		ID: "call_2", Name: "reader", Arguments: `{"path":"in.txt"}`,
+	})
+	if callTrace.Error != "" || callTrace.Approval != "" {
+		t.Fatalf("expected read-only call to run ungated, got approval=%q err=%q", callTrace.Approval, callTrace.Error)
+	}
+}
+
+func TestToolCallApprovalUsesEngineHook(t *testing.T) {
+	eng, agent, ws := newApprovalTestEngine(t)
+	var seen []ApprovalRequest
+	eng.SetApprover(func(_ context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+		seen = append(seen, req)
+		return ApprovalDecision{Approved: req.Skill == "writer", Reason: "not now"}, nil
+	})
+
+	callTrace, _ := eng.executeToolCall(context.Background(), newToolBroker(), agent, "", LLMToolCall{
+		ID: "call_1", Name: "writer", Arguments: `{"path":"out.txt","content":"hi"}`,
+	})
+	if callTrace.Error != "" || callTrace.Approval != "approved" {
+		t.Fatalf("expected approved write, got approval=%q err=%q", callTrace.Approval, callTrace.Error)
+	}
+	if b, err := os.ReadFile(filepath.Join(ws, "out.txt")); err != nil || string(b) != "hi" {
+		t.Fatalf("expected file to be written, got %q (%v)", b, err)
+	}
+
+	callTrace, _ = eng.executeToolCall(context.Background(), newToolBroker(), agent, "", LLMToolCall{
+		ID: "call_2", Name: "shout", Arguments: `{"text":"x"}`,
+	})
+	if callTrace.Approval != "denied" || !strings.Contains(callTrace.Error, "denied by user: not now") {
+		t.Fatalf("expected always-gated echo to be denied, got approval=%q err=%q", callTrace.Approval, callTrace.Error)
+	}
+	if len(seen) != 2 || seen[0].Agent != "coder" || seen[0].Reason != "writes out.txt" || seen[0].CallID != "call_1" {
+		t.Fatalf("unexpected approval requests: %+v", seen)
+	}
+}
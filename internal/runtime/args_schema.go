@@ -0,0 +1,66 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"deeph/internal/jsonschema"
+	"deeph/internal/project"
+)
+
+// argTemplatePattern matches {{args.name}} placeholders in http url/body templates.
+var argTemplatePattern = regexp.MustCompile(`\{\{\s*args\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// checkSkillArgs applies args_schema defaults and validates the result. Skills
+// without a schema get their args back unchanged.
+func checkSkillArgs(cfg project.SkillConfig, args map[string]any) (map[string]any, error) {
+	if len(cfg.ArgsSchema) == 0 {
+		return args, nil
+	}
+	args = jsonschema.ApplyDefaults(cfg.ArgsSchema, args)
+	violations := jsonschema.Validate(cfg.ArgsSchema, args)
+	if len(violations) == 0 {
+		return args, nil
+	}
+	msgs := make([]string, 0, len(violations))
+	for _, v := range violations {
+		msgs = append(msgs, v.String())
+	}
+	return nil, fmt.Errorf("invalid arguments for %s: %s", cfg.Name, strings.Join(msgs, "; "))
+}
+
+// renderURLTemplate substitutes args into a URL. Values are percent-encoded so
+// an argument cannot add path segments, query parameters or change the host.
+func renderURLTemplate(tmpl string, args map[string]any) string {
+	return argTemplatePattern.ReplaceAllStringFunc(tmpl, func(ref string) string {
+		v, ok := args[argTemplatePattern.FindStringSubmatch(ref)[1]]
+		if !ok || v == nil {
+			return ""
+		}
+		s := anyString(v)
+		if _, isString := v.(string); !isString {
+			if b, err := json.Marshal(v); err == nil {
+				s = string(b)
+			}
+		}
+		return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	})
+}
+
+// renderBodyTemplate substitutes the JSON encoding of each arg, so templates are
+// written as {"title": {{args.title}}} and string values cannot break out.
+func renderBodyTemplate(tmpl string, args map[string]any) (string, error) {
+	var renderErr error
+	out := argTemplatePattern.ReplaceAllStringFunc(tmpl, func(ref string) string {
+		v := args[argTemplatePattern.FindStringSubmatch(ref)[1]]
+		b, err := json.Marshal(v)
+		if err != nil && renderErr == nil {
+			renderErr = err
+		}
+		return string(b)
+	})
+	return out, renderErr
+}
@@ -0,0 +1,97 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"deeph/internal/project"
+)
+
+func TestEngineEnforcesArgsSchemaAndRendersHTTPTemplates(t *testing.T) {
+	var gotPath, gotQuery, gotBody, gotType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery, gotType = r.URL.EscapedPath(), r.URL.RawQuery, r.Header.Get("Content-Type")
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"repo":  map[string]any{"type": "string", "pattern": "^[a-z]+/[a-z]+$"},
+			"title": map[string]any{"type": "string", "minLength": 1},
+			"state": map[string]any{"type": "string", "enum": []any{"open", "closed"}, "default": "open"},
+		},
+		"required":             []any{"repo", "title"},
+		"additionalProperties": false,
+	}
+	p := &project.Project{
+		Root: project.RootConfig{Providers: []project.ProviderConfig{{Name: "local", Type: "mock"}}},
+		Skills: []project.SkillConfig{{
+			Name:         "create_issue",
+			Type:         "http",
+			Method:       "POST",
+			URL:          srv.URL + "/repos/{{args.repo}}/issues?state={{args.state}}",
+			BodyTemplate: `{"title": {{args.title}}}`,
+			ArgsSchema:   schema,
+			Params:       map[string]any{"allow_private_networks": true},
+		}},
+		Agents: []project.AgentConfig{{Name: "a1", Provider: "local", Skills: []string{"create_issue"}}},
+	}
+	eng, err := New(t.TempDir(), p)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	defer eng.Close()
+
+	defs, err := eng.buildToolDefinitions(context.Background(), []string{"create_issue"})
+	if err != nil {
+		t.Fatalf("buildToolDefinitions error: %v", err)
+	}
+	if props, _ := defs[0].Parameters["properties"].(map[string]any); props["repo"] == nil || props["url"] != nil {
+		t.Fatalf("expected args_schema to replace the built-in http schema, got %#v", defs[0].Parameters)
+	}
+
+	callTrace, msg := eng.executeToolCall(context.Background(), newToolBroker(), p.Agents[0], "", LLMToolCall{
+		ID:        "call_1",
+		Name:      "create_issue",
+		Arguments: `{"repo":"acme/app","title":"Crash \"on\" start"}`,
+	})
+	if callTrace.Error != "" {
+		t.Fatalf("unexpected tool error: %s", callTrace.Error)
+	}
+	if gotPath != "/repos/acme%2Fapp/issues" || gotQuery != "state=open" {
+		t.Fatalf("unexpected rendered url: path=%q query=%q", gotPath, gotQuery)
+	}
+	if gotBody != `{"title": "Crash \"on\" start"}` || gotType != "application/json" {
+		t.Fatalf("unexpected rendered body %q (content-type %q)", gotBody, gotType)
+	}
+	if !strings.Contains(msg.Content, `"ok":true`) {
+		t.Fatalf("expected ok tool message, got %s", msg.Content)
+	}
+
+	gotPath = ""
+	callTrace, msg = eng.executeToolCall(context.Background(), newToolBroker(), p.Agents[0], "", LLMToolCall{
+		ID:        "call_2",
+		Name:      "create_issue",
+		Arguments: `{"repo":"../admin","url":"http://evil.example/"}`,
+	})
+	for _, want := range []string{"/repo: must match pattern", "/title: is required", "/url: is not an allowed property"} {
+		if !strings.Contains(callTrace.Error, want) {
+			t.Fatalf("expected %q in tool error, got %q", want, callTrace.Error)
+		}
+	}
+	if gotPath != "" {
+		t.Fatalf("expected invalid call to be rejected before the request, server saw %q", gotPath)
+	}
+	if !strings.Contains(msg.Content, `"ok":false`) {
+		t.Fatalf("expected error tool message, got %s", msg.Content)
+	}
+}
@@ -0,0 +1,256 @@
+package runtime
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultArtifactMemoryBytes is how much artifact payload a store keeps in
+// memory before spilling the oldest payloads to disk.
+const DefaultArtifactMemoryBytes = 4 << 20
+
+// ArtifactRetention is how long a payload on disk outlives its last write
+// when no saved context snapshot references it.
+const ArtifactRetention = 24 * time.Hour
+
+// ArtifactStore holds raw artifact payloads by content hash (sha1, the hash in
+// ContextArtifact.Hash and artifact IDs). Payloads stay in memory up to a
+// limit; older ones spill to <dir>/<hh>/<hash>, where later runs can still
+// read them. With an empty dir nothing spills.
+type ArtifactStore struct {
+	mu       sync.Mutex
+	dir      string
+	memLimit int
+	mem      map[string][]byte
+	order    []string
+	memBytes int
+	spilled  map[string]bool
+}
+
+func NewArtifactStore(dir string, memLimit int) *ArtifactStore {
+	if memLimit <= 0 {
+		memLimit = DefaultArtifactMemoryBytes
+	}
+	return &ArtifactStore{
+		dir:      strings.TrimSpace(dir),
+		memLimit: memLimit,
+		mem:      map[string][]byte{},
+		spilled:  map[string]bool{},
+	}
+}
+
+// artifactStoreDir is where an engine's store spills inside the workspace.
+func artifactStoreDir(workspace string) string {
+	if strings.TrimSpace(workspace) == "" {
+		return ""
+	}
+	return filepath.Join(workspace, ".deeph", "artifacts")
+}
+
+// Put stores raw and returns its hash.
+func (s *ArtifactStore) Put(raw []byte) string {
+	h := sha1.Sum(raw)
+	hash := hex.EncodeToString(h[:])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.mem[hash]; ok {
+		return hash
+	}
+	if s.spilled[hash] {
+		// Refresh the payload so PruneArtifacts sees it as in use; if it was
+		// pruned meanwhile, keep it in memory again.
+		if err := os.Chtimes(s.path(hash), time.Time{}, time.Now()); err == nil {
+			return hash
+		}
+		delete(s.spilled, hash)
+	}
+	s.mem[hash] = append([]byte(nil), raw...)
+	s.order = append(s.order, hash)
+	s.memBytes += len(raw)
+	s.spillLocked()
+	return hash
+}
+
+// spillLocked writes the oldest payloads to disk until memory is under the
+// limit. A payload that cannot be written stays in memory.
+func (s *ArtifactStore) spillLocked() {
+	if s.dir == "" {
+		return
+	}
+	kept := s.order[:0]
+	for i, hash := range s.order {
+		if s.memBytes <= s.memLimit || i == len(s.order)-1 {
+			kept = append(kept, s.order[i:]...)
+			break
+		}
+		raw := s.mem[hash]
+		if err := os.MkdirAll(filepath.Dir(s.path(hash)), 0o755); err != nil {
+			kept = append(kept, hash)
+			continue
+		}
+		if err := WriteFileAtomic(s.path(hash), raw, 0o644); err != nil {
+			kept = append(kept, hash)
+			continue
+		}
+		delete(s.mem, hash)
+		s.spilled[hash] = true
+		s.memBytes -= len(raw)
+	}
+	s.order = kept
+}
+
+// Flush writes every in-memory payload to disk so later runs can read it,
+// e.g. when a saved context snapshot references those artifacts. Payloads
+// stay in memory as well.
+func (s *ArtifactStore) Flush() {
+	if s == nil || s.dir == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, hash := range s.order {
+		if _, err := os.Stat(s.path(hash)); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(s.path(hash)), 0o755); err != nil {
+			continue
+		}
+		_ = WriteFileAtomic(s.path(hash), s.mem[hash], 0o644)
+	}
+}
+
+func (s *ArtifactStore) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+// Get returns the payload for a full hash.
+func (s *ArtifactStore) Get(hash string) ([]byte, error) {
+	s.mu.Lock()
+	raw, ok := s.mem[hash]
+	s.mu.Unlock()
+	if ok {
+		return raw, nil
+	}
+	if s.dir == "" || len(hash) < 2 {
+		return nil, fmt.Errorf("artifact %s not found", hash)
+	}
+	raw, err := os.ReadFile(s.path(hash))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("artifact %s not found", hash)
+		}
+		return nil, err
+	}
+	return raw, nil
+}
+
+// Resolve maps an artifact ID ("code/go:abc123def456" or
+// "kind:hash:agent:channel"), a hash or a hash prefix of at least 6 characters
+// to the full hash of a stored payload.
+func (s *ArtifactStore) Resolve(ref string) (string, error) {
+	ref = strings.TrimSpace(ref)
+	prefix := ref
+	if parts := strings.Split(ref, ":"); len(parts) >= 2 {
+		prefix = parts[1]
+	}
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < 6 || strings.Trim(prefix, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid artifact id %q", ref)
+	}
+	seen := map[string]bool{}
+	s.mu.Lock()
+	for hash := range s.mem {
+		if strings.HasPrefix(hash, prefix) {
+			seen[hash] = true
+		}
+	}
+	for hash := range s.spilled {
+		if strings.HasPrefix(hash, prefix) {
+			seen[hash] = true
+		}
+	}
+	s.mu.Unlock()
+	if s.dir != "" {
+		matches, _ := filepath.Glob(filepath.Join(s.dir, prefix[:2], prefix+"*"))
+		for _, m := range matches {
+			seen[filepath.Base(m)] = true
+		}
+	}
+	switch len(seen) {
+	case 0:
+		return "", fmt.Errorf("artifact %q not found", ref)
+	case 1:
+		for hash := range seen {
+			return hash, nil
+		}
+	}
+	hashes := make([]string, 0, len(seen))
+	for hash := range seen {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	return "", fmt.Errorf("artifact %q is ambiguous (%s)", ref, strings.Join(hashes, ", "))
+}
+
+// PruneArtifacts removes payloads under .deeph/artifacts that no saved context
+// snapshot references and that were last written more than maxAge ago, and
+// returns how many it removed. The age grace keeps payloads that running
+// engines spilled but have not referenced from a snapshot yet.
+func PruneArtifacts(workspace string, maxAge time.Duration, now time.Time) (int, error) {
+	dir := artifactStoreDir(workspace)
+	buckets, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	keep := map[string]bool{}
+	ids, err := ListContextSnapshots(workspace)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		file, err := LoadContextSnapshot(workspace, id)
+		if err != nil {
+			// An unreadable snapshot might reference anything; keep everything.
+			return 0, err
+		}
+		for _, a := range file.Artifacts {
+			keep[a.Hash] = true
+		}
+	}
+	removed := 0
+	for _, bucket := range buckets {
+		if !bucket.IsDir() {
+			continue
+		}
+		bucketDir := filepath.Join(dir, bucket.Name())
+		entries, err := os.ReadDir(bucketDir)
+		if err != nil {
+			continue
+		}
+		for _, ent := range entries {
+			if ent.IsDir() || keep[ent.Name()] {
+				continue
+			}
+			info, err := ent.Info()
+			if err != nil || now.Sub(info.ModTime()) <= maxAge {
+				continue
+			}
+			if err := os.Remove(filepath.Join(bucketDir, ent.Name())); err == nil {
+				removed++
+			}
+		}
+		// Only succeeds once the bucket is empty.
+		_ = os.Remove(bucketDir)
+	}
+	return removed, nil
+}
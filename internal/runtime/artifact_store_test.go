@@ -0,0 +1,104 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"deeph/internal/project"
+	"deeph/internal/typesys"
+)
+
+func TestArtifactStoreSpillsToDiskAndResolvesPrefixes(t *testing.T) {
+	dir := t.TempDir()
+	store := NewArtifactStore(dir, 10)
+	first := store.Put([]byte("first payload"))
+	second := store.Put([]byte("second payload"))
+
+	if _, err := os.Stat(filepath.Join(dir, first[:2], first)); err != nil {
+		t.Fatalf("expected oldest payload to spill to disk: %v", err)
+	}
+	for hash, want := range map[string]string{first: "first payload", second: "second payload"} {
+		got, err := store.Get(hash)
+		if err != nil || string(got) != want {
+			t.Fatalf("Get(%s) = %q, %v", hash, got, err)
+		}
+	}
+
+	// A fresh store over the same directory still finds spilled payloads.
+	reopened := NewArtifactStore(dir, 0)
+	hash, err := reopened.Resolve("code/go:" + first[:12] + ":reviewer")
+	if err != nil || hash != first {
+		t.Fatalf("Resolve(id) = %q, %v", hash, err)
+	}
+	if _, err := reopened.Resolve("zz"); err == nil {
+		t.Fatal("expected invalid id error")
+	}
+}
+
+func TestArtifactReadPagesThroughBusArtifacts(t *testing.T) {
+	store := NewArtifactStore("", 0)
+	bus := NewContextBus("goal")
+	bus.SetArtifactStore(store)
+	var lines []string
+	for i := 1; i <= 30; i++ {
+		lines = append(lines, fmt.Sprintf("line %02d", i))
+	}
+	art := bus.PutArtifact(typesys.Kind("code/go"), ContextMomentToolLoop, "file_read", strings.Join(lines, "\n"), "30 lines")
+
+	skill := newSkill("", project.SkillConfig{Name: "artifact_read", Type: "artifact_read"})
+	out, err := skill.Execute(context.Background(), SkillExecution{Args: map[string]any{"id": art.ID, "start_line": 11, "end_line": 20}, Artifacts: store})
+	if err != nil {
+		t.Fatalf("artifact_read error: %v", err)
+	}
+	if out["text"] != strings.Join(lines[10:20], "\n") || out["total_lines"] != 30 || out["next_start_line"] != 21 || out["has_more"] != true {
+		t.Fatalf("unexpected page: %+v", out)
+	}
+	out, err = skill.Execute(context.Background(), SkillExecution{Args: map[string]any{"id": art.Hash[:8], "start_line": 21, "max_bytes": 16}, Artifacts: store})
+	if err != nil {
+		t.Fatalf("artifact_read by hash error: %v", err)
+	}
+	if out["text"] != "line 21\nline 22" || out["truncated"] != true {
+		t.Fatalf("unexpected truncated page: %+v", out)
+	}
+}
+
+func TestPruneArtifactsKeepsSnapshotReferencesAndFreshPayloads(t *testing.T) {
+	ws := t.TempDir()
+	store := NewArtifactStore(artifactStoreDir(ws), 1)
+	referenced := store.Put([]byte("referenced by a snapshot"))
+	stale := store.Put([]byte("stale tool output"))
+	fresh := store.Put([]byte("fresh tool output"))
+	store.Flush()
+	if _, err := SaveContextSnapshot(ws, ContextSnapshotFile{RunID: "20261018-120000-00001", Artifacts: []ContextArtifact{{Hash: referenced}}}); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * ArtifactRetention)
+	for _, hash := range []string{referenced, stale} {
+		if err := os.Chtimes(store.path(hash), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := PruneArtifacts(ws, ArtifactRetention, time.Now())
+	if err != nil || removed != 1 {
+		t.Fatalf("PruneArtifacts = %d, %v; want 1 removed", removed, err)
+	}
+	for hash, want := range map[string]bool{referenced: true, stale: false, fresh: true} {
+		_, err := os.Stat(store.path(hash))
+		if got := err == nil; got != want {
+			t.Fatalf("artifact %s on disk=%v, want %v", hash[:8], got, want)
+		}
+	}
+
+	// Putting a pruned payload again stores it anew.
+	store.Put([]byte("stale tool output"))
+	store.Flush()
+	if got, err := NewArtifactStore(artifactStoreDir(ws), 0).Get(stale); err != nil || string(got) != "stale tool output" {
+		t.Fatalf("expected re-put payload to be readable, got %q, %v", got, err)
+	}
+}
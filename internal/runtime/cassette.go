@@ -0,0 +1,373 @@
+package runtime
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const CassetteVersion = 1
+
+// Cassette is a recorded run: every provider request/response pair and
+// skill result, in call order. Replaying it serves the same responses back
+// without calling providers or running skills.
+type Cassette struct {
+	Version      int                   `json:"version"`
+	RecordedAt   time.Time             `json:"recorded_at"`
+	Spec         string                `json:"spec,omitempty"`
+	Input        string                `json:"input,omitempty"`
+	Interactions []CassetteInteraction `json:"interactions"`
+	Skills       []CassetteSkillCall   `json:"skills,omitempty"`
+}
+
+// CassetteInteraction is one provider Generate call.
+type CassetteInteraction struct {
+	Agent       string      `json:"agent"`
+	Provider    string      `json:"provider"`
+	Fingerprint string      `json:"fingerprint"`
+	Request     LLMRequest  `json:"request"`
+	Response    LLMResponse `json:"response"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// CassetteSkillCall is one skill execution (startup call or tool call).
+type CassetteSkillCall struct {
+	Agent       string         `json:"agent"`
+	Skill       string         `json:"skill"`
+	Fingerprint string         `json:"fingerprint"`
+	Args        map[string]any `json:"args,omitempty"`
+	Result      map[string]any `json:"result,omitempty"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// CassetteReplayStats reports how a replay was served. Exact matches hit by
+// fingerprint; fallbacks are the agent's next unserved recording, used when a
+// prompt or context change altered the request.
+type CassetteReplayStats struct {
+	Hits           int `json:"hits"`
+	Fallbacks      int `json:"fallbacks"`
+	SkillHits      int `json:"skill_hits"`
+	SkillFallbacks int `json:"skill_fallbacks"`
+	// Unused counts recorded interactions and skill calls never served.
+	Unused int `json:"unused"`
+}
+
+// LoadCassette reads a cassette file.
+func LoadCassette(path string) (Cassette, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Cassette{}, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Cassette{}, fmt.Errorf("parse cassette %s: %w", path, err)
+	}
+	if c.Version > CassetteVersion {
+		return Cassette{}, fmt.Errorf("cassette %s has version %d; this deeph reads up to %d", path, c.Version, CassetteVersion)
+	}
+	return c, nil
+}
+
+// SaveCassette writes c to path, creating parent directories.
+func SaveCassette(path string, c Cassette) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, append(b, '\n'), 0o644)
+}
+
+// CassetteRecorder collects a cassette while a run executes. It is safe for
+// concurrent agents.
+type CassetteRecorder struct {
+	mu sync.Mutex
+	c  Cassette
+}
+
+// NewCassetteRecorder starts a recording. input is stored as given, so pass
+// it through the engine's Redactor first.
+func NewCassetteRecorder(spec, input string) *CassetteRecorder {
+	return &CassetteRecorder{c: Cassette{Version: CassetteVersion, RecordedAt: time.Now().UTC(), Spec: spec, Input: input}}
+}
+
+// Cassette returns a copy of what has been recorded so far.
+func (r *CassetteRecorder) Cassette() Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.c
+	c.Interactions = append([]CassetteInteraction(nil), r.c.Interactions...)
+	c.Skills = append([]CassetteSkillCall(nil), r.c.Skills...)
+	if c.Interactions == nil {
+		c.Interactions = []CassetteInteraction{}
+	}
+	return c
+}
+
+func (r *CassetteRecorder) addInteraction(it CassetteInteraction) {
+	r.mu.Lock()
+	r.c.Interactions = append(r.c.Interactions, it)
+	r.mu.Unlock()
+}
+
+func (r *CassetteRecorder) addSkill(call CassetteSkillCall) {
+	r.mu.Lock()
+	r.c.Skills = append(r.c.Skills, call)
+	r.mu.Unlock()
+}
+
+// CassetteReplay serves a cassette back. Each recording is served once.
+type CassetteReplay struct {
+	mu        sync.Mutex
+	c         Cassette
+	used      []bool
+	skillUsed []bool
+	stats     CassetteReplayStats
+}
+
+func NewCassetteReplay(c Cassette) *CassetteReplay {
+	return &CassetteReplay{c: c, used: make([]bool, len(c.Interactions)), skillUsed: make([]bool, len(c.Skills))}
+}
+
+func (r *CassetteReplay) Stats() CassetteReplayStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.stats
+	s.Unused = 0
+	for _, u := range r.used {
+		if !u {
+			s.Unused++
+		}
+	}
+	for _, u := range r.skillUsed {
+		if !u {
+			s.Unused++
+		}
+	}
+	return s
+}
+
+func (r *CassetteReplay) generate(req LLMRequest) (LLMResponse, error) {
+	fp := requestFingerprint(req)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	idx := -1
+	for i, it := range r.c.Interactions {
+		if !r.used[i] && it.Fingerprint == fp {
+			idx = i
+			r.stats.Hits++
+			break
+		}
+	}
+	if idx < 0 {
+		for i, it := range r.c.Interactions {
+			if !r.used[i] && it.Agent == req.AgentName {
+				idx = i
+				r.stats.Fallbacks++
+				break
+			}
+		}
+	}
+	if idx < 0 {
+		return LLMResponse{}, fmt.Errorf("replay: cassette has no unserved response for agent %q (fingerprint %s)", req.AgentName, fp)
+	}
+	r.used[idx] = true
+	it := r.c.Interactions[idx]
+	if it.Error != "" {
+		return LLMResponse{}, errors.New(it.Error)
+	}
+	return it.Response, nil
+}
+
+func (r *CassetteReplay) skill(agent, skill, input string, args map[string]any) (map[string]any, error) {
+	fp := skillFingerprint(agent, skill, input, args)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	idx := -1
+	for i, call := range r.c.Skills {
+		if !r.skillUsed[i] && call.Fingerprint == fp {
+			idx = i
+			r.stats.SkillHits++
+			break
+		}
+	}
+	if idx < 0 {
+		for i, call := range r.c.Skills {
+			if !r.skillUsed[i] && call.Agent == agent && call.Skill == skill {
+				idx = i
+				r.stats.SkillFallbacks++
+				break
+			}
+		}
+	}
+	if idx < 0 {
+		return nil, fmt.Errorf("replay: cassette has no unserved %s result for agent %q", skill, agent)
+	}
+	r.skillUsed[idx] = true
+	call := r.c.Skills[idx]
+	if call.Error != "" {
+		return call.Result, errors.New(call.Error)
+	}
+	return call.Result, nil
+}
+
+// requestFingerprint hashes the parts of a request that determine the
+// response. Startup results are reduced to skill/result/error so timings do
+// not change the fingerprint.
+func requestFingerprint(req LLMRequest) string {
+	type startup struct {
+		Skill  string
+		Result map[string]any
+		Error  string
+	}
+	startups := make([]startup, 0, len(req.StartupResults))
+	for _, s := range req.StartupResults {
+		startups = append(startups, startup{Skill: s.Skill, Result: s.Result, Error: s.Error})
+	}
+	return fingerprintJSON(struct {
+		Agent, Model, System, Input, ToolChoice string
+		Skills                                  []string
+		Startup                                 []startup
+		Messages                                []ChatMessage
+		Tools                                   []LLMToolDefinition
+		Schema                                  map[string]any
+	}{req.AgentName, req.Model, req.SystemPrompt, req.Input, req.ToolChoice, req.AvailableSkills, startups, req.Messages, req.Tools, req.ResponseSchema})
+}
+
+func skillFingerprint(agent, skill, input string, args map[string]any) string {
+	return fingerprintJSON(struct {
+		Agent, Skill, Input string
+		Args                map[string]any
+	}{agent, skill, input, args})
+}
+
+func fingerprintJSON(v any) string {
+	b, _ := json.Marshal(v)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:12])
+}
+
+type cassetteRecorderKey struct{}
+type cassetteReplayKey struct{}
+
+// WithCassetteRecorder records every provider call and skill result of runs
+// executed with ctx into rec.
+func WithCassetteRecorder(ctx context.Context, rec *CassetteRecorder) context.Context {
+	return context.WithValue(ctx, cassetteRecorderKey{}, rec)
+}
+
+// WithCassetteReplay serves provider calls and skill results of runs
+// executed with ctx from rp instead of running them.
+func WithCassetteReplay(ctx context.Context, rp *CassetteReplay) context.Context {
+	return context.WithValue(ctx, cassetteReplayKey{}, rp)
+}
+
+func cassetteRecorderFrom(ctx context.Context) *CassetteRecorder {
+	rec, _ := ctx.Value(cassetteRecorderKey{}).(*CassetteRecorder)
+	return rec
+}
+
+func cassetteReplayFrom(ctx context.Context) *CassetteReplay {
+	rp, _ := ctx.Value(cassetteReplayKey{}).(*CassetteReplay)
+	return rp
+}
+
+// recordingProvider records each Generate call. Stored text is redacted; the
+// fingerprint is taken from the request as sent.
+type recordingProvider struct {
+	Provider
+	rec    *CassetteRecorder
+	redact func(string) string
+}
+
+func (p recordingProvider) Generate(ctx context.Context, req LLMRequest) (LLMResponse, error) {
+	resp, err := p.Provider.Generate(ctx, req)
+	it := CassetteInteraction{
+		Agent:       req.AgentName,
+		Provider:    p.Provider.Name(),
+		Fingerprint: requestFingerprint(req),
+		Request:     redactLLMRequest(req, p.redact),
+		Response:    resp,
+	}
+	it.Response.Text = p.redact(resp.Text)
+	it.Response.ReasoningContent = p.redact(resp.ReasoningContent)
+	if err != nil {
+		it.Error = p.redact(err.Error())
+	}
+	p.rec.addInteraction(it)
+	return resp, err
+}
+
+func redactLLMRequest(req LLMRequest, redact func(string) string) LLMRequest {
+	req.SystemPrompt = redact(req.SystemPrompt)
+	req.Input = redact(req.Input)
+	msgs := make([]ChatMessage, len(req.Messages))
+	for i, m := range req.Messages {
+		m.Content = redact(m.Content)
+		m.ReasoningContent = redact(m.ReasoningContent)
+		msgs[i] = m
+	}
+	req.Messages = msgs
+	return req
+}
+
+// replayProvider answers from a cassette under the original provider name.
+type replayProvider struct {
+	name   string
+	replay *CassetteReplay
+}
+
+func (p replayProvider) Name() string { return p.name }
+
+func (p replayProvider) Generate(_ context.Context, req LLMRequest) (LLMResponse, error) {
+	return p.replay.generate(req)
+}
+
+// cassetteProvider wraps provider for recording or replay when ctx asks for it.
+func (e *Engine) cassetteProvider(ctx context.Context, provider Provider) Provider {
+	if rp := cassetteReplayFrom(ctx); rp != nil {
+		return replayProvider{name: provider.Name(), replay: rp}
+	}
+	if rec := cassetteRecorderFrom(ctx); rec != nil {
+		return recordingProvider{Provider: provider, rec: rec, redact: e.redactor.Redact}
+	}
+	return provider
+}
+
+// cassetteSkill wraps a skill run for recording or replay when ctx asks for
+// it. run already returns redacted results.
+func (e *Engine) cassetteSkill(ctx context.Context, agent, skill, input string, args map[string]any, run func(context.Context) (map[string]any, error)) func(context.Context) (map[string]any, error) {
+	if rp := cassetteReplayFrom(ctx); rp != nil {
+		return func(context.Context) (map[string]any, error) {
+			return rp.skill(agent, skill, input, args)
+		}
+	}
+	rec := cassetteRecorderFrom(ctx)
+	if rec == nil {
+		return run
+	}
+	return func(runCtx context.Context) (map[string]any, error) {
+		out, err := run(runCtx)
+		call := CassetteSkillCall{
+			Agent:       agent,
+			Skill:       skill,
+			Fingerprint: skillFingerprint(agent, skill, input, args),
+			Args:        e.redactor.redactMap(args, nil),
+			Result:      out,
+		}
+		if err != nil {
+			call.Error = err.Error()
+		}
+		rec.addSkill(call)
+		return out, err
+	}
+}
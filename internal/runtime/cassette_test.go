@@ -0,0 +1,95 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"deeph/internal/project"
+)
+
+type failingProvider struct{ calls int }
+
+func (p *failingProvider) Name() string { return "local_mock" }
+
+func (p *failingProvider) Generate(context.Context, LLMRequest) (LLMResponse, error) {
+	p.calls++
+	return LLMResponse{}, errors.New("live provider called during replay")
+}
+
+func cassetteTestProject(prompt string) *project.Project {
+	return &project.Project{
+		Root: project.RootConfig{
+			Version:         1,
+			DefaultProvider: "local_mock",
+			Providers:       []project.ProviderConfig{{Name: "local_mock", Type: "mock", Model: "mock-small"}},
+		},
+		Agents: []project.AgentConfig{{
+			Name:         "planner",
+			Provider:     "local_mock",
+			SystemPrompt: prompt,
+			Skills:       []string{"echo"},
+			StartupCalls: []project.SkillCall{{Skill: "echo", Args: map[string]any{"note": "warmup"}}},
+		}},
+		Skills: []project.SkillConfig{{Name: "echo", Type: "echo"}},
+	}
+}
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	ws := t.TempDir()
+	eng, err := New(ws, cassetteTestProject("Plan carefully."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := NewCassetteRecorder("planner", "ship it")
+	recorded, err := eng.Run(WithCassetteRecorder(context.Background(), rec), []string{"planner"}, "ship it")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(ws, "cassette.json")
+	if err := SaveCassette(path, rec.Cassette()); err != nil {
+		t.Fatal(err)
+	}
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cassette.Interactions) != 1 || len(cassette.Skills) != 1 || cassette.Spec != "planner" {
+		t.Fatalf("unexpected cassette: %+v", cassette)
+	}
+
+	replay := func(prompt string, c Cassette) (ExecutionReport, *failingProvider) {
+		t.Helper()
+		eng, err := New(ws, cassetteTestProject(prompt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		live := &failingProvider{}
+		eng.providers["local_mock"] = live
+		report, err := eng.Run(WithCassetteReplay(context.Background(), NewCassetteReplay(c)), []string{"planner"}, "ship it")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report, live
+	}
+
+	report, live := replay("Plan carefully.", cassette)
+	if live.calls != 0 || report.Results[0].Output != recorded.Results[0].Output {
+		t.Fatalf("replay diverged: calls=%d output=%q", live.calls, report.Results[0].Output)
+	}
+	if s := report.Replay; s == nil || s.Hits != 1 || s.SkillHits != 1 || s.Fallbacks != 0 || s.Unused != 0 {
+		t.Fatalf("unexpected replay stats: %+v", report.Replay)
+	}
+
+	report, _ = replay("Plan very carefully.", cassette)
+	if s := report.Replay; s.Hits != 0 || s.Fallbacks != 1 || report.Results[0].Output != recorded.Results[0].Output {
+		t.Fatalf("expected agent fallback after prompt change, got %+v", s)
+	}
+
+	report, live = replay("Plan carefully.", Cassette{Version: CassetteVersion})
+	if live.calls != 0 || !strings.Contains(report.Results[0].Error, "replay:") {
+		t.Fatalf("expected replay miss error, got %q", report.Results[0].Error)
+	}
+}
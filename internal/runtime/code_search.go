@@ -0,0 +1,302 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"deeph/internal/project"
+	"deeph/internal/reviewscope"
+	"deeph/internal/typesys"
+)
+
+const (
+	defaultCodeSearchMaxResults   = 50
+	maxCodeSearchResults          = 500
+	maxCodeSearchContextLines     = 5
+	defaultCodeSearchMaxFileBytes = 1 << 20
+	maxCodeSearchLineChars        = 300
+)
+
+type CodeSearchSkill struct {
+	cfg       project.SkillConfig
+	workspace string
+}
+
+type codeSearchMatch struct {
+	Path   string   `json:"path"`
+	Line   int      `json:"line"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+func (s *CodeSearchSkill) Name() string { return s.cfg.Name }
+func (s *CodeSearchSkill) Description() string {
+	return coalesce(s.cfg.Description, "Searches workspace code by regex/literal text or looks up Go symbols")
+}
+func (s *CodeSearchSkill) Execute(ctx context.Context, exec SkillExecution) (map[string]any, error) {
+	mode := strings.ToLower(strings.TrimSpace(anyString(exec.Args["mode"])))
+	if mode == "" && strings.TrimSpace(anyString(exec.Args["symbol"])) != "" && strings.TrimSpace(anyString(exec.Args["pattern"])) == "" {
+		mode = "symbol"
+	}
+	switch mode {
+	case "", "grep", "text", "regex":
+		return s.grep(ctx, exec.Args, exec.Paths)
+	case "symbol", "symbol_lookup":
+		return s.lookupSymbol(exec.Args, exec.Paths)
+	default:
+		return nil, fmt.Errorf("code_search mode must be grep or symbol (got %q)", mode)
+	}
+}
+
+func (s *CodeSearchSkill) grep(ctx context.Context, args map[string]any, paths PathPolicy) (map[string]any, error) {
+	pattern := anyString(args["pattern"])
+	if strings.TrimSpace(pattern) == "" {
+		return nil, fmt.Errorf("code_search requires args.pattern (string)")
+	}
+	literal, _ := boolArg(args, "literal")
+	ignoreCase, _ := boolArg(args, "ignore_case")
+	expr := pattern
+	if literal {
+		expr = regexp.QuoteMeta(pattern)
+	}
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	root := "."
+	if raw := strings.TrimSpace(anyString(args["path"])); raw != "" {
+		clean, full, err := resolvePolicyPath(s.workspace, paths, raw, true)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(full); err != nil {
+			return nil, err
+		}
+		root = clean
+	}
+	globs := stringListParam(args, "glob")
+	if len(globs) == 0 {
+		globs = stringListParam(s.cfg.Params, "glob")
+	}
+
+	maxResults := defaultCodeSearchMaxResults
+	if v, ok := intParam(s.cfg.Params, "max_results"); ok && v > 0 {
+		maxResults = v
+	}
+	if v, ok := intArg(args, "max_results"); ok && v > 0 && v < maxResults {
+		maxResults = v
+	}
+	if maxResults > maxCodeSearchResults {
+		maxResults = maxCodeSearchResults
+	}
+	contextLines := 0
+	if v, ok := intArg(args, "context_lines"); ok && v > 0 {
+		contextLines = v
+	}
+	if contextLines > maxCodeSearchContextLines {
+		contextLines = maxCodeSearchContextLines
+	}
+	maxFileBytes := defaultCodeSearchMaxFileBytes
+	if v, ok := intParam(s.cfg.Params, "max_file_bytes"); ok && v > 0 {
+		maxFileBytes = v
+	}
+
+	var (
+		matches      []codeSearchMatch
+		filesScanned int
+		filesMatched int
+		truncated    bool
+	)
+	err = walkWorkspaceFiles(s.workspace, root, func(rel string, d fs.DirEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if len(globs) > 0 && !codeSearchGlobMatch(globs, rel) {
+			return nil
+		}
+		if !paths.Allows(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() > int64(maxFileBytes) {
+			return nil
+		}
+		data, err := os.ReadFile(filepath.Join(s.workspace, filepath.FromSlash(rel)))
+		if err != nil || isBinaryContent(data) {
+			return nil
+		}
+		filesScanned++
+		lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+		matchedFile := false
+		for i, line := range lines {
+			if !re.MatchString(line) {
+				continue
+			}
+			if len(matches) >= maxResults {
+				truncated = true
+				return fs.SkipAll
+			}
+			m := codeSearchMatch{Path: rel, Line: i + 1, Text: clipCodeSearchLine(line)}
+			if contextLines > 0 {
+				for j := max(0, i-contextLines); j < i; j++ {
+					m.Before = append(m.Before, clipCodeSearchLine(lines[j]))
+				}
+				for j := i + 1; j < len(lines) && j <= i+contextLines; j++ {
+					m.After = append(m.After, clipCodeSearchLine(lines[j]))
+				}
+			}
+			matches = append(matches, m)
+			matchedFile = true
+		}
+		if matchedFile {
+			filesMatched++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"mode":          "grep",
+		"pattern":       pattern,
+		"root":          filepath.ToSlash(root),
+		"matches":       matches,
+		"match_count":   len(matches),
+		"files_matched": filesMatched,
+		"files_scanned": filesScanned,
+		"truncated":     truncated,
+		"text":          renderCodeSearchMatches(matches),
+		"detected_kind": typesys.KindToolResult.String(),
+	}, nil
+}
+
+func (s *CodeSearchSkill) lookupSymbol(args map[string]any, paths PathPolicy) (map[string]any, error) {
+	symbol := strings.TrimSpace(coalesce(anyString(args["symbol"]), anyString(args["pattern"])))
+	if symbol == "" {
+		return nil, fmt.Errorf("code_search symbol mode requires args.symbol (string)")
+	}
+	locs, err := reviewscope.LookupGoSymbol(s.workspace, symbol)
+	if err != nil {
+		return nil, err
+	}
+	maxFiles := 20
+	if v, ok := intParam(s.cfg.Params, "max_symbol_files"); ok && v > 0 {
+		maxFiles = v
+	}
+	truncated := false
+	for i := range locs {
+		locs[i].DeclaredIn = allowedPaths(paths, locs[i].DeclaredIn)
+		locs[i].ReferencedBy = allowedPaths(paths, locs[i].ReferencedBy)
+		if len(locs[i].ReferencedBy) > maxFiles {
+			locs[i].ReferencedBy = clipStrings(locs[i].ReferencedBy, maxFiles)
+			truncated = true
+		}
+		if len(locs[i].ImportedBy) > maxFiles {
+			locs[i].ImportedBy = clipStrings(locs[i].ImportedBy, maxFiles)
+			truncated = true
+		}
+	}
+	var b strings.Builder
+	for _, loc := range locs {
+		fmt.Fprintf(&b, "%s (package %s)\n", loc.Symbol, loc.Package)
+		fmt.Fprintf(&b, "  declared: %s\n", strings.Join(loc.DeclaredIn, ", "))
+		if len(loc.ReferencedBy) > 0 {
+			fmt.Fprintf(&b, "  referenced: %s\n", strings.Join(loc.ReferencedBy, ", "))
+		}
+		if len(loc.ImportedBy) > 0 {
+			fmt.Fprintf(&b, "  imported by: %s\n", strings.Join(loc.ImportedBy, ", "))
+		}
+	}
+	if len(locs) == 0 {
+		fmt.Fprintf(&b, "no Go declaration found for %q\n", symbol)
+	}
+	return map[string]any{
+		"mode":          "symbol",
+		"symbol":        symbol,
+		"found":         len(locs) > 0,
+		"symbols":       locs,
+		"truncated":     truncated,
+		"text":          strings.TrimRight(b.String(), "\n"),
+		"detected_kind": typesys.KindToolResult.String(),
+	}, nil
+}
+
+// codeSearchGlobMatch matches patterns without a slash against the base name
+// ("*.go") and patterns with a slash against the full relative path ("internal/**/*.go").
+func codeSearchGlobMatch(globs []string, rel string) bool {
+	for _, g := range globs {
+		g = strings.TrimSpace(g)
+		if g == "" {
+			continue
+		}
+		if strings.Contains(g, "/") {
+			if matchGlobPath(strings.TrimPrefix(g, "/"), rel) {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(g, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isBinaryContent(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+func clipCodeSearchLine(line string) string {
+	line = strings.TrimRight(line, "\r")
+	if len(line) <= maxCodeSearchLineChars {
+		return line
+	}
+	cut := maxCodeSearchLineChars
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut] + "..."
+}
+
+func renderCodeSearchMatches(matches []codeSearchMatch) string {
+	var b strings.Builder
+	for i, m := range matches {
+		if i > 0 && (len(m.Before) > 0 || len(m.After) > 0) {
+			b.WriteString("--\n")
+		}
+		for j, line := range m.Before {
+			fmt.Fprintf(&b, "%s-%d-%s\n", m.Path, m.Line-len(m.Before)+j, line)
+		}
+		fmt.Fprintf(&b, "%s:%d:%s\n", m.Path, m.Line, m.Text)
+		for j, line := range m.After {
+			fmt.Fprintf(&b, "%s-%d-%s\n", m.Path, m.Line+1+j, line)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func allowedPaths(paths PathPolicy, list []string) []string {
+	out := list[:0]
+	for _, rel := range list {
+		if paths.Allows(rel) {
+			out = append(out, rel)
+		}
+	}
+	return out
+}
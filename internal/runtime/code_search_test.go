@@ -0,0 +1,141 @@
+package runtime
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"deeph/internal/project"
+	"deeph/internal/reviewscope"
+)
+
+func writeCodeSearchFile(t *testing.T, ws, rel, body string) {
+	t.Helper()
+	full := filepath.Join(ws, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		t.Fatalf("mkdir %s: %v", rel, err)
+	}
+	if err := os.WriteFile(full, []byte(body), 0o644); err != nil {
+		t.Fatalf("write %s: %v", rel, err)
+	}
+}
+
+func codeSearchPaths(out map[string]any) []string {
+	matches, _ := out["matches"].([]codeSearchMatch)
+	paths := make([]string, 0, len(matches))
+	for _, m := range matches {
+		paths = append(paths, m.Path)
+	}
+	return paths
+}
+
+func TestCodeSearchGrepHonoursGitignoreAndGlobs(t *testing.T) {
+	ws := t.TempDir()
+	writeCodeSearchFile(t, ws, ".gitignore", "build/\n*.gen.go\n!keep.gen.go\n")
+	writeCodeSearchFile(t, ws, "app/main.go", "package app\n\nfunc NewServer() {}\n")
+	writeCodeSearchFile(t, ws, "app/server.ts", "export function NewServer() {}\n")
+	writeCodeSearchFile(t, ws, "app/zz.gen.go", "package app\n\nfunc NewServer2() {}\n")
+	writeCodeSearchFile(t, ws, "app/keep.gen.go", "package app\n\nfunc NewServer3() {}\n")
+	writeCodeSearchFile(t, ws, "build/out.go", "package build\n\nfunc NewServer() {}\n")
+	writeCodeSearchFile(t, ws, "node_modules/pkg/index.go", "func NewServer() {}\n")
+	writeCodeSearchFile(t, ws, "app/nested/.gitignore", "local.go\n")
+	writeCodeSearchFile(t, ws, "app/nested/local.go", "func NewServer() {}\n")
+
+	s := &CodeSearchSkill{cfg: project.SkillConfig{Name: "code_search", Type: "code_search"}, workspace: ws}
+	out, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{
+		"pattern": `func NewServer\d?\(`,
+		"glob":    "*.go",
+	}})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	got := strings.Join(codeSearchPaths(out), ",")
+	if got != "app/keep.gen.go,app/main.go" {
+		t.Fatalf("unexpected matched paths: %q", got)
+	}
+	if text, _ := out["text"].(string); !strings.Contains(text, "app/main.go:3:func NewServer() {}") {
+		t.Fatalf("expected grep-style text, got %q", text)
+	}
+}
+
+func TestCodeSearchGrepLiteralContextAndLimit(t *testing.T) {
+	ws := t.TempDir()
+	writeCodeSearchFile(t, ws, "a.txt", "one\ncall(x)\ntwo\ncall(x)\nthree\ncall(x)\n")
+
+	s := &CodeSearchSkill{cfg: project.SkillConfig{Name: "code_search", Type: "code_search"}, workspace: ws}
+	out, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{
+		"pattern":       "call(x)",
+		"literal":       true,
+		"context_lines": 1,
+		"max_results":   2,
+	}})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	matches, _ := out["matches"].([]codeSearchMatch)
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(matches))
+	}
+	if truncated, _ := out["truncated"].(bool); !truncated {
+		t.Fatalf("expected truncated=true")
+	}
+	if matches[0].Line != 2 || strings.Join(matches[0].Before, "|") != "one" || strings.Join(matches[0].After, "|") != "two" {
+		t.Fatalf("unexpected context: %+v", matches[0])
+	}
+	if _, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"pattern": "x", "path": "../"}}); err == nil {
+		t.Fatalf("expected workspace escape to be rejected")
+	}
+}
+
+func TestCodeSearchSymbolLookup(t *testing.T) {
+	ws := t.TempDir()
+	writeCodeSearchFile(t, ws, "go.mod", "module example.com/app\n\ngo 1.24.0\n")
+	writeCodeSearchFile(t, ws, "store/store.go", "package store\n\nfunc Open() {}\n")
+	writeCodeSearchFile(t, ws, "svc/svc.go", "package svc\n\nimport \"example.com/app/store\"\n\nfunc Run() { store.Open() }\n")
+
+	s := &CodeSearchSkill{cfg: project.SkillConfig{Name: "code_search", Type: "code_search"}, workspace: ws}
+	out, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"mode": "symbol", "symbol": "Open"}})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if found, _ := out["found"].(bool); !found {
+		t.Fatalf("expected symbol to be found: %#v", out)
+	}
+	locs, _ := out["symbols"].([]reviewscope.SymbolLocation)
+	if len(locs) != 1 || locs[0].DeclaredIn[0] != "store/store.go" || strings.Join(locs[0].ReferencedBy, ",") != "svc/svc.go" {
+		t.Fatalf("unexpected symbol locations: %+v", locs)
+	}
+}
+
+func TestGitignoreMatcherAnchoredAndDoubleStar(t *testing.T) {
+	m := &gitignoreMatcher{rules: []gitignoreRule{
+		{pattern: "docs/**/*.md", anchored: true},
+		{pattern: "tmp", anchored: true},
+	}}
+	cases := map[string]bool{
+		"docs/a/b/c.md": true,
+		"docs/c.md":     true,
+		"src/docs/c.md": false,
+		"tmp":           true,
+		"src/tmp":       false,
+	}
+	for rel, want := range cases {
+		if got := m.ignored(rel, false); got != want {
+			t.Fatalf("ignored(%q)=%v want %v", rel, got, want)
+		}
+	}
+}
+
+func TestClipCodeSearchLineKeepsRunesWhole(t *testing.T) {
+	line := strings.Repeat("a", maxCodeSearchLineChars-1) + "é tail"
+	got := clipCodeSearchLine(line)
+	if !utf8.ValidString(got) {
+		t.Fatalf("clipped line is not valid UTF-8: %q", got[len(got)-8:])
+	}
+	if want := strings.Repeat("a", maxCodeSearchLineChars-1) + "..."; got != want {
+		t.Fatalf("unexpected clip: %q", got[len(got)-8:])
+	}
+}
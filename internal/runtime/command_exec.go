@@ -0,0 +1,354 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"strings"
+	"time"
+
+	"deeph/internal/capbuf"
+	"deeph/internal/project"
+	"deeph/internal/typesys"
+)
+
+const (
+	defaultCommandExecTimeout        = 120 * time.Second
+	defaultCommandExecMaxOutputBytes = 64 * 1024
+)
+
+// commandExecBaseEnv is the environment allowlist passed to child processes.
+// Everything else (API keys, tokens, cloud credentials) is scrubbed unless the
+// skill opts in through params.env_allow.
+var commandExecBaseEnv = []string{
+	"PATH",
+	"HOME",
+	"USER",
+	"LOGNAME",
+	"LANG",
+	"LC_ALL",
+	"TERM",
+	"TMPDIR",
+	"TMP",
+	"TEMP",
+	"SYSTEMROOT",
+	"COMSPEC",
+	"PATHEXT",
+	"APPDATA",
+	"LOCALAPPDATA",
+	"USERPROFILE",
+	"GOPATH",
+	"GOROOT",
+	"GOCACHE",
+	"GOMODCACHE",
+	"GOFLAGS",
+	"GOPROXY",
+	"GOPRIVATE",
+	"GOTOOLCHAIN",
+	"CGO_ENABLED",
+	"NODE_PATH",
+	"NPM_CONFIG_CACHE",
+}
+
+type CommandExecSkill struct {
+	cfg       project.SkillConfig
+	workspace string
+}
+
+func (s *CommandExecSkill) Name() string { return s.cfg.Name }
+func (s *CommandExecSkill) Description() string {
+	return coalesce(s.cfg.Description, "Runs an allowlisted command (build/test) inside the workspace")
+}
+func (s *CommandExecSkill) Execute(ctx context.Context, exec SkillExecution) (map[string]any, error) {
+	argv, err := commandExecArgv(exec.Args)
+	if err != nil {
+		return nil, err
+	}
+	allow := commandExecAllowlist(s.cfg)
+	if len(allow) == 0 {
+		return nil, fmt.Errorf("command_exec has no allowlisted commands (set params.allow)")
+	}
+	if !commandAllowed(argv, allow) {
+		return nil, fmt.Errorf("command %q is not allowlisted (allowed: %s)", strings.Join(argv, " "), strings.Join(allow, ", "))
+	}
+	if flag := commandExecDelegatingFlag(argv); flag != "" {
+		return nil, fmt.Errorf("command %q uses %s, which runs an arbitrary program and is never allowed", strings.Join(argv, " "), flag)
+	}
+
+	dir := "."
+	fullDir := s.workspace
+	if raw := strings.TrimSpace(anyString(exec.Args["dir"])); raw != "" {
+		clean, full, err := resolveWorkspacePath(s.workspace, raw)
+		if err != nil {
+			return nil, err
+		}
+		st, err := os.Stat(full)
+		if err != nil {
+			return nil, err
+		}
+		if !st.IsDir() {
+			return nil, fmt.Errorf("dir %q is not a directory", clean)
+		}
+		dir, fullDir = clean, full
+	}
+
+	timeout := defaultCommandExecTimeout
+	if s.cfg.TimeoutMS > 0 {
+		timeout = time.Duration(s.cfg.TimeoutMS) * time.Millisecond
+	}
+	if v, ok := intArg(exec.Args, "timeout_ms"); ok && v > 0 && time.Duration(v)*time.Millisecond < timeout {
+		timeout = time.Duration(v) * time.Millisecond
+	}
+	maxBytes := defaultCommandExecMaxOutputBytes
+	if v, ok := intParam(s.cfg.Params, "max_output_bytes"); ok && v > 0 {
+		maxBytes = v
+	}
+	isolateNet := strings.EqualFold(strings.TrimSpace(anyString(s.cfg.Params["network"])), "off")
+
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	out, isolated, runErr := runCommandExec(runCtx, argv, fullDir, commandExecEnv(s.cfg), maxBytes, isolateNet)
+	duration := time.Since(start)
+
+	timedOut := errors.Is(runCtx.Err(), context.DeadlineExceeded)
+	exitCode := 0
+	if runErr != nil {
+		var exitErr *osexec.ExitError
+		switch {
+		case errors.As(runErr, &exitErr):
+			exitCode = exitErr.ExitCode()
+		case timedOut:
+			exitCode = -1
+		case errors.Is(runErr, osexec.ErrNotFound):
+			return nil, fmt.Errorf("command %q not found in PATH", argv[0])
+		default:
+			return nil, runErr
+		}
+	}
+	if timedOut && exitCode == 0 {
+		exitCode = -1
+	}
+
+	text := out.String()
+	kind := commandExecResultKind(s.cfg, argv)
+	result := map[string]any{
+		"command":       strings.Join(argv, " "),
+		"argv":          argv,
+		"dir":           dir,
+		"exit_code":     exitCode,
+		"ok":            exitCode == 0 && !timedOut,
+		"timed_out":     timedOut,
+		"truncated":     out.Truncated(),
+		"bytes":         len(text),
+		"duration_ms":   int(duration / time.Millisecond),
+		"text":          text,
+		"detected_kind": kind.String(),
+	}
+	if isolateNet {
+		result["network_isolated"] = isolated
+	}
+	if timedOut {
+		result["note"] = fmt.Sprintf("command timed out after %s", timeout)
+	}
+	return result, nil
+}
+
+func runCommandExec(ctx context.Context, argv []string, dir string, env []string, maxBytes int, isolateNet bool) (*capbuf.Buffer, bool, error) {
+	run := func(isolate bool) (*capbuf.Buffer, bool, error) {
+		out := capbuf.New(maxBytes)
+		cmd := osexec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.Dir = dir
+		cmd.Env = env
+		cmd.Stdin = nil
+		cmd.Stdout = out
+		cmd.Stderr = out
+		cmd.WaitDelay = 2 * time.Second
+		applied := configureCommandExec(cmd, isolate)
+		if err := cmd.Start(); err != nil {
+			return out, applied, err
+		}
+		return out, applied, cmd.Wait()
+	}
+	out, applied, err := run(isolateNet)
+	if isolateNet && applied && err != nil && isNamespaceStartError(err) {
+		// Namespaces can be disabled by the host (containers, hardened kernels); degrade gracefully.
+		return run(false)
+	}
+	return out, applied, err
+}
+
+func commandExecArgv(args map[string]any) ([]string, error) {
+	cmdLine := strings.TrimSpace(anyString(args["command"]))
+	if cmdLine == "" {
+		return nil, fmt.Errorf("command_exec requires args.command (string)")
+	}
+	argv, err := splitCommandLine(cmdLine)
+	if err != nil {
+		return nil, err
+	}
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("command_exec requires args.command (string)")
+	}
+	return argv, nil
+}
+
+// splitCommandLine tokenizes a command without invoking a shell.
+// Single and double quotes group words; pipes, redirects and globs stay literal.
+func splitCommandLine(s string) ([]string, error) {
+	var (
+		out   []string
+		cur   strings.Builder
+		quote rune
+		inTok bool
+	)
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+				continue
+			}
+			cur.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inTok = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inTok {
+				out = append(out, cur.String())
+				cur.Reset()
+				inTok = false
+			}
+		default:
+			cur.WriteRune(r)
+			inTok = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in command")
+	}
+	if inTok {
+		out = append(out, cur.String())
+	}
+	return out, nil
+}
+
+func commandExecAllowlist(cfg project.SkillConfig) []string {
+	raw := stringListParam(cfg.Params, "allow")
+	out := make([]string, 0, len(raw))
+	for _, entry := range raw {
+		entry = strings.Join(strings.Fields(entry), " ")
+		if entry == "" {
+			continue
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+// commandAllowed matches argv against allowlist entries token by token,
+// so "go test" permits "go test ./..." but not "go tool" or "/usr/bin/go test".
+func commandAllowed(argv []string, allow []string) bool {
+	if len(argv) == 0 {
+		return false
+	}
+	for _, entry := range allow {
+		prefix := strings.Fields(entry)
+		if len(prefix) == 0 || len(prefix) > len(argv) {
+			continue
+		}
+		match := true
+		for i, tok := range prefix {
+			if argv[i] != tok {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// commandExecDelegatingFlags lists flags that make an allowlisted tool run
+// another program, which would turn "go test" into "run any binary".
+var commandExecDelegatingFlags = map[string][]string{
+	"go":    {"-exec", "-toolexec", "-vettool"},
+	"cargo": {"--config", "-Z"},
+	"npm":   {"--script-shell"},
+	"pnpm":  {"--script-shell"},
+	"yarn":  {"--script-shell"},
+}
+
+// commandExecDelegatingFlag returns the first delegating flag in argv, in
+// either -flag or --flag spelling and with or without an =value, or "".
+func commandExecDelegatingFlag(argv []string) string {
+	flags := commandExecDelegatingFlags[argv[0]]
+	for _, tok := range argv[1:] {
+		if tok == "--" {
+			break
+		}
+		name, _, _ := strings.Cut(tok, "=")
+		for _, flag := range flags {
+			bare := strings.TrimLeft(flag, "-")
+			if name == flag || name == "-"+bare || name == "--"+bare {
+				return flag
+			}
+		}
+	}
+	return ""
+}
+
+func commandExecEnv(cfg project.SkillConfig) []string {
+	allowed := map[string]struct{}{}
+	for _, k := range commandExecBaseEnv {
+		allowed[strings.ToUpper(k)] = struct{}{}
+	}
+	for _, k := range stringListParam(cfg.Params, "env_allow") {
+		if k = strings.TrimSpace(k); k != "" {
+			allowed[strings.ToUpper(k)] = struct{}{}
+		}
+	}
+	env := make([]string, 0, len(allowed)+4)
+	for _, kv := range os.Environ() {
+		k, _, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		if _, ok := allowed[strings.ToUpper(k)]; !ok {
+			continue
+		}
+		env = append(env, kv)
+	}
+	if fixed, ok := cfg.Params["env"].(map[string]any); ok {
+		for k, v := range fixed {
+			k = strings.TrimSpace(k)
+			if k == "" {
+				continue
+			}
+			env = append(env, k+"="+fmt.Sprint(v))
+		}
+	}
+	return env
+}
+
+func commandExecResultKind(cfg project.SkillConfig, argv []string) typesys.Kind {
+	if raw := strings.TrimSpace(anyString(cfg.Params["kind"])); raw != "" {
+		if k, ok := typesys.NormalizeKind(raw); ok {
+			return k
+		}
+	}
+	for _, tok := range argv {
+		switch strings.ToLower(tok) {
+		case "test", "tests", "jest", "vitest", "pytest", "mocha":
+			return typesys.KindDiagnosticTest
+		case "vet", "lint", "eslint", "golangci-lint", "staticcheck", "ruff", "clippy":
+			return typesys.KindDiagnosticLint
+		}
+	}
+	return typesys.KindDiagnosticBuild
+}
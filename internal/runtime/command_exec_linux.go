@@ -0,0 +1,39 @@
+//go:build linux
+
+package runtime
+
+import (
+	"errors"
+	"os"
+	osexec "os/exec"
+	"syscall"
+)
+
+// configureCommandExec puts the child in its own process group (so timeouts kill
+// the whole tree) and, when requested, in fresh user+network namespaces so it only
+// sees a loopback interface. It reports whether network isolation was applied.
+func configureCommandExec(cmd *osexec.Cmd, isolateNet bool) bool {
+	attr := &syscall.SysProcAttr{Setpgid: true}
+	if isolateNet {
+		uid, gid := os.Getuid(), os.Getgid()
+		attr.Cloneflags = syscall.CLONE_NEWNET | syscall.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+		attr.GidMappingsEnableSetgroups = false
+	}
+	cmd.SysProcAttr = attr
+	cmd.Cancel = func() error {
+		if cmd.Process == nil {
+			return nil
+		}
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+	return isolateNet
+}
+
+func isNamespaceStartError(err error) bool {
+	return errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EUSERS)
+}
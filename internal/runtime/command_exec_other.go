@@ -0,0 +1,18 @@
+//go:build !linux
+
+package runtime
+
+import osexec "os/exec"
+
+// configureCommandExec is a no-op outside Linux: network namespaces are unavailable,
+// so network=off degrades to unrestricted and the result reports network_isolated=false.
+func configureCommandExec(cmd *osexec.Cmd, isolateNet bool) bool {
+	_ = cmd
+	_ = isolateNet
+	return false
+}
+
+func isNamespaceStartError(err error) bool {
+	_ = err
+	return false
+}
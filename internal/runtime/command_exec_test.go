@@ -0,0 +1,170 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"deeph/internal/project"
+)
+
+func TestCommandExecSkillRunsAllowlistedCommand(t *testing.T) {
+	s := &CommandExecSkill{
+		cfg: project.SkillConfig{
+			Name:   "command_exec",
+			Type:   "command_exec",
+			Params: map[string]any{"allow": []any{"go env"}},
+		},
+		workspace: t.TempDir(),
+	}
+	out, err := s.Execute(context.Background(), SkillExecution{
+		Args: map[string]any{"command": "go env GOOS"},
+	})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if ok, _ := out["ok"].(bool); !ok {
+		t.Fatalf("expected ok=true, got %#v (text=%q)", out["ok"], out["text"])
+	}
+	if code, _ := out["exit_code"].(int); code != 0 {
+		t.Fatalf("expected exit_code=0, got %d", code)
+	}
+	if text, _ := out["text"].(string); strings.TrimSpace(text) == "" {
+		t.Fatalf("expected command output, got empty text")
+	}
+	if got, _ := out["detected_kind"].(string); got != "diagnostic/build" {
+		t.Fatalf("expected detected_kind=diagnostic/build, got %q", got)
+	}
+}
+
+func TestCommandExecSkillRejectsCommandOutsideAllowlist(t *testing.T) {
+	s := &CommandExecSkill{
+		cfg: project.SkillConfig{
+			Name:   "command_exec",
+			Type:   "command_exec",
+			Params: map[string]any{"allow": []any{"go test"}},
+		},
+		workspace: t.TempDir(),
+	}
+	for _, cmdLine := range []string{"go env", "gotest", "/usr/bin/go test", "rm -rf ."} {
+		_, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"command": cmdLine}})
+		if err == nil || !strings.Contains(err.Error(), "not allowlisted") {
+			t.Fatalf("command %q: expected allowlist error, got %v", cmdLine, err)
+		}
+	}
+}
+
+func TestCommandExecSkillRejectsFlagsThatRunOtherPrograms(t *testing.T) {
+	s := &CommandExecSkill{
+		cfg: project.SkillConfig{
+			Name:   "command_exec",
+			Type:   "command_exec",
+			Params: map[string]any{"allow": []any{"go test", "go vet"}},
+		},
+		workspace: t.TempDir(),
+	}
+	for _, cmdLine := range []string{
+		"go test -exec /tmp/x ./...",
+		"go test --exec=/tmp/x ./...",
+		"go test -toolexec=/tmp/x ./...",
+		"go vet -vettool /tmp/x ./...",
+	} {
+		_, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"command": cmdLine}})
+		if err == nil || !strings.Contains(err.Error(), "never allowed") {
+			t.Fatalf("command %q: expected delegating flag error, got %v", cmdLine, err)
+		}
+	}
+	if got := commandExecDelegatingFlag([]string{"go", "test", "-run", "TestExec", "--", "-exec"}); got != "" {
+		t.Fatalf("expected flags after -- and flag values to pass, got %q", got)
+	}
+}
+
+func TestCommandExecSkillCapsOutput(t *testing.T) {
+	s := &CommandExecSkill{
+		cfg: project.SkillConfig{
+			Name: "command_exec",
+			Type: "command_exec",
+			Params: map[string]any{
+				"allow":            []any{"go env"},
+				"max_output_bytes": 16,
+			},
+		},
+		workspace: t.TempDir(),
+	}
+	out, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"command": "go env"}})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if tr, _ := out["truncated"].(bool); !tr {
+		t.Fatalf("expected truncated=true")
+	}
+	if text, _ := out["text"].(string); len(text) > 16 {
+		t.Fatalf("expected output capped to 16 bytes, got %d", len(text))
+	}
+}
+
+func TestCommandExecSkillRejectsDirEscape(t *testing.T) {
+	s := &CommandExecSkill{
+		cfg: project.SkillConfig{
+			Name:   "command_exec",
+			Type:   "command_exec",
+			Params: map[string]any{"allow": []any{"go env"}},
+		},
+		workspace: t.TempDir(),
+	}
+	_, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"command": "go env", "dir": "../"}})
+	if err == nil || !strings.Contains(err.Error(), "workspace") {
+		t.Fatalf("expected workspace path error, got %v", err)
+	}
+}
+
+func TestCommandExecEnvScrubsSecrets(t *testing.T) {
+	t.Setenv("DEEPSEEK_API_KEY", "sk-secret")
+	t.Setenv("DEEPH_EXEC_OPT_IN", "visible")
+	env := commandExecEnv(project.SkillConfig{Params: map[string]any{
+		"env_allow": []any{"DEEPH_EXEC_OPT_IN"},
+		"env":       map[string]any{"CI": "1"},
+	}})
+	joined := "\n" + strings.Join(env, "\n") + "\n"
+	if strings.Contains(joined, "sk-secret") {
+		t.Fatalf("expected API key to be scrubbed from env")
+	}
+	if !strings.Contains(joined, "\nDEEPH_EXEC_OPT_IN=visible\n") {
+		t.Fatalf("expected env_allow variable to pass through")
+	}
+	if !strings.Contains(joined, "\nCI=1\n") {
+		t.Fatalf("expected fixed env value to be set")
+	}
+}
+
+func TestCommandExecResultKindInfersDiagnosticType(t *testing.T) {
+	cases := map[string]string{
+		"go test ./...":  "diagnostic/test",
+		"npm test":       "diagnostic/test",
+		"go vet ./...":   "diagnostic/lint",
+		"go build ./...": "diagnostic/build",
+	}
+	for cmdLine, want := range cases {
+		argv, err := splitCommandLine(cmdLine)
+		if err != nil {
+			t.Fatalf("splitCommandLine(%q): %v", cmdLine, err)
+		}
+		if got := commandExecResultKind(project.SkillConfig{}, argv).String(); got != want {
+			t.Fatalf("%q: kind=%s want=%s", cmdLine, got, want)
+		}
+	}
+}
+
+func TestSplitCommandLineHonoursQuotesWithoutShell(t *testing.T) {
+	got, err := splitCommandLine(`go test -run "TestA|TestB" ./... > out.txt`)
+	if err != nil {
+		t.Fatalf("splitCommandLine error: %v", err)
+	}
+	want := []string{"go", "test", "-run", "TestA|TestB", "./...", ">", "out.txt"}
+	if strings.Join(got, "\x00") != strings.Join(want, "\x00") {
+		t.Fatalf("unexpected argv: %#v", got)
+	}
+	if _, err := splitCommandLine(`go test "unterminated`); err == nil {
+		t.Fatalf("expected unterminated quote error")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"sync"
 	"time"
 
+	"deeph/internal/tokenizer"
 	"deeph/internal/typesys"
 )
 
@@ -38,6 +39,8 @@ const (
 )
 
 type ContextWeightProfile struct {
+	// Name is the configured profile name ("default" for the built-in weights).
+	Name             string
 	TypeWeights      map[typesys.Kind]float64
 	CategoryWeights  map[string]float64
 	MomentWeights    map[ContextMoment]map[string]float64 // keys: canonical kind or "cat:<category>"
@@ -46,6 +49,7 @@ type ContextWeightProfile struct {
 
 func DefaultContextWeightProfile() ContextWeightProfile {
 	p := ContextWeightProfile{
+		Name:             "default",
 		TypeWeights:      map[typesys.Kind]float64{},
 		CategoryWeights:  map[string]float64{},
 		MomentWeights:    map[ContextMoment]map[string]float64{},
@@ -282,6 +286,37 @@ type ContextCompileSpec struct {
 	Budget        ContextBudget
 	Moment        ContextMoment
 	WeightProfile ContextWeightProfile
+	// Tokenizer counts tokens for the agent's model (heuristic when nil).
+	Tokenizer tokenizer.Tokenizer
+	// Explain records every candidate, with its score breakdown and drop
+	// reason, in CompiledContext.Candidates.
+	Explain bool
+}
+
+// Why a context candidate was left out of the compiled context.
+const (
+	ContextDropBudget   = "budget"
+	ContextDropGroupCap = "group_cap"
+	ContextDropChannel  = "channel"
+)
+
+// ContextCandidateScore is one context candidate, in selection order. Score
+// is Base + Recency + TypeWeight + MomentBoost; the score per token decides
+// the order.
+type ContextCandidateScore struct {
+	Group       string        `json:"group"`
+	Kind        typesys.Kind  `json:"kind"`
+	Moment      ContextMoment `json:"moment"`
+	Channel     string        `json:"channel,omitempty"`
+	Text        string        `json:"text"`
+	Tokens      int           `json:"tokens"`
+	Score       float64       `json:"score"`
+	Base        float64       `json:"base"`
+	Recency     float64       `json:"recency"`
+	TypeWeight  float64       `json:"type_weight"`
+	MomentBoost float64       `json:"moment_boost"`
+	Selected    bool          `json:"selected"`
+	DropReason  string        `json:"drop_reason,omitempty"`
 }
 
 type CompiledContext struct {
@@ -296,6 +331,8 @@ type CompiledContext struct {
 	SelectedArtifacts int
 	SelectedQuestions int
 	DroppedItems      int
+	// Candidates is set when ContextCompileSpec.Explain is.
+	Candidates []ContextCandidateScore
 }
 
 type ContextBus struct {
@@ -308,6 +345,8 @@ type ContextBus struct {
 	artifacts     map[string]ContextArtifact
 	version       uint64
 	dirty         ContextDirtyFlags
+	redact        func(string) string
+	store         *ArtifactStore
 }
 
 func NewContextBus(goal string) *ContextBus {
@@ -323,10 +362,35 @@ func NewContextBus(goal string) *ContextBus {
 	return b
 }
 
+// SetRedactor installs the secret scrubber applied to everything entering the
+// bus (goal, facts, event and artifact summaries) and re-scrubs the goal.
+func (b *ContextBus) SetRedactor(redact func(string) string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.redact = redact
+	b.goal = b.scrub(b.goal)
+}
+
+// SetArtifactStore keeps the raw payload of every artifact put on the bus
+// from now on, so its ID can be read back with artifact_read.
+func (b *ContextBus) SetArtifactStore(store *ArtifactStore) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.store = store
+}
+
+func (b *ContextBus) scrub(s string) string {
+	if b.redact == nil {
+		return s
+	}
+	return b.redact(s)
+}
+
 func (b *ContextBus) SetGoal(goal string) {
 	goal = strings.TrimSpace(goal)
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	goal = b.scrub(goal)
 	if b.goal == goal {
 		return
 	}
@@ -341,6 +405,7 @@ func (b *ContextBus) AddConstraint(text string) {
 	}
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	text = b.scrub(text)
 	for _, c := range b.constraints {
 		if c == text {
 			return
@@ -357,6 +422,7 @@ func (b *ContextBus) AddOpenQuestion(text string) {
 	}
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	text = b.scrub(text)
 	for _, q := range b.openQuestions {
 		if q == text {
 			return
@@ -384,6 +450,7 @@ func (b *ContextBus) PutTypedFact(key, value string, kind typesys.Kind, moment C
 	}
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	value = b.scrub(value)
 	prev, ok := b.facts[key]
 	if ok && prev.Value == value && math.Abs(prev.Confidence-confidence) < 0.0001 && prev.Source == source {
 		return
@@ -417,6 +484,7 @@ func (b *ContextBus) RecordAgentOutput(agent, output string) {
 	}
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	output = b.scrub(output)
 
 	now := time.Now()
 	summary := trim(output, 180)
@@ -488,6 +556,9 @@ func (b *ContextBus) RecordAgentHandoff(link TypedHandoffLink, value typesys.Typ
 		"to_port=" + coalesce(strings.TrimSpace(link.ToPort), "input"),
 		"kind=" + kind.String(),
 	}
+	if value.Meta["contract"] == "invalid" {
+		parts = append(parts, "contract=invalid")
+	}
 	if valueSummary != "" {
 		parts = append(parts, valueSummary)
 	}
@@ -495,6 +566,7 @@ func (b *ContextBus) RecordAgentHandoff(link TypedHandoffLink, value typesys.Typ
 
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	summary = b.scrub(summary)
 
 	// Compact fact for the target input port (cheap and high-value in compiled context).
 	factKey := fmt.Sprintf("handoff.%s.%s", link.ToAgent, coalesce(strings.TrimSpace(link.ToPort), "input"))
@@ -763,7 +835,7 @@ func (b *ContextBus) recordSkillCallLocked(agent string, call SkillCallResult, m
 
 	if call.Error != "" {
 		event.Kind = typesys.KindToolError
-		event.Summary = fmt.Sprintf("skill=%s failed: %s", call.Skill, trim(call.Error, 160))
+		event.Summary = b.scrub(fmt.Sprintf("skill=%s failed: %s", call.Skill, trim(call.Error, 160)))
 		b.events = append(b.events, event)
 		b.trimEventsLocked(64)
 		b.touchLocked(ContextDirtyEvents)
@@ -771,7 +843,7 @@ func (b *ContextBus) recordSkillCallLocked(agent string, call SkillCallResult, m
 	}
 
 	summary, artifactID := b.summarizeSkillResultLocked(call, defaultMoment(moment, ContextMomentToolLoop))
-	event.Summary = summary
+	event.Summary = b.scrub(summary)
 	event.ArtifactID = artifactID
 	b.events = append(b.events, event)
 	b.trimEventsLocked(64)
@@ -821,8 +893,13 @@ func (b *ContextBus) putArtifactLocked(kind typesys.Kind, moment ContextMoment,
 }
 
 func (b *ContextBus) putArtifactScopedLocked(kind typesys.Kind, moment ContextMoment, source, raw, summary, targetAgent, channel string) string {
-	h := sha1.Sum([]byte(raw))
-	hash := hex.EncodeToString(h[:])
+	var hash string
+	if b.store != nil {
+		hash = b.store.Put([]byte(b.scrub(raw)))
+	} else {
+		h := sha1.Sum([]byte(raw))
+		hash = hex.EncodeToString(h[:])
+	}
 	k := defaultKind(kind, typesys.KindArtifactRef)
 	scopeKey := ""
 	targetAgent = strings.TrimSpace(targetAgent)
@@ -843,7 +920,7 @@ func (b *ContextBus) putArtifactScopedLocked(kind typesys.Kind, moment ContextMo
 		Channel:     channel,
 		Hash:        hash,
 		Bytes:       len(raw),
-		Summary:     strings.TrimSpace(summary),
+		Summary:     b.scrub(strings.TrimSpace(summary)),
 		UpdatedAt:   time.Now(),
 	}
 	b.artifacts[id] = art
@@ -864,16 +941,26 @@ func (b *ContextBus) touchLocked(flag ContextDirtyFlags) {
 }
 
 type contextCandidate struct {
-	group  string
-	kind   typesys.Kind
-	moment ContextMoment
-	text   string
-	tokens int
-	score  float64
-	order  int
+	group   string
+	kind    typesys.Kind
+	moment  ContextMoment
+	channel string
+	text    string
+	tokens  int
+	score   float64
+	order   int
+	// recency and the type/moment weights are kept apart for explain mode;
+	// score includes them.
+	recency     float64
+	typeWeight  float64
+	momentBoost float64
 }
 
 func CompileContextSnapshot(snap ContextSnapshot, spec ContextCompileSpec) CompiledContext {
+	var hidden ContextSnapshot
+	if spec.Explain {
+		hidden = channelHiddenSnapshot(snap, strings.TrimSpace(spec.AgentName), spec.Channels)
+	}
 	snap = filterSnapshotForAgent(snap, strings.TrimSpace(spec.AgentName), spec.Channels)
 	budget := spec.Budget.normalized()
 	limit := budget.limitTokens()
@@ -896,14 +983,18 @@ func CompileContextSnapshot(snap ContextSnapshot, spec ContextCompileSpec) Compi
 	}
 	mandatory = append(mandatory, "instruction: use the shared context below, prefer tools only when needed, avoid repeating large content.")
 
-	used := estimateLinesTokens(mandatory)
+	tok := spec.Tokenizer
+	if tok == nil {
+		tok = tokenizer.Heuristic()
+	}
+	used := estimateLinesTokens(tok, mandatory)
 	selectedByGroup := map[string][]contextCandidate{}
 	dropped := 0
 	counts := map[string]int{}
 
-	cands := buildContextCandidates(snap, budget)
+	cands := buildContextCandidates(snap, budget, tok)
 	for i := range cands {
-		cands[i].score += scoreTypeAndMoment(cands[i].kind, cands[i].moment, currentMoment, weights)
+		cands[i].applyWeights(currentMoment, weights)
 	}
 	sort.SliceStable(cands, func(i, j int) bool {
 		di := cands[i].score / float64(maxInt(cands[i].tokens, 1))
@@ -917,12 +1008,19 @@ func CompileContextSnapshot(snap ContextSnapshot, spec ContextCompileSpec) Compi
 		return cands[i].order < cands[j].order
 	})
 
+	var explained []ContextCandidateScore
 	for _, c := range cands {
-		if !allowCandidateGroupCount(c.group, counts, budget) {
-			dropped++
-			continue
+		reason := ""
+		switch {
+		case !allowCandidateGroupCount(c.group, counts, budget):
+			reason = ContextDropGroupCap
+		case used+c.tokens > limit:
+			reason = ContextDropBudget
+		}
+		if spec.Explain {
+			explained = append(explained, c.explain(reason))
 		}
-		if used+c.tokens > limit {
+		if reason != "" {
 			dropped++
 			continue
 		}
@@ -955,10 +1053,13 @@ func CompileContextSnapshot(snap ContextSnapshot, spec ContextCompileSpec) Compi
 		}
 	}
 
+	if spec.Explain {
+		explained = appendChannelHidden(explained, hidden, budget, tok, currentMoment, weights)
+	}
 	text := strings.Join(lines, "\n")
 	return CompiledContext{
 		Text:              text,
-		EstimatedTokens:   estimateTokens(text),
+		EstimatedTokens:   tok.Count(text),
 		BudgetLimitTokens: limit,
 		Version:           snap.Version,
 		DirtyFlags:        snap.DirtyFlags,
@@ -968,6 +1069,7 @@ func CompileContextSnapshot(snap ContextSnapshot, spec ContextCompileSpec) Compi
 		SelectedArtifacts: len(selectedByGroup["artifacts"]),
 		SelectedQuestions: len(selectedByGroup["questions"]),
 		DroppedItems:      dropped,
+		Candidates:        explained,
 	}
 }
 
@@ -1140,7 +1242,7 @@ func shortHashString(s string) string {
 	return shortHash(sum)
 }
 
-func buildContextCandidates(snap ContextSnapshot, budget ContextBudget) []contextCandidate {
+func buildContextCandidates(snap ContextSnapshot, budget ContextBudget, tok tokenizer.Tokenizer) []contextCandidate {
 	cands := make([]contextCandidate, 0, 64)
 	order := 0
 
@@ -1155,7 +1257,7 @@ func buildContextCandidates(snap ContextSnapshot, budget ContextBudget) []contex
 			kind:   typesys.KindMessageSystem,
 			moment: ContextMomentPlan,
 			text:   text,
-			tokens: estimateTokens("- " + text),
+			tokens: tok.Count("- " + text),
 			score:  9.0 - float64(i)*0.1,
 			order:  order,
 		})
@@ -1166,13 +1268,14 @@ func buildContextCandidates(snap ContextSnapshot, budget ContextBudget) []contex
 		line := renderFactCandidateLine(f)
 		score := 8.0 + 3.0*clamp01(f.Confidence)
 		cands = append(cands, contextCandidate{
-			group:  "facts",
-			kind:   defaultKind(f.Kind, typesys.KindMemoryFact),
-			moment: defaultMoment(f.Moment, ContextMomentGeneral),
-			text:   line,
-			tokens: estimateTokens("- " + line),
-			score:  score,
-			order:  order,
+			group:   "facts",
+			kind:    defaultKind(f.Kind, typesys.KindMemoryFact),
+			moment:  defaultMoment(f.Moment, ContextMomentGeneral),
+			channel: f.Channel,
+			text:    line,
+			tokens:  tok.Count("- " + line),
+			score:   score,
+			order:   order,
 		})
 		order++
 	}
@@ -1189,7 +1292,7 @@ func buildContextCandidates(snap ContextSnapshot, budget ContextBudget) []contex
 			kind:   typesys.KindMemoryQuestion,
 			moment: ContextMomentGeneral,
 			text:   text,
-			tokens: estimateTokens("- " + text),
+			tokens: tok.Count("- " + text),
 			score:  score,
 			order:  order,
 		})
@@ -1201,33 +1304,38 @@ func buildContextCandidates(snap ContextSnapshot, budget ContextBudget) []contex
 	for i := len(events) - 1; i >= 0; i-- {
 		ev := events[i]
 		line := renderEventCandidateLine(ev, budget)
-		score := 6.0 + recencyScore(len(events)-1-i)
+		recency := recencyScore(len(events) - 1 - i)
+		score := 6.0 + recency
 		if ev.HasError {
 			score += 2.0
 		}
 		cands = append(cands, contextCandidate{
-			group:  "events",
-			kind:   defaultKind(ev.Kind, inferEventKind(ev)),
-			moment: defaultMoment(ev.Moment, ContextMomentGeneral),
-			text:   line,
-			tokens: estimateTokens("- " + line),
-			score:  score,
-			order:  order,
+			group:   "events",
+			kind:    defaultKind(ev.Kind, inferEventKind(ev)),
+			moment:  defaultMoment(ev.Moment, ContextMomentGeneral),
+			channel: ev.Channel,
+			text:    line,
+			tokens:  tok.Count("- " + line),
+			score:   score,
+			order:   order,
+			recency: recency,
 		})
 		order++
 	}
 
 	for i, a := range snap.Artifacts {
 		line := renderArtifactCandidateLine(a, budget)
-		score := 5.0 + recencyScore(i)
+		recency := recencyScore(i)
 		cands = append(cands, contextCandidate{
-			group:  "artifacts",
-			kind:   defaultKind(a.Kind, typesys.KindArtifactRef),
-			moment: defaultMoment(a.Moment, ContextMomentGeneral),
-			text:   line,
-			tokens: estimateTokens("- " + line),
-			score:  score,
-			order:  order,
+			group:   "artifacts",
+			kind:    defaultKind(a.Kind, typesys.KindArtifactRef),
+			moment:  defaultMoment(a.Moment, ContextMomentGeneral),
+			channel: a.Channel,
+			text:    line,
+			tokens:  tok.Count("- " + line),
+			score:   5.0 + recency,
+			order:   order,
+			recency: recency,
 		})
 		order++
 	}
@@ -1252,20 +1360,11 @@ func allowCandidateGroupCount(group string, counts map[string]int, budget Contex
 	}
 }
 
-func estimateLinesTokens(lines []string) int {
+func estimateLinesTokens(tok tokenizer.Tokenizer, lines []string) int {
 	if len(lines) == 0 {
 		return 0
 	}
-	return estimateTokens(strings.Join(lines, "\n"))
-}
-
-func estimateTokens(s string) int {
-	// Fast heuristic for prompt budgeting. Keeps runtime light and deterministic.
-	chars := len(strings.TrimSpace(s))
-	if chars == 0 {
-		return 0
-	}
-	return (chars + 3) / 4
+	return tok.Count(strings.Join(lines, "\n"))
 }
 
 func recencyScore(indexFromNewest int) float64 {
@@ -1394,8 +1493,15 @@ func summarizeArtifactPayload(kind typesys.Kind, result map[string]any, raw stri
 	if tr, ok := boolMapValue(result, "truncated"); ok && tr {
 		parts = append(parts, "truncated=true")
 	}
+	if code, ok := intMapValue(result, "exit_code"); ok {
+		parts = append(parts, fmt.Sprintf("exit=%d", code))
+	}
 
 	switch {
+	case isDiagnosticKind(kind):
+		if outline := summarizeDiagnosticOutput(raw); outline != "" {
+			parts = append(parts, outline)
+		}
 	case isCodeKind(kind):
 		if outline := summarizeCodeSnippet(kind, raw); outline != "" {
 			parts = append(parts, outline)
@@ -1634,6 +1740,28 @@ func summarizeJSONPayload(raw string) string {
 	}
 }
 
+// summarizeDiagnosticOutput keeps the first failure-looking lines of build/test/lint output,
+// which are what the next agent needs before deciding to page through the full artifact.
+func summarizeDiagnosticOutput(raw string) string {
+	failures := make([]string, 0, 3)
+	sc := bufio.NewScanner(strings.NewReader(raw))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		lower := strings.ToLower(line)
+		if strings.HasPrefix(line, "--- FAIL") || strings.HasPrefix(line, "FAIL") || strings.HasPrefix(lower, "panic:") ||
+			strings.Contains(lower, "error") || strings.Contains(lower, "undefined:") || strings.Contains(line, "✕") {
+			failures = appendUniqueLimited(failures, trim(line, 90), 3)
+		}
+	}
+	if len(failures) == 0 {
+		return summarizePlainText(raw)
+	}
+	return fmt.Sprintf("lines=%d failures=%s", countLines(raw), strings.Join(failures, " | "))
+}
+
 func summarizeMarkdown(raw string) string {
 	headings := make([]string, 0, 4)
 	sc := bufio.NewScanner(strings.NewReader(raw))
@@ -1813,19 +1941,21 @@ func boolMapValue(m map[string]any, key string) (bool, bool) {
 }
 
 func scoreTypeAndMoment(kind typesys.Kind, itemMoment, currentMoment ContextMoment, profile ContextWeightProfile) float64 {
+	typeWeight, momentBoost := scoreTypeAndMomentParts(kind, itemMoment, currentMoment, profile)
+	return typeWeight + momentBoost
+}
+
+func scoreTypeAndMomentParts(kind typesys.Kind, itemMoment, currentMoment ContextMoment, profile ContextWeightProfile) (typeWeight, momentBoost float64) {
 	profile = profile.normalized()
-	score := 0.0
 	if def, ok := typesys.Lookup(kind.String()); ok {
 		if w, ok := profile.TypeWeights[kind]; ok {
-			score += w
+			typeWeight = w
 		} else if w, ok := profile.CategoryWeights[def.Category]; ok {
-			score += w
+			typeWeight = w
 		}
-		score += profile.momentBoost(currentMoment, itemMoment, def.Category, kind)
-		return score
+		return typeWeight, profile.momentBoost(currentMoment, itemMoment, def.Category, kind)
 	}
-	score += profile.momentBoost(currentMoment, itemMoment, "", kind)
-	return score
+	return 0, profile.momentBoost(currentMoment, itemMoment, "", kind)
 }
 
 func (p ContextWeightProfile) momentBoost(current, item ContextMoment, category string, kind typesys.Kind) float64 {
@@ -1974,6 +2104,10 @@ func isCodeKind(kind typesys.Kind) bool {
 	return strings.HasPrefix(kind.String(), "code/")
 }
 
+func isDiagnosticKind(kind typesys.Kind) bool {
+	return strings.HasPrefix(kind.String(), "diagnostic/")
+}
+
 func isSummaryKind(kind typesys.Kind) bool {
 	return strings.HasPrefix(kind.String(), "summary/") || kind == typesys.KindArtifactSummary
 }
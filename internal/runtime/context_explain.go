@@ -0,0 +1,79 @@
+package runtime
+
+import (
+	"context"
+
+	"deeph/internal/tokenizer"
+)
+
+type contextExplainKey struct{}
+
+// WithContextExplain makes runs under ctx record every context candidate of
+// each agent in AgentRunResult.ContextExplain.
+func WithContextExplain(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextExplainKey{}, true)
+}
+
+func contextExplainEnabled(ctx context.Context) bool {
+	on, _ := ctx.Value(contextExplainKey{}).(bool)
+	return on
+}
+
+func (c *contextCandidate) applyWeights(current ContextMoment, weights ContextWeightProfile) {
+	c.typeWeight, c.momentBoost = scoreTypeAndMomentParts(c.kind, c.moment, current, weights)
+	c.score += c.typeWeight + c.momentBoost
+}
+
+func (c contextCandidate) explain(reason string) ContextCandidateScore {
+	return ContextCandidateScore{
+		Group:       c.group,
+		Kind:        c.kind,
+		Moment:      c.moment,
+		Channel:     c.channel,
+		Text:        c.text,
+		Tokens:      c.tokens,
+		Score:       c.score,
+		Base:        c.score - c.recency - c.typeWeight - c.momentBoost,
+		Recency:     c.recency,
+		TypeWeight:  c.typeWeight,
+		MomentBoost: c.momentBoost,
+		Selected:    reason == "",
+		DropReason:  reason,
+	}
+}
+
+// channelHiddenSnapshot keeps the items the agent would see if its compile
+// channels did not filter them out.
+func channelHiddenSnapshot(snap ContextSnapshot, agentName string, channels []string) ContextSnapshot {
+	allowed := normalizeChannelSet(channels)
+	var out ContextSnapshot
+	if len(allowed) == 0 {
+		return out
+	}
+	for _, f := range snap.Facts {
+		if !channelAllowed(f.Channel, allowed) && contextFactVisibleToAgent(f, agentName, nil) {
+			out.Facts = append(out.Facts, f)
+		}
+	}
+	for _, ev := range snap.RecentEvents {
+		if !channelAllowed(ev.Channel, allowed) && contextEventVisibleToAgent(ev, agentName, nil) {
+			out.RecentEvents = append(out.RecentEvents, ev)
+		}
+	}
+	for _, a := range snap.Artifacts {
+		if !channelAllowed(a.Channel, allowed) && contextArtifactVisibleToAgent(a, agentName, nil) {
+			out.Artifacts = append(out.Artifacts, a)
+		}
+	}
+	return out
+}
+
+// appendChannelHidden scores the channel-filtered items like any candidate
+// and appends them as dropped by the channel filter.
+func appendChannelHidden(out []ContextCandidateScore, hidden ContextSnapshot, budget ContextBudget, tok tokenizer.Tokenizer, current ContextMoment, weights ContextWeightProfile) []ContextCandidateScore {
+	for _, c := range buildContextCandidates(hidden, budget, tok) {
+		c.applyWeights(current, weights)
+		out = append(out, c.explain(ContextDropChannel))
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package runtime
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"deeph/internal/project"
+	"deeph/internal/typesys"
+)
+
+func TestCompileExplainRecordsBreakdownAndDropReasons(t *testing.T) {
+	bus := NewContextBus("goal")
+	for _, key := range []string{"a", "b", "c"} {
+		bus.PutFact("note."+key, "short fact "+key, 0.5, "planner")
+	}
+	bus.PutFact("note.long", strings.Repeat("a long fact that will not fit ", 60), 1, "planner")
+	bus.RecordAgentHandoff(TypedHandoffLink{FromAgent: "planner", ToAgent: "coder", FromPort: "plan", ToPort: "brief", Channel: "planner.plan->coder.brief", Kind: typesys.KindSummaryText}, typesys.TypedValue{Kind: typesys.KindSummaryText, InlineText: "brief"})
+	bus.RecordAgentHandoff(TypedHandoffLink{FromAgent: "tester", ToAgent: "coder", FromPort: "log", ToPort: "logs", Channel: "tester.log->coder.logs", Kind: typesys.KindTextPlain}, typesys.TypedValue{Kind: typesys.KindTextPlain, InlineText: "logs"})
+
+	budget := DefaultContextBudget()
+	budget.MaxInputTokens = 320
+	budget.MaxFacts = 5
+	budget.MaxRecentEvents = 1
+	bus.RecordAgentHandoff(TypedHandoffLink{FromAgent: "reviewer", ToAgent: "coder", FromPort: "notes", ToPort: "notes", Channel: "planner.plan->coder.brief", Kind: typesys.KindSummaryText}, typesys.TypedValue{Kind: typesys.KindSummaryText, InlineText: "notes"})
+	compiled := bus.Compile(ContextCompileSpec{
+		AgentName: "coder",
+		Budget:    budget,
+		Moment:    ContextMomentSynthesis,
+		Channels:  []string{"planner.plan->coder.brief"},
+		Explain:   true,
+	})
+	reasons := map[string]int{}
+	for _, c := range compiled.Candidates {
+		reasons[c.DropReason]++
+		if sum := c.Base + c.Recency + c.TypeWeight + c.MomentBoost; math.Abs(sum-c.Score) > 1e-9 {
+			t.Fatalf("score %.3f does not match breakdown %.3f for %+v", c.Score, sum, c)
+		}
+		if c.DropReason == ContextDropChannel && c.Channel != "tester.log->coder.logs" {
+			t.Fatalf("unexpected channel drop: %+v", c)
+		}
+	}
+	if reasons[""] == 0 || reasons[ContextDropGroupCap] == 0 || reasons[ContextDropBudget] == 0 || reasons[ContextDropChannel] == 0 {
+		t.Fatalf("expected kept, group cap, budget and channel candidates, got %v", reasons)
+	}
+	if plain := bus.Compile(ContextCompileSpec{AgentName: "coder", Budget: budget}); plain.Candidates != nil {
+		t.Fatal("expected no candidates without explain")
+	}
+}
+
+func TestRunWithContextExplainReportsCandidates(t *testing.T) {
+	p := &project.Project{
+		Root:   project.RootConfig{Providers: []project.ProviderConfig{{Name: "local", Type: "mock"}}},
+		Agents: []project.AgentConfig{{Name: "planner", Provider: "local"}, {Name: "coder", Provider: "local"}},
+	}
+	eng, err := New(t.TempDir(), p)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	defer eng.Close()
+	report, err := eng.RunSpec(WithContextExplain(context.Background()), "planner>coder", "ship it")
+	if err != nil {
+		t.Fatalf("RunSpec error: %v", err)
+	}
+	if len(report.Results[1].ContextExplain) == 0 {
+		t.Fatalf("expected explained candidates for coder, got %+v", report.Results[1])
+	}
+	plain, err := eng.RunSpec(context.Background(), "planner>coder", "ship it")
+	if err != nil {
+		t.Fatalf("RunSpec error: %v", err)
+	}
+	if plain.Results[1].ContextExplain != nil {
+		t.Fatal("expected no explain data without WithContextExplain")
+	}
+}
@@ -0,0 +1,392 @@
+package runtime
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"deeph/internal/typesys"
+)
+
+// ContextSnapshotVersion is the format version of saved context snapshots.
+const ContextSnapshotVersion = 1
+
+// MaxContextSnapshots is how many saved snapshots a workspace keeps.
+const MaxContextSnapshots = 20
+
+// DefaultContextResumeTTL is how old a resumed fact, event or artifact may be.
+const DefaultContextResumeTTL = 24 * time.Hour
+
+// Merge strategies for resumed context.
+const (
+	// ContextMergeAuto restores everything when the goal is unchanged and
+	// only facts and artifacts (with lower confidence) when it differs.
+	ContextMergeAuto = "auto"
+	// ContextMergeAll restores everything regardless of the goal.
+	ContextMergeAll = "all"
+	// ContextMergeFacts restores facts and artifacts only.
+	ContextMergeFacts = "facts"
+)
+
+// ContextSnapshotFile is a run's ContextBus as saved under
+// .deeph/contexts/<run-id>.json.
+type ContextSnapshotFile struct {
+	Version       int               `json:"version"`
+	RunID         string            `json:"run_id"`
+	Spec          string            `json:"spec,omitempty"`
+	SavedAt       time.Time         `json:"saved_at"`
+	Goal          string            `json:"goal"`
+	Constraints   []string          `json:"constraints,omitempty"`
+	Facts         []ContextFact     `json:"facts,omitempty"`
+	OpenQuestions []string          `json:"open_questions,omitempty"`
+	Events        []ContextEvent    `json:"events,omitempty"`
+	Artifacts     []ContextArtifact `json:"artifacts,omitempty"`
+}
+
+// ContextResumeOptions tune how a snapshot seeds a new run.
+type ContextResumeOptions struct {
+	TTL   time.Duration
+	Merge string
+}
+
+// ContextResumeStats reports what a resume restored.
+type ContextResumeStats struct {
+	RunID       string `json:"run_id"`
+	Facts       int    `json:"facts"`
+	Events      int    `json:"events"`
+	Artifacts   int    `json:"artifacts"`
+	Expired     int    `json:"expired"`
+	GoalChanged bool   `json:"goal_changed"`
+	Merge       string `json:"merge"`
+}
+
+// ContextPersistence asks a run to save its context and optionally seed it
+// from an earlier snapshot.
+type ContextPersistence struct {
+	Save   bool
+	Resume *ContextSnapshotFile
+	Opts   ContextResumeOptions
+}
+
+type contextPersistenceKey struct{}
+
+// WithContextPersistence attaches context save/resume settings to ctx.
+func WithContextPersistence(ctx context.Context, p ContextPersistence) context.Context {
+	return context.WithValue(ctx, contextPersistenceKey{}, p)
+}
+
+func contextPersistenceFrom(ctx context.Context) (ContextPersistence, bool) {
+	p, ok := ctx.Value(contextPersistenceKey{}).(ContextPersistence)
+	return p, ok
+}
+
+// NewRunID returns a sortable run identifier such as 20261018-153012-0479c3e5a1f:
+// UTC time, three digits of milliseconds, then four random bytes in hex.
+func NewRunID(now time.Time) string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	now = now.UTC()
+	return fmt.Sprintf("%s-%03d%s", now.Format("20060102-150405"), now.Nanosecond()/int(time.Millisecond), hex.EncodeToString(b[:]))
+}
+
+func contextSnapshotDir(workspace string) string {
+	return filepath.Join(workspace, ".deeph", "contexts")
+}
+
+// SaveContextSnapshot writes a snapshot and prunes the oldest beyond
+// MaxContextSnapshots.
+func SaveContextSnapshot(workspace string, file ContextSnapshotFile) (string, error) {
+	if strings.TrimSpace(file.RunID) == "" {
+		return "", fmt.Errorf("context snapshot requires a run id")
+	}
+	file.Version = ContextSnapshotVersion
+	dir := contextSnapshotDir(workspace)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	b, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, file.RunID+".json")
+	if err := WriteFileAtomic(path, append(b, '\n'), 0o644); err != nil {
+		return "", err
+	}
+	ids, _ := ListContextSnapshots(workspace)
+	for len(ids) > MaxContextSnapshots {
+		_ = os.Remove(filepath.Join(dir, ids[0]+".json"))
+		ids = ids[1:]
+	}
+	return path, nil
+}
+
+// ListContextSnapshots returns saved run ids, oldest first.
+func ListContextSnapshots(workspace string) ([]string, error) {
+	return ListRecordIDs(contextSnapshotDir(workspace))
+}
+
+// LoadContextSnapshot loads a snapshot by run id, unique id prefix, or
+// "last" for the newest one.
+func LoadContextSnapshot(workspace, ref string) (ContextSnapshotFile, error) {
+	ids, err := ListContextSnapshots(workspace)
+	if err != nil {
+		return ContextSnapshotFile{}, err
+	}
+	if len(ids) == 0 {
+		return ContextSnapshotFile{}, fmt.Errorf("no saved contexts in %s", contextSnapshotDir(workspace))
+	}
+	id, err := ResolveRecordID(ids, ref, "saved context")
+	if err != nil {
+		return ContextSnapshotFile{}, err
+	}
+	b, err := os.ReadFile(filepath.Join(contextSnapshotDir(workspace), id+".json"))
+	if err != nil {
+		return ContextSnapshotFile{}, err
+	}
+	var file ContextSnapshotFile
+	if err := json.Unmarshal(b, &file); err != nil {
+		return ContextSnapshotFile{}, fmt.Errorf("parse saved context %s: %w", id, err)
+	}
+	if file.Version > ContextSnapshotVersion {
+		return ContextSnapshotFile{}, fmt.Errorf("saved context %s has version %d; this deeph reads up to %d", id, file.Version, ContextSnapshotVersion)
+	}
+	return file, nil
+}
+
+// ListRecordIDs returns the ids of the <id>.json records in dir, oldest
+// first. A missing dir has no records.
+func ListRecordIDs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ids []string
+	for _, ent := range entries {
+		if id, ok := strings.CutSuffix(ent.Name(), ".json"); ok && !ent.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// ResolveRecordID maps an id, unique id prefix, or "last" for the newest one
+// to an entry of ids (oldest first). noun names the records in errors.
+func ResolveRecordID(ids []string, ref, noun string) (string, error) {
+	ref = strings.TrimSpace(ref)
+	if len(ids) == 0 {
+		return "", fmt.Errorf("no %s matches %q", noun, ref)
+	}
+	if ref == "" || ref == "last" || ref == "latest" {
+		return ids[len(ids)-1], nil
+	}
+	var matches []string
+	for _, id := range ids {
+		if id == ref {
+			return id, nil
+		}
+		if strings.HasPrefix(id, ref) {
+			matches = append(matches, id)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no %s matches %q", noun, ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%s %q is ambiguous (%s)", noun, ref, strings.Join(matches, ", "))
+	}
+}
+
+// snapshotFile captures the bus for saving. Handoff and runtime facts are
+// run-internal and project memory is reseeded by every run, so they are left
+// out; the agents' final outputs are added as result.<agent> facts so a
+// follow-up run sees what this one concluded.
+func (b *ContextBus) snapshotFile(runID, spec string, results []AgentRunResult, now time.Time) ContextSnapshotFile {
+	for _, r := range results {
+		out := strings.TrimSpace(r.Output)
+		if r.Error != "" || r.Skipped || out == "" {
+			continue
+		}
+		value := trim(out, 600)
+		if len(out) > 600 {
+			art := b.PutArtifact(typesys.KindMessageAgent, ContextMomentSynthesis, r.Agent, out, trim(out, 160))
+			value = trim(out, 440) + " (full output: artifact " + art.ID + ")"
+		}
+		b.PutTypedFact("result."+r.Agent, value, typesys.KindMessageAgent, ContextMomentSynthesis, 0.9, r.Agent)
+	}
+	snap := b.Snapshot()
+	file := ContextSnapshotFile{
+		RunID:         runID,
+		Spec:          spec,
+		SavedAt:       now,
+		Goal:          snap.Goal,
+		Constraints:   snap.Constraints,
+		OpenQuestions: snap.OpenQuestions,
+		Events:        snap.RecentEvents,
+		Artifacts:     snap.Artifacts,
+	}
+	for _, f := range snap.Facts {
+		if strings.HasPrefix(f.Key, "handoff.") || strings.HasPrefix(f.Key, "runtime.") || strings.HasPrefix(f.Key, "memory.") {
+			continue
+		}
+		file.Facts = append(file.Facts, f)
+	}
+	return file
+}
+
+// Resume seeds the bus from a saved snapshot. Items older than the TTL are
+// dropped; fact confidence decays linearly to half at the TTL. Resumed items
+// lose their agent and channel scope so every agent of the new run sees them.
+func (b *ContextBus) Resume(file ContextSnapshotFile, opts ContextResumeOptions, now time.Time) ContextResumeStats {
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = DefaultContextResumeTTL
+	}
+	merge := strings.TrimSpace(opts.Merge)
+	if merge == "" {
+		merge = ContextMergeAuto
+	}
+	stats := ContextResumeStats{RunID: file.RunID, Merge: merge}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats.GoalChanged = !strings.EqualFold(strings.Join(strings.Fields(file.Goal), " "), strings.Join(strings.Fields(b.goal), " "))
+	everything := merge == ContextMergeAll || (merge == ContextMergeAuto && !stats.GoalChanged)
+	penalty := 1.0
+	if stats.GoalChanged && merge == ContextMergeAuto {
+		penalty = 0.7
+	}
+	source := "resume:" + file.RunID
+	fresh := func(t time.Time) (float64, bool) {
+		age := now.Sub(t)
+		if t.IsZero() || age < 0 {
+			age = 0
+		}
+		if age > ttl {
+			stats.Expired++
+			return 0, false
+		}
+		return 1 - 0.5*float64(age)/float64(ttl), true
+	}
+
+	for _, f := range file.Facts {
+		decay, ok := fresh(f.UpdatedAt)
+		if !ok {
+			continue
+		}
+		if _, exists := b.facts[f.Key]; exists {
+			continue
+		}
+		f.Value = b.scrub(f.Value)
+		f.Confidence = clamp01(f.Confidence * decay * penalty)
+		f.Source = source
+		f.TargetAgent, f.Channel = "", ""
+		b.facts[f.Key] = f
+		stats.Facts++
+	}
+	if stats.GoalChanged && strings.TrimSpace(file.Goal) != "" {
+		b.facts["resume.previous_goal"] = ContextFact{
+			Key:        "resume.previous_goal",
+			Value:      b.scrub(trim(file.Goal, 240)),
+			Kind:       typesys.KindMemoryFact,
+			Moment:     ContextMomentGeneral,
+			Confidence: 0.6,
+			Source:     source,
+			UpdatedAt:  file.SavedAt,
+		}
+	}
+	for _, a := range file.Artifacts {
+		if _, ok := fresh(a.UpdatedAt); !ok {
+			continue
+		}
+		if _, exists := b.artifacts[a.ID]; exists {
+			continue
+		}
+		a.Summary = b.scrub(a.Summary)
+		a.TargetAgent, a.Channel = "", ""
+		b.artifacts[a.ID] = a
+		stats.Artifacts++
+	}
+	if everything {
+		for _, c := range file.Constraints {
+			if c = b.scrub(strings.TrimSpace(c)); c != "" && !containsString(b.constraints, c) {
+				b.constraints = append(b.constraints, c)
+			}
+		}
+		for _, q := range file.OpenQuestions {
+			if q = b.scrub(strings.TrimSpace(q)); q != "" && !containsString(b.openQuestions, q) {
+				b.openQuestions = append(b.openQuestions, q)
+			}
+		}
+		var events []ContextEvent
+		for _, ev := range file.Events {
+			if _, ok := fresh(ev.UpdatedAt); !ok {
+				continue
+			}
+			ev.Summary = b.scrub(ev.Summary)
+			ev.TargetAgent, ev.Channel = "", ""
+			events = append(events, ev)
+		}
+		stats.Events = len(events)
+		b.events = append(events, b.events...)
+		b.trimEventsLocked(64)
+	}
+	b.touchLocked(ContextDirtyFacts | ContextDirtyArtifacts | ContextDirtyEvents | ContextDirtyConstraints | ContextDirtyQuestions)
+	return stats
+}
+
+func containsString(items []string, s string) bool {
+	for _, it := range items {
+		if it == s {
+			return true
+		}
+	}
+	return false
+}
+
+// resumeContext seeds a run's bus from the snapshot requested on ctx.
+func (e *Engine) resumeContext(ctx context.Context, bus *ContextBus, report *ExecutionReport) {
+	p, ok := contextPersistenceFrom(ctx)
+	if !ok || p.Resume == nil {
+		return
+	}
+	stats := bus.Resume(*p.Resume, p.Opts, time.Now())
+	report.ContextResumed = &stats
+}
+
+// pruneArtifacts drops stale payloads from .deeph/artifacts once a run is
+// done, so spilled tool output does not pile up across runs.
+func (e *Engine) pruneArtifacts() {
+	if strings.TrimSpace(e.workspace) == "" {
+		return
+	}
+	_, _ = PruneArtifacts(e.workspace, ArtifactRetention, time.Now())
+}
+
+// saveContext writes the run's bus to .deeph/contexts when ctx asks for it.
+// A failed save does not fail the run; it is reported in ContextSaveError.
+func (e *Engine) saveContext(ctx context.Context, bus *ContextBus, graph AgentSpecGraph, report *ExecutionReport) {
+	p, ok := contextPersistenceFrom(ctx)
+	if !ok || !p.Save || strings.TrimSpace(e.workspace) == "" {
+		return
+	}
+	file := bus.snapshotFile(report.RunID, graph.Raw, report.Results, time.Now())
+	e.artifacts.Flush()
+	path, err := SaveContextSnapshot(e.workspace, file)
+	if err != nil {
+		report.ContextSaveError = err.Error()
+		return
+	}
+	report.ContextSaved = path
+}
@@ -0,0 +1,117 @@
+package runtime
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"deeph/internal/project"
+	"deeph/internal/typesys"
+)
+
+func TestContextResumeAppliesTTLDecayAndGoalMerge(t *testing.T) {
+	now := time.Now()
+	file := ContextSnapshotFile{
+		RunID:       "20260101-000000-abcd",
+		Goal:        "fix the login bug",
+		SavedAt:     now.Add(-time.Hour),
+		Constraints: []string{"Keep the public API stable."},
+		Facts: []ContextFact{
+			{Key: "diag.cause", Value: "nil session", Kind: typesys.KindMemoryFact, Confidence: 1, TargetAgent: "coder", UpdatedAt: now.Add(-12 * time.Hour)},
+			{Key: "diag.stale", Value: "old", Kind: typesys.KindMemoryFact, Confidence: 1, UpdatedAt: now.Add(-48 * time.Hour)},
+		},
+		Events: []ContextEvent{{Type: "agent_output", Agent: "diagnose", Summary: "found it", UpdatedAt: now.Add(-time.Hour)}},
+	}
+
+	same := NewContextBus("Fix the  login bug")
+	stats := same.Resume(file, ContextResumeOptions{}, now)
+	if stats.GoalChanged || stats.Facts != 1 || stats.Expired != 1 || stats.Events != 1 {
+		t.Fatalf("unexpected stats for same goal: %+v", stats)
+	}
+	snap := same.Snapshot()
+	var cause ContextFact
+	for _, f := range snap.Facts {
+		if f.Key == "diag.cause" {
+			cause = f
+		}
+	}
+	if cause.Confidence < 0.74 || cause.Confidence > 0.76 || cause.TargetAgent != "" || cause.Source != "resume:"+file.RunID {
+		t.Fatalf("expected decayed, unscoped resumed fact, got %+v", cause)
+	}
+	if len(snap.Constraints) != 1 || len(snap.RecentEvents) != 1 {
+		t.Fatalf("expected constraints and events restored, got %+v", snap)
+	}
+
+	other := NewContextBus("add a logout button")
+	stats = other.Resume(file, ContextResumeOptions{Merge: ContextMergeAuto}, now)
+	if !stats.GoalChanged || stats.Events != 0 {
+		t.Fatalf("unexpected stats for changed goal: %+v", stats)
+	}
+	snap = other.Snapshot()
+	keys := map[string]ContextFact{}
+	for _, f := range snap.Facts {
+		keys[f.Key] = f
+	}
+	if _, ok := keys["resume.previous_goal"]; !ok || len(snap.Constraints) != 0 {
+		t.Fatalf("expected only facts plus previous goal, got %+v", snap)
+	}
+	if c := keys["diag.cause"].Confidence; c > 0.53 {
+		t.Fatalf("expected goal-change penalty, got confidence %.3f", c)
+	}
+}
+
+func TestRunSavesAndResumesContextSnapshot(t *testing.T) {
+	p := &project.Project{
+		Root:   project.RootConfig{Providers: []project.ProviderConfig{{Name: "local", Type: "mock"}}},
+		Agents: []project.AgentConfig{{Name: "planner", Provider: "local"}},
+	}
+	dir := t.TempDir()
+	eng, err := New(dir, p)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	defer eng.Close()
+	first, err := eng.RunSpec(WithContextPersistence(context.Background(), ContextPersistence{Save: true}), "planner", "diagnose the crash")
+	if err != nil {
+		t.Fatalf("RunSpec error: %v", err)
+	}
+	if first.RunID == "" || first.ContextSaved == "" {
+		t.Fatalf("expected a saved context, got run_id=%q saved=%q err=%q", first.RunID, first.ContextSaved, first.ContextSaveError)
+	}
+	file, err := LoadContextSnapshot(dir, "last")
+	if err != nil {
+		t.Fatalf("LoadContextSnapshot error: %v", err)
+	}
+	if file.RunID != first.RunID || file.Version != ContextSnapshotVersion {
+		t.Fatalf("unexpected snapshot header: %+v", file)
+	}
+	for _, f := range file.Facts {
+		if strings.HasPrefix(f.Key, "runtime.") || strings.HasPrefix(f.Key, "handoff.") {
+			t.Fatalf("run-internal fact %q should not be saved", f.Key)
+		}
+	}
+	if _, err := LoadContextSnapshot(dir, file.RunID[:8]); err != nil {
+		t.Fatalf("expected prefix lookup to work: %v", err)
+	}
+
+	second, err := eng.RunSpec(WithContextPersistence(context.Background(), ContextPersistence{Resume: &file}), "planner", "diagnose the crash")
+	if err != nil {
+		t.Fatalf("RunSpec error: %v", err)
+	}
+	if second.ContextResumed == nil || second.ContextResumed.Facts == 0 || second.ContextSaved != "" {
+		t.Fatalf("expected resumed facts without saving, got %+v", second.ContextResumed)
+	}
+}
+
+func TestNewRunIDFormat(t *testing.T) {
+	now := time.Date(2026, 10, 18, 15, 30, 12, 47*int(time.Millisecond), time.UTC)
+	a, b := NewRunID(now), NewRunID(now)
+	if !regexp.MustCompile(`^20261018-153012-047[0-9a-f]{8}$`).MatchString(a) {
+		t.Fatalf("unexpected run id format: %q", a)
+	}
+	if a == b {
+		t.Fatalf("expected distinct run ids within the same millisecond, got %q twice", a)
+	}
+}
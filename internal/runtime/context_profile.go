@@ -0,0 +1,111 @@
+package runtime
+
+import (
+	"strings"
+
+	"deeph/internal/project"
+	"deeph/internal/typesys"
+)
+
+// ContextWeightProfileFromConfig merges a YAML profile over the defaults.
+// Category weights only move kinds still at their category default, so the
+// built-in per-kind tuning survives unless a kind is set explicitly.
+func ContextWeightProfileFromConfig(cfg project.ContextProfileConfig) ContextWeightProfile {
+	p := DefaultContextWeightProfile()
+	p.Name = strings.TrimSpace(cfg.Name)
+	base := DefaultContextWeightProfile()
+	for cat, w := range cfg.Categories {
+		p.CategoryWeights[cat] = w
+		for _, d := range typesys.List() {
+			if d.Category == cat && base.TypeWeights[d.Kind] == base.CategoryWeights[cat] {
+				p.TypeWeights[d.Kind] = w
+			}
+		}
+	}
+	for raw, w := range cfg.Types {
+		if def, ok := typesys.Lookup(raw); ok {
+			p.TypeWeights[def.Kind] = w
+		}
+	}
+	for moment, weights := range cfg.Moments {
+		m := ContextMoment(strings.TrimSpace(moment))
+		merged := map[string]float64{}
+		for k, v := range p.MomentWeights[m] {
+			merged[k] = v
+		}
+		for k, v := range weights {
+			if def, ok := typesys.Lookup(k); ok && !strings.HasPrefix(k, "cat:") {
+				k = def.Kind.String()
+			}
+			merged[k] = v
+		}
+		p.MomentWeights[m] = merged
+	}
+	if cfg.MatchMomentBoost != nil {
+		p.MatchMomentBoost = *cfg.MatchMomentBoost
+	}
+	return p
+}
+
+// contextWeightProfileFor returns the agent's configured profile, or the
+// built-in defaults.
+func (e *Engine) contextWeightProfileFor(agent project.AgentConfig) ContextWeightProfile {
+	if e.project == nil {
+		return DefaultContextWeightProfile()
+	}
+	cfg, ok := e.project.ContextProfileFor(agent)
+	if !ok {
+		return DefaultContextWeightProfile()
+	}
+	return ContextWeightProfileFromConfig(cfg)
+}
+
+// TaskContextPreview is the context an agent would compile at the start of
+// a run, with every candidate's score, for `deeph trace --context`.
+type TaskContextPreview struct {
+	Agent      string                  `json:"agent"`
+	Profile    string                  `json:"profile"`
+	Moment     ContextMoment           `json:"moment"`
+	Budget     int                     `json:"budget_tokens"`
+	Tokens     int                     `json:"tokens"`
+	Candidates []ContextCandidateScore `json:"candidates"`
+}
+
+// PreviewTaskContexts compiles each planned task's context from the run
+// input and placeholder handoffs for its incoming links, so profile weights
+// can be tuned without calling providers.
+func (e *Engine) PreviewTaskContexts(tasks []Task, input string) []TaskContextPreview {
+	out := make([]TaskContextPreview, 0, len(tasks))
+	for _, task := range tasks {
+		bus := NewContextBus(e.redactor.Redact(input))
+		for _, link := range task.Incoming {
+			bus.RecordAgentHandoff(link, typesys.TypedValue{
+				Kind:       link.Kind,
+				InlineText: "<" + link.FromAgent + "." + coalesce(link.FromPort, "output") + " output>",
+			})
+		}
+		budget := e.contextBudgetForTask(task.Agent, task.Provider)
+		moment := e.contextMomentForTask(task.Agent, task.Provider)
+		channels, _ := selectTaskCompileChannels(task, budget, moment)
+		profile := e.contextWeightProfileFor(task.Agent)
+		compiled := bus.Compile(ContextCompileSpec{
+			AgentName:     task.Agent.Name,
+			Skills:        task.Agent.Skills,
+			Budget:        budget,
+			Moment:        moment,
+			Channels:      channels,
+			WeightProfile: profile,
+			Tokenizer:     e.taskTokenizer(task),
+			Explain:       true,
+		})
+		out = append(out, TaskContextPreview{
+			Agent:      task.Agent.Name,
+			Profile:    profile.Name,
+			Moment:     compiled.Moment,
+			Budget:     compiled.BudgetLimitTokens,
+			Tokens:     compiled.EstimatedTokens,
+			Candidates: compiled.Candidates,
+		})
+	}
+	return out
+}
@@ -0,0 +1,72 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"deeph/internal/project"
+	"deeph/internal/typesys"
+)
+
+func TestContextWeightProfileFromConfigMergesOverDefaults(t *testing.T) {
+	base := DefaultContextWeightProfile()
+	p := ContextWeightProfileFromConfig(project.ContextProfileConfig{
+		Name:       "reviewer",
+		Categories: map[string]float64{"code": 2.0},
+		Types:      map[string]float64{"ts": 1.7},
+		Moments:    map[string]map[string]float64{"synthesis": {"cat:code": 0.4, "go": 0.2}},
+	})
+	if p.Name != "reviewer" {
+		t.Fatalf("expected profile name, got %q", p.Name)
+	}
+	if p.TypeWeights[typesys.KindCodeRust] != 2.0 {
+		t.Fatalf("expected category weight on untuned kind, got %v", p.TypeWeights[typesys.KindCodeRust])
+	}
+	if p.TypeWeights[typesys.KindCodeGo] != base.TypeWeights[typesys.KindCodeGo] {
+		t.Fatalf("expected kind-specific default to survive a category override, got %v", p.TypeWeights[typesys.KindCodeGo])
+	}
+	if p.TypeWeights[typesys.KindCodeTS] != 1.7 {
+		t.Fatalf("expected type alias override, got %v", p.TypeWeights[typesys.KindCodeTS])
+	}
+	synth := p.MomentWeights[ContextMomentSynthesis]
+	if synth["cat:code"] != 0.4 || synth["code/go"] != 0.2 || synth["cat:summary"] != base.MomentWeights[ContextMomentSynthesis]["cat:summary"] {
+		t.Fatalf("unexpected merged synthesis weights: %+v", synth)
+	}
+}
+
+func TestPreviewTaskContextsScoresCandidatesWithAgentProfile(t *testing.T) {
+	p := &project.Project{
+		Root: project.RootConfig{
+			Providers: []project.ProviderConfig{{Name: "local", Type: "mock"}},
+			ContextProfiles: []project.ContextProfileConfig{
+				{Name: "heavy", Categories: map[string]float64{"message": 9}},
+			},
+		},
+		Agents: []project.AgentConfig{
+			{Name: "planner", Provider: "local"},
+			{Name: "coder", Provider: "local", Metadata: map[string]string{"context_profile": "heavy"}},
+		},
+	}
+	eng, err := New(t.TempDir(), p)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	defer eng.Close()
+	plan, tasks, err := eng.PlanSpec(context.Background(), "planner>coder", "ship it")
+	if err != nil {
+		t.Fatalf("PlanSpec error: %v", err)
+	}
+	if plan.Tasks[0].ContextProfile != "default" || plan.Tasks[1].ContextProfile != "heavy" {
+		t.Fatalf("unexpected plan profiles: %q %q", plan.Tasks[0].ContextProfile, plan.Tasks[1].ContextProfile)
+	}
+	previews := eng.PreviewTaskContexts(tasks, "ship it")
+	coder := previews[1]
+	if coder.Profile != "heavy" || len(coder.Candidates) == 0 {
+		t.Fatalf("expected scored candidates for coder, got %+v", coder)
+	}
+	c := coder.Candidates[0]
+	if !c.Selected || !strings.Contains(c.Text, "<planner.output output>") || c.Score < 9 {
+		t.Fatalf("expected placeholder handoff scored with the heavy profile, got %+v", c)
+	}
+}
@@ -3,6 +3,7 @@ package runtime
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
@@ -14,6 +15,7 @@ import (
 	"time"
 
 	"deeph/internal/project"
+	"deeph/internal/tokenizer"
 	"deeph/internal/typesys"
 )
 
@@ -24,6 +26,19 @@ type Engine struct {
 	providerCfgs map[string]project.ProviderConfig
 	skills       map[string]Skill
 	skillCfgs    map[string]project.SkillConfig
+
+	mcpMu     sync.RWMutex
+	mcpRoutes map[string]mcpToolRoute
+
+	approverMu sync.RWMutex
+	approver   Approver
+
+	redactor *Redactor
+	// artifacts holds the raw payloads behind context artifact IDs.
+	artifacts *ArtifactStore
+
+	tokenizerMu sync.Mutex
+	tokenizers  map[string]tokenizer.Tokenizer
 }
 
 func New(workspace string, p *project.Project) (*Engine, error) {
@@ -33,7 +48,15 @@ func New(workspace string, p *project.Project) (*Engine, error) {
 	providers := make(map[string]Provider, len(p.Root.Providers))
 	providerCfgs := make(map[string]project.ProviderConfig, len(p.Root.Providers))
 	for _, pc := range p.Root.Providers {
-		providers[pc.Name] = newProvider(pc)
+		provider := newProvider(pc)
+		if mock, ok := provider.(*MockProvider); ok && strings.TrimSpace(pc.MockScript) != "" {
+			script, err := LoadMockScript(MockScriptPath(workspace, pc.MockScript))
+			if err != nil {
+				return nil, fmt.Errorf("provider %q mock_script: %w", pc.Name, err)
+			}
+			mock.script = script
+		}
+		providers[pc.Name] = provider
 		providerCfgs[pc.Name] = pc
 	}
 	skills := make(map[string]Skill, len(p.Skills))
@@ -49,9 +72,25 @@ func New(workspace string, p *project.Project) (*Engine, error) {
 		providerCfgs: providerCfgs,
 		skills:       skills,
 		skillCfgs:    skillCfgs,
+		mcpRoutes:    map[string]mcpToolRoute{},
+		redactor:     NewRedactor(p),
+		artifacts:    NewArtifactStore(artifactStoreDir(workspace), DefaultArtifactMemoryBytes),
 	}, nil
 }
 
+// Close releases long-lived skill resources such as MCP server processes.
+func (e *Engine) Close() error {
+	var errs []error
+	for _, skill := range e.skills {
+		if c, ok := skill.(interface{ Close() error }); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func (e *Engine) Plan(ctx context.Context, agentNames []string, input string) (ExecutionPlan, []Task, error) {
 	graph := AgentSpecGraph{
 		Raw:    strings.Join(agentNames, "+"),
@@ -119,18 +158,22 @@ func (e *Engine) planGraph(ctx context.Context, graph AgentSpecGraph, input stri
 			})
 			specStageByIdx = append(specStageByIdx, stageIdx)
 			plan.Tasks = append(plan.Tasks, TaskPlan{
-				Agent:         a.Name,
-				AgentFile:     agentFile,
-				Provider:      providerCfg.Name,
-				ProviderType:  providerCfg.Type,
-				Model:         coalesce(a.Model, providerCfg.Model),
-				Skills:        append([]string(nil), a.Skills...),
-				TimeoutMS:     a.TimeoutMS,
-				StartupCalls:  len(a.StartupCalls),
-				ContextBudget: e.contextBudgetForTask(a, providerCfg).limitTokens(),
-				ContextMoment: string(e.contextMomentForTask(a, providerCfg)),
-				StageIndex:    stageIdx,
-				IO:            taskIOPlan(a),
+				Agent:          a.Name,
+				AgentFile:      agentFile,
+				Provider:       providerCfg.Name,
+				ProviderType:   providerCfg.Type,
+				Model:          coalesce(a.Model, providerCfg.Model),
+				Skills:         append([]string(nil), a.Skills...),
+				TimeoutMS:      a.TimeoutMS,
+				StartupCalls:   len(a.StartupCalls),
+				ContextBudget:  e.contextBudgetForTask(a, providerCfg).limitTokens(),
+				ContextMoment:  string(e.contextMomentForTask(a, providerCfg)),
+				ContextProfile: e.contextWeightProfileFor(a).Name,
+				StageIndex:     stageIdx,
+				IO:             taskIOPlan(a),
+				Paths:          e.taskPathPlan(a),
+				Routes:         taskRoutePlan(a),
+				Map:            taskMapPlan(a),
 			})
 			specStageTaskIndexes[stageIdx] = append(specStageTaskIndexes[stageIdx], taskIndex)
 		}
@@ -321,6 +364,7 @@ func (e *Engine) planGraph(ctx context.Context, graph AgentSpecGraph, input stri
 		tasks[i].Incoming = dedupeHandoffLinks(tasks[i].Incoming)
 		tasks[i].Outgoing = dedupeHandoffLinks(tasks[i].Outgoing)
 	}
+	planGraphLoops(tasks, &plan)
 	return plan, tasks, nil
 }
 
@@ -367,12 +411,18 @@ func (e *Engine) runGraph(ctx context.Context, graph AgentSpecGraph, input strin
 		return ExecutionReport{}, err
 	}
 	report := ExecutionReport{
+		RunID:     NewRunID(time.Now()),
 		StartedAt: time.Now(),
 		Parallel:  plan.Parallel,
-		Input:     input,
+		Input:     e.redactor.Redact(input),
 		Results:   make([]AgentRunResult, len(tasks)),
 	}
+	redactions := &RedactionTally{}
+	ctx = withRedactionTally(ctx, redactions)
+	ctx = withMockTurnScope(ctx)
 	sharedBus := NewContextBus(input)
+	sharedBus.SetRedactor(func(s string) string { return e.redactor.redact(s, redactions) })
+	sharedBus.SetArtifactStore(e.artifacts)
 	toolBroker := newToolBroker()
 	stageToolBudgets := buildStageToolBudgets(tasks)
 	sharedBus.AddConstraint("Prefer concise answers and avoid repeating large raw tool outputs.")
@@ -380,6 +430,8 @@ func (e *Engine) runGraph(ctx context.Context, graph AgentSpecGraph, input strin
 	sharedBus.PutFact("runtime.engine", "deepH", 1.0, "runtime")
 	sharedBus.PutFact("runtime.parallel", strconv.FormatBool(plan.Parallel), 1.0, "runtime")
 	sharedBus.PutFact("runtime.scheduler", "dag_channels", 1.0, "runtime")
+	e.seedProjectMemory(sharedBus)
+	e.resumeContext(ctx, sharedBus, &report)
 
 	taskIdxByAgent := make(map[string]int, len(tasks))
 	for i, t := range tasks {
@@ -388,29 +440,16 @@ func (e *Engine) runGraph(ctx context.Context, graph AgentSpecGraph, input strin
 
 	if len(tasks) == 0 {
 		report.EndedAt = time.Now()
+		report.Redactions = redactions.Counts()
 		return report, nil
 	}
 
-	successors := make([][]int, len(tasks))
+	successors, preds := taskGraphEdges(tasks)
 	indegree := make([]int, len(tasks))
-	for dstIdx, task := range tasks {
-		seenPred := map[int]struct{}{}
-		for _, depName := range task.DependsOn {
-			srcIdx, ok := taskIdxByAgent[depName]
-			if !ok || srcIdx == dstIdx {
-				continue
-			}
-			if _, ok := seenPred[srcIdx]; ok {
-				continue
-			}
-			seenPred[srcIdx] = struct{}{}
-			indegree[dstIdx]++
-			successors[srcIdx] = append(successors[srcIdx], dstIdx)
-		}
-	}
-	for i := range successors {
-		sort.Ints(successors[i])
+	for i := range tasks {
+		indegree[i] = len(preds[i])
 	}
+	loops, loopOf := buildGraphLoops(tasks, successors, preds)
 
 	type taskResultEvent struct {
 		taskIndex int
@@ -418,17 +457,48 @@ func (e *Engine) runGraph(ctx context.Context, graph AgentSpecGraph, input strin
 	}
 	resultsCh := make(chan taskResultEvent, len(tasks))
 	launched := make([]bool, len(tasks))
+	// slot maps a task to its latest entry in report.Results; loop iterations
+	// after the first append new entries.
+	slot := make([]int, len(tasks))
+	for i := range slot {
+		slot[i] = i
+	}
 	launchTask := func(idx int) {
 		if idx < 0 || idx >= len(tasks) || launched[idx] {
 			return
 		}
 		launched[idx] = true
-		go func(taskIndex int) {
+		if m := tasks[idx].Agent.Map; m != nil {
+			// Items from an upstream output are read here, before the
+			// goroutine, while no other result is being written.
+			over := strings.TrimSpace(m.Over)
+			var items []mapItem
+			var itemsErr error
+			if over != project.MapOverChangedFiles {
+				src, ok := taskIdxByAgent[over]
+				if !ok || !reachable(idx, preds)[src] {
+					itemsErr = fmt.Errorf("map over %s: agent is not upstream of %s in this spec", over, tasks[idx].Agent.Name)
+				} else {
+					items, itemsErr = mapItemsFromOutput(over, m.Field, report.Results[slot[src]].Output)
+				}
+			}
+			go func(taskIndex int, task Task) {
+				if over == project.MapOverChangedFiles {
+					items, itemsErr = changedFileMapItems(e.workspace, m.BaseRef)
+				}
+				resultsCh <- taskResultEvent{
+					taskIndex: taskIndex,
+					result:    e.runMapTask(ctx, task, items, itemsErr, input, sharedBus, toolBroker, stageToolBudgets[task.StageIndex]),
+				}
+			}(idx, tasks[idx])
+			return
+		}
+		go func(taskIndex int, task Task) {
 			resultsCh <- taskResultEvent{
 				taskIndex: taskIndex,
-				result:    e.runTask(ctx, tasks[taskIndex], input, sharedBus, toolBroker, stageToolBudgets[tasks[taskIndex].StageIndex]),
+				result:    e.runTask(ctx, task, input, sharedBus, toolBroker, stageToolBudgets[task.StageIndex]),
 			}
-		}(idx)
+		}(idx, tasks[idx])
 	}
 
 	launchedCount := 0
@@ -442,28 +512,145 @@ func (e *Engine) runGraph(ctx context.Context, graph AgentSpecGraph, input strin
 		return ExecutionReport{}, fmt.Errorf("no runnable tasks for spec %q (dependency deadlock)", graph.Raw)
 	}
 
-	completedCount := 0
-	for completedCount < len(tasks) {
+	activeIn := make([]int, len(tasks))
+	edgeActive := map[[2]int]bool{}
+	skipReasons := make([][]string, len(tasks))
+	release := func(src, succIdx int) {
+		res := report.Results[slot[src]]
+		name := tasks[src].Agent.Name
+		switch {
+		case res.Skipped:
+			skipReasons[succIdx] = append(skipReasons[succIdx], "upstream "+name+" skipped")
+		case !routeAllows(res.Routes, tasks[succIdx].Agent.Name):
+			skipReasons[succIdx] = append(skipReasons[succIdx], "route from "+name+" not taken")
+		default:
+			activeIn[succIdx]++
+			edgeActive[[2]int{src, succIdx}] = true
+		}
+		if indegree[succIdx] > 0 {
+			indegree[succIdx]--
+		}
+		if indegree[succIdx] == 0 && !launched[succIdx] {
+			if activeIn[succIdx] == 0 {
+				// Every incoming edge was routed away: report the branch as skipped.
+				launched[succIdx] = true
+				resultsCh <- taskResultEvent{taskIndex: succIdx, result: skippedTaskResult(tasks[succIdx], skipReasons[succIdx])}
+				return
+			}
+			launchTask(succIdx)
+		}
+	}
+
+	remaining := len(tasks)
+	for remaining > 0 {
 		item := <-resultsCh
-		report.Results[item.taskIndex] = item.result
-		pub := e.publishTaskOutputs(sharedBus, tasks[item.taskIndex], report.Results[item.taskIndex])
-		report.Results[item.taskIndex].SentHandoffs = pub.Sent
-		report.Results[item.taskIndex].DroppedHandoffs = pub.Dropped
-		report.Results[item.taskIndex].HandoffTokens = pub.Tokens
-		report.Results[item.taskIndex].SkippedOutputPublish = pub.SkippedUnconsumedOutput
-		completedCount++
+		remaining--
+		var lp *graphLoop
+		if l := loopOf[item.taskIndex]; l >= 0 {
+			lp = loops[l]
+			item.result.Iteration = lp.iter
+		}
+		if !item.result.Skipped {
+			item.result.Output = e.redactor.redact(item.result.Output, redactions)
+			item.result.Error = e.redactor.redact(item.result.Error, redactions)
+			item.result.Routes = evaluateRoutes(tasks[item.taskIndex].Agent.Routes, item.result.Output)
+		}
+		pos := slot[item.taskIndex]
+		report.Results[pos] = item.result
+		var pub publishTaskOutputsResult
+		if tasks[item.taskIndex].Agent.Map != nil && len(tasks[item.taskIndex].Outgoing) > 0 {
+			if item.result.Error == "" && !item.result.Skipped {
+				pub = e.publishMapOutputs(sharedBus, tasks, item.taskIndex, report.Results[pos], taskIdxByAgent)
+			}
+		} else {
+			pub = e.publishTaskOutputs(sharedBus, tasks[item.taskIndex], report.Results[pos])
+		}
+		report.Results[pos].SentHandoffs = pub.Sent
+		report.Results[pos].DroppedHandoffs = pub.Dropped
+		report.Results[pos].HandoffTokens = pub.Tokens
+		report.Results[pos].InvalidHandoffs = pub.Invalid
+		report.Results[pos].SkippedOutputPublish = pub.SkippedUnconsumedOutput
 
+		if lp == nil {
+			for _, succIdx := range successors[item.taskIndex] {
+				release(item.taskIndex, succIdx)
+			}
+			continue
+		}
+		// Inside a loop body only in-body edges are released; edges leaving
+		// the body wait until the loop is done.
 		for _, succIdx := range successors[item.taskIndex] {
-			if indegree[succIdx] > 0 {
-				indegree[succIdx]--
+			if lp.inBody[succIdx] {
+				release(item.taskIndex, succIdx)
 			}
-			if indegree[succIdx] == 0 && !launched[succIdx] {
-				launchTask(succIdx)
-				launchedCount++
+		}
+		if item.taskIndex != lp.exit {
+			continue
+		}
+		res := report.Results[pos]
+		exitMet := !res.Skipped && res.Error == "" && loopExitMet(lp.cfg, res.Output)
+		lp.report.Iterations = append(lp.report.Iterations, LoopIteration{Iteration: lp.iter, ExitMet: exitMet, Context: sharedBus.Snapshot()})
+		switch {
+		case exitMet:
+			lp.done, lp.report.Exited = true, true
+		case res.Skipped || res.Error != "":
+			lp.done, lp.report.StopReason = true, "exit agent did not produce output"
+		case lp.iter >= lp.report.MaxIterations:
+			lp.done, lp.report.StopReason = true, fmt.Sprintf("max_iterations=%d reached", lp.report.MaxIterations)
+		}
+		if lp.done {
+			for _, src := range lp.body {
+				for _, succIdx := range successors[src] {
+					if !lp.inBody[succIdx] {
+						release(src, succIdx)
+					}
+				}
+			}
+			continue
+		}
+
+		// Next iteration: hand the exit output back, then reset the body.
+		feedback := loopFeedbackLink(tasks[lp.exit], tasks[lp.back])
+		if tv := e.buildAgentOutputTypedValue(sharedBus, tasks[lp.exit], res, feedback); tv.Kind != "" {
+			sharedBus.RecordAgentHandoff(feedback, tv)
+		}
+		if !hasIncomingChannel(tasks[lp.back], feedback.Channel) {
+			tasks[lp.back].Incoming = append(tasks[lp.back].Incoming, feedback)
+		}
+		lp.iter++
+		for _, idx := range lp.body {
+			launched[idx] = false
+			skipReasons[idx] = nil
+			indegree[idx], activeIn[idx] = 0, 0
+			for _, p := range preds[idx] {
+				switch {
+				case lp.inBody[p]:
+					indegree[idx]++
+					delete(edgeActive, [2]int{p, idx})
+				case edgeActive[[2]int{p, idx}]:
+					activeIn[idx]++
+				}
 			}
+			report.Results = append(report.Results, AgentRunResult{})
+			slot[idx] = len(report.Results) - 1
+		}
+		remaining += len(lp.body)
+		launchTask(lp.back)
+	}
+	for _, lp := range loops {
+		if len(lp.report.Iterations) > 0 {
+			report.Loops = append(report.Loops, lp.report)
 		}
 	}
+	restageLoopResults(report.Results, loops, tasks)
+	e.saveContext(ctx, sharedBus, graph, &report)
+	e.pruneArtifacts()
+	if rp := cassetteReplayFrom(ctx); rp != nil {
+		stats := rp.Stats()
+		report.Replay = &stats
+	}
 	report.EndedAt = time.Now()
+	report.Redactions = redactions.Counts()
 	return report, nil
 }
 
@@ -539,7 +726,12 @@ func (e *Engine) runTask(parent context.Context, task Task, input string, shared
 			return res
 		}
 		callStart := time.Now()
-		out, cacheable, cached, err := e.executeSkillWithBroker(ctx, broker, task.Agent, call.Skill, input, call.Args)
+		var out map[string]any
+		var cacheable, cached bool
+		args, err := checkSkillArgs(e.skillCfgs[call.Skill], call.Args)
+		if err == nil {
+			out, cacheable, cached, err = e.executeSkillWithBroker(ctx, broker, task.Agent, call.Skill, input, args)
+		}
 		callRes := SkillCallResult{Skill: call.Skill, Duration: time.Since(callStart), Cacheable: cacheable, Cached: cached}
 		afterToolCallBudgets(toolBudget, stageBudget, callRes.Duration)
 		if err != nil {
@@ -574,13 +766,17 @@ func (e *Engine) runTask(parent context.Context, task Task, input string, shared
 	res.StartupCalls = startupResults
 
 	compiled := bus.Compile(ContextCompileSpec{
-		AgentName: task.Agent.Name,
-		Skills:    task.Agent.Skills,
-		Budget:    budget,
-		Moment:    moment,
-		Channels:  compileChannels,
+		AgentName:     task.Agent.Name,
+		Skills:        task.Agent.Skills,
+		Budget:        budget,
+		Moment:        moment,
+		Channels:      compileChannels,
+		WeightProfile: e.contextWeightProfileFor(task.Agent),
+		Tokenizer:     e.taskTokenizer(task),
+		Explain:       contextExplainEnabled(parent),
 	})
 	res.ContextTokens = compiled.EstimatedTokens
+	res.ContextExplain = compiled.Candidates
 	res.ContextVersion = compiled.Version
 	res.ContextDropped = compiled.DroppedItems
 
@@ -590,7 +786,14 @@ func (e *Engine) runTask(parent context.Context, task Task, input string, shared
 		res.Duration = time.Since(start)
 		return res
 	}
+	provider = usageProvider{Provider: e.cassetteProvider(parent, provider), usage: &res.Usage}
+
+	contracts := agentOutputContracts(task.Agent)
+	if len(contracts) > 0 {
+		task.Agent.SystemPrompt = withContractInstructions(task.Agent.SystemPrompt, contracts)
+	}
 
+	var llmResp LLMResponse
 	if shouldUseDeepSeekToolLoop(task.Agent, task.Provider) {
 		toolResp, toolTrace, toolHits, toolMisses, err := e.runToolLoop(ctx, provider, task, input, bus, compiled, broker, toolBudget, stageBudget)
 		res.ToolCalls = toolTrace
@@ -601,31 +804,22 @@ func (e *Engine) runTask(parent context.Context, task Task, input string, shared
 			res.Duration = time.Since(start)
 			return res
 		}
-		res.Output = toolResp.Text
-		if pt, ok := toolResp.Meta["provider_type"].(string); ok && pt != "" {
-			res.ProviderType = pt
-		}
-		if toolResp.Provider != "" {
-			res.Provider = toolResp.Provider
-		}
-		if toolResp.Model != "" {
-			res.Model = toolResp.Model
+		llmResp = toolResp
+	} else {
+		resp, err := provider.Generate(ctx, LLMRequest{
+			AgentName:       task.Agent.Name,
+			Model:           coalesce(task.Agent.Model, task.Provider.Model),
+			SystemPrompt:    task.Agent.SystemPrompt,
+			Input:           compiled.Text,
+			AvailableSkills: append([]string(nil), task.Agent.Skills...),
+			ResponseSchema:  contractResponseSchema(contracts),
+		})
+		if err != nil {
+			res.Error = err.Error()
+			res.Duration = time.Since(start)
+			return res
 		}
-		res.Duration = time.Since(start)
-		return res
-	}
-
-	llmResp, err := provider.Generate(ctx, LLMRequest{
-		AgentName:       task.Agent.Name,
-		Model:           coalesce(task.Agent.Model, task.Provider.Model),
-		SystemPrompt:    task.Agent.SystemPrompt,
-		Input:           compiled.Text,
-		AvailableSkills: append([]string(nil), task.Agent.Skills...),
-	})
-	if err != nil {
-		res.Error = err.Error()
-		res.Duration = time.Since(start)
-		return res
+		llmResp = resp
 	}
 	res.Output = llmResp.Text
 	if pt, ok := llmResp.Meta["provider_type"].(string); ok && pt != "" {
@@ -637,18 +831,22 @@ func (e *Engine) runTask(parent context.Context, task Task, input string, shared
 	if llmResp.Model != "" {
 		res.Model = llmResp.Model
 	}
+	if len(contracts) > 0 {
+		e.enforceOutputContracts(ctx, provider, task, compiled, contracts, &res)
+	}
 	res.Duration = time.Since(start)
 	return res
 }
 
 func (e *Engine) runToolLoop(ctx context.Context, provider Provider, task Task, input string, bus *ContextBus, compiled CompiledContext, broker *toolBroker, toolBudget *taskToolBudget, stageBudget *stageToolBudget) (LLMResponse, []SkillCallResult, int, int, error) {
-	tools, err := e.buildToolDefinitions(task.Agent.Skills)
+	tools, err := e.buildToolDefinitions(ctx, task.Agent.Skills)
 	if err != nil {
 		return LLMResponse{}, nil, 0, 0, err
 	}
 	trace := make([]SkillCallResult, 0)
 	cacheHits := 0
 	cacheMisses := 0
+	responseSchema := contractResponseSchema(agentOutputContracts(task.Agent))
 	if len(tools) == 0 {
 		resp, err := provider.Generate(ctx, LLMRequest{
 			AgentName:       task.Agent.Name,
@@ -656,6 +854,7 @@ func (e *Engine) runToolLoop(ctx context.Context, provider Provider, task Task,
 			SystemPrompt:    task.Agent.SystemPrompt,
 			Input:           compiled.Text,
 			AvailableSkills: append([]string(nil), task.Agent.Skills...),
+			ResponseSchema:  responseSchema,
 		})
 		return resp, trace, cacheHits, cacheMisses, err
 	}
@@ -680,6 +879,7 @@ func (e *Engine) runToolLoop(ctx context.Context, provider Provider, task Task,
 			Messages:        append([]ChatMessage(nil), messages...),
 			Tools:           tools,
 			ToolChoice:      "auto",
+			ResponseSchema:  responseSchema,
 		})
 		if err != nil {
 			if round == 0 && isToolCallUnsupportedError(err) {
@@ -690,6 +890,7 @@ func (e *Engine) runToolLoop(ctx context.Context, provider Provider, task Task,
 					SystemPrompt:    task.Agent.SystemPrompt,
 					Input:           compiled.Text,
 					AvailableSkills: append([]string(nil), task.Agent.Skills...),
+					ResponseSchema:  responseSchema,
 				})
 				if plainErr == nil {
 					if resp.Meta == nil {
@@ -815,18 +1016,39 @@ func (e *Engine) executeToolCall(ctx context.Context, broker *toolBroker, agent
 		}
 		args = obj
 	}
-	callTrace.Args = args
+	// The trace keeps a scrubbed copy; the skill still receives the real args.
+	callTrace.Args = e.redactor.redactMap(args, redactionTallyFrom(ctx))
 
-	skill, ok := e.skills[tc.Name]
+	skillName, skillArgs, tool := tc.Name, args, ""
+	if route, ok := e.mcpRoute(tc.Name); ok {
+		skillName, tool = route.Skill, route.Tool
+		skillArgs = map[string]any{"tool": route.Tool, "arguments": args}
+	}
+	skill, ok := e.skills[skillName]
 	if !ok {
 		callTrace.Error = "skill not registered"
 		callTrace.Duration = 0
 		return callTrace, toolErrorMessage(tc, callTrace.Error)
 	}
+	// Reject malformed calls before asking anyone to approve them.
+	skillArgs, err := checkSkillArgs(e.skillCfgs[skillName], skillArgs)
+	if err != nil {
+		callTrace.Error = err.Error()
+		return callTrace, toolErrorMessage(tc, callTrace.Error)
+	}
+	// A replayed call never executes, so there is nothing to approve.
+	if cassetteReplayFrom(ctx) == nil {
+		approval, err := e.checkToolCallApproval(ctx, agent, e.skillCfgs[skillName], tc, tool, args)
+		callTrace.Approval = approval
+		if err != nil {
+			callTrace.Error = err.Error()
+			return callTrace, toolErrorMessage(tc, callTrace.Error)
+		}
+	}
 
 	start := time.Now()
 	_ = skill // resolved above for existence; execution happens via helper.
-	result, cacheable, cached, err := e.executeSkillWithBroker(ctx, broker, agent, tc.Name, input, args)
+	result, cacheable, cached, err := e.executeSkillWithBroker(ctx, broker, agent, skillName, input, skillArgs)
 	callTrace.Duration = time.Since(start)
 	callTrace.Cacheable = cacheable
 	callTrace.Cached = cached
@@ -838,23 +1060,41 @@ func (e *Engine) executeToolCall(ctx context.Context, broker *toolBroker, agent
 	return callTrace, toolResultMessage(tc, result)
 }
 
+// executeSkillWithBroker runs one skill call; callers validate args with
+// checkSkillArgs first.
 func (e *Engine) executeSkillWithBroker(ctx context.Context, broker *toolBroker, agent project.AgentConfig, skillName, input string, args map[string]any) (map[string]any, bool, bool, error) {
 	skill, ok := e.skills[skillName]
 	if !ok {
 		return nil, false, false, fmt.Errorf("skill %q not registered", skillName)
 	}
 	lockKey := e.lockKeyForSkillCall(agent, skillName, args)
+	exec := SkillExecution{AgentName: agent.Name, Input: input, Args: args, Paths: newPathPolicy(agent, e.skillCfgs[skillName]), Artifacts: e.artifacts, Redact: e.redactor.Redact}
 	runSkill := func(runCtx context.Context) (map[string]any, error) {
 		if broker != nil && lockKey != "" {
 			return broker.WithResourceLock(runCtx, lockKey, func(lockedCtx context.Context) (map[string]any, error) {
-				return skill.Execute(lockedCtx, SkillExecution{AgentName: agent.Name, Input: input, Args: args})
+				return skill.Execute(lockedCtx, exec)
 			})
 		}
-		return skill.Execute(runCtx, SkillExecution{AgentName: agent.Name, Input: input, Args: args})
+		return skill.Execute(runCtx, exec)
+	}
+	tally := redactionTallyFrom(ctx)
+	redacted := runSkill
+	runSkill = func(runCtx context.Context) (map[string]any, error) {
+		// Scrub secrets once, before results are cached, traced or sent on.
+		out, err := redacted(runCtx)
+		if workspaceContentSkills[e.skillCfgs[skillName].Type] {
+			return e.redactor.redactContentMap(out, tally), e.redactor.redactError(err, tally)
+		}
+		return e.redactor.redactMap(out, tally), e.redactor.redactError(err, tally)
 	}
+	runSkill = e.cassetteSkill(ctx, agent.Name, skillName, input, args, runSkill)
 	cacheKey, cacheable := e.cacheKeyForSkillCall(agent, skillName, input, args)
 	if !cacheable || broker == nil {
 		out, err := runSkill(ctx)
+		if workspaceMutatingSkills[e.skillCfgs[skillName].Type] {
+			// Cached reads may predate this call, even a failed one.
+			broker.Invalidate()
+		}
 		return out, cacheable, false, err
 	}
 	out, err, cacheHit := broker.Do(ctx, cacheKey, func(runCtx context.Context) (map[string]any, error) {
@@ -863,6 +1103,26 @@ func (e *Engine) executeSkillWithBroker(ctx context.Context, broker *toolBroker,
 	return out, true, cacheHit, err
 }
 
+// workspaceMutatingSkills are the skill types that can change workspace
+// files, so cached workspace reads are dropped after each of their calls.
+var workspaceMutatingSkills = map[string]bool{
+	"file_write_safe": true,
+	"command_exec":    true,
+	"memory_write":    true,
+	"plugin":          true,
+	"mcp":             true,
+}
+
+// workspaceContentSkills return workspace file contents, which are scrubbed
+// with known credential formats only (see redactContentMap).
+var workspaceContentSkills = map[string]bool{
+	"file_read":       true,
+	"file_read_range": true,
+	"code_search":     true,
+	"repo_map":        true,
+	"git":             true,
+}
+
 func (e *Engine) cacheKeyForSkillCall(agent project.AgentConfig, skillName, input string, args map[string]any) (string, bool) {
 	cfg, ok := e.skillCfgs[skillName]
 	if !ok {
@@ -870,9 +1130,17 @@ func (e *Engine) cacheKeyForSkillCall(agent project.AgentConfig, skillName, inpu
 	}
 	typ := strings.ToLower(strings.TrimSpace(cfg.Type))
 	switch typ {
-	case "file_read", "file_read_range":
-		// Workspace-scoped deterministic reads; safe to dedupe across agents in a run.
+	case "artifact_read":
+		// Artifacts are content-addressed, so a read never changes.
 		return encodeSkillCacheKey("v1", typ, skillName, args, "")
+	case "file_read", "file_read_range", "code_search", "repo_map":
+		// Workspace-scoped deterministic reads; safe to dedupe across agents in a
+		// run that share the same path policy.
+		key, ok := encodeSkillCacheKey("v1", typ, skillName, args, "")
+		if scope := newPathPolicy(agent, cfg).Key(); ok && scope != "" {
+			key += "|paths=" + scope
+		}
+		return key, ok
 	case "command_doc":
 		return encodeSkillCacheKey("v1", typ, skillName, args, "")
 	case "echo":
@@ -927,6 +1195,12 @@ func (e *Engine) lockKeyForSkillCall(agent project.AgentConfig, skillName string
 			return ""
 		}
 		return "http-host:" + host
+	case "command_exec":
+		// Builds/tests share the workspace tree; serialize them so parallel agents do not race.
+		if !metadataBoolDefault(agent.Metadata, "lock_exec_tools", true) {
+			return ""
+		}
+		return "exec:workspace"
 	default:
 		return ""
 	}
@@ -989,24 +1263,112 @@ func tryDecodeToolArgs(raw string) map[string]any {
 	return m
 }
 
-func (e *Engine) buildToolDefinitions(skillNames []string) ([]LLMToolDefinition, error) {
+func (e *Engine) buildToolDefinitions(ctx context.Context, skillNames []string) ([]LLMToolDefinition, error) {
 	tools := make([]LLMToolDefinition, 0, len(skillNames))
 	for _, name := range skillNames {
 		cfg, ok := e.skillCfgs[name]
 		if !ok {
 			return nil, fmt.Errorf("agent references unknown skill %q", name)
 		}
+		if cfg.Type == "mcp" {
+			defs, err := e.mcpToolDefinitions(ctx, cfg)
+			if err != nil {
+				return nil, err
+			}
+			tools = append(tools, defs...)
+			continue
+		}
 		def := LLMToolDefinition{
 			Name:        cfg.Name,
 			Description: coalesce(cfg.Description, "Runtime skill"),
 			Parameters:  toolParametersSchema(cfg),
 		}
+		if plugin, ok := e.skills[cfg.Name].(*PluginSkill); ok {
+			desc, err := plugin.Describe(ctx)
+			if err != nil {
+				return nil, err
+			}
+			def.Description = coalesce(cfg.Description, desc.Description, "Plugin skill "+desc.Name)
+			if len(cfg.ArgsSchema) == 0 && len(desc.Parameters) > 0 {
+				def.Parameters = desc.Parameters
+			}
+		}
 		tools = append(tools, def)
 	}
 	return tools, nil
 }
 
+// mcpToolDefinitions discovers the server's tools and registers a route for each
+// advertised name so executeToolCall can dispatch it back to the owning skill.
+func (e *Engine) mcpToolDefinitions(ctx context.Context, cfg project.SkillConfig) ([]LLMToolDefinition, error) {
+	skill, ok := e.skills[cfg.Name].(*MCPSkill)
+	if !ok {
+		return nil, fmt.Errorf("skill %q is not an mcp skill", cfg.Name)
+	}
+	tools, err := skill.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defs := make([]LLMToolDefinition, 0, len(tools))
+	e.mcpMu.Lock()
+	defer e.mcpMu.Unlock()
+	if e.mcpRoutes == nil {
+		e.mcpRoutes = map[string]mcpToolRoute{}
+	}
+	for _, t := range tools {
+		route := mcpToolRoute{Skill: cfg.Name, Tool: t.Name}
+		name, err := e.mcpRouteName(route)
+		if err != nil {
+			return nil, err
+		}
+		params := t.InputSchema
+		if len(params) == 0 {
+			params = map[string]any{"type": "object", "additionalProperties": true}
+		}
+		defs = append(defs, LLMToolDefinition{
+			Name:        name,
+			Description: coalesce(t.Description, cfg.Description, "MCP tool "+t.Name),
+			Parameters:  params,
+		})
+		e.mcpRoutes[name] = route
+	}
+	return defs, nil
+}
+
+// mcpRouteName picks the advertised name for route. A name already routed to
+// another tool, or shadowed by a skill, gets a hash suffix instead of silently
+// replacing the earlier route. The caller holds e.mcpMu.
+func (e *Engine) mcpRouteName(route mcpToolRoute) (string, error) {
+	free := func(name string) bool {
+		if _, ok := e.skills[name]; ok {
+			return false
+		}
+		prev, ok := e.mcpRoutes[name]
+		return !ok || prev == route
+	}
+	if name := mcpToolName(route.Skill, route.Tool); free(name) {
+		return name, nil
+	}
+	if name := mcpHashedToolName(route.Skill, route.Tool); free(name) {
+		return name, nil
+	}
+	return "", fmt.Errorf("mcp tool %q of skill %q collides with another tool name", route.Tool, route.Skill)
+}
+
+func (e *Engine) mcpRoute(toolName string) (mcpToolRoute, bool) {
+	if _, ok := e.skills[toolName]; ok {
+		return mcpToolRoute{}, false
+	}
+	e.mcpMu.RLock()
+	defer e.mcpMu.RUnlock()
+	route, ok := e.mcpRoutes[toolName]
+	return route, ok
+}
+
 func toolParametersSchema(cfg project.SkillConfig) map[string]any {
+	if len(cfg.ArgsSchema) > 0 {
+		return cfg.ArgsSchema
+	}
 	switch cfg.Type {
 	case "file_read":
 		return map[string]any{
@@ -1044,6 +1406,54 @@ func toolParametersSchema(cfg project.SkillConfig) map[string]any {
 			"required":             []string{"path"},
 			"additionalProperties": false,
 		}
+	case "memory_write":
+		return map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"key": map[string]any{
+					"type":        "string",
+					"description": "Stable dotted key, e.g. build.command or convention.errors",
+				},
+				"value": map[string]any{
+					"type":        "string",
+					"description": "The fact, one or two sentences",
+				},
+				"confidence": map[string]any{
+					"type":        "number",
+					"description": "0..1, how sure you are (default 0.7)",
+				},
+				"evidence": map[string]any{
+					"type":        "string",
+					"description": "Where the fact comes from (file path, command output)",
+				},
+			},
+			"required":             []string{"key", "value"},
+			"additionalProperties": false,
+		}
+	case "artifact_read":
+		return map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"id": map[string]any{
+					"type":        "string",
+					"description": "Artifact ID from the context (id=...), or its hash",
+				},
+				"start_line": map[string]any{
+					"type":        "integer",
+					"description": "1-based start line (inclusive)",
+				},
+				"end_line": map[string]any{
+					"type":        "integer",
+					"description": "1-based end line (inclusive)",
+				},
+				"max_bytes": map[string]any{
+					"type":        "integer",
+					"description": "Optional override to reduce returned bytes",
+				},
+			},
+			"required":             []string{"id"},
+			"additionalProperties": false,
+		}
 	case "file_write_safe":
 		return map[string]any{
 			"type": "object",
@@ -1099,6 +1509,146 @@ func toolParametersSchema(cfg project.SkillConfig) map[string]any {
 			},
 			"required": []string{"url"},
 		}
+	case "command_exec":
+		commandDesc := "Command line to run (no shell; pipes and redirects are not interpreted)"
+		if allow := commandExecAllowlist(cfg); len(allow) > 0 {
+			commandDesc += ". Allowed prefixes: " + strings.Join(allow, ", ")
+		}
+		return map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"command": map[string]any{
+					"type":        "string",
+					"description": commandDesc,
+				},
+				"dir": map[string]any{
+					"type":        "string",
+					"description": "Optional working directory inside the workspace (relative path only)",
+				},
+				"timeout_ms": map[string]any{
+					"type":        "integer",
+					"description": "Optional lower timeout in milliseconds",
+				},
+			},
+			"required":             []string{"command"},
+			"additionalProperties": false,
+		}
+	case "code_search":
+		return map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"mode": map[string]any{
+					"type":        "string",
+					"enum":        []string{"grep", "symbol"},
+					"description": "grep searches file contents (default); symbol looks up a Go declaration, its references and importing packages",
+				},
+				"pattern": map[string]any{
+					"type":        "string",
+					"description": "Regular expression (RE2) to search for in grep mode",
+				},
+				"literal": map[string]any{
+					"type":        "boolean",
+					"description": "Treat pattern as plain text instead of a regex",
+				},
+				"ignore_case": map[string]any{
+					"type":        "boolean",
+					"description": "Case-insensitive match",
+				},
+				"symbol": map[string]any{
+					"type":        "string",
+					"description": "Go symbol for symbol mode: Name, Type.Method or pkg.Name",
+				},
+				"path": map[string]any{
+					"type":        "string",
+					"description": "Optional directory inside the workspace to limit the search (relative path only)",
+				},
+				"glob": map[string]any{
+					"type":        "string",
+					"description": "Optional comma-separated file globs such as *.go or internal/**/*.ts",
+				},
+				"context_lines": map[string]any{
+					"type":        "integer",
+					"description": "Lines of context before and after each match (max 5)",
+				},
+				"max_results": map[string]any{
+					"type":        "integer",
+					"description": "Optional lower cap on returned matches",
+				},
+			},
+			"additionalProperties": false,
+		}
+	case "repo_map":
+		return map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"path": map[string]any{
+					"type":        "string",
+					"description": "Optional directory inside the workspace to map (relative path only)",
+				},
+				"max_depth": map[string]any{
+					"type":        "integer",
+					"description": "Optional lower directory depth; deeper folders are collapsed into file counts",
+				},
+				"max_entries": map[string]any{
+					"type":        "integer",
+					"description": "Optional lower cap on listed directories and files",
+				},
+				"outline": map[string]any{
+					"type":        "boolean",
+					"description": "Include Go/TS/JS symbol outlines (default true)",
+				},
+			},
+			"additionalProperties": false,
+		}
+	case "git":
+		return map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"op": map[string]any{
+					"type":        "string",
+					"enum":        []string{"log", "show", "blame", "diff", "status"},
+					"description": "Read-only git operation",
+				},
+				"path": map[string]any{
+					"type":        "string",
+					"description": "Path inside the workspace (required for blame; optional filter for log, show, diff, status)",
+				},
+				"commit": map[string]any{
+					"type":        "string",
+					"description": "Commit for show (hash, tag, branch or HEAD~N)",
+				},
+				"ref": map[string]any{
+					"type":        "string",
+					"description": "Optional ref for log, blame or diff (diff compares the working tree against it)",
+				},
+				"start_line": map[string]any{
+					"type":        "integer",
+					"description": "1-based first line for blame",
+				},
+				"end_line": map[string]any{
+					"type":        "integer",
+					"description": "1-based last line for blame (inclusive)",
+				},
+				"max_count": map[string]any{
+					"type":        "integer",
+					"description": "Number of commits for log (default 20, max 100)",
+				},
+				"stat": map[string]any{
+					"type":        "boolean",
+					"description": "Show only a diffstat for diff",
+				},
+				"name_only": map[string]any{
+					"type":        "boolean",
+					"description": "List the files each commit touched (log)",
+				},
+				"max_bytes": map[string]any{
+					"type":        "integer",
+					"description": "Optional lower cap on returned bytes",
+				},
+			},
+			"required":             []string{"op"},
+			"additionalProperties": false,
+		}
 	case "echo":
 		return map[string]any{
 			"type": "object",
@@ -1196,8 +1746,11 @@ func (e *Engine) contextMomentForTask(agent project.AgentConfig, provider projec
 	return ContextMomentSynthesis
 }
 
+// shouldUseDeepSeekToolLoop reports whether the agent runs the tool-calling
+// loop: DeepSeek providers and scripted mock providers, for agents with skills.
 func shouldUseDeepSeekToolLoop(agent project.AgentConfig, provider project.ProviderConfig) bool {
-	if provider.Type != "deepseek" || len(agent.Skills) == 0 {
+	scriptedMock := provider.Type == "mock" && strings.TrimSpace(provider.MockScript) != ""
+	if (provider.Type != "deepseek" && !scriptedMock) || len(agent.Skills) == 0 {
 		return false
 	}
 	if metadataBool(agent.Metadata, "disable_tool_loop") || metadataBool(agent.Metadata, "disable_tools") {
@@ -1563,6 +2116,7 @@ type publishTaskOutputsResult struct {
 	Sent                    int
 	Dropped                 int
 	Tokens                  int
+	Invalid                 int
 	SkippedUnconsumedOutput bool
 }
 
@@ -1617,9 +2171,9 @@ func (e *Engine) publishTaskOutputs(bus *ContextBus, task Task, res AgentRunResu
 		}
 		tokenCost := tv.TokensHint
 		if tokenCost <= 0 {
-			tokenCost = estimateTokens(strings.TrimSpace(tv.InlineText))
+			tokenCost = e.handoffTokenizer(link).Count(tv.InlineText)
 			if tokenCost <= 0 {
-				tokenCost = estimateTokens(fmt.Sprint(tv.Meta))
+				tokenCost = e.handoffTokenizer(link).Count(fmt.Sprint(tv.Meta))
 			}
 			if tokenCost <= 0 {
 				tokenCost = 1
@@ -1679,6 +2233,15 @@ func (e *Engine) publishTaskOutputs(bus *ContextBus, task Task, res AgentRunResu
 			out.Dropped++
 			continue
 		}
+		if contractPortInvalid(res, c.Link.FromPort) {
+			meta := make(map[string]string, len(tv.Meta)+1)
+			for k, v := range tv.Meta {
+				meta[k] = v
+			}
+			meta["contract"] = "invalid"
+			tv.Meta = meta
+			out.Invalid++
+		}
 		bus.RecordAgentHandoff(c.Link, tv)
 		sentChannels++
 		usedTokens += c.TokensCost
@@ -1956,7 +2519,8 @@ func (e *Engine) previewAgentOutputTypedValue(task Task, res AgentRunResult, lin
 	if summary == "" {
 		summary = trim(raw, 220)
 	}
-	tokensHint := estimateTokens(summary)
+	tok := e.handoffTokenizer(link)
+	tokensHint := tok.Count(summary)
 
 	if shouldInlineHandoff(kind, raw) {
 		inline := raw
@@ -1969,7 +2533,7 @@ func (e *Engine) previewAgentOutputTypedValue(task Task, res AgentRunResult, lin
 			Kind:       kind,
 			InlineText: inline,
 			Bytes:      len(raw),
-			TokensHint: estimateTokens(inline),
+			TokensHint: tok.Count(inline),
 		}
 	}
 	return typesys.TypedValue{
@@ -1994,7 +2558,8 @@ func (e *Engine) buildAgentOutputTypedValue(bus *ContextBus, task Task, res Agen
 	if summary == "" {
 		summary = trim(raw, 220)
 	}
-	tokensHint := estimateTokens(summary)
+	tok := e.handoffTokenizer(link)
+	tokensHint := tok.Count(summary)
 
 	if shouldInlineHandoff(kind, raw) {
 		inline := raw
@@ -2007,7 +2572,7 @@ func (e *Engine) buildAgentOutputTypedValue(bus *ContextBus, task Task, res Agen
 			Kind:       kind,
 			InlineText: inline,
 			Bytes:      len(raw),
-			TokensHint: estimateTokens(inline),
+			TokensHint: tok.Count(inline),
 			Meta: map[string]string{
 				"from_agent": task.Agent.Name,
 				"from_port":  coalesce(strings.TrimSpace(link.FromPort), "output"),
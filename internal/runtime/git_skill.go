@@ -0,0 +1,269 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	osexec "os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"deeph/internal/capbuf"
+	"deeph/internal/project"
+	"deeph/internal/typesys"
+)
+
+const (
+	defaultGitSkillTimeout        = 10 * time.Second
+	defaultGitSkillMaxOutputBytes = 32 * 1024
+	defaultGitSkillLogCount       = 20
+	maxGitSkillLogCount           = 100
+	maxGitSkillBlameLines         = 400
+)
+
+// gitRefPattern accepts commit-ish values (hashes, branches, tags, HEAD~2, main...topic)
+// and rejects anything that git could parse as an option. ":" is excluded so
+// "HEAD:.env" cannot name a blob behind the path policy.
+var gitRefPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/~^@{}+-]*$`)
+
+// GitSkill exposes a read-only subset of git (log, show, blame, diff, status).
+type GitSkill struct {
+	cfg       project.SkillConfig
+	workspace string
+}
+
+func (s *GitSkill) Name() string { return s.cfg.Name }
+func (s *GitSkill) Description() string {
+	return coalesce(s.cfg.Description, "Read-only git history for the workspace (log, show, blame, diff, status)")
+}
+func (s *GitSkill) Execute(ctx context.Context, exec SkillExecution) (map[string]any, error) {
+	op := strings.ToLower(strings.TrimSpace(anyString(exec.Args["op"])))
+	gitArgs, err := s.buildArgs(op, exec.Args, exec.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := defaultGitSkillTimeout
+	if s.cfg.TimeoutMS > 0 {
+		timeout = time.Duration(s.cfg.TimeoutMS) * time.Millisecond
+	}
+	maxBytes := defaultGitSkillMaxOutputBytes
+	if v, ok := intParam(s.cfg.Params, "max_output_bytes"); ok && v > 0 {
+		maxBytes = v
+	}
+	if v, ok := intArg(exec.Args, "max_bytes"); ok && v > 0 && v < maxBytes {
+		maxBytes = v
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	argv := append([]string{
+		"--no-pager",
+		"-c", "core.fsmonitor=false",
+		"-c", "color.ui=false",
+		"-C", s.workspace,
+	}, gitArgs...)
+	out := capbuf.New(maxBytes)
+	cmd := osexec.CommandContext(runCtx, "git", argv...)
+	cmd.Dir = s.workspace
+	cmd.Env = append(commandExecEnv(s.cfg), "GIT_OPTIONAL_LOCKS=0", "GIT_TERMINAL_PROMPT=0", "GIT_PAGER=cat")
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("git %s timed out after %s", op, timeout)
+		}
+		var exitErr *osexec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("git %s failed (exit %d): %s", op, exitErr.ExitCode(), trim(strings.TrimSpace(out.String()), 400))
+		}
+		return nil, err
+	}
+
+	kind := typesys.KindTextPlain
+	if op == "show" || op == "diff" {
+		kind = typesys.KindTextDiff
+	}
+	text := out.String()
+	return map[string]any{
+		"op":            op,
+		"args":          gitArgs,
+		"text":          text,
+		"bytes":         len(text),
+		"truncated":     out.Truncated(),
+		"detected_kind": kind.String(),
+	}, nil
+}
+
+func (s *GitSkill) buildArgs(op string, args map[string]any, paths PathPolicy) ([]string, error) {
+	switch op {
+	case "log":
+		count := defaultGitSkillLogCount
+		if v, ok := intArg(args, "max_count"); ok && v > 0 {
+			count = min(v, maxGitSkillLogCount)
+		}
+		out := []string{"log", "--no-decorate", "--date=short", "--format=%h %ad %an %s", "-n", strconv.Itoa(count)}
+		if nameOnly, _ := boolArg(args, "name_only"); nameOnly {
+			out = append(out, "--name-only", "--relative")
+		}
+		if ref, err := gitRefArg(args, "ref", false); err != nil {
+			return nil, err
+		} else if ref != "" {
+			out = append(out, ref)
+		}
+		return s.appendPathspec(out, args, paths, false)
+	case "show":
+		ref, err := gitRefArg(args, "commit", true)
+		if err != nil {
+			return nil, err
+		}
+		// Peel to a commit so a tree or blob id cannot dump file contents.
+		out := []string{"show", "--no-ext-diff", "--no-textconv", "--relative", "--stat", "--patch", "--format=commit %H%nAuthor: %an <%ae>%nDate: %ad%n%n%B", ref + "^{commit}"}
+		return s.appendPathspec(out, args, paths, false)
+	case "blame":
+		start := 1
+		if v, ok := intArg(args, "start_line"); ok && v > 0 {
+			start = v
+		}
+		end := start + maxGitSkillBlameLines - 1
+		if v, ok := intArg(args, "end_line"); ok && v >= start {
+			end = min(v, start+maxGitSkillBlameLines-1)
+		}
+		out := []string{"blame", "--date=short", "-L", fmt.Sprintf("%d,%d", start, end)}
+		if ref, err := gitRefArg(args, "ref", false); err != nil {
+			return nil, err
+		} else if ref != "" {
+			out = append(out, ref)
+		}
+		return s.appendPathspec(out, args, paths, true)
+	case "diff":
+		out := []string{"diff", "--no-ext-diff", "--no-textconv", "--relative"}
+		if stat, _ := boolArg(args, "stat"); stat {
+			out = append(out, "--stat")
+		}
+		if ref, err := gitRefArg(args, "ref", false); err != nil {
+			return nil, err
+		} else if ref != "" {
+			out = append(out, ref)
+		}
+		return s.appendPathspec(out, args, paths, false)
+	case "status":
+		return s.appendPathspec([]string{"status", "--short", "--branch"}, args, paths, false)
+	case "":
+		return nil, fmt.Errorf("git requires args.op (log, show, blame, diff or status)")
+	default:
+		return nil, fmt.Errorf("unsupported git op %q (allowed: log, show, blame, diff, status)", op)
+	}
+}
+
+// appendPathspec adds args.path after checking it against the path policy,
+// then excludes every denied pattern so history of protected files stays
+// hidden even without a path. Without a path it scopes to allow_paths, or to
+// "." so a workspace inside a larger repository never sees its siblings. Ops
+// that require a path (blame) take a single file and get no excludes.
+func (s *GitSkill) appendPathspec(argv []string, args map[string]any, paths PathPolicy, required bool) ([]string, error) {
+	raw := strings.TrimSpace(anyString(args["path"]))
+	if raw == "" {
+		if required {
+			return nil, fmt.Errorf("git %s requires args.path (string)", argv[0])
+		}
+		include, err := gitAllowPathspecs(paths)
+		if err != nil {
+			return nil, err
+		}
+		argv = append(append(argv, "--"), include...)
+		return append(argv, gitExcludePathspecs(paths, "")...), nil
+	}
+	clean, _, err := resolvePolicyPath(s.workspace, paths, raw, false)
+	if err != nil {
+		return nil, err
+	}
+	argv = append(argv, "--", clean)
+	if required {
+		return argv, nil
+	}
+	return append(argv, gitExcludePathspecs(paths, filepath.ToSlash(clean))...), nil
+}
+
+// gitExcludePathspecs maps deny_paths and DefaultDenyPaths to :(exclude)
+// pathspecs. A default the given path was exempted from is left out so the
+// path stays visible.
+func gitExcludePathspecs(paths PathPolicy, given string) []string {
+	var out []string
+	for _, pat := range paths.Deny {
+		out = appendGitPatternPathspecs(out, "exclude,glob", pat)
+	}
+	for _, pat := range DefaultDenyPaths {
+		if given != "" && matchPathPattern(pat, given) {
+			continue
+		}
+		out = appendGitPatternPathspecs(out, "exclude,glob", pat)
+	}
+	return out
+}
+
+// gitAllowPathspecs maps allow_paths to positive :(glob) pathspecs, or "."
+// without them. Git ORs positive pathspecs, so the levels are intersected up
+// front: of two patterns the one lying inside the other survives, and pairs
+// where neither contains the other are dropped. That can hide more than Check
+// would, never less.
+func gitAllowPathspecs(paths PathPolicy) ([]string, error) {
+	if len(paths.Allow) == 0 {
+		return []string{"."}, nil
+	}
+	patterns := paths.Allow[0]
+	for _, level := range paths.Allow[1:] {
+		var next []string
+		for _, a := range patterns {
+			for _, b := range level {
+				switch {
+				case matchPathPattern(a, b):
+					next = append(next, b)
+				case matchPathPattern(b, a):
+					next = append(next, a)
+				}
+			}
+		}
+		patterns = next
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("allow_paths levels %v have no path in common", paths.Allow)
+	}
+	var out []string
+	seen := map[string]bool{}
+	for _, pat := range patterns {
+		if !seen[pat] {
+			seen[pat] = true
+			out = appendGitPatternPathspecs(out, "glob", pat)
+		}
+	}
+	return out, nil
+}
+
+// appendGitPatternPathspecs spells a PathPolicy pattern as pathspecs with the
+// same matching: names match at any depth, patterns with "/" are anchored, and
+// a match covers everything below it.
+func appendGitPatternPathspecs(out []string, magic, pat string) []string {
+	if !strings.Contains(pat, "/") {
+		pat = "**/" + pat
+	}
+	return append(out, ":("+magic+")"+pat, ":("+magic+")"+pat+"/**")
+}
+
+func gitRefArg(args map[string]any, key string, required bool) (string, error) {
+	ref := strings.TrimSpace(anyString(args[key]))
+	if ref == "" {
+		if required {
+			return "", fmt.Errorf("git requires args.%s (string)", key)
+		}
+		return "", nil
+	}
+	if !gitRefPattern.MatchString(ref) {
+		return "", fmt.Errorf("invalid git ref %q", ref)
+	}
+	return ref, nil
+}
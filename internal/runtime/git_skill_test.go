@@ -0,0 +1,214 @@
+package runtime
+
+import (
+	"context"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"deeph/internal/project"
+)
+
+func runSkillTestGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := osexec.Command("git", append([]string{"-C", dir}, args...)...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v (%s)", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+}
+
+// initTestGitRepo creates a repository with one commit of main.go and an
+// uncommitted edit on top.
+func initTestGitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := osexec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	ws := t.TempDir()
+	runSkillTestGit(t, ws, "init", "-q")
+	runSkillTestGit(t, ws, "config", "user.email", "dev@example.com")
+	runSkillTestGit(t, ws, "config", "user.name", "Dev One")
+	writeCodeSearchFile(t, ws, "main.go", "package main\n\nfunc main() {}\n")
+	runSkillTestGit(t, ws, "add", "main.go")
+	runSkillTestGit(t, ws, "commit", "-q", "-m", "add entrypoint")
+	writeCodeSearchFile(t, ws, "main.go", "package main\n\nfunc main() { run() }\n")
+	return ws
+}
+
+func TestGitSkillReadOnlyOperations(t *testing.T) {
+	ws := initTestGitRepo(t)
+	s := &GitSkill{cfg: project.SkillConfig{Name: "git", Type: "git"}, workspace: ws}
+	cases := []struct {
+		args map[string]any
+		want string
+	}{
+		{map[string]any{"op": "log"}, "Dev One add entrypoint"},
+		{map[string]any{"op": "show", "commit": "HEAD"}, "+func main() {}"},
+		{map[string]any{"op": "blame", "path": "main.go", "start_line": 1, "end_line": 1}, "package main"},
+		{map[string]any{"op": "diff", "path": "main.go"}, "+func main() { run() }"},
+		{map[string]any{"op": "status"}, "M main.go"},
+	}
+	for _, tc := range cases {
+		out, err := s.Execute(context.Background(), SkillExecution{Args: tc.args})
+		if err != nil {
+			t.Fatalf("%v: Execute error: %v", tc.args, err)
+		}
+		if text, _ := out["text"].(string); !strings.Contains(text, tc.want) {
+			t.Fatalf("%v: expected %q in output, got %q", tc.args, tc.want, text)
+		}
+	}
+}
+
+func TestGitSkillRejectsUnsafeInput(t *testing.T) {
+	ws := initTestGitRepo(t)
+	s := &GitSkill{cfg: project.SkillConfig{Name: "git", Type: "git"}, workspace: ws}
+	for _, args := range []map[string]any{
+		{"op": "push"},
+		{"op": "show", "commit": "--output=/tmp/x"},
+		{"op": "diff", "ref": "-p"},
+		{"op": "blame", "path": "../outside.go"},
+		{"op": "blame"},
+		{"op": "show", "commit": "HEAD:.env"},
+		{"op": "diff", "ref": "HEAD:main.go"},
+	} {
+		if _, err := s.Execute(context.Background(), SkillExecution{Args: args}); err == nil {
+			t.Fatalf("%v: expected error", args)
+		}
+	}
+}
+
+func TestGitSkillCapsOutput(t *testing.T) {
+	ws := initTestGitRepo(t)
+	s := &GitSkill{cfg: project.SkillConfig{Name: "git", Type: "git"}, workspace: ws}
+	out, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"op": "show", "commit": "HEAD", "max_bytes": 20}})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if truncated, _ := out["truncated"].(bool); !truncated {
+		t.Fatalf("expected truncated output, got %#v", out)
+	}
+	if got, _ := out["bytes"].(int); got != 20 {
+		t.Fatalf("expected 20 bytes, got %d", got)
+	}
+}
+
+func TestGitSkillHidesDeniedPathsWithoutExplicitPath(t *testing.T) {
+	ws := initTestGitRepo(t)
+	s := &GitSkill{cfg: project.SkillConfig{Name: "git", Type: "git"}, workspace: ws}
+	writeCodeSearchFile(t, ws, ".env", "API_TOKEN=dotenv-secret-value\n")
+	writeCodeSearchFile(t, ws, ".env.example", "API_TOKEN=changeme\n")
+	writeCodeSearchFile(t, ws, "config/private.txt", "private-config-value\n")
+	runSkillTestGit(t, ws, "add", "-A")
+	runSkillTestGit(t, ws, "commit", "-q", "-m", "add config")
+	writeCodeSearchFile(t, ws, ".env", "API_TOKEN=rotated-secret-value\n")
+	writeCodeSearchFile(t, ws, "main.go", "package main\n\nfunc main() { run(); stop() }\n")
+
+	paths := PathPolicy{Deny: []string{"config/private.txt"}, Exempt: []string{".env.example"}}
+	for _, args := range []map[string]any{
+		{"op": "show", "commit": "HEAD"},
+		{"op": "diff"},
+		{"op": "diff", "ref": "HEAD~1"},
+		{"op": "log", "ref": "HEAD"},
+		{"op": "status"},
+	} {
+		out, err := s.Execute(context.Background(), SkillExecution{Args: args, Paths: paths})
+		if err != nil {
+			t.Fatalf("%v: Execute error: %v", args, err)
+		}
+		text, _ := out["text"].(string)
+		for _, leak := range []string{"secret-value", "private-config-value", "config/private.txt", " .env\n"} {
+			if strings.Contains(text, leak) {
+				t.Fatalf("%v: denied content %q leaked:\n%s", args, leak, text)
+			}
+		}
+	}
+
+	out, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"op": "show", "commit": "HEAD", "path": ".env.example"}, Paths: paths})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if text, _ := out["text"].(string); !strings.Contains(text, "+API_TOKEN=changeme") {
+		t.Fatalf("expected exempt path to stay visible, got:\n%s", text)
+	}
+}
+
+func TestGitSkillScopesHistoryToAllowPaths(t *testing.T) {
+	ws := initTestGitRepo(t)
+	writeCodeSearchFile(t, ws, "src/app.go", "package src\n")
+	writeCodeSearchFile(t, ws, "src/util.go", "package src\n")
+	writeCodeSearchFile(t, ws, "docs/plan.md", "internal-plan-text\n")
+	runSkillTestGit(t, ws, "add", "-A")
+	runSkillTestGit(t, ws, "commit", "-q", "-m", "add src and docs")
+
+	s := &GitSkill{cfg: project.SkillConfig{Name: "git", Type: "git"}, workspace: ws}
+	paths := PathPolicy{Allow: [][]string{{"src"}}}
+	for _, args := range []map[string]any{
+		{"op": "log", "name_only": true},
+		{"op": "show", "commit": "HEAD"},
+		{"op": "status"},
+	} {
+		out, err := s.Execute(context.Background(), SkillExecution{Args: args, Paths: paths})
+		if err != nil {
+			t.Fatalf("%v: Execute error: %v", args, err)
+		}
+		text, _ := out["text"].(string)
+		for _, leak := range []string{"docs/plan.md", "internal-plan-text", "main.go"} {
+			if strings.Contains(text, leak) {
+				t.Fatalf("%v: path outside allow_paths leaked %q:\n%s", args, leak, text)
+			}
+		}
+		if args["op"] == "log" && !strings.Contains(text, "src/app.go") {
+			t.Fatalf("expected allowed file in log --name-only, got:\n%s", text)
+		}
+	}
+
+	if _, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"op": "log", "path": "docs"}, Paths: paths}); err == nil || !strings.Contains(err.Error(), "outside allow_paths") {
+		t.Fatalf("expected explicit path outside allow_paths to be rejected, got %v", err)
+	}
+
+	narrow := PathPolicy{Allow: [][]string{{"src"}, {"src/app.go", "docs"}}}
+	out, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"op": "log", "name_only": true}, Paths: narrow})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if text, _ := out["text"].(string); !strings.Contains(text, "src/app.go") || strings.Contains(text, "src/util.go") || strings.Contains(text, "docs/") {
+		t.Fatalf("expected only the intersection of allow levels, got:\n%s", text)
+	}
+}
+
+func TestGitSkillStaysInsideSubdirectoryWorkspace(t *testing.T) {
+	repo := initTestGitRepo(t)
+	writeCodeSearchFile(t, repo, "svc/api.go", "package svc\n")
+	writeCodeSearchFile(t, repo, "other/secret.txt", "sibling-content\n")
+	runSkillTestGit(t, repo, "add", "-A")
+	runSkillTestGit(t, repo, "commit", "-q", "-m", "add service dirs")
+	writeCodeSearchFile(t, repo, "svc/api.go", "package svc\n\nfunc API() {}\n")
+	writeCodeSearchFile(t, repo, "other/secret.txt", "sibling-edit\n")
+
+	s := &GitSkill{cfg: project.SkillConfig{Name: "git", Type: "git"}, workspace: filepath.Join(repo, "svc")}
+	for _, tc := range []struct {
+		args map[string]any
+		want string
+	}{
+		{map[string]any{"op": "show", "commit": "HEAD"}, "+package svc"},
+		{map[string]any{"op": "diff"}, "+func API() {}"},
+		{map[string]any{"op": "status"}, "api.go"},
+		{map[string]any{"op": "log"}, "add service dirs"},
+	} {
+		out, err := s.Execute(context.Background(), SkillExecution{Args: tc.args})
+		if err != nil {
+			t.Fatalf("%v: Execute error: %v", tc.args, err)
+		}
+		text, _ := out["text"].(string)
+		if !strings.Contains(text, tc.want) {
+			t.Fatalf("%v: expected %q in output, got:\n%s", tc.args, tc.want, text)
+		}
+		for _, leak := range []string{"sibling-", "secret.txt", "main.go", "run()"} {
+			if strings.Contains(text, leak) {
+				t.Fatalf("%v: output outside the workspace leaked %q:\n%s", tc.args, leak, text)
+			}
+		}
+	}
+}
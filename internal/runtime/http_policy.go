@@ -0,0 +1,268 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"deeph/internal/project"
+)
+
+// envSecretPattern matches ${env:NAME} references in http skill config.
+var envSecretPattern = regexp.MustCompile(`\$\{env:([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// httpEgressPolicy limits where an http skill may send requests. Hosts and URL
+// prefixes are alternatives (either match is enough); an empty policy allows any
+// public host. Private and link-local addresses stay blocked unless
+// params.allow_private_networks is true.
+type httpEgressPolicy struct {
+	hosts        []string
+	urlPrefixes  []string
+	methods      map[string]struct{}
+	allowPrivate bool
+}
+
+func httpEgressPolicyFromConfig(cfg project.SkillConfig) httpEgressPolicy {
+	p := httpEgressPolicy{}
+	for _, h := range stringListParam(cfg.Params, "allow_hosts") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			p.hosts = append(p.hosts, h)
+		}
+	}
+	for _, prefix := range stringListParam(cfg.Params, "allow_url_prefixes") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			p.urlPrefixes = append(p.urlPrefixes, prefix)
+		}
+	}
+	for _, m := range stringListParam(cfg.Params, "allow_methods") {
+		if m = strings.ToUpper(strings.TrimSpace(m)); m != "" {
+			if p.methods == nil {
+				p.methods = map[string]struct{}{}
+			}
+			p.methods[m] = struct{}{}
+		}
+	}
+	p.allowPrivate, _ = boolParam(cfg.Params, "allow_private_networks")
+	return p
+}
+
+func (p httpEgressPolicy) restricted() bool {
+	return len(p.hosts) > 0 || len(p.urlPrefixes) > 0
+}
+
+func (p httpEgressPolicy) checkMethod(method string) error {
+	if len(p.methods) == 0 {
+		return nil
+	}
+	if _, ok := p.methods[method]; ok {
+		return nil
+	}
+	allowed := make([]string, 0, len(p.methods))
+	for m := range p.methods {
+		allowed = append(allowed, m)
+	}
+	sort.Strings(allowed)
+	return fmt.Errorf("method %s is not allowed by egress policy (allowed: %s)", method, strings.Join(allowed, ", "))
+}
+
+func (p httpEgressPolicy) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url scheme %q is not allowed (http or https only)", u.Scheme)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("url has no host")
+	}
+	if p.restricted() && !p.hostAllowed(host) && !p.prefixAllowed(u) {
+		return fmt.Errorf("host %q is not allowed by egress policy", host)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return p.checkIP(ip)
+	}
+	return nil
+}
+
+func (p httpEgressPolicy) hostAllowed(host string) bool {
+	for _, pattern := range p.hosts {
+		if pattern == host {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok && strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p httpEgressPolicy) prefixAllowed(u *url.URL) bool {
+	// Compare against the normalized URL so "https://api.x/a/../admin" cannot slip past "https://api.x/a/".
+	normalized := *u
+	normalized.Path = cleanURLPath(u.Path)
+	normalized.RawPath = ""
+	full := normalized.String()
+	for _, prefix := range p.urlPrefixes {
+		if pu, err := url.Parse(prefix); err == nil && pu.Path == "" {
+			// A bare origin must match exactly, otherwise "https://api.x" would accept "https://api.x.evil.io".
+			if strings.EqualFold(pu.Scheme, u.Scheme) && strings.EqualFold(pu.Host, u.Host) {
+				return true
+			}
+			continue
+		}
+		if strings.HasPrefix(full, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p httpEgressPolicy) checkIP(ip net.IP) error {
+	if p.allowPrivate {
+		return nil
+	}
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("egress to private, loopback or link-local address %s is blocked (set params.allow_private_networks to permit)", ip)
+	}
+	return nil
+}
+
+func cleanURLPath(p string) string {
+	if p == "" {
+		return ""
+	}
+	segments := strings.Split(p, "/")
+	out := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		switch seg {
+		case ".":
+			continue
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			continue
+		}
+		out = append(out, seg)
+	}
+	return strings.Join(out, "/")
+}
+
+// secretHeaderNames returns the canonical names of configured headers whose
+// value references ${env:NAME}.
+func secretHeaderNames(cfg project.SkillConfig) map[string]struct{} {
+	out := map[string]struct{}{}
+	for k, v := range cfg.Headers {
+		if envSecretPattern.MatchString(v) {
+			out[http.CanonicalHeaderKey(k)] = struct{}{}
+		}
+	}
+	return out
+}
+
+// configuredHTTPHost returns the host of the skill's url, or "" when the url
+// is unset or its host is templated (and so chosen by the model).
+func configuredHTTPHost(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || strings.ContainsAny(u.Host, "{}$") {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// newHTTPSkillClient enforces the egress policy on every connection (so DNS
+// rebinding cannot reach a private address) and on every redirect hop.
+// Secret-bearing headers are dropped when a redirect leaves the original host.
+func newHTTPSkillClient(cfg project.SkillConfig, timeout time.Duration) *http.Client {
+	policy := httpEgressPolicyFromConfig(cfg)
+	secretHeaders := secretHeaderNames(cfg)
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip != nil {
+				return policy.checkIP(ip)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	if !policy.allowPrivate {
+		// A proxy would hide the real destination from the dial check.
+		transport.Proxy = nil
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			if err := policy.checkURL(req.URL); err != nil {
+				return err
+			}
+			// net/http only strips Authorization and Cookie across domains;
+			// custom headers such as X-Api-Key would follow the redirect.
+			if !strings.EqualFold(req.URL.Hostname(), via[0].URL.Hostname()) {
+				for k := range secretHeaders {
+					req.Header.Del(k)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// interpolateEnvSecrets expands ${env:NAME} references and records each resolved
+// value so it can be redacted from results and errors.
+func interpolateEnvSecrets(s string, secrets map[string]string) (string, error) {
+	var missing []string
+	out := envSecretPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envSecretPattern.FindStringSubmatch(ref)[1]
+		val, ok := os.LookupEnv(name)
+		if !ok || val == "" {
+			missing = append(missing, name)
+			return ref
+		}
+		if secrets != nil {
+			secrets[name] = val
+		}
+		return val
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s referenced by ${env:%s} is not set", missing[0], missing[0])
+	}
+	return out, nil
+}
+
+func redactSecrets(s string, secrets map[string]string) string {
+	for name, val := range secrets {
+		if len(val) < 4 {
+			continue
+		}
+		s = strings.ReplaceAll(s, val, "[redacted:env:"+name+"]")
+	}
+	return s
+}
+
+func redactError(err error, secrets map[string]string) error {
+	if err == nil || len(secrets) == 0 {
+		return err
+	}
+	msg := redactSecrets(err.Error(), secrets)
+	if msg == err.Error() {
+		return err
+	}
+	// Drop the wrapped error: its message still carries the secret.
+	return errors.New(msg)
+}
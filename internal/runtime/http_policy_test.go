@@ -0,0 +1,167 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"deeph/internal/project"
+)
+
+func TestHTTPEgressPolicyHostsPrefixesAndPrivateRanges(t *testing.T) {
+	p := httpEgressPolicyFromConfig(project.SkillConfig{Params: map[string]any{
+		"allow_hosts":        []any{"api.github.com", "*.example.org"},
+		"allow_url_prefixes": []any{"https://uploads.test/repos/", "https://origin.test"},
+	}})
+	cases := map[string]bool{
+		"https://api.github.com/user":               true,
+		"https://docs.example.org/x":                true,
+		"https://example.org.evil.io/":              false,
+		"https://uploads.test/repos/a":              true,
+		"https://uploads.test/repos/../admin":       false,
+		"https://uploads.test/other":                false,
+		"https://origin.test/anything":              true,
+		"https://origin.test.evil.io/":              false,
+		"ftp://api.github.com/":                     false,
+		"http://169.254.169.254/latest/meta-data/":  false,
+		"http://10.1.2.3/":                          false,
+		"http://[fd00::1]/":                         false,
+		"http://127.0.0.1:8080/":                    false,
+		"http://[::1]/":                             false,
+		"http://evil.io/":                           false,
+		"https://api.github.com.attacker.example/x": false,
+	}
+	for raw, want := range cases {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatalf("parse %q: %v", raw, err)
+		}
+		if got := p.checkURL(u) == nil; got != want {
+			t.Fatalf("checkURL(%q) allowed=%v want %v (err=%v)", raw, got, want, p.checkURL(u))
+		}
+	}
+
+	open := httpEgressPolicyFromConfig(project.SkillConfig{})
+	if err := open.checkURL(&url.URL{Scheme: "http", Host: "192.168.1.10"}); err == nil {
+		t.Fatalf("expected RFC1918 target to be blocked without allow_private_networks")
+	}
+	allowPrivate := httpEgressPolicyFromConfig(project.SkillConfig{Params: map[string]any{"allow_private_networks": true}})
+	if err := allowPrivate.checkURL(&url.URL{Scheme: "http", Host: "192.168.1.10"}); err != nil {
+		t.Fatalf("expected private target to be allowed when opted in: %v", err)
+	}
+}
+
+func TestHTTPSkillEnforcesMethodPolicy(t *testing.T) {
+	cfg := project.SkillConfig{
+		Name:   "api",
+		Type:   "http",
+		URL:    "http://127.0.0.1:1/",
+		Params: map[string]any{"allow_methods": []any{"GET"}},
+	}
+	s := &HTTPSkill{cfg: cfg, client: newHTTPSkillClient(cfg, 5*time.Second)}
+	_, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"method": "DELETE"}})
+	if err == nil || !strings.Contains(err.Error(), "not allowed by egress policy") {
+		t.Fatalf("expected method policy error, got %v", err)
+	}
+}
+
+func TestHTTPSkillInterpolatesAndRedactsEnvSecrets(t *testing.T) {
+	const token = "s3cr3t-token-value"
+	t.Setenv("DEEPH_TEST_API_TOKEN", token)
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("you sent " + gotAuth))
+	}))
+	defer srv.Close()
+
+	cfg := project.SkillConfig{
+		Name:    "api",
+		Type:    "http",
+		URL:     srv.URL + "/echo",
+		Headers: map[string]string{"Authorization": "Bearer ${env:DEEPH_TEST_API_TOKEN}"},
+		Params:  map[string]any{"allow_private_networks": true},
+	}
+	s := &HTTPSkill{cfg: cfg, client: newHTTPSkillClient(cfg, 5*time.Second)}
+	out, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{
+		"headers": map[string]any{"authorization": "Bearer attacker"},
+	}})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if gotAuth != "Bearer "+token {
+		t.Fatalf("expected interpolated, non-overridable Authorization header, server saw %q", gotAuth)
+	}
+	body, _ := out["body"].(string)
+	if strings.Contains(body, token) || !strings.Contains(body, "[redacted:env:DEEPH_TEST_API_TOKEN]") {
+		t.Fatalf("expected secret to be redacted from body, got %q", body)
+	}
+
+	// Model-supplied args are never interpolated.
+	_, err = s.Execute(context.Background(), SkillExecution{Args: map[string]any{"url": srv.URL + "/?t=${env:DEEPH_TEST_API_TOKEN}"}})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+
+	missingCfg := project.SkillConfig{Name: "api", Type: "http", URL: srv.URL + "/?k=${env:DEEPH_TEST_MISSING_VAR}", Params: map[string]any{"allow_private_networks": true}}
+	missing := &HTTPSkill{cfg: missingCfg, client: newHTTPSkillClient(missingCfg, 5*time.Second)}
+	if _, err := missing.Execute(context.Background(), SkillExecution{}); err == nil || !strings.Contains(err.Error(), "DEEPH_TEST_MISSING_VAR") {
+		t.Fatalf("expected missing env var error, got %v", err)
+	}
+}
+
+func TestHTTPSkillKeepsSecretHeadersOnConfiguredHost(t *testing.T) {
+	const key = "k3y-for-configured-host"
+	t.Setenv("DEEPH_TEST_API_KEY", key)
+	seen := map[string]string{}
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen["other"+r.URL.Path] = r.Header.Get("X-Api-Key")
+	}))
+	defer other.Close()
+	// Same listener, different host name: the redirect and the model url
+	// both leave the configured host.
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen["origin"+r.URL.Path] = r.Header.Get("X-Api-Key")
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, otherURL+"/landed", http.StatusFound)
+		}
+	}))
+	defer origin.Close()
+
+	cfg := project.SkillConfig{
+		Name:    "api",
+		Type:    "http",
+		URL:     origin.URL + "/items",
+		Headers: map[string]string{"X-Api-Key": "${env:DEEPH_TEST_API_KEY}"},
+		Params:  map[string]any{"allow_private_networks": true},
+	}
+	s := &HTTPSkill{cfg: cfg, client: newHTTPSkillClient(cfg, 5*time.Second)}
+	if _, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{}}); err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if _, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"url": origin.URL + "/redirect"}}); err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	out, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"url": otherURL + "/direct"}})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if seen["origin/items"] != key || seen["origin/redirect"] != key {
+		t.Fatalf("expected the key on the configured host, got %v", seen)
+	}
+	if v, ok := seen["other/landed"]; !ok || v != "" {
+		t.Fatalf("expected the key to be stripped on a cross-host redirect, got %q (seen=%v)", v, seen)
+	}
+	if v, ok := seen["other/direct"]; !ok || v != "" {
+		t.Fatalf("expected the key to be withheld from a model-supplied host, got %q", v)
+	}
+	if got, _ := out["withheld_headers"].([]string); len(got) != 1 || got[0] != "X-Api-Key" {
+		t.Fatalf("expected withheld_headers [X-Api-Key], got %v", out["withheld_headers"])
+	}
+}
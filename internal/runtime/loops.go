@@ -0,0 +1,239 @@
+package runtime
+
+import (
+	"strings"
+
+	"deeph/internal/jsonpath"
+	"deeph/internal/project"
+	"deeph/internal/typesys"
+)
+
+// TaskLoopPlan is a loop closed by one agent, as shown by trace.
+type TaskLoopPlan struct {
+	BackTo        string
+	Until         string
+	MaxIterations int
+	Body          []string
+}
+
+// LoopReport summarizes one loop of a run. Each iteration keeps a snapshot of
+// the shared context as it stood when the exit agent finished.
+type LoopReport struct {
+	Agent         string          `json:"agent"`
+	BackTo        string          `json:"back_to"`
+	Body          []string        `json:"body"`
+	MaxIterations int             `json:"max_iterations"`
+	Iterations    []LoopIteration `json:"iterations"`
+	// Exited is true when the exit condition was met; StopReason explains a
+	// stop at the cap or on an error.
+	Exited     bool   `json:"exited"`
+	StopReason string `json:"stop_reason,omitempty"`
+}
+
+type LoopIteration struct {
+	Iteration int             `json:"iteration"`
+	ExitMet   bool            `json:"exit_met"`
+	Context   ContextSnapshot `json:"context"`
+}
+
+// graphLoop is the scheduler state of one loop in runGraph.
+type graphLoop struct {
+	exit   int
+	back   int
+	body   []int
+	inBody map[int]bool
+	cfg    project.LoopConfig
+	iter   int
+	done   bool
+	report LoopReport
+}
+
+func loopMaxIterations(cfg project.LoopConfig) int {
+	if cfg.MaxIterations > 0 {
+		return cfg.MaxIterations
+	}
+	return project.DefaultLoopIterations
+}
+
+// buildGraphLoops resolves the loops declared by agents in the run. Loops
+// whose back_to agent is not an upstream of the exit agent in this spec, or
+// whose body overlaps an earlier loop, are ignored.
+func buildGraphLoops(tasks []Task, successors, preds [][]int) ([]*graphLoop, []int) {
+	idxByAgent := make(map[string]int, len(tasks))
+	for i, t := range tasks {
+		idxByAgent[t.Agent.Name] = i
+	}
+	loopOf := make([]int, len(tasks))
+	for i := range loopOf {
+		loopOf[i] = -1
+	}
+	var loops []*graphLoop
+	for exit, t := range tasks {
+		if t.Agent.Loop == nil {
+			continue
+		}
+		back, ok := idxByAgent[strings.TrimSpace(t.Agent.Loop.BackTo)]
+		if !ok {
+			continue
+		}
+		body := loopBody(back, exit, successors, preds)
+		if len(body) == 0 {
+			continue
+		}
+		overlap := false
+		for _, idx := range body {
+			if loopOf[idx] >= 0 {
+				overlap = true
+				break
+			}
+		}
+		if overlap {
+			continue
+		}
+		lp := &graphLoop{exit: exit, back: back, body: body, inBody: map[int]bool{}, cfg: *t.Agent.Loop, iter: 1}
+		names := make([]string, 0, len(body))
+		for _, idx := range body {
+			lp.inBody[idx] = true
+			loopOf[idx] = len(loops)
+			names = append(names, tasks[idx].Agent.Name)
+		}
+		lp.report = LoopReport{Agent: t.Agent.Name, BackTo: tasks[back].Agent.Name, Body: names, MaxIterations: loopMaxIterations(lp.cfg)}
+		loops = append(loops, lp)
+	}
+	return loops, loopOf
+}
+
+// loopBody is every task reachable from back that also reaches exit, in task
+// order; nil when back is not upstream of exit.
+func loopBody(back, exit int, successors, preds [][]int) []int {
+	fromBack := reachable(back, successors)
+	if !fromBack[exit] {
+		return nil
+	}
+	toExit := reachable(exit, preds)
+	var body []int
+	for idx := range successors {
+		if fromBack[idx] && toExit[idx] {
+			body = append(body, idx)
+		}
+	}
+	return body
+}
+
+func reachable(start int, edges [][]int) map[int]bool {
+	seen := map[int]bool{start: true}
+	stack := []int{start}
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, next := range edges[cur] {
+			if !seen[next] {
+				seen[next] = true
+				stack = append(stack, next)
+			}
+		}
+	}
+	return seen
+}
+
+// taskGraphEdges derives successor and predecessor lists from planned DependsOn.
+func taskGraphEdges(tasks []Task) (successors, preds [][]int) {
+	idxByAgent := make(map[string]int, len(tasks))
+	for i, t := range tasks {
+		idxByAgent[t.Agent.Name] = i
+	}
+	successors = make([][]int, len(tasks))
+	preds = make([][]int, len(tasks))
+	for dst, t := range tasks {
+		seen := map[int]bool{}
+		for _, dep := range t.DependsOn {
+			src, ok := idxByAgent[dep]
+			if !ok || src == dst || seen[src] {
+				continue
+			}
+			seen[src] = true
+			preds[dst] = append(preds[dst], src)
+			successors[src] = append(successors[src], dst)
+		}
+	}
+	return successors, preds
+}
+
+func planGraphLoops(tasks []Task, plan *ExecutionPlan) {
+	successors, preds := taskGraphEdges(tasks)
+	loops, _ := buildGraphLoops(tasks, successors, preds)
+	for _, lp := range loops {
+		plan.Tasks[lp.exit].Loop = &TaskLoopPlan{
+			BackTo:        lp.report.BackTo,
+			Until:         describeRoute(project.RouteConfig{When: lp.cfg.Until}),
+			MaxIterations: lp.report.MaxIterations,
+			Body:          lp.report.Body,
+		}
+	}
+}
+
+// loopExitMet evaluates the loop exit condition over the exit agent's output.
+func loopExitMet(cfg project.LoopConfig, output string) bool {
+	var value any
+	if _, parsed, err := jsonpath.Extract(output); err == nil {
+		value = parsed
+	}
+	return routeMatches(project.RouteConfig{When: cfg.Until}, output, value)
+}
+
+// loopFeedbackLink hands the exit agent's output back to the first body agent.
+func loopFeedbackLink(exit, back Task) TypedHandoffLink {
+	kind := typesys.KindMessageAgent
+	return TypedHandoffLink{
+		FromAgent:   exit.Agent.Name,
+		ToAgent:     back.Agent.Name,
+		FromPort:    "loop",
+		ToPort:      "feedback",
+		Kind:        kind,
+		Channel:     handoffChannelID(exit.Agent.Name, "loop", back.Agent.Name, "feedback", kind),
+		MergePolicy: "latest",
+	}
+}
+
+// restageLoopResults gives every loop iteration after the first its own
+// stages and pushes later stages back accordingly. Result order is kept:
+// Results[i] still belongs to plan task i and later iterations follow.
+func restageLoopResults(results []AgentRunResult, loops []*graphLoop, tasks []Task) {
+	delta := make([]int, len(results))
+	for _, lp := range loops {
+		n := len(lp.report.Iterations)
+		if n <= 1 {
+			continue
+		}
+		lo, hi := tasks[lp.body[0]].StageIndex, tasks[lp.body[0]].StageIndex
+		for _, idx := range lp.body {
+			lo = minInt(lo, tasks[idx].StageIndex)
+			hi = maxInt(hi, tasks[idx].StageIndex)
+		}
+		span := hi - lo + 1
+		inBody := map[string]bool{}
+		for _, name := range lp.report.Body {
+			inBody[name] = true
+		}
+		for i, r := range results {
+			switch {
+			case inBody[r.Agent] && r.Iteration > 1:
+				delta[i] += (r.Iteration - 1) * span
+			case !inBody[r.Agent] && r.StageIndex > hi:
+				delta[i] += (n - 1) * span
+			}
+		}
+	}
+	for i := range results {
+		results[i].StageIndex += delta[i]
+	}
+}
+
+func hasIncomingChannel(task Task, channel string) bool {
+	for _, l := range task.Incoming {
+		if l.Channel == channel {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package runtime
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"deeph/internal/project"
+)
+
+func loopTestEngine(t *testing.T, loop *project.LoopConfig, reviews []string) (*Engine, *scriptedContractProvider) {
+	t.Helper()
+	p := &project.Project{
+		Root: project.RootConfig{Providers: []project.ProviderConfig{{Name: "local", Type: "mock"}}},
+		Agents: []project.AgentConfig{
+			{Name: "planner", Provider: "local"},
+			{Name: "coder", Provider: "local"},
+			{Name: "reviewer", Provider: "local", Loop: loop},
+			{Name: "writer", Provider: "local"},
+		},
+	}
+	eng, err := New(t.TempDir(), p)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	t.Cleanup(func() { eng.Close() })
+	prov := &scriptedContractProvider{replies: map[string][]string{"reviewer": reviews}}
+	eng.providers["local"] = prov
+	return eng, prov
+}
+
+func TestLoopRepeatsBodyUntilExitCondition(t *testing.T) {
+	loop := &project.LoopConfig{BackTo: "coder", Until: project.RouteCondition{Field: "approved"}, MaxIterations: 3}
+	eng, prov := loopTestEngine(t, loop, []string{
+		`{"approved": false, "notes": "rename the helper"}`,
+		`{"approved": true}`,
+	})
+
+	plan, _, err := eng.PlanSpec(context.Background(), "planner>coder>reviewer>writer", "add a flag")
+	if err != nil {
+		t.Fatalf("PlanSpec error: %v", err)
+	}
+	if lp := plan.Tasks[2].Loop; lp == nil || lp.BackTo != "coder" || strings.Join(lp.Body, ",") != "coder,reviewer" {
+		t.Fatalf("expected loop plan on reviewer, got %+v", plan.Tasks[2].Loop)
+	}
+
+	report, err := eng.RunSpec(context.Background(), "planner>coder>reviewer>writer", "add a flag")
+	if err != nil {
+		t.Fatalf("RunSpec error: %v", err)
+	}
+	var order []string
+	for _, r := range report.Results {
+		order = append(order, r.Agent+"#"+string(rune('0'+r.Iteration))+"@"+string(rune('0'+r.StageIndex)))
+	}
+	if got := strings.Join(order, " "); got != "planner#0@0 coder#1@1 reviewer#1@2 writer#0@5 coder#2@3 reviewer#2@4" {
+		t.Fatalf("unexpected results: %s", got)
+	}
+	if len(report.Loops) != 1 {
+		t.Fatalf("expected one loop report, got %+v", report.Loops)
+	}
+	lr := report.Loops[0]
+	if !lr.Exited || len(lr.Iterations) != 2 || lr.Iterations[0].ExitMet || !lr.Iterations[1].ExitMet {
+		t.Fatalf("unexpected loop report: %+v", lr)
+	}
+	if lr.Iterations[1].Context.Version <= lr.Iterations[0].Context.Version {
+		t.Fatalf("expected per-iteration context snapshots, got versions %d and %d", lr.Iterations[0].Context.Version, lr.Iterations[1].Context.Version)
+	}
+
+	var coderInputs []string
+	writerCalls := 0
+	for _, req := range prov.requests {
+		switch req.AgentName {
+		case "coder":
+			coderInputs = append(coderInputs, req.Input)
+		case "writer":
+			writerCalls++
+		}
+	}
+	if len(coderInputs) != 2 || !strings.Contains(coderInputs[1], "rename the helper") {
+		t.Fatalf("expected second coder iteration to receive reviewer feedback, got %q", coderInputs)
+	}
+	if writerCalls != 1 {
+		t.Fatalf("expected writer to run once after the loop, got %d", writerCalls)
+	}
+}
+
+func TestLoopStopsAtMaxIterations(t *testing.T) {
+	loop := &project.LoopConfig{BackTo: "reviewer", Until: project.RouteCondition{Regex: `(?i)\bLGTM\b`}, MaxIterations: 2}
+	eng, _ := loopTestEngine(t, loop, []string{"needs work"})
+	report, err := eng.RunSpec(context.Background(), "coder>reviewer>writer", "add a flag")
+	if err != nil {
+		t.Fatalf("RunSpec error: %v", err)
+	}
+	if len(report.Results) != 4 {
+		t.Fatalf("expected coder, 2 reviewer iterations and writer, got %d results", len(report.Results))
+	}
+	lr := report.Loops[0]
+	if lr.Exited || len(lr.Iterations) != 2 || !strings.Contains(lr.StopReason, "max_iterations=2") {
+		t.Fatalf("expected loop to stop at the cap, got %+v", lr)
+	}
+	if r := report.Results[3]; r.Agent != "reviewer" || r.Iteration != 2 || r.StageIndex != 2 {
+		t.Fatalf("expected reviewer iteration 2 as its own stage, got %s#%d stage=%d", r.Agent, r.Iteration, r.StageIndex)
+	}
+}
+
+func TestLoopReviewerRereadsFileRewrittenByCoder(t *testing.T) {
+	ws := t.TempDir()
+	script := `
+rules:
+  - agent: coder
+    turn: 1
+    tool_calls: [{name: write, args: {path: notes.txt, content: "status: draft"}}]
+  - agent: coder
+    turn: 3
+    tool_calls: [{name: write, args: {path: notes.txt, content: "status: final", overwrite: true}}]
+  - agent: coder
+    text: "updated notes.txt"
+  - agent: reviewer
+    turn: 1
+    tool_calls: [{name: read, args: {path: notes.txt}}]
+  - agent: reviewer
+    turn: 3
+    tool_calls: [{name: read, args: {path: notes.txt}}]
+  - agent: reviewer
+    turn: 2
+    text: '{"approved": false}'
+  - agent: reviewer
+    text: '{"approved": true}'
+default: error
+`
+	if err := os.WriteFile(filepath.Join(ws, "mock.yaml"), []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := &project.Project{
+		Root: project.RootConfig{Providers: []project.ProviderConfig{{Name: "local", Type: "mock", MockScript: "mock.yaml"}}},
+		Agents: []project.AgentConfig{
+			{Name: "coder", Provider: "local", Skills: []string{"write"}},
+			{Name: "reviewer", Provider: "local", Skills: []string{"read"}, Loop: &project.LoopConfig{BackTo: "coder", Until: project.RouteCondition{Field: "approved"}, MaxIterations: 3}},
+		},
+		Skills: []project.SkillConfig{
+			{Name: "write", Type: "file_write_safe"},
+			{Name: "read", Type: "file_read"},
+		},
+	}
+	eng, err := New(ws, p)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	t.Cleanup(func() { eng.Close() })
+
+	report, err := eng.RunSpec(context.Background(), "coder>reviewer", "write the notes")
+	if err != nil {
+		t.Fatalf("RunSpec error: %v", err)
+	}
+	var reads []string
+	for _, r := range report.Results {
+		if r.Error != "" {
+			t.Fatalf("%s failed: %s", r.Agent, r.Error)
+		}
+		for _, call := range r.ToolCalls {
+			if call.Skill == "read" {
+				content, _ := call.Result["text"].(string)
+				reads = append(reads, content)
+			}
+		}
+	}
+	if len(reads) != 2 || !strings.Contains(reads[0], "draft") || !strings.Contains(reads[1], "final") {
+		t.Fatalf("expected the second review to read the rewritten file, got %q", reads)
+	}
+	if len(report.Loops) != 1 || !report.Loops[0].Exited || len(report.Loops[0].Iterations) != 2 {
+		t.Fatalf("expected the loop to converge in two iterations, got %+v", report.Loops)
+	}
+}
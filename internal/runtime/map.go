@@ -0,0 +1,278 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"deeph/internal/jsonpath"
+	"deeph/internal/project"
+	"deeph/internal/reviewscope"
+)
+
+// mapExcerptChars bounds the code excerpt given to one changed-file instance.
+const mapExcerptChars = 2400
+
+// TaskMapPlan is an agent's fan-out, as shown by trace.
+type TaskMapPlan struct {
+	Over        string
+	Field       string
+	MaxItems    int
+	Concurrency int
+}
+
+// MapItemResult is the outcome of one instance of a mapped agent.
+type MapItemResult struct {
+	Index         int           `json:"index"`
+	Item          string        `json:"item"`
+	Output        string        `json:"output,omitempty"`
+	Error         string        `json:"error,omitempty"`
+	ContextTokens int           `json:"context_tokens"`
+	Duration      time.Duration `json:"duration"`
+	// Contracts holds the instance's output contract verdicts, which mark
+	// its handoffs invalid like those of any agent.
+	Contracts []OutputContractResult `json:"contracts,omitempty"`
+}
+
+type mapItem struct {
+	label string
+	text  string
+}
+
+func mapMaxItems(cfg project.MapConfig) int {
+	if cfg.MaxItems > 0 {
+		return minInt(cfg.MaxItems, project.MaxMapItems)
+	}
+	return project.DefaultMapItems
+}
+
+func mapConcurrency(cfg project.MapConfig) int {
+	if cfg.Concurrency > 0 {
+		return cfg.Concurrency
+	}
+	return project.DefaultMapConcurrency
+}
+
+func taskMapPlan(a project.AgentConfig) *TaskMapPlan {
+	if a.Map == nil {
+		return nil
+	}
+	return &TaskMapPlan{
+		Over:        strings.TrimSpace(a.Map.Over),
+		Field:       strings.TrimSpace(a.Map.Field),
+		MaxItems:    mapMaxItems(*a.Map),
+		Concurrency: mapConcurrency(*a.Map),
+	}
+}
+
+// mapItemsFromOutput reads the list to map over from an upstream output: a
+// JSON array, or the array at field inside a JSON object.
+func mapItemsFromOutput(over, field, output string) ([]mapItem, error) {
+	_, value, err := jsonpath.Extract(output)
+	if err != nil {
+		return nil, fmt.Errorf("map over %s: output is not JSON: %w", over, err)
+	}
+	if field = strings.TrimSpace(field); field != "" {
+		v, ok := jsonpath.Lookup(value, field)
+		if !ok {
+			return nil, fmt.Errorf("map over %s: field %q not found", over, field)
+		}
+		value = v
+	}
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("map over %s: expected a JSON array, got %T", over, value)
+	}
+	items := make([]mapItem, 0, len(list))
+	for _, v := range list {
+		text := routeValueString(v)
+		if _, isString := v.(string); !isString {
+			if b, err := json.MarshalIndent(v, "", "  "); err == nil {
+				text = string(b)
+			}
+		}
+		items = append(items, mapItem{label: mapItemLabel(v), text: text})
+	}
+	return items, nil
+}
+
+// mapItemLabel names an item in reports: a path/name/id/title field of an
+// object, or the value itself, clipped.
+func mapItemLabel(v any) string {
+	if obj, ok := v.(map[string]any); ok {
+		for _, key := range []string{"path", "file", "name", "id", "title"} {
+			if s := strings.TrimSpace(routeValueString(obj[key])); s != "" {
+				return clipMapLabel(s)
+			}
+		}
+		b, _ := json.Marshal(v)
+		return clipMapLabel(string(b))
+	}
+	return clipMapLabel(routeValueString(v))
+}
+
+func clipMapLabel(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > 60 {
+		return s[:57] + "..."
+	}
+	return s
+}
+
+// changedFileMapItems maps over the files changed in the workspace; each item
+// carries the file's diff stats, hunks and a numbered excerpt.
+func changedFileMapItems(workspace, baseRef string) ([]mapItem, error) {
+	files, base, err := reviewscope.ChangedFiles(workspace, baseRef)
+	if errors.Is(err, reviewscope.ErrNoReviewChanges) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("map over %s: %w", project.MapOverChangedFiles, err)
+	}
+	items := make([]mapItem, 0, len(files))
+	for _, f := range files {
+		var b strings.Builder
+		fmt.Fprintf(&b, "path: %s\n", f.Path)
+		if f.OldPath != "" && f.OldPath != f.Path {
+			fmt.Fprintf(&b, "old_path: %s\n", f.OldPath)
+		}
+		fmt.Fprintf(&b, "status: %s base_ref: %s line_delta: +%d -%d\n", f.Status, base, f.Added, f.Deleted)
+		for _, h := range f.Hunks {
+			fmt.Fprintf(&b, "hunk: -%d,%d +%d,%d\n", h.OldStart, h.OldCount, h.NewStart, h.NewCount)
+		}
+		if excerpt := reviewscope.Excerpt(workspace, f, mapExcerptChars); excerpt != "" {
+			b.WriteString("excerpt:\n" + excerpt)
+		}
+		items = append(items, mapItem{label: f.Path, text: strings.TrimSpace(b.String())})
+	}
+	return items, nil
+}
+
+// runMapTask runs one instance of the task per item, at most the configured
+// concurrency at a time. Each instance compiles its context from a private
+// bus whose goal is the run input plus its item, with its own context and
+// tool budgets. The result's Output is a JSON array of the instance outputs.
+func (e *Engine) runMapTask(ctx context.Context, task Task, items []mapItem, itemsErr error, input string, sharedBus *ContextBus, broker *toolBroker, stageBudget *stageToolBudget) AgentRunResult {
+	start := time.Now()
+	res := AgentRunResult{
+		Agent:         task.Agent.Name,
+		Provider:      task.Provider.Name,
+		ProviderType:  task.Provider.Type,
+		Model:         coalesce(task.Agent.Model, task.Provider.Model),
+		Skills:        append([]string(nil), task.SkillNames...),
+		StageIndex:    task.StageIndex,
+		DependsOn:     append([]string(nil), task.DependsOn...),
+		ContextBudget: e.contextBudgetForTask(task.Agent, task.Provider).limitTokens(),
+		ContextMoment: string(e.contextMomentForTask(task.Agent, task.Provider)),
+	}
+	if itemsErr != nil {
+		res.Error = itemsErr.Error()
+		res.Duration = time.Since(start)
+		return res
+	}
+	cfg := *task.Agent.Map
+	if limit := mapMaxItems(cfg); len(items) > limit {
+		res.MapDropped = len(items) - limit
+		items = items[:limit]
+	}
+
+	results := make([]AgentRunResult, len(items))
+	sem := make(chan struct{}, mapConcurrency(cfg))
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, item mapItem) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			bus := NewContextBus("")
+			if sharedBus != nil {
+				bus.SetRedactor(sharedBus.scrub)
+				bus.SetArtifactStore(sharedBus.store)
+			}
+			bus.SetGoal(fmt.Sprintf("%s\n\n[map item %d/%d]\n%s", strings.TrimSpace(input), i+1, len(items), item.text))
+			instance := task
+			instance.Incoming = nil
+			results[i] = e.runTask(withMockTurnScope(ctx), instance, item.text, bus, broker, stageBudget)
+		}(i, item)
+	}
+	wg.Wait()
+
+	outputs := make([]any, 0, len(items))
+	failed := 0
+	for i, r := range results {
+		res.MapItems = append(res.MapItems, MapItemResult{
+			Index:         i,
+			Item:          items[i].label,
+			Output:        r.Output,
+			Error:         r.Error,
+			ContextTokens: r.ContextTokens,
+			Duration:      r.Duration,
+			Contracts:     r.Contracts,
+		})
+		res.StartupCalls = append(res.StartupCalls, r.StartupCalls...)
+		res.ToolCalls = append(res.ToolCalls, r.ToolCalls...)
+		res.ToolCacheHits += r.ToolCacheHits
+		res.ToolCacheMisses += r.ToolCacheMisses
+		res.Usage.Add(r.Usage)
+		res.ContextTokens = maxInt(res.ContextTokens, r.ContextTokens)
+		if r.Error != "" {
+			failed++
+			continue
+		}
+		var out any = r.Output
+		if _, parsed, err := jsonpath.Extract(r.Output); err == nil {
+			out = parsed
+		}
+		outputs = append(outputs, map[string]any{"item": items[i].label, "output": out})
+	}
+	if failed > 0 && failed == len(items) {
+		res.Error = fmt.Sprintf("map: all %d items failed: %s", failed, results[0].Error)
+	}
+	b, _ := json.Marshal(outputs)
+	res.Output = string(b)
+	res.Duration = time.Since(start)
+	return res
+}
+
+// mapItemLink is link specialized to instance i of a mapped agent, so every
+// instance output reaches the successor on its own channel and fact key.
+func mapItemLink(link TypedHandoffLink, i int) TypedHandoffLink {
+	l := link
+	l.FromPort = fmt.Sprintf("%s[%d]", coalesce(strings.TrimSpace(link.FromPort), "output"), i)
+	l.ToPort = fmt.Sprintf("%s[%d]", coalesce(strings.TrimSpace(link.ToPort), "input"), i)
+	l.Channel = handoffChannelID(l.FromAgent, l.FromPort, l.ToAgent, l.ToPort, l.Kind)
+	return l
+}
+
+// publishMapOutputs hands each successful instance output of the mapped task
+// at idx to its successors on per-item channels, which are added to the
+// successors' incoming links.
+func (e *Engine) publishMapOutputs(bus *ContextBus, tasks []Task, idx int, res AgentRunResult, taskIdxByAgent map[string]int) publishTaskOutputsResult {
+	total := publishTaskOutputsResult{}
+	task := tasks[idx]
+	for _, item := range res.MapItems {
+		if item.Error != "" {
+			continue
+		}
+		itemTask := task
+		itemTask.Outgoing = make([]TypedHandoffLink, 0, len(task.Outgoing))
+		for _, link := range task.Outgoing {
+			il := mapItemLink(link, item.Index)
+			if dst, ok := taskIdxByAgent[il.ToAgent]; ok && !hasIncomingChannel(tasks[dst], il.Channel) {
+				tasks[dst].Incoming = append(tasks[dst].Incoming, il)
+			}
+			itemTask.Outgoing = append(itemTask.Outgoing, il)
+		}
+		pub := e.publishTaskOutputs(bus, itemTask, AgentRunResult{Agent: res.Agent, Output: item.Output, Contracts: item.Contracts})
+		total.Sent += pub.Sent
+		total.Dropped += pub.Dropped
+		total.Tokens += pub.Tokens
+		total.Invalid += pub.Invalid
+	}
+	return total
+}
@@ -0,0 +1,94 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"deeph/internal/project"
+)
+
+func TestMapFansOutOverUpstreamArrayAndReduces(t *testing.T) {
+	p := &project.Project{
+		Root: project.RootConfig{Providers: []project.ProviderConfig{{Name: "local", Type: "mock"}}},
+		Agents: []project.AgentConfig{
+			{Name: "splitter", Provider: "local"},
+			{Name: "reviewer", Provider: "local", Map: &project.MapConfig{Over: "splitter", Field: "files", MaxItems: 2, Concurrency: 2}},
+			{Name: "summarizer", Provider: "local"},
+		},
+	}
+	eng, err := New(t.TempDir(), p)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	defer eng.Close()
+	prov := &scriptedContractProvider{replies: map[string][]string{
+		"splitter": {`{"files": [{"path": "a.go"}, {"path": "b.go"}, {"path": "c.go"}]}`},
+		"reviewer": {`{"issues": 0}`},
+	}}
+	eng.providers["local"] = prov
+
+	plan, _, err := eng.PlanSpec(context.Background(), "splitter>reviewer>summarizer", "review the change")
+	if err != nil {
+		t.Fatalf("PlanSpec error: %v", err)
+	}
+	if m := plan.Tasks[1].Map; m == nil || m.Over != "splitter" || m.MaxItems != 2 || m.Concurrency != 2 {
+		t.Fatalf("expected map plan on reviewer, got %+v", plan.Tasks[1].Map)
+	}
+
+	report, err := eng.RunSpec(context.Background(), "splitter>reviewer>summarizer", "review the change")
+	if err != nil {
+		t.Fatalf("RunSpec error: %v", err)
+	}
+	r := report.Results[1]
+	if r.Error != "" || len(r.MapItems) != 2 || r.MapDropped != 1 {
+		t.Fatalf("expected two mapped items and one dropped, got %+v", r)
+	}
+	if r.MapItems[0].Item != "a.go" || r.MapItems[1].Item != "b.go" {
+		t.Fatalf("unexpected item labels: %+v", r.MapItems)
+	}
+	if r.Output != `[{"item":"a.go","output":{"issues":0}},{"item":"b.go","output":{"issues":0}}]` {
+		t.Fatalf("unexpected aggregated output: %s", r.Output)
+	}
+	if r.SentHandoffs != 2 {
+		t.Fatalf("expected one handoff per item, got %d", r.SentHandoffs)
+	}
+
+	var reviewerInputs []string
+	var summarizerInput string
+	for _, req := range prov.requests {
+		switch req.AgentName {
+		case "reviewer":
+			reviewerInputs = append(reviewerInputs, req.Input)
+		case "summarizer":
+			summarizerInput = req.Input
+		}
+	}
+	if len(reviewerInputs) != 2 {
+		t.Fatalf("expected two reviewer instances, got %d", len(reviewerInputs))
+	}
+	for _, in := range reviewerInputs {
+		a, b := strings.Contains(in, `"a.go"`), strings.Contains(in, `"b.go"`)
+		if a == b || strings.Contains(in, "c.go") || strings.Contains(in, `"files"`) {
+			t.Fatalf("expected each instance to see only its own item, got %q", in)
+		}
+	}
+	for _, key := range []string{"summarizer.input[0]", "summarizer.input[1]"} {
+		if !strings.Contains(summarizerInput, key) {
+			t.Fatalf("expected reducer context to carry %s, got %q", key, summarizerInput)
+		}
+	}
+}
+
+func TestMapItemsFromOutputRejectsNonArrays(t *testing.T) {
+	if _, err := mapItemsFromOutput("planner", "", `{"files": []}`); err == nil || !strings.Contains(err.Error(), "expected a JSON array") {
+		t.Fatalf("expected array error, got %v", err)
+	}
+	if _, err := mapItemsFromOutput("planner", "files", "no json here"); err == nil {
+		t.Fatal("expected error for non-JSON output")
+	}
+	items, err := mapItemsFromOutput("planner", "", "```json\n[\"fix parser\", {\"name\": \"docs\", \"why\": \"stale\"}]\n```")
+	if err != nil || len(items) != 2 || items[0].text != "fix parser" || items[1].label != "docs" {
+		t.Fatalf("unexpected items %+v (%v)", items, err)
+	}
+}
@@ -0,0 +1,673 @@
+package runtime
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	osexec "os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"deeph/internal/capbuf"
+	"deeph/internal/project"
+	"deeph/internal/typesys"
+)
+
+const (
+	mcpProtocolVersion   = "2025-03-26"
+	defaultMCPTimeout    = 30 * time.Second
+	defaultMCPMaxBytes   = 64 * 1024
+	mcpToolNameSeparator = "__"
+	maxMCPToolNameLength = 64
+)
+
+// MCPSkill connects to a Model Context Protocol server (stdio subprocess or
+// streamable HTTP endpoint). The server is started lazily on first use, kept
+// warm for the lifetime of the Engine and each of its tools is exposed to the
+// tool loop as "<skill>__<tool>".
+type MCPSkill struct {
+	cfg       project.SkillConfig
+	workspace string
+
+	mu        sync.Mutex
+	transport mcpTransport
+	tools     []mcpTool
+	loaded    bool
+}
+
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"inputSchema,omitempty"`
+}
+
+type mcpToolRoute struct {
+	Skill string
+	Tool  string
+}
+
+type mcpContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Resource *struct {
+		URI      string `json:"uri"`
+		MimeType string `json:"mimeType,omitempty"`
+		Text     string `json:"text,omitempty"`
+	} `json:"resource,omitempty"`
+}
+
+type mcpCallToolResult struct {
+	Content           []mcpContent `json:"content"`
+	StructuredContent any          `json:"structuredContent,omitempty"`
+	IsError           bool         `json:"isError,omitempty"`
+}
+
+func (s *MCPSkill) Name() string { return s.cfg.Name }
+func (s *MCPSkill) Description() string {
+	return coalesce(s.cfg.Description, "Tools provided by an MCP server")
+}
+
+// Execute calls a single server tool. Tool loops reach it through the routed
+// "<skill>__<tool>" names; startup calls pass args.tool and args.arguments directly.
+func (s *MCPSkill) Execute(ctx context.Context, exec SkillExecution) (map[string]any, error) {
+	tool := strings.TrimSpace(anyString(exec.Args["tool"]))
+	if tool == "" {
+		return nil, fmt.Errorf("mcp skill requires args.tool (string)")
+	}
+	arguments, _ := exec.Args["arguments"].(map[string]any)
+	if arguments == nil {
+		arguments = map[string]any{}
+	}
+	tools, err := s.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	known := false
+	for _, t := range tools {
+		if t.Name == tool {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return nil, fmt.Errorf("mcp server %q does not expose tool %q", s.cfg.Name, tool)
+	}
+
+	transport, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	callCtx, cancel := context.WithTimeout(ctx, s.timeout())
+	defer cancel()
+	raw, err := transport.call(callCtx, "tools/call", map[string]any{"name": tool, "arguments": arguments})
+	if err != nil {
+		return nil, fmt.Errorf("mcp %s/%s: %w", s.cfg.Name, tool, err)
+	}
+	var res mcpCallToolResult
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return nil, fmt.Errorf("mcp %s/%s: decode result: %w", s.cfg.Name, tool, err)
+	}
+
+	maxBytes := defaultMCPMaxBytes
+	if v, ok := intParam(s.cfg.Params, "max_bytes"); ok && v > 0 {
+		maxBytes = v
+	}
+	text, truncated := mcpContentText(res.Content, maxBytes)
+	if res.IsError {
+		return nil, fmt.Errorf("mcp tool %s/%s reported an error: %s", s.cfg.Name, tool, coalesce(trim(text, 400), "no details"))
+	}
+	kind := typesys.KindTextPlain
+	out := map[string]any{
+		"server":    s.cfg.Name,
+		"tool":      tool,
+		"text":      text,
+		"truncated": truncated,
+	}
+	if res.StructuredContent != nil {
+		out["structured"] = res.StructuredContent
+		kind = typesys.KindJSONObject
+	}
+	out["detected_kind"] = kind.String()
+	return out, nil
+}
+
+// ListTools discovers the server's tools once per Engine, applying params.tools as an allowlist.
+func (s *MCPSkill) ListTools(ctx context.Context) ([]mcpTool, error) {
+	s.mu.Lock()
+	if s.loaded {
+		tools := s.tools
+		s.mu.Unlock()
+		return tools, nil
+	}
+	s.mu.Unlock()
+
+	transport, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	allow := map[string]struct{}{}
+	for _, name := range stringListParam(s.cfg.Params, "tools") {
+		if name = strings.TrimSpace(name); name != "" {
+			allow[name] = struct{}{}
+		}
+	}
+	var tools []mcpTool
+	cursor := ""
+	for page := 0; page < 20; page++ {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		callCtx, cancel := context.WithTimeout(ctx, s.timeout())
+		raw, err := transport.call(callCtx, "tools/list", params)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("mcp %s: list tools: %w", s.cfg.Name, err)
+		}
+		var res struct {
+			Tools      []mcpTool `json:"tools"`
+			NextCursor string    `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(raw, &res); err != nil {
+			return nil, fmt.Errorf("mcp %s: decode tools: %w", s.cfg.Name, err)
+		}
+		for _, t := range res.Tools {
+			if strings.TrimSpace(t.Name) == "" {
+				continue
+			}
+			if len(allow) > 0 {
+				if _, ok := allow[t.Name]; !ok {
+					continue
+				}
+			}
+			tools = append(tools, t)
+		}
+		if res.NextCursor == "" {
+			break
+		}
+		cursor = res.NextCursor
+	}
+
+	s.mu.Lock()
+	s.tools, s.loaded = tools, true
+	s.mu.Unlock()
+	return tools, nil
+}
+
+// Close stops the server process (stdio) or ends the HTTP session.
+func (s *MCPSkill) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transport == nil {
+		return nil
+	}
+	err := s.transport.close()
+	s.transport = nil
+	s.loaded = false
+	s.tools = nil
+	return err
+}
+
+func (s *MCPSkill) timeout() time.Duration {
+	if s.cfg.TimeoutMS > 0 {
+		return time.Duration(s.cfg.TimeoutMS) * time.Millisecond
+	}
+	return defaultMCPTimeout
+}
+
+func (s *MCPSkill) connect(ctx context.Context) (mcpTransport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transport != nil {
+		return s.transport, nil
+	}
+	var (
+		transport mcpTransport
+		err       error
+	)
+	if endpoint := strings.TrimSpace(s.cfg.URL); endpoint != "" {
+		transport = &mcpHTTPTransport{url: endpoint, headers: s.cfg.Headers, client: &http.Client{}}
+	} else {
+		argv := stringListParam(s.cfg.Params, "command")
+		if raw, ok := s.cfg.Params["command"].(string); ok {
+			if argv, err = splitCommandLine(raw); err != nil {
+				return nil, err
+			}
+		}
+		argv = append(argv, stringListParam(s.cfg.Params, "args")...)
+		if len(argv) == 0 || strings.TrimSpace(argv[0]) == "" {
+			return nil, fmt.Errorf("mcp skill %q requires url or params.command", s.cfg.Name)
+		}
+		transport, err = startMCPStdioTransport(argv, s.workspace, commandExecEnv(s.cfg), nil)
+		if err != nil {
+			return nil, fmt.Errorf("mcp %s: start server: %w", s.cfg.Name, err)
+		}
+	}
+
+	initCtx, cancel := context.WithTimeout(ctx, s.timeout())
+	defer cancel()
+	if _, err := transport.call(initCtx, "initialize", map[string]any{
+		"protocolVersion": mcpProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "deeph", "version": "1"},
+	}); err != nil {
+		_ = transport.close()
+		return nil, fmt.Errorf("mcp %s: initialize: %w", s.cfg.Name, err)
+	}
+	if err := transport.notify(initCtx, "notifications/initialized", nil); err != nil {
+		_ = transport.close()
+		return nil, fmt.Errorf("mcp %s: initialized notification: %w", s.cfg.Name, err)
+	}
+	s.transport = transport
+	return transport, nil
+}
+
+// mcpToolName builds the function name advertised to the model. Provider APIs
+// restrict names to [A-Za-z0-9_-]{1,64}.
+func mcpToolName(skill, tool string) string {
+	var b strings.Builder
+	for _, r := range skill + mcpToolNameSeparator + tool {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	name := b.String()
+	if len(name) > maxMCPToolNameLength {
+		name = name[:maxMCPToolNameLength]
+	}
+	return name
+}
+
+// mcpHashedToolName is mcpToolName with a short hash of the original skill and
+// tool names, used when sanitizing or clipping made two tools collide.
+func mcpHashedToolName(skill, tool string) string {
+	sum := sha256.Sum256([]byte(skill + "\x00" + tool))
+	suffix := "_" + hex.EncodeToString(sum[:4])
+	name := mcpToolName(skill, tool)
+	if len(name) > maxMCPToolNameLength-len(suffix) {
+		name = name[:maxMCPToolNameLength-len(suffix)]
+	}
+	return name + suffix
+}
+
+func mcpContentText(content []mcpContent, maxBytes int) (string, bool) {
+	parts := make([]string, 0, len(content))
+	for _, c := range content {
+		switch c.Type {
+		case "text":
+			parts = append(parts, c.Text)
+		case "resource":
+			if c.Resource != nil {
+				parts = append(parts, coalesce(c.Resource.Text, "[resource "+c.Resource.URI+"]"))
+			}
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content %s omitted]", c.Type, c.MimeType))
+		}
+	}
+	text := strings.Join(parts, "\n")
+	if maxBytes > 0 && len(text) > maxBytes {
+		return text[:maxBytes], true
+	}
+	return text, false
+}
+
+type mcpTransport interface {
+	call(ctx context.Context, method string, params any) (json.RawMessage, error)
+	notify(ctx context.Context, method string, params any) error
+	close() error
+}
+
+type mcpRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *mcpRPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+type mcpMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *mcpRPCError    `json:"error,omitempty"`
+}
+
+func encodeMCPRequest(id int64, method string, params any) ([]byte, error) {
+	msg := map[string]any{"jsonrpc": "2.0", "method": method}
+	if id > 0 {
+		msg["id"] = id
+	}
+	if params != nil {
+		msg["params"] = params
+	}
+	return json.Marshal(msg)
+}
+
+// mcpStdioTransport speaks newline-delimited JSON-RPC with a server subprocess.
+// A reader goroutine dispatches responses to waiting callers by request id.
+type mcpStdioTransport struct {
+	cmd    *osexec.Cmd
+	stdin  io.WriteCloser
+	stderr *capbuf.Buffer
+
+	writeMu sync.Mutex
+	nextID  atomic.Int64
+
+	mu      sync.Mutex
+	pending map[int64]chan mcpMessage
+	done    chan struct{}
+	readErr error
+
+	// onNotify receives server notifications (messages without an id); nil drops them.
+	onNotify func(mcpMessage)
+}
+
+func startMCPStdioTransport(argv []string, dir string, env []string, onNotify func(mcpMessage)) (*mcpStdioTransport, error) {
+	cmd := osexec.Command(argv[0], argv[1:]...)
+	cmd.Dir = dir
+	cmd.Env = env
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	t := &mcpStdioTransport{
+		cmd:      cmd,
+		stdin:    stdin,
+		stderr:   capbuf.New(8 * 1024),
+		pending:  map[int64]chan mcpMessage{},
+		done:     make(chan struct{}),
+		onNotify: onNotify,
+	}
+	cmd.Stderr = t.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	go t.readLoop(stdout)
+	return t, nil
+}
+
+func (t *mcpStdioTransport) readLoop(stdout io.Reader) {
+	reader := bufio.NewReaderSize(stdout, 64*1024)
+	var err error
+	for {
+		var line []byte
+		line, err = reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var msg mcpMessage
+			if json.Unmarshal(line, &msg) == nil {
+				t.dispatch(msg)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	t.mu.Lock()
+	if errors.Is(err, io.EOF) {
+		err = fmt.Errorf("server closed stdout")
+	}
+	if tail := strings.TrimSpace(t.stderr.String()); tail != "" {
+		err = fmt.Errorf("%w (stderr: %s)", err, trim(tail, 300))
+	}
+	t.readErr = err
+	close(t.done)
+	t.mu.Unlock()
+}
+
+func (t *mcpStdioTransport) dispatch(msg mcpMessage) {
+	if msg.Method != "" {
+		if len(msg.ID) > 0 {
+			// Server-initiated request: answer ping, decline everything else.
+			reply := map[string]any{"jsonrpc": "2.0", "id": msg.ID}
+			if msg.Method == "ping" {
+				reply["result"] = map[string]any{}
+			} else {
+				reply["error"] = mcpRPCError{Code: -32601, Message: "method not supported by deeph client"}
+			}
+			if b, err := json.Marshal(reply); err == nil {
+				_ = t.write(b)
+			}
+		} else if t.onNotify != nil {
+			t.onNotify(msg)
+		}
+		return
+	}
+	id, err := strconv.ParseInt(strings.Trim(string(msg.ID), `"`), 10, 64)
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	ch := t.pending[id]
+	delete(t.pending, id)
+	t.mu.Unlock()
+	if ch != nil {
+		ch <- msg
+	}
+}
+
+func (t *mcpStdioTransport) write(b []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err := t.stdin.Write(append(b, '\n'))
+	return err
+}
+
+func (t *mcpStdioTransport) call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	id := t.nextID.Add(1)
+	b, err := encodeMCPRequest(id, method, params)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan mcpMessage, 1)
+	t.mu.Lock()
+	if t.readErr != nil {
+		err := t.readErr
+		t.mu.Unlock()
+		return nil, err
+	}
+	t.pending[id] = ch
+	t.mu.Unlock()
+	if err := t.write(b); err != nil {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+		return nil, err
+	}
+	select {
+	case msg := <-ch:
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+		return msg.Result, nil
+	case <-t.done:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return nil, t.readErr
+	case <-ctx.Done():
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+		if b, err := encodeMCPRequest(0, "notifications/cancelled", map[string]any{"requestId": id, "reason": "timeout"}); err == nil {
+			_ = t.write(b)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (t *mcpStdioTransport) notify(_ context.Context, method string, params any) error {
+	b, err := encodeMCPRequest(0, method, params)
+	if err != nil {
+		return err
+	}
+	return t.write(b)
+}
+
+func (t *mcpStdioTransport) close() error {
+	_ = t.stdin.Close()
+	select {
+	case <-t.done:
+	case <-time.After(2 * time.Second):
+		if t.cmd.Process != nil {
+			_ = t.cmd.Process.Kill()
+		}
+	}
+	_ = t.cmd.Wait()
+	return nil
+}
+
+// mcpHTTPTransport implements the streamable HTTP transport: each JSON-RPC
+// message is POSTed and the reply arrives as JSON or as a short SSE stream.
+type mcpHTTPTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	nextID  atomic.Int64
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+func (t *mcpHTTPTransport) post(ctx context.Context, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	t.mu.Unlock()
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if sid := resp.Header.Get("Mcp-Session-Id"); sid != "" {
+		t.mu.Lock()
+		t.sessionID = sid
+		t.mu.Unlock()
+	}
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("http %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return resp, nil
+}
+
+func (t *mcpHTTPTransport) call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	id := t.nextID.Add(1)
+	body, err := encodeMCPRequest(id, method, params)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.post(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	want := strconv.FormatInt(id, 10)
+	accept := func(msg mcpMessage) (json.RawMessage, bool, error) {
+		if msg.Method != "" || strings.Trim(string(msg.ID), `"`) != want {
+			return nil, false, nil
+		}
+		if msg.Error != nil {
+			return nil, true, msg.Error
+		}
+		return msg.Result, true, nil
+	}
+	if strings.HasPrefix(strings.ToLower(resp.Header.Get("Content-Type")), "text/event-stream") {
+		reader := bufio.NewReader(resp.Body)
+		var data strings.Builder
+		for {
+			line, readErr := reader.ReadString('\n')
+			line = strings.TrimRight(line, "\r\n")
+			switch {
+			case strings.HasPrefix(line, "data:"):
+				data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			case line == "" && data.Len() > 0:
+				var msg mcpMessage
+				if json.Unmarshal([]byte(data.String()), &msg) == nil {
+					if result, ok, err := accept(msg); ok {
+						return result, err
+					}
+				}
+				data.Reset()
+			}
+			if readErr != nil {
+				return nil, fmt.Errorf("event stream ended before response to %s", method)
+			}
+		}
+	}
+	var msg mcpMessage
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&msg); err != nil {
+		return nil, fmt.Errorf("decode %s response: %w", method, err)
+	}
+	result, ok, err := accept(msg)
+	if !ok {
+		return nil, fmt.Errorf("unexpected response to %s", method)
+	}
+	return result, err
+}
+
+func (t *mcpHTTPTransport) notify(ctx context.Context, method string, params any) error {
+	body, err := encodeMCPRequest(0, method, params)
+	if err != nil {
+		return err
+	}
+	resp, err := t.post(ctx, body)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+func (t *mcpHTTPTransport) close() error {
+	t.mu.Lock()
+	sid := t.sessionID
+	t.mu.Unlock()
+	if sid == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Mcp-Session-Id", sid)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,246 @@
+package runtime
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"deeph/internal/project"
+)
+
+// mcpStubReply answers the subset of MCP used by the client: initialize,
+// tools/list and tools/call for an "echo" tool and a failing "boom" tool.
+func mcpStubReply(msg mcpMessage) map[string]any {
+	if len(msg.ID) == 0 {
+		return nil
+	}
+	reply := map[string]any{"jsonrpc": "2.0", "id": msg.ID}
+	switch msg.Method {
+	case "initialize":
+		reply["result"] = map[string]any{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "stub", "version": "0"},
+		}
+	case "tools/list":
+		reply["result"] = map[string]any{"tools": []map[string]any{
+			{
+				"name":        "echo",
+				"description": "Echoes text back",
+				"inputSchema": map[string]any{
+					"type":       "object",
+					"properties": map[string]any{"text": map[string]any{"type": "string"}},
+					"required":   []string{"text"},
+				},
+			},
+			{"name": "boom", "description": "Always fails"},
+		}}
+	case "tools/call":
+		var params struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		_ = json.Unmarshal(msg.Params, &params)
+		switch params.Name {
+		case "echo":
+			reply["result"] = map[string]any{"content": []map[string]any{{"type": "text", "text": fmt.Sprintf("echo: %v", params.Arguments["text"])}}}
+		default:
+			reply["result"] = map[string]any{"isError": true, "content": []map[string]any{{"type": "text", "text": "kaboom"}}}
+		}
+	default:
+		reply["error"] = map[string]any{"code": -32601, "message": "unknown method"}
+	}
+	return reply
+}
+
+// TestMCPStubServerProcess is not a real test: when DEEPH_MCP_STUB=1 the test
+// binary acts as a stdio MCP server for TestMCPSkillStdioDiscoversAndCallsTools.
+func TestMCPStubServerProcess(t *testing.T) {
+	if os.Getenv("DEEPH_MCP_STUB") != "1" {
+		t.Skip("helper process")
+	}
+	sc := bufio.NewScanner(os.Stdin)
+	for sc.Scan() {
+		var msg mcpMessage
+		if err := json.Unmarshal(sc.Bytes(), &msg); err != nil {
+			continue
+		}
+		if reply := mcpStubReply(msg); reply != nil {
+			b, _ := json.Marshal(reply)
+			fmt.Fprintln(os.Stdout, string(b))
+		}
+	}
+	os.Exit(0)
+}
+
+func newMCPStubHTTPServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		var msg mcpMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if msg.Method != "initialize" && r.Header.Get("Mcp-Session-Id") != "sess-1" {
+			http.Error(w, "missing session", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Mcp-Session-Id", "sess-1")
+		reply := mcpStubReply(msg)
+		if reply == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		b, _ := json.Marshal(reply)
+		if msg.Method == "tools/call" {
+			// Exercise the SSE response path for tool calls.
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", b)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestMCPSkillStdioDiscoversAndCallsTools(t *testing.T) {
+	s := &MCPSkill{
+		cfg: project.SkillConfig{
+			Name: "stub",
+			Type: "mcp",
+			Params: map[string]any{
+				"command": []any{os.Args[0], "-test.run=^TestMCPStubServerProcess$"},
+				"env":     map[string]any{"DEEPH_MCP_STUB": "1"},
+			},
+		},
+		workspace: t.TempDir(),
+	}
+	defer s.Close()
+
+	tools, err := s.ListTools(context.Background())
+	if err != nil {
+		t.Fatalf("ListTools error: %v", err)
+	}
+	if len(tools) != 2 || tools[0].Name != "echo" {
+		t.Fatalf("unexpected tools: %+v", tools)
+	}
+	out, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{
+		"tool":      "echo",
+		"arguments": map[string]any{"text": "hi"},
+	}})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if got, _ := out["text"].(string); got != "echo: hi" {
+		t.Fatalf("expected echo text, got %q", got)
+	}
+	if _, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"tool": "boom"}}); err == nil || !strings.Contains(err.Error(), "kaboom") {
+		t.Fatalf("expected tool error to surface, got %v", err)
+	}
+	if _, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"tool": "missing"}}); err == nil {
+		t.Fatalf("expected unknown tool to be rejected")
+	}
+}
+
+func TestEngineRoutesMCPToolsThroughToolLoop(t *testing.T) {
+	srv := newMCPStubHTTPServer(t)
+	p := &project.Project{
+		Root: project.RootConfig{Providers: []project.ProviderConfig{{Name: "local", Type: "mock"}}},
+		Skills: []project.SkillConfig{{
+			Name:   "stub",
+			Type:   "mcp",
+			URL:    srv.URL,
+			Params: map[string]any{"tools": []any{"echo"}},
+		}},
+		Agents: []project.AgentConfig{{Name: "a1", Provider: "local", Skills: []string{"stub"}}},
+	}
+	eng, err := New(t.TempDir(), p)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	defer eng.Close()
+
+	defs, err := eng.buildToolDefinitions(context.Background(), []string{"stub"})
+	if err != nil {
+		t.Fatalf("buildToolDefinitions error: %v", err)
+	}
+	if len(defs) != 1 || defs[0].Name != "stub__echo" {
+		t.Fatalf("expected only stub__echo (allowlisted), got %+v", defs)
+	}
+	if props, _ := defs[0].Parameters["properties"].(map[string]any); props["text"] == nil {
+		t.Fatalf("expected server input schema to be forwarded, got %#v", defs[0].Parameters)
+	}
+
+	broker := newToolBroker()
+	callTrace, msg := eng.executeToolCall(context.Background(), broker, p.Agents[0], "", LLMToolCall{
+		ID:        "call_1",
+		Name:      "stub__echo",
+		Arguments: `{"text":"routed"}`,
+	})
+	if callTrace.Error != "" {
+		t.Fatalf("unexpected tool error: %s", callTrace.Error)
+	}
+	if callTrace.Skill != "stub__echo" || callTrace.Args["text"] != "routed" {
+		t.Fatalf("unexpected trace: %+v", callTrace)
+	}
+	if got, _ := callTrace.Result["text"].(string); got != "echo: routed" {
+		t.Fatalf("expected routed result, got %#v", callTrace.Result)
+	}
+	if !strings.Contains(msg.Content, `"ok":true`) {
+		t.Fatalf("expected ok tool message, got %s", msg.Content)
+	}
+}
+
+func TestMCPToolNameSanitizes(t *testing.T) {
+	if got := mcpToolName("gh", "search.issues/v2"); got != "gh__search_issues_v2" {
+		t.Fatalf("got %q", got)
+	}
+	if got := mcpToolName("s", strings.Repeat("x", 100)); len(got) != maxMCPToolNameLength {
+		t.Fatalf("expected name clipped to %d chars, got %d", maxMCPToolNameLength, len(got))
+	}
+}
+
+func TestMCPRouteNameDisambiguatesCollisions(t *testing.T) {
+	e := &Engine{skills: map[string]Skill{"gh__skill": nil}, mcpRoutes: map[string]mcpToolRoute{}}
+	register := func(skill, tool string) string {
+		t.Helper()
+		route := mcpToolRoute{Skill: skill, Tool: tool}
+		name, err := e.mcpRouteName(route)
+		if err != nil {
+			t.Fatalf("mcpRouteName(%s, %s): %v", skill, tool, err)
+		}
+		e.mcpRoutes[name] = route
+		return name
+	}
+	dotted := register("gh", "search.issues")
+	underscored := register("gh", "search_issues")
+	if dotted != "gh__search_issues" || underscored == dotted {
+		t.Fatalf("expected distinct names, got %q and %q", dotted, underscored)
+	}
+	if len(underscored) > maxMCPToolNameLength || !strings.HasPrefix(underscored, "gh__search_issues_") {
+		t.Fatalf("unexpected disambiguated name %q", underscored)
+	}
+	if again := register("gh", "search_issues"); again != underscored {
+		t.Fatalf("re-listing changed the name: %q -> %q", underscored, again)
+	}
+	if got := register("gh", "skill"); got == "gh__skill" {
+		t.Fatalf("expected a name shadowed by a skill to be disambiguated")
+	}
+	long := strings.Repeat("x", 100)
+	a, b := register("s", long+"a"), register("s", long+"b")
+	if a == b || len(b) != maxMCPToolNameLength {
+		t.Fatalf("expected clipped names to stay distinct, got %q and %q", a, b)
+	}
+}
@@ -0,0 +1,241 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MockScript scripts a mock provider (providers[].mock_script): the first
+// rule matching a request answers it.
+type MockScript struct {
+	Rules []MockRule `yaml:"rules"`
+	// Default answers requests no rule matches: "echo" (the built-in mock
+	// summary, default) or "error".
+	Default string `yaml:"default"`
+}
+
+type MockRule struct {
+	// Agent matches the agent name; empty or "*" matches any agent.
+	Agent string `yaml:"agent"`
+	// InputContains lists substrings that must all appear (case-insensitive)
+	// in the request input or its messages.
+	InputContains []string `yaml:"input_contains"`
+	// Turn matches the agent's Nth generation on this provider within the
+	// run or map instance (1-based); 0 matches any turn.
+	Turn int `yaml:"turn"`
+	// Times caps how often the rule answers per run or map instance; 0 is
+	// unlimited.
+	Times int `yaml:"times"`
+
+	// Text is the response; {{agent}} and {{turn}} are substituted.
+	Text         string         `yaml:"text"`
+	ToolCalls    []MockToolCall `yaml:"tool_calls"`
+	Error        string         `yaml:"error"`
+	Delay        string         `yaml:"delay"`
+	FinishReason string         `yaml:"finish_reason"`
+	// Usage is reported as OpenAI-style meta["usage"].
+	Usage map[string]int `yaml:"usage"`
+
+	delay time.Duration
+}
+
+type MockToolCall struct {
+	Name string         `yaml:"name"`
+	Args map[string]any `yaml:"args"`
+}
+
+// LoadMockScript reads and validates a mock script file.
+func LoadMockScript(path string) (*MockScript, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s MockScript
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	switch s.Default = strings.ToLower(strings.TrimSpace(s.Default)); s.Default {
+	case "", "echo", "error":
+	default:
+		return nil, fmt.Errorf("%s: default must be echo or error, got %q", path, s.Default)
+	}
+	for i := range s.Rules {
+		r := &s.Rules[i]
+		if r.Turn < 0 || r.Times < 0 {
+			return nil, fmt.Errorf("%s: rules[%d]: turn and times must be >= 0", path, i)
+		}
+		if r.Text == "" && len(r.ToolCalls) == 0 && r.Error == "" {
+			return nil, fmt.Errorf("%s: rules[%d]: set text, tool_calls or error", path, i)
+		}
+		for j, tc := range r.ToolCalls {
+			if strings.TrimSpace(tc.Name) == "" {
+				return nil, fmt.Errorf("%s: rules[%d].tool_calls[%d].name is required", path, i, j)
+			}
+		}
+		if d := strings.TrimSpace(r.Delay); d != "" {
+			if r.delay, err = time.ParseDuration(d); err != nil || r.delay < 0 {
+				return nil, fmt.Errorf("%s: rules[%d]: invalid delay %q", path, i, r.Delay)
+			}
+		}
+	}
+	return &s, nil
+}
+
+// MockScriptPath resolves a provider's mock_script against the workspace.
+func MockScriptPath(workspace, script string) string {
+	script = strings.TrimSpace(script)
+	if script == "" || filepath.IsAbs(script) {
+		return script
+	}
+	return filepath.Join(workspace, script)
+}
+
+// mockCounts tracks one script's generations per agent (for turn) and
+// answers per rule (for times).
+type mockCounts struct {
+	turns map[string]int
+	fired []int
+}
+
+func newMockCounts(s *MockScript) *mockCounts {
+	return &mockCounts{turns: map[string]int{}, fired: make([]int, len(s.Rules))}
+}
+
+// next counts a generation by req's agent and returns its turn and the index
+// of the rule that answers it, or -1.
+func (c *mockCounts) next(s *MockScript, req LLMRequest) (int, int) {
+	c.turns[req.AgentName]++
+	turn := c.turns[req.AgentName]
+	for i, r := range s.Rules {
+		if r.matches(req, turn) && (r.Times == 0 || c.fired[i] < r.Times) {
+			c.fired[i]++
+			return turn, i
+		}
+	}
+	return turn, -1
+}
+
+// mockTurnScope holds the mock counts of one run or one map instance, so
+// turn and times count from the start of each run and every mapped instance
+// starts at turn 1.
+type mockTurnScope struct {
+	mu     sync.Mutex
+	counts map[*MockProvider]*mockCounts
+}
+
+type mockTurnScopeKey struct{}
+
+// withMockTurnScope starts a fresh scope for mock script counts.
+func withMockTurnScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, mockTurnScopeKey{}, &mockTurnScope{counts: map[*MockProvider]*mockCounts{}})
+}
+
+// scripted answers req from the script; ok is false when the built-in echo
+// should answer instead.
+func (p *MockProvider) scripted(ctx context.Context, req LLMRequest, model string) (LLMResponse, bool, error) {
+	var turn, idx int
+	if scope, _ := ctx.Value(mockTurnScopeKey{}).(*mockTurnScope); scope != nil {
+		scope.mu.Lock()
+		c := scope.counts[p]
+		if c == nil {
+			c = newMockCounts(p.script)
+			scope.counts[p] = c
+		}
+		turn, idx = c.next(p.script, req)
+		scope.mu.Unlock()
+	} else {
+		p.mu.Lock()
+		if p.counts == nil {
+			p.counts = newMockCounts(p.script)
+		}
+		turn, idx = p.counts.next(p.script, req)
+		p.mu.Unlock()
+	}
+
+	if idx < 0 {
+		if p.script.Default == "error" {
+			return LLMResponse{}, true, fmt.Errorf("mock script: no rule matches agent %q turn %d", req.AgentName, turn)
+		}
+		return LLMResponse{}, false, nil
+	}
+	r := p.script.Rules[idx]
+	if r.delay > 0 {
+		select {
+		case <-time.After(r.delay):
+		case <-ctx.Done():
+			return LLMResponse{}, true, ctx.Err()
+		}
+	}
+	if r.Error != "" {
+		return LLMResponse{}, true, errors.New(r.Error)
+	}
+	resp := LLMResponse{
+		Text:         strings.NewReplacer("{{agent}}", req.AgentName, "{{turn}}", strconv.Itoa(turn)).Replace(r.Text),
+		Provider:     p.name,
+		Model:        model,
+		Meta:         map[string]any{"provider_type": p.typeName, "mock_rule": idx},
+		FinishReason: coalesce(r.FinishReason, "stop"),
+	}
+	for i, tc := range r.ToolCalls {
+		args := tc.Args
+		if args == nil {
+			args = map[string]any{}
+		}
+		b, err := json.Marshal(args)
+		if err != nil {
+			return LLMResponse{}, true, fmt.Errorf("mock script: rules[%d].tool_calls[%d] args: %w", idx, i, err)
+		}
+		resp.ToolCalls = append(resp.ToolCalls, LLMToolCall{
+			ID:        fmt.Sprintf("mock_%s_%d_%d", req.AgentName, turn, i),
+			Type:      "function",
+			Name:      tc.Name,
+			Arguments: string(b),
+		})
+	}
+	if len(resp.ToolCalls) > 0 && r.FinishReason == "" {
+		resp.FinishReason = "tool_calls"
+	}
+	if len(r.Usage) > 0 {
+		usage := map[string]any{}
+		for k, v := range r.Usage {
+			usage[k] = v
+		}
+		resp.Meta["usage"] = usage
+	}
+	return resp, true, nil
+}
+
+func (r MockRule) matches(req LLMRequest, turn int) bool {
+	if a := strings.TrimSpace(r.Agent); a != "" && a != "*" && a != req.AgentName {
+		return false
+	}
+	if r.Turn > 0 && r.Turn != turn {
+		return false
+	}
+	if len(r.InputContains) == 0 {
+		return true
+	}
+	var sb strings.Builder
+	sb.WriteString(req.Input)
+	for _, m := range req.Messages {
+		sb.WriteByte('\n')
+		sb.WriteString(m.Content)
+	}
+	hay := strings.ToLower(sb.String())
+	for _, s := range r.InputContains {
+		if !strings.Contains(hay, strings.ToLower(s)) {
+			return false
+		}
+	}
+	return true
+}
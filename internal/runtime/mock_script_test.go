@@ -0,0 +1,141 @@
+package runtime
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"deeph/internal/project"
+)
+
+func TestMockScriptDrivesToolLoopAndHandoff(t *testing.T) {
+	ws := t.TempDir()
+	script := `
+rules:
+  - agent: planner
+    text: "plan: patch auth/session.go"
+    usage: {prompt_tokens: 30, completion_tokens: 5}
+  - agent: coder
+    turn: 1
+    input_contains: ["PATCH AUTH"]
+    tool_calls:
+      - name: echo
+        args: {path: auth/session.go}
+  - agent: coder
+    text: "done by {{agent}} on turn {{turn}}"
+default: error
+`
+	if err := os.WriteFile(filepath.Join(ws, "mock.yaml"), []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	proj := &project.Project{
+		Root: project.RootConfig{
+			Version:         1,
+			DefaultProvider: "local_mock",
+			Providers:       []project.ProviderConfig{{Name: "local_mock", Type: "mock", Model: "mock-small", MockScript: "mock.yaml"}},
+		},
+		Agents: []project.AgentConfig{
+			{Name: "planner", Provider: "local_mock"},
+			{Name: "coder", Provider: "local_mock", Skills: []string{"echo"}},
+			{Name: "stray", Provider: "local_mock"},
+		},
+		Skills: []project.SkillConfig{{Name: "echo", Type: "echo"}},
+	}
+	eng, err := New(ws, proj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := eng.RunSpec(context.Background(), "planner>coder", "fix the login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != 2 {
+		t.Fatalf("results=%d", len(report.Results))
+	}
+	planner, coder := report.Results[0], report.Results[1]
+	if planner.Output != "plan: patch auth/session.go" || planner.Usage.TotalTokens != 35 {
+		t.Fatalf("unexpected planner result: %q usage=%+v", planner.Output, planner.Usage)
+	}
+	if coder.Error != "" || coder.Output != "done by coder on turn 2" {
+		t.Fatalf("unexpected coder result: output=%q err=%q", coder.Output, coder.Error)
+	}
+	if len(coder.ToolCalls) != 1 || coder.ToolCalls[0].Skill != "echo" || coder.ToolCalls[0].Args["path"] != "auth/session.go" {
+		t.Fatalf("expected one scripted echo tool call, got %+v", coder.ToolCalls)
+	}
+
+	report, err = eng.RunSpec(context.Background(), "stray", "anything")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report.Results[0].Error, `no rule matches agent "stray"`) {
+		t.Fatalf("expected default error, got %q", report.Results[0].Error)
+	}
+}
+
+func TestLoadMockScriptRejectsInvalidRules(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"empty.yaml":   "rules:\n  - agent: coder\n",
+		"delay.yaml":   "rules:\n  - text: hi\n    delay: soon\n",
+		"default.yaml": "default: maybe\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadMockScript(path); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+	proj := &project.Project{Root: project.RootConfig{Providers: []project.ProviderConfig{{Name: "m", Type: "mock", MockScript: "missing.yaml"}}}}
+	if _, err := New(dir, proj); err == nil || !strings.Contains(err.Error(), "mock_script") {
+		t.Fatalf("expected New to fail on a missing script, got %v", err)
+	}
+}
+
+func TestMockScriptTurnsCountPerRunAndMapInstance(t *testing.T) {
+	ws := t.TempDir()
+	script := `
+rules:
+  - agent: splitter
+    text: '{"files": ["a.go", "b.go", "c.go"]}'
+  - agent: reviewer
+    turn: 1
+    text: "reviewed on turn {{turn}}"
+default: error
+`
+	if err := os.WriteFile(filepath.Join(ws, "mock.yaml"), []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	proj := &project.Project{
+		Root: project.RootConfig{
+			Providers: []project.ProviderConfig{{Name: "local_mock", Type: "mock", MockScript: "mock.yaml"}},
+		},
+		Agents: []project.AgentConfig{
+			{Name: "splitter", Provider: "local_mock"},
+			{Name: "reviewer", Provider: "local_mock", Map: &project.MapConfig{Over: "splitter", Field: "files", Concurrency: 2}},
+		},
+	}
+	eng, err := New(ws, proj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+	for run := 1; run <= 2; run++ {
+		report, err := eng.RunSpec(context.Background(), "splitter>reviewer", "review the change")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := report.Results[1]
+		if r.Error != "" || len(r.MapItems) != 3 {
+			t.Fatalf("run %d: expected three mapped items, got %+v", run, r)
+		}
+		for _, item := range r.MapItems {
+			if item.Error != "" || item.Output != "reviewed on turn 1" {
+				t.Fatalf("run %d: expected every instance to answer on turn 1, got %+v", run, item)
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"deeph/internal/jsonpath"
+	"deeph/internal/jsonschema"
+	"deeph/internal/project"
+)
+
+const defaultContractRetries = 2
+
+// OutputContractResult records whether the agent output met one output port's
+// JSON Schema.
+type OutputContractResult struct {
+	Port       string   `json:"port"`
+	Valid      bool     `json:"valid"`
+	Violations []string `json:"violations,omitempty"`
+}
+
+type outputContract struct {
+	Port   string
+	Schema map[string]any
+}
+
+func agentOutputContracts(agent project.AgentConfig) []outputContract {
+	var out []outputContract
+	for _, p := range agent.IO.Outputs {
+		if len(p.Schema) > 0 {
+			out = append(out, outputContract{Port: strings.TrimSpace(p.Name), Schema: p.Schema})
+		}
+	}
+	return out
+}
+
+// contractResponseSchema is the schema passed to providers as a JSON-mode hint.
+// When several ports declare schemas the first one is used; all are validated.
+func contractResponseSchema(contracts []outputContract) map[string]any {
+	if len(contracts) == 0 {
+		return nil
+	}
+	return contracts[0].Schema
+}
+
+func contractRetries(agent project.AgentConfig) int {
+	if v, ok := metadataInt(agent.Metadata, "contract_retries"); ok && v >= 0 {
+		return v
+	}
+	return defaultContractRetries
+}
+
+// withContractInstructions tells the model the answer must be JSON matching the
+// port schemas (JSON mode on some providers also requires the word "JSON").
+func withContractInstructions(systemPrompt string, contracts []outputContract) string {
+	if len(contracts) == 0 {
+		return systemPrompt
+	}
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(systemPrompt))
+	if b.Len() > 0 {
+		b.WriteString("\n\n")
+	}
+	b.WriteString("Your final answer must be a single JSON value (no prose, no code fences) that satisfies ")
+	if len(contracts) == 1 {
+		b.WriteString("this JSON Schema:\n")
+	} else {
+		b.WriteString("every one of these JSON Schemas:\n")
+	}
+	for _, c := range contracts {
+		schema, _ := json.Marshal(c.Schema)
+		fmt.Fprintf(&b, "- output port %s: %s\n", coalesce(c.Port, "output"), schema)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// checkOutputContracts parses output as JSON (tolerating code fences and
+// surrounding prose) and validates it against every contract. normalized is
+// the bare JSON text when parsing succeeded.
+func checkOutputContracts(contracts []outputContract, output string) (normalized string, results []OutputContractResult, ok bool) {
+	raw, value, err := jsonpath.Extract(output)
+	ok = true
+	for _, c := range contracts {
+		r := OutputContractResult{Port: c.Port, Valid: true}
+		if err != nil {
+			r.Valid = false
+			r.Violations = []string{err.Error()}
+		} else {
+			for _, v := range jsonschema.Validate(c.Schema, value) {
+				r.Valid = false
+				r.Violations = append(r.Violations, v.String())
+			}
+		}
+		ok = ok && r.Valid
+		results = append(results, r)
+	}
+	return raw, results, ok
+}
+
+func contractCorrection(results []OutputContractResult) string {
+	var b strings.Builder
+	b.WriteString("Your previous answer did not satisfy the output contract:\n")
+	for _, r := range results {
+		for _, v := range r.Violations {
+			fmt.Fprintf(&b, "- port %s: %s\n", coalesce(r.Port, "output"), v)
+		}
+	}
+	b.WriteString("Reply again with only the corrected JSON value.")
+	return b.String()
+}
+
+// enforceOutputContracts validates res.Output against the agent's output port
+// schemas and asks the provider to correct it up to contract_retries times. The
+// last output is kept either way; failed ports mark their handoffs invalid.
+func (e *Engine) enforceOutputContracts(ctx context.Context, provider Provider, task Task, compiled CompiledContext, contracts []outputContract, res *AgentRunResult) {
+	retries := contractRetries(task.Agent)
+	for attempt := 0; ; attempt++ {
+		res.ContractAttempts = attempt + 1
+		normalized, results, ok := checkOutputContracts(contracts, res.Output)
+		res.Contracts = results
+		if ok {
+			res.Output = normalized
+			return
+		}
+		if attempt >= retries || ctx.Err() != nil {
+			return
+		}
+		correction := contractCorrection(results)
+		messages := e.initialMessages(task.Agent, compiled.Text)
+		messages = append(messages,
+			ChatMessage{Role: "assistant", Content: res.Output},
+			ChatMessage{Role: "user", Content: correction},
+		)
+		resp, err := provider.Generate(ctx, LLMRequest{
+			AgentName:       task.Agent.Name,
+			Model:           coalesce(task.Agent.Model, task.Provider.Model),
+			SystemPrompt:    task.Agent.SystemPrompt,
+			Input:           compiled.Text + "\n\nPrevious answer:\n" + res.Output + "\n\n" + correction,
+			AvailableSkills: append([]string(nil), task.Agent.Skills...),
+			Messages:        messages,
+			ResponseSchema:  contractResponseSchema(contracts),
+		})
+		if err != nil {
+			// Keep the last output and its violations; the retry itself failed.
+			return
+		}
+		res.Output = resp.Text
+	}
+}
+
+// contractPortInvalid reports whether a handoff from port carries output that
+// failed its schema contract.
+func contractPortInvalid(res AgentRunResult, port string) bool {
+	port = strings.TrimSpace(port)
+	for _, c := range res.Contracts {
+		if c.Valid {
+			continue
+		}
+		if c.Port == port || (port == "" && len(res.Contracts) == 1) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"deeph/internal/project"
+)
+
+type scriptedContractProvider struct {
+	mu       sync.Mutex
+	replies  map[string][]string
+	requests []LLMRequest
+}
+
+func (p *scriptedContractProvider) Name() string { return "scripted" }
+
+func (p *scriptedContractProvider) Generate(_ context.Context, req LLMRequest) (LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, req)
+	queue := p.replies[req.AgentName]
+	text := "done"
+	if len(queue) > 0 {
+		text = queue[0]
+		if len(queue) > 1 {
+			p.replies[req.AgentName] = queue[1:]
+		}
+	}
+	return LLMResponse{Text: text, Provider: "scripted"}, nil
+}
+
+func contractTestEngine(t *testing.T, retries string, replies []string) (*Engine, *scriptedContractProvider) {
+	t.Helper()
+	schema := map[string]any{
+		"type":     "object",
+		"required": []any{"summary", "risk"},
+		"properties": map[string]any{
+			"summary": map[string]any{"type": "string"},
+			"risk":    map[string]any{"type": "string", "enum": []any{"low", "high"}},
+		},
+	}
+	p := &project.Project{
+		Root: project.RootConfig{Providers: []project.ProviderConfig{{Name: "local", Type: "mock"}}},
+		Agents: []project.AgentConfig{
+			{
+				Name:         "analyst",
+				Provider:     "local",
+				SystemPrompt: "Assess the change.",
+				Metadata:     map[string]string{"contract_retries": retries},
+				IO: project.AgentIOConfig{Outputs: []project.IOPortConfig{
+					{Name: "report", Produces: []string{"json/object"}, Schema: schema},
+				}},
+			},
+			{
+				Name:     "writer",
+				Provider: "local",
+				IO: project.AgentIOConfig{Inputs: []project.IOPortConfig{
+					{Name: "report", Accepts: []string{"json/object"}},
+				}},
+			},
+		},
+	}
+	eng, err := New(t.TempDir(), p)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	t.Cleanup(func() { eng.Close() })
+	prov := &scriptedContractProvider{replies: map[string][]string{"analyst": replies}}
+	eng.providers["local"] = prov
+	return eng, prov
+}
+
+func TestOutputContractRetriesWithValidationErrors(t *testing.T) {
+	eng, prov := contractTestEngine(t, "2", []string{
+		"Here you go: not json",
+		`{"summary": "ok", "risk": "medium"}`,
+		"```json\n{\"summary\": \"ok\", \"risk\": \"low\"}\n```",
+	})
+	report, err := eng.RunSpec(context.Background(), "analyst>writer", "review the patch")
+	if err != nil {
+		t.Fatalf("RunSpec error: %v", err)
+	}
+	res := report.Results[0]
+	if res.ContractAttempts != 3 || len(res.Contracts) != 1 || !res.Contracts[0].Valid {
+		t.Fatalf("expected valid contract after 3 attempts, got attempts=%d contracts=%+v", res.ContractAttempts, res.Contracts)
+	}
+	if res.Output != `{"summary": "ok", "risk": "low"}` {
+		t.Fatalf("expected output normalized to bare JSON, got %q", res.Output)
+	}
+	if res.InvalidHandoffs != 0 || res.SentHandoffs == 0 {
+		t.Fatalf("expected a valid handoff, got sent=%d invalid=%d", res.SentHandoffs, res.InvalidHandoffs)
+	}
+
+	var analystReqs []LLMRequest
+	for _, req := range prov.requests {
+		if req.AgentName == "analyst" {
+			analystReqs = append(analystReqs, req)
+		}
+	}
+	if len(analystReqs) != 3 {
+		t.Fatalf("expected 3 analyst requests, got %d", len(analystReqs))
+	}
+	if analystReqs[0].ResponseSchema == nil || !strings.Contains(analystReqs[0].SystemPrompt, "JSON Schema") {
+		t.Fatalf("expected JSON mode hint and schema instructions, got %+v", analystReqs[0])
+	}
+	retry := analystReqs[2]
+	if n := len(retry.Messages); n < 2 || !strings.Contains(retry.Messages[n-1].Content, "risk") || retry.Messages[n-2].Role != "assistant" {
+		t.Fatalf("expected retry to carry the previous answer and violations, got %+v", retry.Messages)
+	}
+}
+
+func TestOutputContractMarksHandoffInvalidAfterRetries(t *testing.T) {
+	eng, prov := contractTestEngine(t, "1", []string{"no json here"})
+	report, err := eng.RunSpec(context.Background(), "analyst>writer", "review the patch")
+	if err != nil {
+		t.Fatalf("RunSpec error: %v", err)
+	}
+	res := report.Results[0]
+	if res.ContractAttempts != 2 || res.Contracts[0].Valid || len(res.Contracts[0].Violations) == 0 {
+		t.Fatalf("expected failed contract after 2 attempts, got attempts=%d contracts=%+v", res.ContractAttempts, res.Contracts)
+	}
+	if res.InvalidHandoffs == 0 {
+		t.Fatalf("expected invalid handoff to be counted, got %+v", res)
+	}
+	var writerInput string
+	for _, req := range prov.requests {
+		if req.AgentName == "writer" {
+			writerInput = req.Input
+		}
+	}
+	if !strings.Contains(writerInput, "contract=invalid") {
+		t.Fatalf("expected downstream context to flag the invalid handoff, got:\n%s", writerInput)
+	}
+}
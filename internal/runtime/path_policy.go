@@ -0,0 +1,232 @@
+package runtime
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"deeph/internal/project"
+)
+
+// DefaultDenyPaths protects repository internals, dotenv files and key
+// material from every file skill. Entries prefixed with "!" in deny_paths
+// lift a default for matching paths (e.g. "!.env.example").
+var DefaultDenyPaths = []string{
+	".git",
+	".env",
+	".env.*",
+	".ssh",
+	"*.pem",
+	"*.key",
+	"*.p12",
+	"*.pfx",
+	"id_rsa*",
+	"id_dsa*",
+	"id_ecdsa*",
+	"id_ed25519*",
+}
+
+// fileSkillAccess classifies the skill types that take workspace paths.
+var fileSkillAccess = map[string]string{
+	"file_read":       "read",
+	"file_read_range": "read",
+	"code_search":     "read",
+	"repo_map":        "read",
+	"git":             "read",
+	"file_write_safe": "write",
+}
+
+// PathPolicy is the effective allow/deny scope of one agent using one skill.
+// The zero value enforces DefaultDenyPaths only.
+type PathPolicy struct {
+	// Allow holds one list per level (agent, skill, agent write_paths); a path
+	// must match every non-empty level.
+	Allow  [][]string
+	Deny   []string
+	Exempt []string
+}
+
+func newPathPolicy(agent project.AgentConfig, cfg project.SkillConfig) PathPolicy {
+	p := PathPolicy{}
+	for _, allow := range [][]string{agent.AllowPaths, cfg.AllowPaths} {
+		if list := cleanPathPatterns(allow); len(list) > 0 {
+			p.Allow = append(p.Allow, list)
+		}
+	}
+	if fileSkillAccess[cfg.Type] == "write" {
+		if list := cleanPathPatterns(agent.WritePaths); len(list) > 0 {
+			p.Allow = append(p.Allow, list)
+		}
+	}
+	for _, raw := range append(append([]string(nil), agent.DenyPaths...), cfg.DenyPaths...) {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(raw), "!"); ok {
+			p.Exempt = append(p.Exempt, cleanPathPatterns([]string{rest})...)
+			continue
+		}
+		p.Deny = append(p.Deny, cleanPathPatterns([]string{raw})...)
+	}
+	return p
+}
+
+// taskPathPlan lists the path policy of each file skill the agent can call.
+func (e *Engine) taskPathPlan(agent project.AgentConfig) []TaskPathPlan {
+	var out []TaskPathPlan
+	for _, name := range agent.Skills {
+		cfg, ok := e.skillCfgs[name]
+		if !ok {
+			continue
+		}
+		access, ok := fileSkillAccess[cfg.Type]
+		if !ok {
+			continue
+		}
+		p := newPathPolicy(agent, cfg)
+		out = append(out, TaskPathPlan{Skill: name, Access: access, Allow: p.Allow, Deny: p.Deny, Exempt: p.Exempt})
+	}
+	return out
+}
+
+func cleanPathPatterns(list []string) []string {
+	out := make([]string, 0, len(list))
+	for _, raw := range list {
+		pat := strings.Trim(filepath.ToSlash(strings.TrimSpace(raw)), "/")
+		pat = strings.TrimPrefix(pat, "./")
+		if pat != "" {
+			out = append(out, pat)
+		}
+	}
+	return out
+}
+
+// Key fingerprints the policy so cached tool results are never shared between
+// agents with different scopes.
+func (p PathPolicy) Key() string {
+	if len(p.Allow) == 0 && len(p.Deny) == 0 && len(p.Exempt) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(p.Allow)+2)
+	for _, level := range p.Allow {
+		parts = append(parts, "allow="+strings.Join(level, ","))
+	}
+	parts = append(parts, "deny="+strings.Join(p.Deny, ","), "exempt="+strings.Join(p.Exempt, ","))
+	return strings.Join(parts, ";")
+}
+
+// Check reports why a slash-separated workspace-relative path is off limits.
+func (p PathPolicy) Check(rel string) error {
+	if err := p.checkDeny(rel); err != nil {
+		return err
+	}
+	for _, level := range p.Allow {
+		if matchAnyPathPattern(level, rel) == "" {
+			return fmt.Errorf("path %q is outside allow_paths %v", rel, level)
+		}
+	}
+	return nil
+}
+
+// checkDeny applies only the deny lists; directory roots whose entries are
+// filtered one by one use it so "." stays searchable under allow_paths.
+func (p PathPolicy) checkDeny(rel string) error {
+	rel = path.Clean(filepath.ToSlash(rel))
+	if rel == "." {
+		return nil
+	}
+	if pat := matchAnyPathPattern(p.Deny, rel); pat != "" {
+		return fmt.Errorf("path %q is denied by deny_paths (%s)", rel, pat)
+	}
+	if pat := matchAnyPathPattern(DefaultDenyPaths, rel); pat != "" && matchAnyPathPattern(p.Exempt, rel) == "" {
+		return fmt.Errorf("path %q is protected by default (%s); exempt it with deny_paths: [\"!%s\"]", rel, pat, rel)
+	}
+	return nil
+}
+
+// Allows is the boolean form of Check, used to filter walk results.
+func (p PathPolicy) Allows(rel string) bool {
+	return p.Check(rel) == nil
+}
+
+func matchAnyPathPattern(patterns []string, rel string) string {
+	for _, pat := range patterns {
+		if matchPathPattern(pat, rel) {
+			return pat
+		}
+	}
+	return ""
+}
+
+// matchPathPattern matches a workspace-relative path or any of its parent
+// directories. Patterns without "/" match a single name at any depth, as in
+// .gitignore; others are anchored at the workspace root and support "**".
+func matchPathPattern(pattern, rel string) bool {
+	rel = path.Clean(filepath.ToSlash(rel))
+	segs := strings.Split(rel, "/")
+	if !strings.Contains(pattern, "/") {
+		for _, seg := range segs {
+			if ok, _ := path.Match(pattern, seg); ok {
+				return true
+			}
+		}
+		return false
+	}
+	for i := len(segs); i > 0; i-- {
+		if matchGlobPath(pattern, strings.Join(segs[:i], "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePolicyPath resolves a model-supplied path inside the workspace and
+// applies the policy to both the lexical path and its symlink target, so a
+// link cannot be used to reach a protected file.
+func resolvePolicyPath(workspace string, policy PathPolicy, raw string, dir bool) (string, string, error) {
+	clean, full, err := resolveWorkspacePath(workspace, raw)
+	if err != nil {
+		return "", "", err
+	}
+	check := policy.Check
+	if dir {
+		check = policy.checkDeny
+	}
+	if err := check(filepath.ToSlash(clean)); err != nil {
+		return "", "", err
+	}
+	real, ok := resolveExistingPath(full)
+	if !ok {
+		return clean, full, nil
+	}
+	root, err := filepath.EvalSymlinks(workspace)
+	if err != nil {
+		return clean, full, nil
+	}
+	rel, err := filepath.Rel(root, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", "", fmt.Errorf("path %q resolves outside the workspace", clean)
+	}
+	if rel != clean {
+		if err := check(filepath.ToSlash(rel)); err != nil {
+			return "", "", err
+		}
+	}
+	return clean, full, nil
+}
+
+// resolveExistingPath evaluates symlinks for full or, for files not created
+// yet, for its nearest existing parent.
+func resolveExistingPath(full string) (string, bool) {
+	suffix := ""
+	for cur := full; ; {
+		if real, err := filepath.EvalSymlinks(cur); err == nil {
+			return filepath.Join(real, suffix), true
+		}
+		parent := filepath.Dir(cur)
+		if parent == cur {
+			return "", false
+		}
+		suffix = filepath.Join(filepath.Base(cur), suffix)
+		cur = parent
+	}
+}
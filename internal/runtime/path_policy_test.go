@@ -0,0 +1,129 @@
+package runtime
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"deeph/internal/project"
+)
+
+func TestPathPolicyDefaultsAllowAndExemptions(t *testing.T) {
+	var zero PathPolicy
+	for _, rel := range []string{".git/config", ".env", "svc/.env.local", "deploy/tls.key", "home/.ssh/known_hosts", "id_ed25519.pub"} {
+		if zero.Allows(rel) {
+			t.Fatalf("expected default policy to deny %q", rel)
+		}
+	}
+	for _, rel := range []string{"main.go", "docs/env.md", ".github/workflows/ci.yml", "keys.go"} {
+		if err := zero.Check(rel); err != nil {
+			t.Fatalf("expected default policy to allow %q: %v", rel, err)
+		}
+	}
+
+	agent := project.AgentConfig{
+		AllowPaths: []string{"internal/**", "README.md", ".env.example"},
+		DenyPaths:  []string{"internal/secret", "!.env.example"},
+		WritePaths: []string{"internal/runtime/**"},
+	}
+	read := newPathPolicy(agent, project.SkillConfig{Type: "file_read"})
+	write := newPathPolicy(agent, project.SkillConfig{Type: "file_write_safe", DenyPaths: []string{"*_test.go"}})
+
+	cases := []struct {
+		policy PathPolicy
+		rel    string
+		want   string
+	}{
+		{read, "internal/project/types.go", ""},
+		{read, "README.md", ""},
+		{read, ".env.example", ""},
+		{read, "cmd/deeph/main.go", "outside allow_paths"},
+		{read, "internal/secret/token.txt", "denied by deny_paths"},
+		{read, "internal/.env", "protected by default"},
+		{write, "internal/runtime/engine.go", ""},
+		{write, "internal/project/types.go", "outside allow_paths"},
+		{write, "internal/runtime/engine_test.go", "denied by deny_paths (*_test.go)"},
+	}
+	for _, tc := range cases {
+		err := tc.policy.Check(tc.rel)
+		if tc.want == "" && err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.rel, err)
+		}
+		if tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+			t.Fatalf("%s: expected error containing %q, got %v", tc.rel, tc.want, err)
+		}
+	}
+	if read.Key() == write.Key() || zero.Key() != "" {
+		t.Fatalf("expected distinct cache scopes, got read=%q write=%q zero=%q", read.Key(), write.Key(), zero.Key())
+	}
+}
+
+func TestFileSkillsEnforcePathPolicy(t *testing.T) {
+	ws := t.TempDir()
+	mustWrite := func(rel, content string) {
+		t.Helper()
+		full := filepath.Join(ws, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustWrite(".env", "TOKEN=needle\n")
+	mustWrite("app/main.go", "package main // needle\n")
+	mustWrite("docs/notes.md", "needle\n")
+	if err := os.Symlink(filepath.Join(ws, ".env"), filepath.Join(ws, "app", "env.txt")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	p := &project.Project{
+		Root: project.RootConfig{Providers: []project.ProviderConfig{{Name: "local", Type: "mock"}}},
+		Skills: []project.SkillConfig{
+			{Name: "read", Type: "file_read"},
+			{Name: "write", Type: "file_write_safe"},
+			{Name: "search", Type: "code_search"},
+		},
+		Agents: []project.AgentConfig{{Name: "coder", Provider: "local", Skills: []string{"read", "write", "search"}, AllowPaths: []string{"app/**", ".env"}, DenyPaths: []string{"!.env"}, WritePaths: []string{"app/gen/**"}}},
+	}
+	eng, err := New(ws, p)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	defer eng.Close()
+	agent := p.Agents[0]
+	call := func(skill string, args map[string]any) (map[string]any, error) {
+		out, _, _, err := eng.executeSkillWithBroker(context.Background(), newToolBroker(), agent, skill, "", args)
+		return out, err
+	}
+
+	if _, err := call("read", map[string]any{"path": "app/main.go"}); err != nil {
+		t.Fatalf("expected allowed read, got %v", err)
+	}
+	if _, err := call("read", map[string]any{"path": "docs/notes.md"}); err == nil || !strings.Contains(err.Error(), "outside allow_paths") {
+		t.Fatalf("expected docs read to be denied, got %v", err)
+	}
+	if _, err := call("read", map[string]any{"path": ".env"}); err != nil {
+		t.Fatalf("expected exempted .env read, got %v", err)
+	}
+	if _, err := call("write", map[string]any{"path": "app/main.go", "content": "x", "overwrite": true}); err == nil || !strings.Contains(err.Error(), "outside allow_paths") {
+		t.Fatalf("expected write outside write_paths to be denied, got %v", err)
+	}
+	if _, err := call("write", map[string]any{"path": "app/gen/out.go", "content": "package gen\n"}); err != nil {
+		t.Fatalf("expected write inside write_paths, got %v", err)
+	}
+	out, err := call("search", map[string]any{"pattern": "needle"})
+	if err != nil {
+		t.Fatalf("code_search error: %v", err)
+	}
+	if text := anyString(out["text"]); strings.Contains(text, "docs/notes.md") || !strings.Contains(text, "app/main.go") {
+		t.Fatalf("expected search results filtered by allow_paths, got:\n%s", text)
+	}
+
+	strict := project.AgentConfig{Name: "reviewer", AllowPaths: []string{"app/**"}}
+	if _, _, _, err := eng.executeSkillWithBroker(context.Background(), newToolBroker(), strict, "read", "", map[string]any{"path": "app/env.txt"}); err == nil || !strings.Contains(err.Error(), "protected by default") {
+		t.Fatalf("expected symlink to .env to be denied, got %v", err)
+	}
+}
@@ -0,0 +1,275 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"deeph/internal/jsonschema"
+	"deeph/internal/project"
+)
+
+const (
+	// PluginProtocolVersion is sent with describe so plugins can reject clients they do not understand.
+	PluginProtocolVersion = "deeph-plugin/1"
+	defaultPluginTimeout  = 30 * time.Second
+	maxPluginProgress     = 20
+)
+
+// PluginDescription is the reply to the describe call.
+type PluginDescription struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Version     string         `json:"version,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+// PluginSkill runs a standalone executable that speaks newline-delimited
+// JSON-RPC 2.0 over stdio:
+//
+//	describe {protocol}                          -> PluginDescription
+//	execute  {agent, input, args, progress_token} -> result object
+//	progress {progress_token, message} (notification, optional, during execute)
+//
+// The process is started on first use and kept warm for the lifetime of the
+// Engine, which spans every turn of a chat session rather than a single run;
+// if it exits it is restarted on the next call.
+type PluginSkill struct {
+	cfg       project.SkillConfig
+	workspace string
+
+	mu        sync.Mutex
+	transport *mcpStdioTransport
+	desc      *PluginDescription
+
+	nextToken  atomic.Int64
+	progressMu sync.Mutex
+	progress   map[string][]string
+}
+
+func (s *PluginSkill) Name() string { return s.cfg.Name }
+func (s *PluginSkill) Description() string {
+	return coalesce(s.cfg.Description, "External process skill plugin")
+}
+
+// Describe returns the plugin's self-description, starting the process if needed.
+func (s *PluginSkill) Describe(ctx context.Context) (PluginDescription, error) {
+	if _, err := s.connect(ctx); err != nil {
+		return PluginDescription{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.desc == nil {
+		return PluginDescription{}, fmt.Errorf("plugin %s: not described", s.cfg.Name)
+	}
+	return *s.desc, nil
+}
+
+func (s *PluginSkill) Execute(ctx context.Context, exec SkillExecution) (map[string]any, error) {
+	desc, err := s.Describe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	args := exec.Args
+	if args == nil {
+		args = map[string]any{}
+	}
+	// A skill-level args_schema is enforced by the Engine; otherwise hold the
+	// model to the schema the plugin advertised.
+	if len(s.cfg.ArgsSchema) == 0 && len(desc.Parameters) > 0 && len(jsonschema.Check(desc.Parameters)) == 0 {
+		if violations := jsonschema.Validate(desc.Parameters, args); len(violations) > 0 {
+			msgs := make([]string, 0, len(violations))
+			for _, v := range violations {
+				msgs = append(msgs, v.String())
+			}
+			return nil, fmt.Errorf("invalid arguments for %s: %s", s.cfg.Name, strings.Join(msgs, "; "))
+		}
+	}
+
+	transport, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token := s.cfg.Name + "-" + strconv.FormatInt(s.nextToken.Add(1), 10)
+	s.progressMu.Lock()
+	if s.progress == nil {
+		s.progress = map[string][]string{}
+	}
+	s.progress[token] = nil
+	s.progressMu.Unlock()
+	defer func() {
+		s.progressMu.Lock()
+		delete(s.progress, token)
+		s.progressMu.Unlock()
+	}()
+
+	callCtx, cancel := context.WithTimeout(ctx, s.timeout())
+	defer cancel()
+	raw, err := transport.call(callCtx, "execute", map[string]any{
+		"agent":          exec.AgentName,
+		"input":          exec.Input,
+		"args":           args,
+		"progress_token": token,
+	})
+	progress := s.takeProgress(token)
+	if err != nil {
+		s.resetIfExited(transport)
+		if len(progress) > 0 {
+			return nil, fmt.Errorf("plugin %s: %w (last progress: %s)", s.cfg.Name, err, progress[len(progress)-1])
+		}
+		return nil, fmt.Errorf("plugin %s: %w", s.cfg.Name, err)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(raw, &out); err != nil || out == nil {
+		return nil, fmt.Errorf("plugin %s: execute must return a JSON object", s.cfg.Name)
+	}
+	out["plugin"] = desc.Name
+	if len(progress) > 0 {
+		out["progress"] = progress
+	}
+	return out, nil
+}
+
+// Close stops the plugin process.
+func (s *PluginSkill) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transport == nil {
+		return nil
+	}
+	err := s.transport.close()
+	s.transport = nil
+	s.desc = nil
+	return err
+}
+
+func (s *PluginSkill) timeout() time.Duration {
+	if s.cfg.TimeoutMS > 0 {
+		return time.Duration(s.cfg.TimeoutMS) * time.Millisecond
+	}
+	return defaultPluginTimeout
+}
+
+func (s *PluginSkill) connect(ctx context.Context) (*mcpStdioTransport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transport != nil {
+		select {
+		case <-s.transport.done:
+			// The process died since the last call; start a fresh one.
+			_ = s.transport.close()
+			s.transport, s.desc = nil, nil
+		default:
+			return s.transport, nil
+		}
+	}
+	argv, err := pluginCommand(s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := startMCPStdioTransport(argv, s.workspace, commandExecEnv(s.cfg), s.recordProgress)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: start: %w", s.cfg.Name, err)
+	}
+	descCtx, cancel := context.WithTimeout(ctx, s.timeout())
+	defer cancel()
+	desc, err := describePlugin(descCtx, transport)
+	if err != nil {
+		_ = transport.close()
+		return nil, fmt.Errorf("plugin %s: %w", s.cfg.Name, err)
+	}
+	s.transport, s.desc = transport, &desc
+	return transport, nil
+}
+
+func (s *PluginSkill) resetIfExited(t *mcpStdioTransport) {
+	select {
+	case <-t.done:
+	default:
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transport == t {
+		_ = t.close()
+		s.transport, s.desc = nil, nil
+	}
+}
+
+func (s *PluginSkill) recordProgress(msg mcpMessage) {
+	if msg.Method != "progress" {
+		return
+	}
+	var p struct {
+		Token   string `json:"progress_token"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(msg.Params, &p) != nil || strings.TrimSpace(p.Message) == "" {
+		return
+	}
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+	lines, ok := s.progress[p.Token]
+	if !ok {
+		return
+	}
+	lines = append(lines, trim(strings.TrimSpace(p.Message), 200))
+	if len(lines) > maxPluginProgress {
+		lines = lines[len(lines)-maxPluginProgress:]
+	}
+	s.progress[p.Token] = lines
+}
+
+func (s *PluginSkill) takeProgress(token string) []string {
+	s.progressMu.Lock()
+	defer s.progressMu.Unlock()
+	return s.progress[token]
+}
+
+func pluginCommand(cfg project.SkillConfig) ([]string, error) {
+	argv := stringListParam(cfg.Params, "command")
+	if raw, ok := cfg.Params["command"].(string); ok {
+		var err error
+		if argv, err = splitCommandLine(raw); err != nil {
+			return nil, err
+		}
+	}
+	argv = append(argv, stringListParam(cfg.Params, "args")...)
+	if len(argv) == 0 || strings.TrimSpace(argv[0]) == "" {
+		return nil, fmt.Errorf("plugin skill %q requires params.command", cfg.Name)
+	}
+	return argv, nil
+}
+
+func describePlugin(ctx context.Context, t *mcpStdioTransport) (PluginDescription, error) {
+	raw, err := t.call(ctx, "describe", map[string]any{"protocol": PluginProtocolVersion})
+	if err != nil {
+		return PluginDescription{}, fmt.Errorf("describe: %w", err)
+	}
+	var desc PluginDescription
+	if err := json.Unmarshal(raw, &desc); err != nil {
+		return PluginDescription{}, fmt.Errorf("describe: decode: %w", err)
+	}
+	if strings.TrimSpace(desc.Name) == "" {
+		return PluginDescription{}, fmt.Errorf("describe: plugin returned no name")
+	}
+	return desc, nil
+}
+
+// DescribePlugin starts argv in dir with the same scrubbed environment as the
+// skill (plus envAllow), performs the describe handshake and stops it again.
+// `deeph skill add` uses it to validate a plugin before installing.
+func DescribePlugin(ctx context.Context, dir string, argv, envAllow []string) (PluginDescription, error) {
+	cfg := project.SkillConfig{Name: "plugin", Type: "plugin", Params: map[string]any{"command": argv, "env_allow": envAllow}}
+	t, err := startMCPStdioTransport(argv, dir, commandExecEnv(cfg), nil)
+	if err != nil {
+		return PluginDescription{}, err
+	}
+	defer t.close()
+	return describePlugin(ctx, t)
+}
@@ -0,0 +1,144 @@
+package runtime
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"deeph/internal/project"
+)
+
+// TestPluginStubProcess is not a real test: when DEEPH_PLUGIN_STUB=1 the test
+// binary acts as a deeph plugin. "echo" returns its args with progress
+// notifications, "fail" returns a JSON-RPC error and "crash" exits mid-call.
+func TestPluginStubProcess(t *testing.T) {
+	if os.Getenv("DEEPH_PLUGIN_STUB") != "1" {
+		t.Skip("helper process")
+	}
+	sc := bufio.NewScanner(os.Stdin)
+	send := func(v map[string]any) {
+		b, _ := json.Marshal(v)
+		fmt.Fprintln(os.Stdout, string(b))
+	}
+	for sc.Scan() {
+		var msg mcpMessage
+		if err := json.Unmarshal(sc.Bytes(), &msg); err != nil || len(msg.ID) == 0 {
+			continue
+		}
+		switch msg.Method {
+		case "describe":
+			send(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": map[string]any{
+				"name":        "stub",
+				"description": "Stub plugin",
+				"version":     "1.0.0",
+				"parameters": map[string]any{
+					"type":       "object",
+					"properties": map[string]any{"mode": map[string]any{"type": "string", "enum": []any{"echo", "fail", "crash"}}},
+					"required":   []any{"mode"},
+				},
+			}})
+		case "execute":
+			var params struct {
+				Agent string         `json:"agent"`
+				Args  map[string]any `json:"args"`
+				Token string         `json:"progress_token"`
+			}
+			_ = json.Unmarshal(msg.Params, &params)
+			switch params.Args["mode"] {
+			case "crash":
+				os.Exit(3)
+			case "fail":
+				send(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "error": map[string]any{"code": 1, "message": "upstream unavailable"}})
+			default:
+				for i := 1; i <= 2; i++ {
+					send(map[string]any{"jsonrpc": "2.0", "method": "progress", "params": map[string]any{"progress_token": params.Token, "message": fmt.Sprintf("step %d", i)}})
+				}
+				send(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": map[string]any{"agent": params.Agent, "pid": os.Getpid()}})
+			}
+		}
+	}
+	os.Exit(0)
+}
+
+func newStubPluginSkill(t *testing.T) *PluginSkill {
+	t.Helper()
+	return &PluginSkill{
+		cfg: project.SkillConfig{
+			Name: "stub",
+			Type: "plugin",
+			Params: map[string]any{
+				"command": []any{os.Args[0], "-test.run=^TestPluginStubProcess$"},
+				"env":     map[string]any{"DEEPH_PLUGIN_STUB": "1"},
+			},
+		},
+		workspace: t.TempDir(),
+	}
+}
+
+func TestPluginSkillExecutesAndStaysWarm(t *testing.T) {
+	s := newStubPluginSkill(t)
+	defer s.Close()
+
+	out, err := s.Execute(context.Background(), SkillExecution{AgentName: "coder", Args: map[string]any{"mode": "echo"}})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if out["agent"] != "coder" || out["plugin"] != "stub" {
+		t.Fatalf("unexpected result: %#v", out)
+	}
+	if progress, _ := out["progress"].([]string); strings.Join(progress, ",") != "step 1,step 2" {
+		t.Fatalf("expected streamed progress, got %#v", out["progress"])
+	}
+	again, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"mode": "echo"}})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if again["pid"] != out["pid"] {
+		t.Fatalf("expected the plugin process to be reused, pids %v and %v", out["pid"], again["pid"])
+	}
+
+	if _, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"mode": "fail"}}); err == nil || !strings.Contains(err.Error(), "upstream unavailable") {
+		t.Fatalf("expected plugin error to surface, got %v", err)
+	}
+	if _, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"mode": "other"}}); err == nil || !strings.Contains(err.Error(), "must be one of") {
+		t.Fatalf("expected described schema to be enforced, got %v", err)
+	}
+	if _, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"mode": "crash"}}); err == nil {
+		t.Fatalf("expected crash to surface as an error")
+	}
+	restarted, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"mode": "echo"}})
+	if err != nil {
+		t.Fatalf("expected plugin to restart after crash: %v", err)
+	}
+	if restarted["pid"] == out["pid"] {
+		t.Fatalf("expected a new plugin process after crash")
+	}
+}
+
+func TestEngineAdvertisesPluginDescribedSchema(t *testing.T) {
+	stub := newStubPluginSkill(t)
+	p := &project.Project{
+		Root:   project.RootConfig{Providers: []project.ProviderConfig{{Name: "local", Type: "mock"}}},
+		Skills: []project.SkillConfig{stub.cfg},
+		Agents: []project.AgentConfig{{Name: "a1", Provider: "local", Skills: []string{"stub"}}},
+	}
+	eng, err := New(t.TempDir(), p)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	defer eng.Close()
+	defs, err := eng.buildToolDefinitions(context.Background(), []string{"stub"})
+	if err != nil {
+		t.Fatalf("buildToolDefinitions error: %v", err)
+	}
+	if len(defs) != 1 || defs[0].Description != "Stub plugin" {
+		t.Fatalf("unexpected definitions: %+v", defs)
+	}
+	if props, _ := defs[0].Parameters["properties"].(map[string]any); props["mode"] == nil {
+		t.Fatalf("expected described parameters, got %#v", defs[0].Parameters)
+	}
+}
@@ -0,0 +1,247 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"deeph/internal/typesys"
+)
+
+// ProjectMemoryVersion is the format version of .deeph/memory.json.
+const ProjectMemoryVersion = 1
+
+// MaxProjectMemoryEntries caps the store; beyond it the weakest agent-written
+// entries are evicted.
+const MaxProjectMemoryEntries = 200
+
+// MaxProjectMemoryFacts is how many entries seed a run's context.
+const MaxProjectMemoryFacts = 24
+
+// ProjectMemorySourceUser marks entries added with `deeph memory add`. Agent
+// entries use "agent:<name>" and never overwrite user entries.
+const ProjectMemorySourceUser = "user"
+
+// ProjectMemoryEntry is one long-lived fact about the workspace (build
+// commands, conventions, architecture decisions).
+type ProjectMemoryEntry struct {
+	Key        string    `json:"key"`
+	Value      string    `json:"value"`
+	Kind       string    `json:"kind"`
+	Confidence float64   `json:"confidence"`
+	Source     string    `json:"source"`
+	Evidence   string    `json:"evidence,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type projectMemoryFile struct {
+	Version int                  `json:"version"`
+	Entries []ProjectMemoryEntry `json:"entries"`
+}
+
+// projectMemoryMu serializes read-modify-write cycles on memory files; agents
+// of one run may write concurrently.
+var projectMemoryMu sync.Mutex
+
+// ProjectMemoryPath is where a workspace's project memory lives.
+func ProjectMemoryPath(workspace string) string {
+	return filepath.Join(workspace, ".deeph", "memory.json")
+}
+
+// NormalizeProjectMemoryKey lowercases key and checks it only uses
+// letters, digits, '.', '_' and '-'.
+func NormalizeProjectMemoryKey(key string) (string, error) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if key == "" {
+		return "", fmt.Errorf("memory key is required")
+	}
+	if len(key) > 80 {
+		return "", fmt.Errorf("memory key %q is longer than 80 characters", key)
+	}
+	for _, r := range key {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '.' && r != '_' && r != '-' {
+			return "", fmt.Errorf("memory key %q may only use letters, digits, '.', '_' and '-'", key)
+		}
+	}
+	return key, nil
+}
+
+// LoadProjectMemory returns the workspace's entries sorted by key.
+func LoadProjectMemory(workspace string) ([]ProjectMemoryEntry, error) {
+	projectMemoryMu.Lock()
+	defer projectMemoryMu.Unlock()
+	return loadProjectMemoryLocked(workspace)
+}
+
+func loadProjectMemoryLocked(workspace string) ([]ProjectMemoryEntry, error) {
+	b, err := os.ReadFile(ProjectMemoryPath(workspace))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var file projectMemoryFile
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", ProjectMemoryPath(workspace), err)
+	}
+	if file.Version > ProjectMemoryVersion {
+		return nil, fmt.Errorf("%s has version %d; this deeph reads up to %d", ProjectMemoryPath(workspace), file.Version, ProjectMemoryVersion)
+	}
+	sort.Slice(file.Entries, func(i, j int) bool { return file.Entries[i].Key < file.Entries[j].Key })
+	return file.Entries, nil
+}
+
+func saveProjectMemoryLocked(workspace string, entries []ProjectMemoryEntry) error {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	b, err := json.MarshalIndent(projectMemoryFile{Version: ProjectMemoryVersion, Entries: entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := ProjectMemoryPath(workspace)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, append(b, '\n'), 0o644)
+}
+
+// PutProjectMemory adds or replaces the entry with the same key and returns
+// the stored entry. Agent writes cannot replace a user entry.
+func PutProjectMemory(workspace string, entry ProjectMemoryEntry, now time.Time) (ProjectMemoryEntry, error) {
+	key, err := NormalizeProjectMemoryKey(entry.Key)
+	if err != nil {
+		return ProjectMemoryEntry{}, err
+	}
+	entry.Key = key
+	entry.Value = strings.TrimSpace(entry.Value)
+	if entry.Value == "" {
+		return ProjectMemoryEntry{}, fmt.Errorf("memory %q requires a value", key)
+	}
+	if len(entry.Value) > 1000 {
+		return ProjectMemoryEntry{}, fmt.Errorf("memory %q value is longer than 1000 characters; store a summary", key)
+	}
+	entry.Kind = string(typesys.KindMemoryFact)
+	if entry.Confidence <= 0 {
+		entry.Confidence = 0.8
+	}
+	entry.Confidence = clamp01(entry.Confidence)
+	entry.Source = coalesce(strings.TrimSpace(entry.Source), ProjectMemorySourceUser)
+	entry.Evidence = trim(strings.TrimSpace(entry.Evidence), 240)
+	entry.CreatedAt, entry.UpdatedAt = now, now
+
+	projectMemoryMu.Lock()
+	defer projectMemoryMu.Unlock()
+	entries, err := loadProjectMemoryLocked(workspace)
+	if err != nil {
+		return ProjectMemoryEntry{}, err
+	}
+	replaced := false
+	for i, old := range entries {
+		if old.Key != key {
+			continue
+		}
+		if old.Source == ProjectMemorySourceUser && entry.Source != ProjectMemorySourceUser {
+			return ProjectMemoryEntry{}, fmt.Errorf("memory %q was set by the user; agents cannot overwrite it", key)
+		}
+		entry.CreatedAt = old.CreatedAt
+		entries[i] = entry
+		replaced = true
+	}
+	if !replaced {
+		entries = append(entries, entry)
+	}
+	entries = evictProjectMemory(entries)
+	if err := saveProjectMemoryLocked(workspace, entries); err != nil {
+		return ProjectMemoryEntry{}, err
+	}
+	return entry, nil
+}
+
+// evictProjectMemory drops the lowest-confidence, oldest agent entries until
+// the store fits MaxProjectMemoryEntries. User entries are never evicted.
+func evictProjectMemory(entries []ProjectMemoryEntry) []ProjectMemoryEntry {
+	if len(entries) <= MaxProjectMemoryEntries {
+		return entries
+	}
+	var agent []int
+	for i, e := range entries {
+		if e.Source != ProjectMemorySourceUser {
+			agent = append(agent, i)
+		}
+	}
+	sort.Slice(agent, func(i, j int) bool {
+		a, b := entries[agent[i]], entries[agent[j]]
+		if a.Confidence != b.Confidence {
+			return a.Confidence < b.Confidence
+		}
+		return a.UpdatedAt.Before(b.UpdatedAt)
+	})
+	drop := map[int]bool{}
+	for _, i := range agent {
+		if len(entries)-len(drop) <= MaxProjectMemoryEntries {
+			break
+		}
+		drop[i] = true
+	}
+	kept := entries[:0]
+	for i, e := range entries {
+		if !drop[i] {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// RemoveProjectMemory deletes every entry match reports and returns them.
+func RemoveProjectMemory(workspace string, match func(ProjectMemoryEntry) bool) ([]ProjectMemoryEntry, error) {
+	projectMemoryMu.Lock()
+	defer projectMemoryMu.Unlock()
+	entries, err := loadProjectMemoryLocked(workspace)
+	if err != nil {
+		return nil, err
+	}
+	var removed []ProjectMemoryEntry
+	kept := entries[:0]
+	for _, e := range entries {
+		if match(e) {
+			removed = append(removed, e)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	return removed, saveProjectMemoryLocked(workspace, kept)
+}
+
+// seedProjectMemory surfaces the strongest project memory entries as
+// memory.<key> facts at the discovery moment. A broken memory file does not
+// fail the run.
+func (e *Engine) seedProjectMemory(bus *ContextBus) {
+	if strings.TrimSpace(e.workspace) == "" {
+		return
+	}
+	entries, err := LoadProjectMemory(e.workspace)
+	if err != nil || len(entries) == 0 {
+		return
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Confidence != entries[j].Confidence {
+			return entries[i].Confidence > entries[j].Confidence
+		}
+		return entries[i].UpdatedAt.After(entries[j].UpdatedAt)
+	})
+	if len(entries) > MaxProjectMemoryFacts {
+		entries = entries[:MaxProjectMemoryFacts]
+	}
+	for _, m := range entries {
+		bus.PutTypedFact("memory."+m.Key, m.Value, typesys.KindMemoryFact, ContextMomentDiscovery, m.Confidence, "memory:"+m.Source)
+	}
+}
@@ -0,0 +1,71 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"deeph/internal/project"
+)
+
+func TestProjectMemoryPutProtectsUserEntriesAndRemoves(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	if _, err := PutProjectMemory(dir, ProjectMemoryEntry{Key: "Build.Command", Value: "make build", Source: ProjectMemorySourceUser}, now); err != nil {
+		t.Fatalf("PutProjectMemory error: %v", err)
+	}
+	if _, err := PutProjectMemory(dir, ProjectMemoryEntry{Key: "build.command", Value: "go build", Source: "agent:coder"}, now); err == nil {
+		t.Fatal("expected agent write over a user entry to fail")
+	}
+	if _, err := PutProjectMemory(dir, ProjectMemoryEntry{Key: "bad key", Value: "x"}, now); err == nil {
+		t.Fatal("expected invalid key to fail")
+	}
+	if _, err := PutProjectMemory(dir, ProjectMemoryEntry{Key: "convention.errors", Value: "wrap with %w", Confidence: 0.4, Source: "agent:coder"}, now); err != nil {
+		t.Fatalf("PutProjectMemory error: %v", err)
+	}
+	entries, err := LoadProjectMemory(dir)
+	if err != nil || len(entries) != 2 || entries[0].Key != "build.command" {
+		t.Fatalf("unexpected entries %+v err=%v", entries, err)
+	}
+	removed, err := RemoveProjectMemory(dir, func(e ProjectMemoryEntry) bool { return e.Confidence < 0.5 })
+	if err != nil || len(removed) != 1 || removed[0].Key != "convention.errors" {
+		t.Fatalf("unexpected removal %+v err=%v", removed, err)
+	}
+}
+
+func TestMemoryWriteSkillSeedsLaterRuns(t *testing.T) {
+	dir := t.TempDir()
+	skill := newSkill(dir, project.SkillConfig{Name: "memory_write", Type: "memory_write", Params: map[string]any{"max_confidence": 0.9}})
+	out, err := skill.Execute(context.Background(), SkillExecution{
+		AgentName: "coder",
+		Args:      map[string]any{"key": "build.command", "value": "make build token=abc", "evidence": "ran with token=abc", "confidence": 1.0},
+		Redact:    func(s string) string { return strings.ReplaceAll(s, "abc", "[redacted]") },
+	})
+	if err != nil {
+		t.Fatalf("memory_write error: %v", err)
+	}
+	if out["confidence"].(float64) != 0.9 || out["source"] != "agent:coder" {
+		t.Fatalf("unexpected memory_write result %+v", out)
+	}
+	if entries, err := LoadProjectMemory(dir); err != nil || len(entries) != 1 || entries[0].Evidence != "ran with token=[redacted]" {
+		t.Fatalf("expected redacted evidence on disk, got %+v err=%v", entries, err)
+	}
+
+	p := &project.Project{
+		Root:   project.RootConfig{Providers: []project.ProviderConfig{{Name: "local", Type: "mock"}}},
+		Agents: []project.AgentConfig{{Name: "planner", Provider: "local"}},
+	}
+	eng, err := New(dir, p)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	defer eng.Close()
+	report, err := eng.RunSpec(context.Background(), "planner", "plan the release")
+	if err != nil {
+		t.Fatalf("RunSpec error: %v", err)
+	}
+	if out := report.Results[0].Output; !strings.Contains(out, "memory.build.command=make build token=[redacted]") {
+		t.Fatalf("expected project memory in the agent context, got %q", out)
+	}
+}
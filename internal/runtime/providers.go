@@ -28,11 +28,16 @@ type MockProvider struct {
 	name     string
 	typeName string
 	model    string
+	// script, when set, answers requests by rule. Turns and times count per
+	// run (see withMockTurnScope); counts is used for calls outside a run.
+	script *MockScript
+	mu     sync.Mutex
+	counts *mockCounts
 }
 
 func (p *MockProvider) Name() string { return p.name }
 
-func (p *MockProvider) Generate(_ context.Context, req LLMRequest) (LLMResponse, error) {
+func (p *MockProvider) Generate(ctx context.Context, req LLMRequest) (LLMResponse, error) {
 	model := req.Model
 	if model == "" {
 		model = p.model
@@ -40,6 +45,11 @@ func (p *MockProvider) Generate(_ context.Context, req LLMRequest) (LLMResponse,
 	if model == "" {
 		model = "mock-small"
 	}
+	if p.script != nil {
+		if resp, ok, err := p.scripted(ctx, req, model); ok || err != nil {
+			return resp, err
+		}
+	}
 	parts := []string{
 		fmt.Sprintf("agent=%s", req.AgentName),
 		fmt.Sprintf("model=%s", model),
@@ -84,6 +94,9 @@ func (p *HTTPProvider) Generate(ctx context.Context, req LLMRequest) (LLMRespons
 		"available_skills": req.AvailableSkills,
 		"startup_results":  req.StartupResults,
 	}
+	if len(req.ResponseSchema) > 0 {
+		payload["response_schema"] = req.ResponseSchema
+	}
 	b, err := json.Marshal(payload)
 	if err != nil {
 		return LLMResponse{}, fmt.Errorf("marshal provider payload: %w", err)
@@ -259,6 +272,8 @@ func (p *DeepSeekProvider) deepSeekPayload(req LLMRequest, model string) (map[st
 		} else {
 			payload["tool_choice"] = "auto"
 		}
+	} else if len(req.ResponseSchema) > 0 {
+		payload["response_format"] = map[string]any{"type": "json_object"}
 	}
 	return payload, nil
 }
@@ -428,6 +443,9 @@ func (p *GRPCProvider) Generate(ctx context.Context, req LLMRequest) (LLMRespons
 		"tools":            req.Tools,
 		"tool_choice":      req.ToolChoice,
 	}
+	if len(req.ResponseSchema) > 0 {
+		payload["response_schema"] = req.ResponseSchema
+	}
 	normalizedPayload, err := normalizeGRPCPayload(payload)
 	if err != nil {
 		return LLMResponse{}, fmt.Errorf("marshal grpc provider payload: %w", err)
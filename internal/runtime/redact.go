@@ -0,0 +1,371 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"deeph/internal/project"
+)
+
+const (
+	minRedactedEnvValueLen  = 8
+	minHighEntropyTokenLen  = 32
+	minHighEntropyBitsPerCh = 4.2
+)
+
+type redactionRule struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// builtinRedactionRules match well-known credential formats. Rules with two
+// capture groups keep the first (e.g. "Bearer ", "API_TOKEN=") and redact the second.
+var builtinRedactionRules = []redactionRule{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY-----`)},
+	{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github_token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"slack_token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"google_api_key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{"stripe_key", regexp.MustCompile(`\b(?:sk|rk)_(?:live|test)_[A-Za-z0-9]{16,}`)},
+	{"api_key", regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{"bearer_token", regexp.MustCompile(`(?i)(\bbearer\s+)([A-Za-z0-9._~+/-]{16,}=*)`)},
+	{"secret_assignment", regexp.MustCompile(`(?m)^(\s*(?:export\s+)?[A-Z0-9_]*(?:SECRET|TOKEN|PASSWORD|PASSWD|API_KEY|APIKEY|ACCESS_KEY|PRIVATE_KEY)[A-Z0-9_]*\s*=\s*["']?)([^\s"'#]{6,})`)},
+}
+
+// heuristicRedactionRules guess from the variable name rather than the
+// value's format, so they are skipped for workspace file contents.
+var heuristicRedactionRules = map[string]bool{"secret_assignment": true}
+
+var (
+	highEntropyTokenPattern = regexp.MustCompile(`[A-Za-z0-9+/_=-]{32,}`)
+	secretEnvNamePattern    = regexp.MustCompile(`(?i)(KEY|TOKEN|SECRET|PASSWORD|PASSWD|CREDENTIAL)`)
+	redactionPlaceholder    = regexp.MustCompile(`\[redacted:[a-z0-9_:A-Z]+\]`)
+)
+
+// Redactor removes secrets from text before it reaches the ContextBus, traces,
+// chat sessions or the terminal: known credential formats, the values of
+// configured/secret-looking env vars and high-entropy tokens.
+type Redactor struct {
+	disabled bool
+	entropy  bool
+	rules    []redactionRule
+	env      []redactionEnvValue
+}
+
+type redactionEnvValue struct {
+	name  string
+	value string
+}
+
+// NewRedactor builds the redactor for a project. Env values are captured once,
+// so later changes to the process environment are not picked up.
+func NewRedactor(p *project.Project) *Redactor {
+	r := &Redactor{entropy: true, rules: append([]redactionRule(nil), builtinRedactionRules...)}
+	if p == nil {
+		r.env = collectRedactionEnv(nil)
+		return r
+	}
+	cfg := p.Root.Redaction
+	r.disabled = cfg.Disabled
+	if cfg.HighEntropy != nil {
+		r.entropy = *cfg.HighEntropy
+	}
+	for i, raw := range cfg.Patterns {
+		re, err := regexp.Compile(raw)
+		if err != nil {
+			// project.Validate reports invalid patterns; skip them here.
+			continue
+		}
+		r.rules = append(r.rules, redactionRule{name: "pattern_" + strconv.Itoa(i+1), re: re})
+	}
+	names := append([]string(nil), cfg.Env...)
+	for _, prov := range p.Root.Providers {
+		if prov.APIKeyEnv != "" {
+			names = append(names, prov.APIKeyEnv)
+		}
+	}
+	for _, sc := range p.Skills {
+		refs := []string{sc.URL}
+		for _, v := range sc.Headers {
+			refs = append(refs, v)
+		}
+		for _, ref := range refs {
+			for _, m := range envSecretPattern.FindAllStringSubmatch(ref, -1) {
+				names = append(names, m[1])
+			}
+		}
+	}
+	r.env = collectRedactionEnv(names)
+	return r
+}
+
+// collectRedactionEnv resolves the named env vars plus every variable whose
+// name looks like a credential. Longer values are replaced first.
+func collectRedactionEnv(names []string) []redactionEnvValue {
+	seen := map[string]bool{}
+	var out []redactionEnvValue
+	add := func(name, value string) {
+		value = strings.TrimSpace(value)
+		if name == "" || len(value) < minRedactedEnvValueLen || seen[name] {
+			return
+		}
+		seen[name] = true
+		out = append(out, redactionEnvValue{name: name, value: value})
+	}
+	for _, name := range names {
+		add(strings.TrimSpace(name), os.Getenv(strings.TrimSpace(name)))
+	}
+	for _, kv := range os.Environ() {
+		name, value, ok := strings.Cut(kv, "=")
+		if ok && secretEnvNamePattern.MatchString(name) {
+			add(name, value)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return len(out[i].value) > len(out[j].value) })
+	return out
+}
+
+// Redact returns s with secrets replaced by [redacted:<reason>] markers.
+func (r *Redactor) Redact(s string) string {
+	return r.redact(s, nil)
+}
+
+func (r *Redactor) redact(s string, tally *RedactionTally) string {
+	return r.scrub(s, tally, true)
+}
+
+// scrub applies env values and format rules; heuristics adds the assignment
+// rule and high-entropy tokens.
+func (r *Redactor) scrub(s string, tally *RedactionTally, heuristics bool) string {
+	if r == nil || r.disabled || strings.TrimSpace(s) == "" {
+		return s
+	}
+	for _, ev := range r.env {
+		if n := strings.Count(s, ev.value); n > 0 {
+			s = strings.ReplaceAll(s, ev.value, "[redacted:env:"+ev.name+"]")
+			tally.add("env", n)
+		}
+	}
+	for _, rule := range r.rules {
+		if heuristicRedactionRules[rule.name] && !heuristics {
+			continue
+		}
+		marker := "[redacted:" + rule.name + "]"
+		keepPrefix := rule.re.NumSubexp() >= 2
+		s = rule.re.ReplaceAllStringFunc(s, func(m string) string {
+			if redactionPlaceholder.MatchString(m) {
+				return m
+			}
+			tally.add(rule.name, 1)
+			if keepPrefix {
+				sub := rule.re.FindStringSubmatch(m)
+				return sub[1] + marker
+			}
+			return marker
+		})
+	}
+	if r.entropy && heuristics {
+		s = replaceHighEntropyTokens(s, tally)
+	}
+	return s
+}
+
+func replaceHighEntropyTokens(s string, tally *RedactionTally) string {
+	locs := highEntropyTokenPattern.FindAllStringIndex(s, -1)
+	if len(locs) == 0 {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range locs {
+		tok := s[loc[0]:loc[1]]
+		if !looksLikeSecretToken(tok) || isChecksumToken(s[:loc[0]], tok) {
+			continue
+		}
+		b.WriteString(s[last:loc[0]])
+		b.WriteString("[redacted:high_entropy]")
+		last = loc[1]
+		tally.add("high_entropy", 1)
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// looksLikeSecretToken requires mixed case, digits and high per-character
+// entropy, which rules out hex digests, UUIDs, identifiers and paths.
+func looksLikeSecretToken(tok string) bool {
+	if len(tok) < minHighEntropyTokenLen {
+		return false
+	}
+	var upper, lower, digit bool
+	freq := map[rune]int{}
+	for _, c := range tok {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+		freq[c]++
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+	entropy := 0.0
+	n := float64(len(tok))
+	for _, count := range freq {
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= minHighEntropyBitsPerCh
+}
+
+// isChecksumToken skips module/package integrity hashes (go.sum "h1:", npm
+// "sha512-"), which are public and would otherwise look like secrets.
+func isChecksumToken(before, tok string) bool {
+	if strings.HasSuffix(before, "h1:") {
+		return true
+	}
+	for _, prefix := range []string{"sha1-", "sha256-", "sha384-", "sha512-"} {
+		if strings.HasPrefix(tok, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValue walks decoded JSON-like values (skill results) and redacts strings.
+func (r *Redactor) redactValue(v any, tally *RedactionTally, heuristics bool) any {
+	switch x := v.(type) {
+	case string:
+		return r.scrub(x, tally, heuristics)
+	case map[string]any:
+		out := make(map[string]any, len(x))
+		for k, val := range x {
+			out[k] = r.redactValue(val, tally, heuristics)
+		}
+		return out
+	case []any:
+		out := make([]any, len(x))
+		for i, val := range x {
+			out[i] = r.redactValue(val, tally, heuristics)
+		}
+		return out
+	case []string:
+		out := make([]string, len(x))
+		for i, val := range x {
+			out[i] = r.scrub(val, tally, heuristics)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func (r *Redactor) redactMap(m map[string]any, tally *RedactionTally) map[string]any {
+	if r == nil || r.disabled || m == nil {
+		return m
+	}
+	out, _ := r.redactValue(m, tally, true).(map[string]any)
+	return out
+}
+
+// redactContentMap scrubs results that carry workspace file contents. Only
+// env values and known credential formats are replaced: the assignment and
+// entropy heuristics would rewrite code such as MAX_TOKEN_LENGTH = 4096000,
+// which then gets written back by an edit.
+func (r *Redactor) redactContentMap(m map[string]any, tally *RedactionTally) map[string]any {
+	if r == nil || r.disabled || m == nil {
+		return m
+	}
+	out, _ := r.redactValue(m, tally, false).(map[string]any)
+	return out
+}
+
+func (r *Redactor) redactError(err error, tally *RedactionTally) error {
+	if err == nil || r == nil || r.disabled {
+		return err
+	}
+	msg := r.redact(err.Error(), tally)
+	if msg == err.Error() {
+		return err
+	}
+	return errors.New(msg)
+}
+
+// RedactionTally counts redactions by reason for one run.
+type RedactionTally struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (t *RedactionTally) add(reason string, n int) {
+	if t == nil || n <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.counts == nil {
+		t.counts = map[string]int{}
+	}
+	t.counts[reason] += n
+}
+
+// Counts returns a copy of the per-reason counts, or nil when nothing was redacted.
+func (t *RedactionTally) Counts() map[string]int {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.counts) == 0 {
+		return nil
+	}
+	out := make(map[string]int, len(t.counts))
+	for k, v := range t.counts {
+		out[k] = v
+	}
+	return out
+}
+
+type redactionTallyKey struct{}
+
+func withRedactionTally(ctx context.Context, t *RedactionTally) context.Context {
+	return context.WithValue(ctx, redactionTallyKey{}, t)
+}
+
+func redactionTallyFrom(ctx context.Context) *RedactionTally {
+	t, _ := ctx.Value(redactionTallyKey{}).(*RedactionTally)
+	return t
+}
+
+// Redactor returns the engine's redactor so callers can scrub text they
+// persist or print themselves (chat sessions, reports).
+func (e *Engine) Redactor() *Redactor {
+	if e == nil {
+		return nil
+	}
+	return e.redactor
+}
+
+// RedactionTotal sums per-reason redaction counts.
+func RedactionTotal(counts map[string]int) int {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
@@ -0,0 +1,285 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"deeph/internal/project"
+	"deeph/internal/typesys"
+)
+
+const (
+	defaultRepoMapMaxDepth     = 4
+	defaultRepoMapMaxEntries   = 300
+	defaultRepoMapMaxChars     = 12000
+	defaultRepoMapOutlineFiles = 40
+	maxRepoMapScannedFiles     = 20000
+	maxRepoMapOutlineBytes     = 256 * 1024
+)
+
+type RepoMapSkill struct {
+	cfg       project.SkillConfig
+	workspace string
+}
+
+type repoMapFile struct {
+	Path     string `json:"path"`
+	Language string `json:"language,omitempty"`
+	Bytes    int64  `json:"bytes"`
+	Outline  string `json:"outline,omitempty"`
+}
+
+type repoMapDir struct {
+	name  string
+	dirs  map[string]*repoMapDir
+	files []repoMapFile
+	count int
+	bytes int64
+}
+
+func (s *RepoMapSkill) Name() string { return s.cfg.Name }
+func (s *RepoMapSkill) Description() string {
+	return coalesce(s.cfg.Description, "Lists the workspace as a budgeted tree with languages, sizes and code outlines")
+}
+func (s *RepoMapSkill) Execute(ctx context.Context, exec SkillExecution) (map[string]any, error) {
+	root := "."
+	if raw := strings.TrimSpace(anyString(exec.Args["path"])); raw != "" {
+		clean, full, err := resolvePolicyPath(s.workspace, exec.Paths, raw, true)
+		if err != nil {
+			return nil, err
+		}
+		st, err := os.Stat(full)
+		if err != nil {
+			return nil, err
+		}
+		if !st.IsDir() {
+			return nil, fmt.Errorf("path %q is not a directory", clean)
+		}
+		root = clean
+	}
+	maxDepth := repoMapLimit(s.cfg.Params, exec.Args, "max_depth", defaultRepoMapMaxDepth)
+	maxEntries := repoMapLimit(s.cfg.Params, exec.Args, "max_entries", defaultRepoMapMaxEntries)
+	maxChars := repoMapLimit(s.cfg.Params, exec.Args, "max_chars", defaultRepoMapMaxChars)
+	outlineFiles := repoMapLimit(s.cfg.Params, exec.Args, "outline_files", defaultRepoMapOutlineFiles)
+	if v, ok := boolArg(exec.Args, "outline"); ok && !v {
+		outlineFiles = 0
+	}
+
+	tree := &repoMapDir{name: filepath.ToSlash(root)}
+	scanned := 0
+	scanTruncated := false
+	prefix := ""
+	if root != "." {
+		prefix = filepath.ToSlash(root) + "/"
+	}
+	err := walkWorkspaceFiles(s.workspace, root, func(rel string, d fs.DirEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !exec.Paths.Allows(rel) {
+			return nil
+		}
+		if scanned >= maxRepoMapScannedFiles {
+			scanTruncated = true
+			return fs.SkipAll
+		}
+		scanned++
+		var size int64
+		if info, err := d.Info(); err == nil {
+			size = info.Size()
+		}
+		tree.add(strings.TrimPrefix(rel, prefix), repoMapFile{Path: rel, Language: repoMapLanguage(rel), Bytes: size})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r := &repoMapRenderer{
+		workspace:    s.workspace,
+		maxDepth:     maxDepth,
+		maxEntries:   maxEntries,
+		maxChars:     maxChars,
+		outlineFiles: outlineFiles,
+	}
+	r.writeLine(fmt.Sprintf("%s/ (%d files, %s)", tree.name, tree.count, formatRepoMapBytes(tree.bytes)))
+	r.renderDir(tree, 1)
+	return map[string]any{
+		"root":          filepath.ToSlash(root),
+		"file_count":    tree.count,
+		"total_bytes":   tree.bytes,
+		"files":         r.files,
+		"entries":       r.entries,
+		"omitted":       r.omitted,
+		"truncated":     scanTruncated || r.omitted > 0,
+		"text":          strings.TrimRight(r.out.String(), "\n"),
+		"detected_kind": typesys.KindToolResult.String(),
+	}, nil
+}
+
+func (d *repoMapDir) add(rel string, f repoMapFile) {
+	cur := d
+	cur.count++
+	cur.bytes += f.Bytes
+	parts := strings.Split(rel, "/")
+	for _, part := range parts[:len(parts)-1] {
+		if cur.dirs == nil {
+			cur.dirs = map[string]*repoMapDir{}
+		}
+		next := cur.dirs[part]
+		if next == nil {
+			next = &repoMapDir{name: part}
+			cur.dirs[part] = next
+		}
+		next.count++
+		next.bytes += f.Bytes
+		cur = next
+	}
+	cur.files = append(cur.files, f)
+}
+
+type repoMapRenderer struct {
+	workspace    string
+	maxDepth     int
+	maxEntries   int
+	maxChars     int
+	outlineFiles int
+	outlined     int
+	entries      int
+	omitted      int
+	files        []repoMapFile
+	out          strings.Builder
+}
+
+func (r *repoMapRenderer) full() bool {
+	return r.entries >= r.maxEntries || r.out.Len() >= r.maxChars
+}
+
+func (r *repoMapRenderer) writeLine(line string) bool {
+	if r.out.Len()+len(line)+1 > r.maxChars && r.out.Len() > 0 {
+		return false
+	}
+	r.out.WriteString(line)
+	r.out.WriteByte('\n')
+	return true
+}
+
+// renderDir prints sub-directories first, then files, collapsing anything below
+// maxDepth into a single "(N files)" line so large trees stay within budget.
+func (r *repoMapRenderer) renderDir(dir *repoMapDir, depth int) {
+	indent := strings.Repeat("  ", depth)
+	names := make([]string, 0, len(dir.dirs))
+	for name := range dir.dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sub := dir.dirs[name]
+		if r.full() || !r.writeLine(fmt.Sprintf("%s%s/ (%d files, %s)", indent, name, sub.count, formatRepoMapBytes(sub.bytes))) {
+			r.omitted += sub.count
+			continue
+		}
+		r.entries++
+		if depth >= r.maxDepth {
+			continue
+		}
+		r.renderDir(sub, depth+1)
+	}
+	sort.Slice(dir.files, func(i, j int) bool { return dir.files[i].Path < dir.files[j].Path })
+	for _, f := range dir.files {
+		if r.full() {
+			r.omitted++
+			continue
+		}
+		f.Outline = r.outline(f)
+		line := indent + path.Base(f.Path)
+		if f.Language != "" {
+			line += "  " + f.Language
+		}
+		line += "  " + formatRepoMapBytes(f.Bytes)
+		if f.Outline != "" {
+			line += "  " + f.Outline
+		}
+		if !r.writeLine(line) {
+			r.omitted++
+			continue
+		}
+		r.entries++
+		r.files = append(r.files, f)
+	}
+}
+
+func (r *repoMapRenderer) outline(f repoMapFile) string {
+	if r.outlined >= r.outlineFiles || f.Bytes > maxRepoMapOutlineBytes {
+		return ""
+	}
+	kind := typesys.InferKindFromPath(f.Path)
+	switch kind {
+	case typesys.KindCodeGo, typesys.KindCodeTS, typesys.KindCodeTSX, typesys.KindCodeJS, typesys.KindCodeJSX:
+	default:
+		return ""
+	}
+	b, err := os.ReadFile(filepath.Join(r.workspace, filepath.FromSlash(f.Path)))
+	if err != nil {
+		return ""
+	}
+	r.outlined++
+	if kind == typesys.KindCodeGo {
+		return summarizeGoCode(string(b))
+	}
+	return summarizeTSJSCode(string(b))
+}
+
+func repoMapLimit(params, args map[string]any, key string, def int) int {
+	limit := def
+	if v, ok := intParam(params, key); ok && v > 0 {
+		limit = v
+	}
+	if v, ok := intArg(args, key); ok && v > 0 && v < limit {
+		limit = v
+	}
+	return limit
+}
+
+func repoMapLanguage(rel string) string {
+	if strings.EqualFold(path.Base(rel), "go.mod") {
+		return "go.mod"
+	}
+	if path.Ext(rel) == "" {
+		return ""
+	}
+	kind := typesys.InferKindFromPath(rel)
+	switch kind {
+	case typesys.KindTextPlain:
+		if strings.EqualFold(path.Ext(rel), ".txt") {
+			return "text"
+		}
+		return ""
+	case typesys.KindJSONValue:
+		return "json"
+	case typesys.KindTextMarkdown:
+		return "markdown"
+	case typesys.KindTextDiff:
+		return "diff"
+	case typesys.KindDataCSV:
+		return "csv"
+	}
+	return strings.TrimPrefix(kind.String(), "code/")
+}
+
+func formatRepoMapBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
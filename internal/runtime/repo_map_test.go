@@ -0,0 +1,83 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"deeph/internal/project"
+)
+
+func TestRepoMapListsTreeWithLanguagesAndOutlines(t *testing.T) {
+	ws := t.TempDir()
+	writeCodeSearchFile(t, ws, ".gitignore", "dist/\n")
+	writeCodeSearchFile(t, ws, "README.md", "# demo\n")
+	writeCodeSearchFile(t, ws, "internal/store/store.go", "package store\n\ntype Client struct{}\n\nfunc Open() *Client { return nil }\n")
+	writeCodeSearchFile(t, ws, "web/api.ts", "export function fetchUsers() {}\nexport class UserStore {}\n")
+	writeCodeSearchFile(t, ws, "dist/bundle.js", "console.log(1)\n")
+	writeCodeSearchFile(t, ws, "node_modules/x/index.js", "module.exports = {}\n")
+	writeCodeSearchFile(t, ws, "coverage/lcov.info", "TN:\n")
+
+	s := &RepoMapSkill{cfg: project.SkillConfig{Name: "repo_map", Type: "repo_map"}, workspace: ws}
+	out, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{}})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if got, _ := out["file_count"].(int); got != 4 {
+		t.Fatalf("expected 4 files (.gitignore, README, store.go, api.ts), got %d", got)
+	}
+	text, _ := out["text"].(string)
+	for _, want := range []string{
+		"internal/ (1 files",
+		"store.go  go",
+		"pkg=store",
+		"type:Client",
+		"func:Open",
+		"api.ts  ts",
+		"fetchUsers",
+		"README.md  markdown",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected %q in repo map:\n%s", want, text)
+		}
+	}
+	for _, unwanted := range []string{"dist", "node_modules", "bundle.js", "coverage", "lcov"} {
+		if strings.Contains(text, unwanted) {
+			t.Fatalf("did not expect %q in repo map:\n%s", unwanted, text)
+		}
+	}
+}
+
+func TestRepoMapCollapsesDeepTreesAndHonoursBudget(t *testing.T) {
+	ws := t.TempDir()
+	writeCodeSearchFile(t, ws, "a/b/c/d.go", "package c\n")
+	writeCodeSearchFile(t, ws, "a/b/c/e.go", "package c\n")
+	for _, name := range []string{"f1.txt", "f2.txt", "f3.txt", "f4.txt"} {
+		writeCodeSearchFile(t, ws, "z/"+name, "x\n")
+	}
+
+	s := &RepoMapSkill{cfg: project.SkillConfig{Name: "repo_map", Type: "repo_map"}, workspace: ws}
+	out, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"max_depth": 2}})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	text, _ := out["text"].(string)
+	if !strings.Contains(text, "b/ (2 files") || strings.Contains(text, "c/") || strings.Contains(text, "d.go") {
+		t.Fatalf("expected a/b to be collapsed at depth 2:\n%s", text)
+	}
+
+	out, err = s.Execute(context.Background(), SkillExecution{Args: map[string]any{"max_entries": 5}})
+	if err != nil {
+		t.Fatalf("Execute error: %v", err)
+	}
+	if truncated, _ := out["truncated"].(bool); !truncated {
+		t.Fatalf("expected truncated=true with max_entries=5, got %#v", out)
+	}
+	if omitted, _ := out["omitted"].(int); omitted == 0 {
+		t.Fatalf("expected omitted entries to be reported")
+	}
+
+	if _, err := s.Execute(context.Background(), SkillExecution{Args: map[string]any{"path": "../"}}); err == nil {
+		t.Fatalf("expected workspace escape to be rejected")
+	}
+}
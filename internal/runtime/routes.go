@@ -0,0 +1,225 @@
+package runtime
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"deeph/internal/jsonpath"
+	"deeph/internal/project"
+)
+
+// RouteDecision records whether a routed successor was activated by an
+// agent's output.
+type RouteDecision struct {
+	To    string `json:"to"`
+	Taken bool   `json:"taken"`
+	Rule  string `json:"rule"`
+}
+
+// TaskRoutePlan is one configured route as shown by trace.
+type TaskRoutePlan struct {
+	To   string
+	When string
+}
+
+func taskRoutePlan(agent project.AgentConfig) []TaskRoutePlan {
+	out := make([]TaskRoutePlan, 0, len(agent.Routes))
+	for _, r := range agent.Routes {
+		out = append(out, TaskRoutePlan{To: strings.TrimSpace(r.To), When: describeRoute(r)})
+	}
+	return out
+}
+
+func describeRoute(r project.RouteConfig) string {
+	if r.Default {
+		return "default"
+	}
+	w := r.When
+	var parts []string
+	if w.Choice {
+		parts = append(parts, "choice")
+	}
+	if f := strings.TrimSpace(w.Field); f != "" {
+		switch {
+		case w.Equals != "":
+			parts = append(parts, fmt.Sprintf("%s==%q", f, w.Equals))
+		case len(w.In) > 0:
+			parts = append(parts, fmt.Sprintf("%s in %v", f, w.In))
+		case w.Regex == "":
+			parts = append(parts, f)
+		default:
+			parts = append(parts, fmt.Sprintf("%s~/%s/", f, w.Regex))
+		}
+	} else if w.Regex != "" {
+		parts = append(parts, fmt.Sprintf("output~/%s/", w.Regex))
+	}
+	return strings.Join(parts, " ")
+}
+
+// evaluateRoutes decides, per routed successor, whether output activates it.
+// A successor is taken when any of its non-default routes match; default
+// routes are taken only when no other route matched.
+func evaluateRoutes(routes []project.RouteConfig, output string) []RouteDecision {
+	if len(routes) == 0 {
+		return nil
+	}
+	var value any
+	_, parsed, err := jsonpath.Extract(output)
+	if err == nil {
+		value = parsed
+	}
+	idx := map[string]int{}
+	var out []RouteDecision
+	anyMatched := false
+	for _, r := range routes {
+		to := strings.TrimSpace(r.To)
+		if to == "" {
+			continue
+		}
+		i, ok := idx[to]
+		if !ok {
+			i = len(out)
+			idx[to] = i
+			out = append(out, RouteDecision{To: to, Rule: describeRoute(r)})
+		}
+		if r.Default || out[i].Taken {
+			continue
+		}
+		if routeMatches(r, output, value) {
+			out[i].Taken = true
+			out[i].Rule = describeRoute(r)
+			anyMatched = true
+		}
+	}
+	if !anyMatched {
+		for _, r := range routes {
+			if !r.Default {
+				continue
+			}
+			if i, ok := idx[strings.TrimSpace(r.To)]; ok {
+				out[i].Taken = true
+				out[i].Rule = "default"
+			}
+		}
+	}
+	return out
+}
+
+func routeMatches(r project.RouteConfig, output string, value any) bool {
+	w := r.When
+	if w.Choice {
+		return strings.EqualFold(routerChoice(output, value), strings.TrimSpace(r.To))
+	}
+	if field := strings.TrimSpace(w.Field); field != "" {
+		v, ok := jsonpath.Lookup(value, field)
+		if !ok {
+			return false
+		}
+		s := routeValueString(v)
+		switch {
+		case w.Equals != "":
+			return s == w.Equals
+		case len(w.In) > 0:
+			for _, c := range w.In {
+				if s == c {
+					return true
+				}
+			}
+			return false
+		case w.Regex != "":
+			return routeRegexMatch(w.Regex, s)
+		default:
+			return routeTruthy(v)
+		}
+	}
+	if w.Regex != "" {
+		return routeRegexMatch(w.Regex, output)
+	}
+	return false
+}
+
+func routeRegexMatch(pattern, s string) bool {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		// project.Validate reports invalid patterns; treat them as no match.
+		return false
+	}
+	return re.MatchString(s)
+}
+
+// routerChoice reads a router agent's answer: a "route"/"choice" field when
+// the output is a JSON object, otherwise its first non-empty line.
+func routerChoice(output string, value any) string {
+	if m, ok := value.(map[string]any); ok {
+		for _, key := range []string{"route", "choice", "next"} {
+			if s, ok := m[key].(string); ok {
+				return strings.TrimSpace(s)
+			}
+		}
+	}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.Trim(strings.TrimSpace(line), "`*\"'.:")
+		if line != "" {
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
+}
+
+func routeValueString(v any) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+func routeTruthy(v any) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case string:
+		return x != "" && !strings.EqualFold(x, "false") && x != "0"
+	case float64:
+		return x != 0
+	case []any:
+		return len(x) > 0
+	case map[string]any:
+		return len(x) > 0
+	default:
+		return true
+	}
+}
+
+// routeAllows reports whether a finished upstream's decisions let to run.
+// Successors without a route are always allowed.
+func routeAllows(decisions []RouteDecision, to string) bool {
+	for _, d := range decisions {
+		if d.To == to {
+			return d.Taken
+		}
+	}
+	return true
+}
+
+func skippedTaskResult(task Task, reasons []string) AgentRunResult {
+	return AgentRunResult{
+		Agent:        task.Agent.Name,
+		Provider:     task.Provider.Name,
+		ProviderType: task.Provider.Type,
+		Model:        coalesce(task.Agent.Model, task.Provider.Model),
+		StageIndex:   task.StageIndex,
+		DependsOn:    append([]string(nil), task.DependsOn...),
+		Skipped:      true,
+		SkipReason:   strings.Join(reasons, "; "),
+	}
+}
@@ -0,0 +1,109 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"deeph/internal/project"
+)
+
+func TestEvaluateRoutesFieldRegexChoiceAndDefault(t *testing.T) {
+	routes := []project.RouteConfig{
+		{To: "coder", When: project.RouteCondition{Field: "verdict.action", Equals: "patch"}},
+		{To: "coder", When: project.RouteCondition{Regex: `(?i)needs code change`}},
+		{To: "docs", When: project.RouteCondition{Field: "verdict.docs"}},
+		{To: "writer", Default: true},
+	}
+	cases := []struct {
+		output string
+		taken  map[string]bool
+	}{
+		{`{"verdict": {"action": "patch", "docs": true}}`, map[string]bool{"coder": true, "docs": true, "writer": false}},
+		{"Analysis done. Needs code change in parser.", map[string]bool{"coder": true, "docs": false, "writer": false}},
+		{`{"verdict": {"action": "none", "docs": false}}`, map[string]bool{"coder": false, "docs": false, "writer": true}},
+	}
+	for _, tc := range cases {
+		got := map[string]bool{}
+		for _, d := range evaluateRoutes(routes, tc.output) {
+			got[d.To] = d.Taken
+		}
+		for to, want := range tc.taken {
+			if got[to] != want {
+				t.Fatalf("output %q: route %s taken=%v want %v (%v)", tc.output, to, got[to], want, got)
+			}
+		}
+	}
+
+	choice := []project.RouteConfig{
+		{To: "coder", When: project.RouteCondition{Choice: true}},
+		{To: "writer", When: project.RouteCondition{Choice: true}},
+	}
+	for output, want := range map[string]string{"**Coder**\nbecause...": "coder", `{"route": "writer"}`: "writer"} {
+		for _, d := range evaluateRoutes(choice, output) {
+			if d.Taken != (d.To == want) {
+				t.Fatalf("choice %q: unexpected decision %+v", output, d)
+			}
+		}
+	}
+	if !routeAllows(nil, "anyone") {
+		t.Fatal("expected unrouted successors to be allowed")
+	}
+}
+
+func TestRunSpecSkipsBranchesNotRouted(t *testing.T) {
+	p := &project.Project{
+		Root: project.RootConfig{Providers: []project.ProviderConfig{{Name: "local", Type: "mock"}}},
+		Agents: []project.AgentConfig{
+			{Name: "diagnoser", Provider: "local", Routes: []project.RouteConfig{
+				{To: "coder", When: project.RouteCondition{Field: "needs_code"}},
+				{To: "writer", Default: true},
+			}},
+			{Name: "coder", Provider: "local"},
+			{Name: "writer", Provider: "local"},
+			{Name: "tester", Provider: "local"},
+			{Name: "final", Provider: "local"},
+		},
+	}
+	eng, err := New(t.TempDir(), p)
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	defer eng.Close()
+	prov := &scriptedContractProvider{replies: map[string][]string{"diagnoser": {`{"needs_code": false}`}}}
+	eng.providers["local"] = prov
+
+	report, err := eng.RunSpec(context.Background(), "diagnoser>coder+writer>final", "fix it")
+	if err != nil {
+		t.Fatalf("RunSpec error: %v", err)
+	}
+	byAgent := map[string]AgentRunResult{}
+	for _, r := range report.Results {
+		byAgent[r.Agent] = r
+	}
+	if r := byAgent["coder"]; !r.Skipped || !strings.Contains(r.SkipReason, "route from diagnoser not taken") {
+		t.Fatalf("expected coder to be skipped by route, got %+v", r)
+	}
+	// final joins coder and writer, so the writer branch alone keeps it alive.
+	for _, name := range []string{"writer", "final"} {
+		if r := byAgent[name]; r.Skipped || r.Output == "" {
+			t.Fatalf("expected %s to run, got %+v", name, r)
+		}
+	}
+	if d := byAgent["diagnoser"].Routes; len(d) != 2 || d[0].Taken || !d[1].Taken {
+		t.Fatalf("unexpected route decisions: %+v", d)
+	}
+
+	chain, err := eng.RunSpec(context.Background(), "diagnoser>coder>tester", "fix it")
+	if err != nil {
+		t.Fatalf("RunSpec chain error: %v", err)
+	}
+	if r := chain.Results[2]; r.Agent != "tester" || !r.Skipped || !strings.Contains(r.SkipReason, "upstream coder skipped") {
+		t.Fatalf("expected tester to be skipped with coder, got %+v", r)
+	}
+	for _, req := range prov.requests {
+		if req.AgentName == "coder" || req.AgentName == "tester" {
+			t.Fatalf("skipped agent %s called the provider", req.AgentName)
+		}
+	}
+}
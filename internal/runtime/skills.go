@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -123,7 +124,7 @@ func (s *FileReadSkill) Execute(_ context.Context, exec SkillExecution) (map[str
 	if !ok || strings.TrimSpace(pathVal) == "" {
 		return nil, fmt.Errorf("file_read requires args.path (string)")
 	}
-	clean, fullClean, err := resolveWorkspacePath(s.workspace, pathVal)
+	clean, fullClean, err := resolvePolicyPath(s.workspace, exec.Paths, pathVal, false)
 	if err != nil {
 		return nil, err
 	}
@@ -163,7 +164,7 @@ func (s *FileReadRangeSkill) Execute(_ context.Context, exec SkillExecution) (ma
 	if !ok || strings.TrimSpace(pathVal) == "" {
 		return nil, fmt.Errorf("file_read_range requires args.path (string)")
 	}
-	clean, fullClean, err := resolveWorkspacePath(s.workspace, pathVal)
+	clean, fullClean, err := resolvePolicyPath(s.workspace, exec.Paths, pathVal, false)
 	if err != nil {
 		return nil, err
 	}
@@ -251,6 +252,135 @@ func (s *FileReadRangeSkill) Execute(_ context.Context, exec SkillExecution) (ma
 	}, nil
 }
 
+type ArtifactReadSkill struct{ cfg project.SkillConfig }
+
+func (s *ArtifactReadSkill) Name() string { return s.cfg.Name }
+func (s *ArtifactReadSkill) Description() string {
+	return coalesce(s.cfg.Description, "Reads a line range of a context artifact by ID")
+}
+func (s *ArtifactReadSkill) Execute(_ context.Context, exec SkillExecution) (map[string]any, error) {
+	id := strings.TrimSpace(anyString(exec.Args["id"]))
+	if id == "" {
+		return nil, fmt.Errorf("artifact_read requires args.id (string)")
+	}
+	if exec.Artifacts == nil {
+		return nil, fmt.Errorf("artifact_read: no artifact store in this run")
+	}
+	hash, err := exec.Artifacts.Resolve(id)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := exec.Artifacts.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	startLine := 1
+	if v, ok := intArg(exec.Args, "start_line"); ok && v > 0 {
+		startLine = v
+	}
+	endLine := startLine + 199
+	if v, ok := intArg(exec.Args, "end_line"); ok && v >= startLine {
+		endLine = v
+	}
+	if endLine-startLine > 1000 {
+		endLine = startLine + 1000
+	}
+	maxBytes := 32768
+	if v, ok := intParam(s.cfg.Params, "max_bytes"); ok && v > 0 {
+		maxBytes = v
+	}
+	if v, ok := intArg(exec.Args, "max_bytes"); ok && v > 0 && v < maxBytes {
+		maxBytes = v
+	}
+
+	all := strings.Split(strings.ReplaceAll(string(raw), "\r\n", "\n"), "\n")
+	var (
+		lines      []string
+		bytesUsed  int
+		truncated  bool
+		lastLineNo = startLine - 1
+	)
+	for lineNo := startLine; lineNo <= endLine && lineNo <= len(all); lineNo++ {
+		txt := all[lineNo-1]
+		needed := len(txt)
+		if len(lines) > 0 {
+			needed++
+		}
+		if bytesUsed+needed > maxBytes {
+			truncated = true
+			break
+		}
+		lines = append(lines, txt)
+		bytesUsed += needed
+		lastLineNo = lineNo
+	}
+	text := strings.Join(lines, "\n")
+	out := map[string]any{
+		"id":          id,
+		"hash":        hash,
+		"bytes":       len(raw),
+		"total_lines": len(all),
+		"start_line":  startLine,
+		"actual_end":  lastLineNo,
+		"lines_read":  len(lines),
+		"truncated":   truncated,
+		"has_more":    lastLineNo < len(all),
+		"text":        text,
+	}
+	if lastLineNo < len(all) {
+		out["next_start_line"] = lastLineNo + 1
+	}
+	return out, nil
+}
+
+// MemoryWriteSkill records a long-lived project fact in .deeph/memory.json;
+// later runs see it as a memory.<key> fact at the discovery moment.
+type MemoryWriteSkill struct {
+	cfg       project.SkillConfig
+	workspace string
+}
+
+func (s *MemoryWriteSkill) Name() string { return s.cfg.Name }
+func (s *MemoryWriteSkill) Description() string {
+	return coalesce(s.cfg.Description, "Records a long-lived fact about the project for future runs")
+}
+func (s *MemoryWriteSkill) Execute(_ context.Context, exec SkillExecution) (map[string]any, error) {
+	key := anyString(exec.Args["key"])
+	value := anyString(exec.Args["value"])
+	evidence := anyString(exec.Args["evidence"])
+	if strings.TrimSpace(key) == "" || strings.TrimSpace(value) == "" {
+		return nil, fmt.Errorf("memory_write requires args.key and args.value (string)")
+	}
+	if exec.Redact != nil {
+		value = exec.Redact(value)
+		evidence = exec.Redact(evidence)
+	}
+	confidence := 0.7
+	if v, ok := exec.Args["confidence"].(float64); ok && v > 0 {
+		confidence = v
+	}
+	if max, ok := floatParam(s.cfg.Params, "max_confidence"); ok && max > 0 && confidence > max {
+		confidence = max
+	}
+	entry, err := PutProjectMemory(s.workspace, ProjectMemoryEntry{
+		Key:        key,
+		Value:      value,
+		Confidence: confidence,
+		Source:     "agent:" + exec.AgentName,
+		Evidence:   evidence,
+	}, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"key":        entry.Key,
+		"confidence": entry.Confidence,
+		"source":     entry.Source,
+		"stored":     true,
+	}, nil
+}
+
 type FileWriteSafeSkill struct {
 	cfg       project.SkillConfig
 	workspace string
@@ -270,7 +400,7 @@ func (s *FileWriteSafeSkill) Execute(_ context.Context, exec SkillExecution) (ma
 		return nil, fmt.Errorf("file_write_safe requires args.content (string)")
 	}
 
-	clean, fullClean, err := resolveWorkspacePath(s.workspace, pathVal)
+	clean, fullClean, err := resolvePolicyPath(s.workspace, exec.Paths, pathVal, false)
 	if err != nil {
 		return nil, err
 	}
@@ -348,8 +478,17 @@ func (s *FileWriteSafeSkill) Execute(_ context.Context, exec SkillExecution) (ma
 	} else {
 		created = true
 	}
+	// A placeholder means the content came from a scrubbed read; writing it
+	// back would replace the real value on disk. Markers the file already
+	// holds (e.g. in redaction tests) are fine.
+	for _, marker := range redactionPlaceholder.FindAllString(content, -1) {
+		existing, _ := os.ReadFile(fullClean)
+		if !bytes.Contains(existing, []byte(marker)) {
+			return nil, fmt.Errorf("content contains the redaction placeholder %s; write the real value instead of the scrubbed one", marker)
+		}
+	}
 	if changed {
-		if err := writeFileAtomic(fullClean, []byte(content), 0o644); err != nil {
+		if err := WriteFileAtomic(fullClean, []byte(content), 0o644); err != nil {
 			return nil, err
 		}
 	}
@@ -381,30 +520,87 @@ type HTTPSkill struct {
 func (s *HTTPSkill) Name() string        { return s.cfg.Name }
 func (s *HTTPSkill) Description() string { return coalesce(s.cfg.Description, "Makes an HTTP request") }
 func (s *HTTPSkill) Execute(ctx context.Context, exec SkillExecution) (map[string]any, error) {
+	// With args_schema the model only fills the declared args; url, method and
+	// body come from the skill's templates.
+	templated := len(s.cfg.ArgsSchema) > 0
 	method := strings.ToUpper(coalesce(anyString(exec.Args["method"]), s.cfg.Method, http.MethodGet))
-	rawURL := coalesce(anyString(exec.Args["url"]), s.cfg.URL)
+	if templated {
+		method = strings.ToUpper(coalesce(s.cfg.Method, http.MethodGet))
+	}
+	// ${env:NAME} is only expanded in skill YAML, never in model-supplied args,
+	// so a tool call cannot ask for arbitrary secrets.
+	secrets := map[string]string{}
+	rawURL := anyString(exec.Args["url"])
+	if templated || strings.TrimSpace(rawURL) == "" {
+		var err error
+		if rawURL, err = interpolateEnvSecrets(s.cfg.URL, secrets); err != nil {
+			return nil, err
+		}
+		rawURL = renderURLTemplate(rawURL, exec.Args)
+	}
 	if strings.TrimSpace(rawURL) == "" {
 		return nil, fmt.Errorf("http skill requires url in config or args")
 	}
-	if _, err := url.ParseRequestURI(rawURL); err != nil {
-		return nil, fmt.Errorf("invalid url: %w", err)
+	u, err := url.ParseRequestURI(rawURL)
+	if err != nil {
+		return nil, redactError(fmt.Errorf("invalid url: %w", err), secrets)
+	}
+	policy := httpEgressPolicyFromConfig(s.cfg)
+	if err := policy.checkMethod(method); err != nil {
+		return nil, err
+	}
+	if err := policy.checkURL(u); err != nil {
+		return nil, redactError(err, secrets)
 	}
 	bodyStr := anyString(exec.Args["body"])
+	if templated {
+		bodyStr = ""
+	}
+	if strings.TrimSpace(s.cfg.BodyTemplate) != "" {
+		tmpl, err := interpolateEnvSecrets(s.cfg.BodyTemplate, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("body_template: %w", err)
+		}
+		if bodyStr, err = renderBodyTemplate(tmpl, exec.Args); err != nil {
+			return nil, fmt.Errorf("body_template: %w", err)
+		}
+	}
 	req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewBufferString(bodyStr))
 	if err != nil {
-		return nil, err
-	}
+		return nil, redactError(err, secrets)
+	}
+	// Secret-bearing headers only go to the configured url's host or, when
+	// the skill has an allowlist, to hosts that passed it; a model-supplied
+	// url elsewhere gets the request without them.
+	sendSecrets := policy.restricted() || strings.EqualFold(u.Hostname(), configuredHTTPHost(s.cfg.URL))
+	pinned := secretHeaderNames(s.cfg)
+	var withheld []string
 	for k, v := range s.cfg.Headers {
-		req.Header.Set(k, v)
+		if _, secret := pinned[http.CanonicalHeaderKey(k)]; secret && !sendSecrets {
+			withheld = append(withheld, http.CanonicalHeaderKey(k))
+			continue
+		}
+		val, err := interpolateEnvSecrets(v, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", k, err)
+		}
+		req.Header.Set(k, val)
 	}
-	if headers, ok := exec.Args["headers"].(map[string]any); ok {
+	if strings.TrimSpace(s.cfg.BodyTemplate) != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if headers, ok := exec.Args["headers"].(map[string]any); ok && !templated {
 		for k, v := range headers {
+			if _, ok := pinned[http.CanonicalHeaderKey(k)]; ok {
+				// Secret-bearing headers from config cannot be replaced by the model.
+				continue
+			}
 			req.Header.Set(k, anyString(v))
 		}
 	}
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, redactError(err, secrets)
 	}
 	defer resp.Body.Close()
 	maxBytes := 65536
@@ -413,16 +609,29 @@ func (s *HTTPSkill) Execute(ctx context.Context, exec SkillExecution) (map[strin
 	}
 	b, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxBytes)))
 	if err != nil {
-		return nil, err
+		return nil, redactError(err, secrets)
 	}
 	contentType := resp.Header.Get("Content-Type")
 	detectedKind := detectHTTPBodyKind(contentType, b)
-	return map[string]any{
+	result := map[string]any{
 		"status":        resp.StatusCode,
-		"body":          string(b),
+		"body":          redactSecrets(string(b), secrets),
 		"content_type":  contentType,
 		"detected_kind": detectedKind.String(),
-	}, nil
+	}
+	if len(withheld) > 0 {
+		sort.Strings(withheld)
+		result["withheld_headers"] = withheld
+	}
+	if len(secrets) > 0 {
+		names := make([]string, 0, len(secrets))
+		for name := range secrets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		result["secrets_used"] = names
+	}
+	return result, nil
 }
 
 func newSkill(workspace string, sc project.SkillConfig) Skill {
@@ -441,8 +650,24 @@ func newSkill(workspace string, sc project.SkillConfig) Skill {
 		return &FileReadRangeSkill{cfg: sc, workspace: workspace}
 	case "file_write_safe":
 		return &FileWriteSafeSkill{cfg: sc, workspace: workspace}
+	case "artifact_read":
+		return &ArtifactReadSkill{cfg: sc}
+	case "memory_write":
+		return &MemoryWriteSkill{cfg: sc, workspace: workspace}
 	case "http":
-		return &HTTPSkill{cfg: sc, client: &http.Client{Timeout: timeout}}
+		return &HTTPSkill{cfg: sc, client: newHTTPSkillClient(sc, timeout)}
+	case "command_exec":
+		return &CommandExecSkill{cfg: sc, workspace: workspace}
+	case "code_search":
+		return &CodeSearchSkill{cfg: sc, workspace: workspace}
+	case "repo_map":
+		return &RepoMapSkill{cfg: sc, workspace: workspace}
+	case "git":
+		return &GitSkill{cfg: sc, workspace: workspace}
+	case "mcp":
+		return &MCPSkill{cfg: sc, workspace: workspace}
+	case "plugin":
+		return &PluginSkill{cfg: sc, workspace: workspace}
 	default:
 		return &EchoSkill{cfg: project.SkillConfig{Name: sc.Name, Description: "fallback for unsupported skill type"}}
 	}
@@ -501,6 +726,17 @@ func intParam(params map[string]any, key string) (int, bool) {
 	}
 }
 
+func floatParam(params map[string]any, key string) (float64, bool) {
+	switch n := params[key].(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
 func intArg(args map[string]any, key string) (int, bool) {
 	if args == nil {
 		return 0, false
@@ -508,6 +744,31 @@ func intArg(args map[string]any, key string) (int, bool) {
 	return intParam(args, key)
 }
 
+func stringListParam(params map[string]any, key string) []string {
+	if params == nil {
+		return nil
+	}
+	switch v := params[key].(type) {
+	case []string:
+		return append([]string(nil), v...)
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return nil
+		}
+		return strings.Split(v, ",")
+	default:
+		return nil
+	}
+}
+
 func boolParam(params map[string]any, key string) (bool, bool) {
 	if params == nil {
 		return false, false
@@ -569,7 +830,9 @@ func sha1HexFile(path string) (string, error) {
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
-func writeFileAtomic(path string, b []byte, mode os.FileMode) error {
+// WriteFileAtomic writes b through a temp file in the same directory and a
+// rename, so readers never see a partial file.
+func WriteFileAtomic(path string, b []byte, mode os.FileMode) error {
 	dir := filepath.Dir(path)
 	tmp, err := os.CreateTemp(dir, ".deeph-write-*")
 	if err != nil {
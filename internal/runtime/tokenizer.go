@@ -0,0 +1,70 @@
+package runtime
+
+import (
+	"strings"
+
+	"deeph/internal/project"
+	"deeph/internal/tokenizer"
+)
+
+// tokenizerFor returns the tokenizer for a provider/model pair, resolving
+// vocabulary files once per engine. A provider `tokenizer` that cannot be
+// loaded falls back to the heuristic; `deeph validate` reports it.
+func (e *Engine) tokenizerFor(provider project.ProviderConfig, model string) tokenizer.Tokenizer {
+	model = coalesce(strings.TrimSpace(model), provider.Model)
+	key := provider.Name + "|" + model
+	e.tokenizerMu.Lock()
+	defer e.tokenizerMu.Unlock()
+	if tok, ok := e.tokenizers[key]; ok {
+		return tok
+	}
+	tok, err := tokenizer.Resolve(e.workspace, provider.Tokenizer, provider.Type, model, tokenizer.SearchDirs(e.workspace))
+	if err != nil || tok == nil {
+		tok = tokenizer.Heuristic()
+	}
+	if e.tokenizers == nil {
+		e.tokenizers = map[string]tokenizer.Tokenizer{}
+	}
+	e.tokenizers[key] = tok
+	return tok
+}
+
+// TokenizerForAgent returns the tokenizer used to budget an agent's prompt:
+// its provider's (or the default provider's) vocabulary for its model.
+func (e *Engine) TokenizerForAgent(name string) tokenizer.Tokenizer {
+	if e.project == nil {
+		return tokenizer.Heuristic()
+	}
+	for _, a := range e.project.Agents {
+		if a.Name != name {
+			continue
+		}
+		providerName := coalesce(a.Provider, e.project.Root.DefaultProvider)
+		if pc, ok := e.providerCfgs[providerName]; ok {
+			return e.tokenizerFor(pc, a.Model)
+		}
+		break
+	}
+	return e.DefaultTokenizer()
+}
+
+// DefaultTokenizer is the default provider's tokenizer, or the heuristic.
+func (e *Engine) DefaultTokenizer() tokenizer.Tokenizer {
+	if e.project == nil {
+		return tokenizer.Heuristic()
+	}
+	if pc, ok := e.providerCfgs[e.project.Root.DefaultProvider]; ok {
+		return e.tokenizerFor(pc, "")
+	}
+	return tokenizer.Heuristic()
+}
+
+func (e *Engine) taskTokenizer(task Task) tokenizer.Tokenizer {
+	return e.tokenizerFor(task.Provider, task.Agent.Model)
+}
+
+// handoffTokenizer counts a handoff in the receiving agent's tokens, since it
+// is spent from that agent's context budget.
+func (e *Engine) handoffTokenizer(link TypedHandoffLink) tokenizer.Tokenizer {
+	return e.TokenizerForAgent(link.ToAgent)
+}
@@ -0,0 +1,66 @@
+package runtime
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"deeph/internal/project"
+)
+
+// byteTokenizer counts every byte as a token.
+type byteTokenizer struct{}
+
+func (byteTokenizer) Name() string          { return "bytes" }
+func (byteTokenizer) Count(text string) int { return len(text) }
+
+func TestCompileContextBudgetsWithSpecTokenizer(t *testing.T) {
+	bus := NewContextBus("summarize the release notes")
+	for i := 0; i < 6; i++ {
+		bus.PutFact("note."+string(rune('a'+i)), "a fact that costs about forty bytes in total", 0.9, "planner")
+	}
+	budget := DefaultContextBudget()
+	budget.MaxInputTokens = 240
+
+	heuristic := bus.Compile(ContextCompileSpec{AgentName: "writer", Budget: budget})
+	exact := bus.Compile(ContextCompileSpec{AgentName: "writer", Budget: budget, Tokenizer: byteTokenizer{}})
+	if exact.EstimatedTokens != len(exact.Text) {
+		t.Fatalf("expected byte count %d, got %d", len(exact.Text), exact.EstimatedTokens)
+	}
+	if exact.DroppedItems <= heuristic.DroppedItems {
+		t.Fatalf("expected the costlier tokenizer to drop more items (%d vs %d)", exact.DroppedItems, heuristic.DroppedItems)
+	}
+}
+
+func TestEngineResolvesProviderTokenizerFromWorkspace(t *testing.T) {
+	ws := t.TempDir()
+	dir := filepath.Join(ws, ".deeph", "tokenizers")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	vocab := base64.StdEncoding.EncodeToString([]byte("ab")) + " 0\n"
+	if err := os.WriteFile(filepath.Join(dir, "custom.tiktoken"), []byte(vocab), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := &project.Project{
+		Root: project.RootConfig{
+			DefaultProvider: "local",
+			Providers: []project.ProviderConfig{
+				{Name: "local", Type: "mock"},
+				{Name: "tuned", Type: "http", Tokenizer: "custom"},
+			},
+		},
+		Agents: []project.AgentConfig{{Name: "writer", Provider: "tuned"}, {Name: "planner"}},
+	}
+	eng, err := New(ws, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := eng.TokenizerForAgent("writer").Name(); got != "custom" {
+		t.Fatalf("expected custom tokenizer, got %s", got)
+	}
+	if got := eng.TokenizerForAgent("planner").Name(); got != "heuristic" {
+		t.Fatalf("expected heuristic fallback, got %s", got)
+	}
+}
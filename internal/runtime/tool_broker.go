@@ -11,6 +11,9 @@ type toolBroker struct {
 	cache    map[string]toolBrokerEntry
 	inflight map[string]*toolBrokerInflight
 	locks    map[string]*toolBrokerKeyLock
+	// generation advances on Invalidate; results of calls started in an
+	// older generation are returned but not cached.
+	generation uint64
 }
 
 type toolBrokerEntry struct {
@@ -67,15 +70,18 @@ func (b *toolBroker) Do(ctx context.Context, key string, fn func(context.Context
 	}
 	inf := &toolBrokerInflight{done: make(chan struct{})}
 	b.inflight[key] = inf
+	gen := b.generation
 	b.mu.Unlock()
 
 	r, e := fn(ctx)
 
 	b.mu.Lock()
-	delete(b.inflight, key)
+	if b.inflight[key] == inf {
+		delete(b.inflight, key)
+	}
 	inf.result = cloneTopMap(r)
 	inf.err = e
-	if e == nil {
+	if e == nil && gen == b.generation {
 		b.cache[key] = toolBrokerEntry{
 			result:   cloneTopMap(r),
 			cachedAt: time.Now(),
@@ -86,6 +92,20 @@ func (b *toolBroker) Do(ctx context.Context, key string, fn func(context.Context
 	return cloneTopMap(r), e, false
 }
 
+// Invalidate drops every cached result, e.g. after a skill changed the
+// workspace. Calls still in flight finish for their callers but are neither
+// cached nor shared with later callers.
+func (b *toolBroker) Invalidate() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.generation++
+	clear(b.cache)
+	clear(b.inflight)
+}
+
 func (b *toolBroker) WithResourceLock(ctx context.Context, key string, fn func(context.Context) (map[string]any, error)) (map[string]any, error) {
 	if b == nil || key == "" {
 		return fn(ctx)
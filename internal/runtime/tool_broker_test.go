@@ -145,3 +145,43 @@ func TestToolBrokerResourceLockSerializesDifferentKeysSameResource(t *testing.T)
 		t.Fatalf("expected serialized resource lock max concurrency=1, got %d", got)
 	}
 }
+
+func TestToolBrokerInvalidateDropsCachedAndInflightResults(t *testing.T) {
+	b := newToolBroker()
+	var runs atomic.Int32
+	fn := func(context.Context) (map[string]any, error) {
+		return map[string]any{"run": runs.Add(1)}, nil
+	}
+
+	b.Do(context.Background(), "k1", fn)
+	b.Invalidate()
+	if _, _, hit := b.Do(context.Background(), "k1", fn); hit {
+		t.Fatalf("expected a miss after Invalidate")
+	}
+
+	// A call that started before Invalidate must not repopulate the cache.
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Do(context.Background(), "k2", func(ctx context.Context) (map[string]any, error) {
+			<-release
+			return fn(ctx)
+		})
+	}()
+	for {
+		b.mu.Lock()
+		_, started := b.inflight["k2"]
+		b.mu.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	b.Invalidate()
+	close(release)
+	<-done
+	if _, _, hit := b.Do(context.Background(), "k2", fn); hit {
+		t.Fatalf("expected stale in-flight result to stay uncached")
+	}
+}
@@ -18,6 +18,9 @@ type LLMRequest struct {
 	Messages        []ChatMessage
 	Tools           []LLMToolDefinition
 	ToolChoice      string
+	// ResponseSchema is set when the agent has an output contract; providers
+	// that support it switch to JSON mode.
+	ResponseSchema map[string]any
 }
 
 type LLMResponse struct {
@@ -62,6 +65,12 @@ type SkillExecution struct {
 	AgentName string
 	Input     string
 	Args      map[string]any
+	// Paths scopes workspace paths for file skills (agent + skill policy).
+	Paths PathPolicy
+	// Artifacts is the engine's artifact store, read by artifact_read.
+	Artifacts *ArtifactStore
+	// Redact scrubs secrets from text a skill persists (memory_write).
+	Redact func(string) string
 }
 
 type SkillCallResult struct {
@@ -73,6 +82,7 @@ type SkillCallResult struct {
 	Args      map[string]any `json:"args,omitempty"`
 	Cached    bool           `json:"cached,omitempty"`
 	Cacheable bool           `json:"cacheable,omitempty"`
+	Approval  string         `json:"approval,omitempty"`
 }
 
 type Skill interface {
@@ -113,9 +123,24 @@ type TaskPlan struct {
 	StartupCalls  int
 	ContextBudget int
 	ContextMoment string
-	StageIndex    int
-	DependsOn     []string
-	IO            TaskIOPlan
+	// ContextProfile names the weight profile the agent compiles context with.
+	ContextProfile string
+	StageIndex     int
+	DependsOn      []string
+	IO             TaskIOPlan
+	Paths          []TaskPathPlan
+	Routes         []TaskRoutePlan
+	Loop           *TaskLoopPlan
+	Map            *TaskMapPlan
+}
+
+// TaskPathPlan is the effective path policy of one file skill for an agent.
+type TaskPathPlan struct {
+	Skill  string
+	Access string
+	Allow  [][]string
+	Deny   []string
+	Exempt []string
 }
 
 type TaskIOPlan struct {
@@ -201,8 +226,29 @@ type AgentRunResult struct {
 	DroppedHandoffs            int
 	HandoffTokens              int
 	SkippedOutputPublish       bool
-	Duration                   time.Duration
-	Error                      string
+	// ContractAttempts counts generations spent meeting the output port
+	// schemas (1 when the first answer was valid); Contracts holds the verdicts.
+	ContractAttempts int
+	Contracts        []OutputContractResult
+	InvalidHandoffs  int
+	// Routes holds this agent's routing decisions; Skipped marks a branch
+	// whose incoming routes were all not taken.
+	Routes     []RouteDecision
+	Skipped    bool
+	SkipReason string
+	// Iteration is the 1-based loop iteration for agents in a loop body.
+	Iteration int
+	// MapItems holds one entry per instance of a mapped agent; MapDropped
+	// counts items beyond map.max_items.
+	MapItems   []MapItemResult
+	MapDropped int
+	// ContextExplain lists every context candidate with its score breakdown
+	// and drop reason when the run was started WithContextExplain.
+	ContextExplain []ContextCandidateScore `json:",omitempty"`
+	// Usage sums provider token usage over the agent's generations.
+	Usage    TokenUsage
+	Duration time.Duration
+	Error    string
 }
 
 type ExecutionReport struct {
@@ -211,6 +257,19 @@ type ExecutionReport struct {
 	Parallel  bool
 	Input     string
 	Results   []AgentRunResult
+	// Redactions counts secrets scrubbed during the run, by reason.
+	Redactions map[string]int
+	Loops      []LoopReport
+	// RunID identifies the run; its saved context snapshot, if any, is
+	// .deeph/contexts/<RunID>.json.
+	RunID string
+	// ContextSaved is the snapshot path when the run's context was saved.
+	ContextSaved     string
+	ContextSaveError string
+	// ContextResumed reports the snapshot this run was seeded from.
+	ContextResumed *ContextResumeStats
+	// Replay reports how a run started WithCassetteReplay was served.
+	Replay *CassetteReplayStats
 }
 
 type Planner interface {
@@ -0,0 +1,62 @@
+package runtime
+
+import "context"
+
+// TokenUsage sums provider-reported token usage over an agent's generations.
+// Providers that report nothing (mock, some gRPC backends) only count calls.
+type TokenUsage struct {
+	Calls            int `json:"calls"`
+	PromptTokens     int `json:"prompt_tokens,omitempty"`
+	CompletionTokens int `json:"completion_tokens,omitempty"`
+	TotalTokens      int `json:"total_tokens,omitempty"`
+}
+
+// Add accumulates o into u.
+func (u *TokenUsage) Add(o TokenUsage) {
+	u.Calls += o.Calls
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.TotalTokens += o.TotalTokens
+}
+
+// addMeta counts one generation and its meta["usage"] (OpenAI-style
+// prompt_tokens/completion_tokens/total_tokens) when present.
+func (u *TokenUsage) addMeta(meta map[string]any) {
+	u.Calls++
+	usage, _ := meta["usage"].(map[string]any)
+	prompt, completion, total := usageInt(usage["prompt_tokens"]), usageInt(usage["completion_tokens"]), usageInt(usage["total_tokens"])
+	if total == 0 {
+		total = prompt + completion
+	}
+	u.PromptTokens += prompt
+	u.CompletionTokens += completion
+	u.TotalTokens += total
+}
+
+func usageInt(v any) int {
+	switch n := v.(type) {
+	case float64:
+		return int(n)
+	case int:
+		return n
+	case int64:
+		return int(n)
+	default:
+		return 0
+	}
+}
+
+// usageProvider counts the usage of every Generate call of one task,
+// including tool-loop rounds and contract retries.
+type usageProvider struct {
+	Provider
+	usage *TokenUsage
+}
+
+func (p usageProvider) Generate(ctx context.Context, req LLMRequest) (LLMResponse, error) {
+	resp, err := p.Provider.Generate(ctx, req)
+	if err == nil {
+		p.usage.addMeta(resp.Meta)
+	}
+	return resp, err
+}
@@ -0,0 +1,14 @@
+package runtime
+
+import "testing"
+
+func TestTokenUsageAddMeta(t *testing.T) {
+	var u TokenUsage
+	u.addMeta(map[string]any{"usage": map[string]any{"prompt_tokens": float64(12), "completion_tokens": float64(8)}})
+	u.addMeta(map[string]any{"usage": map[string]any{"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 6}})
+	u.addMeta(nil)
+	want := TokenUsage{Calls: 3, PromptTokens: 15, CompletionTokens: 10, TotalTokens: 26}
+	if u != want {
+		t.Fatalf("usage = %+v, want %+v", u, want)
+	}
+}
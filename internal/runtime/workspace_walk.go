@@ -0,0 +1,192 @@
+package runtime
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// workspaceSkipDirs are the directories deeph never descends into when
+// scanning a workspace, independent of .gitignore: VCS and deeph state,
+// dependencies and build output.
+var workspaceSkipDirs = map[string]struct{}{
+	".git":         {},
+	".deeph":       {},
+	"node_modules": {},
+	".next":        {},
+	".turbo":       {},
+	"dist":         {},
+	"build":        {},
+	"coverage":     {},
+	"vendor":       {},
+	".venv":        {},
+	"venv":         {},
+	"__pycache__":  {},
+}
+
+// ShouldSkipWorkspaceDir reports whether a workspace scan should skip the
+// directory name: a workspaceSkipDirs entry or any dot directory.
+func ShouldSkipWorkspaceDir(name string) bool {
+	name = strings.TrimSpace(strings.ToLower(name))
+	if name == "" {
+		return false
+	}
+	if _, ok := workspaceSkipDirs[name]; ok {
+		return true
+	}
+	return strings.HasPrefix(name, ".")
+}
+
+type gitignoreRule struct {
+	base     string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// gitignoreMatcher implements the subset of .gitignore semantics needed to keep
+// workspace scans aligned with what the repository tracks: nested files,
+// negation, directory-only and anchored patterns, and ** globs.
+type gitignoreMatcher struct {
+	rules []gitignoreRule
+}
+
+func (m *gitignoreMatcher) load(workspace, relDir string) {
+	f, err := os.Open(filepath.Join(workspace, relDir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	base := filepath.ToSlash(filepath.Clean(relDir))
+	if base == "." {
+		base = ""
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := gitignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, "\\")
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		m.rules = append(m.rules, rule)
+	}
+}
+
+// ignored reports whether a slash-separated workspace-relative path is ignored.
+// The last matching rule wins, as in git.
+func (m *gitignoreMatcher) ignored(rel string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		target := rel
+		if rule.base != "" {
+			if !strings.HasPrefix(rel, rule.base+"/") {
+				continue
+			}
+			target = strings.TrimPrefix(rel, rule.base+"/")
+		}
+		var ok bool
+		if rule.anchored {
+			ok = matchGlobPath(rule.pattern, target)
+		} else {
+			ok, _ = path.Match(rule.pattern, path.Base(target))
+		}
+		if ok {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// matchGlobPath matches slash-separated paths where "**" spans any number of segments.
+func matchGlobPath(pattern, name string) bool {
+	return matchGlobSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchGlobSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// walkWorkspaceFiles visits regular files under root (a workspace-relative dir),
+// skipping deeph's default directories and anything matched by .gitignore.
+// fn receives slash-separated workspace-relative paths; returning fs.SkipAll stops the walk.
+func walkWorkspaceFiles(workspace, root string, fn func(rel string, d fs.DirEntry) error) error {
+	ignore := &gitignoreMatcher{}
+	start := filepath.Join(workspace, root)
+	if rel := filepath.Clean(root); rel != "." {
+		// Pick up .gitignore files from the ancestors of a scoped search root.
+		ignore.load(workspace, ".")
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		for i := 1; i < len(parts); i++ {
+			ignore.load(workspace, filepath.FromSlash(strings.Join(parts[:i], "/")))
+		}
+	}
+	return filepath.WalkDir(start, func(full string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relOS, err := filepath.Rel(workspace, full)
+		if err != nil {
+			return err
+		}
+		rel := filepath.ToSlash(relOS)
+		if d.IsDir() {
+			if full != start && (ShouldSkipWorkspaceDir(d.Name()) || ignore.ignored(rel, true)) {
+				return filepath.SkipDir
+			}
+			ignore.load(workspace, relOS)
+			return nil
+		}
+		if !d.Type().IsRegular() || ignore.ignored(rel, false) {
+			return nil
+		}
+		return fn(rel, d)
+	})
+}
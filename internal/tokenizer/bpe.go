@@ -0,0 +1,269 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bpeCacheLimit bounds the per-tokenizer cache of piece token counts.
+const bpeCacheLimit = 1 << 16
+
+// BPE is a byte-level byte-pair-encoding tokenizer: text is split into
+// pieces like the GPT-style pre-tokenizers do, then each piece is merged
+// pairwise by rank, lowest first.
+type BPE struct {
+	name  string
+	ranks map[string]int
+
+	mu    sync.Mutex
+	cache map[string]int
+}
+
+func newBPE(name string, ranks map[string]int) (*BPE, error) {
+	if len(ranks) == 0 {
+		return nil, errEmptyVocab
+	}
+	return &BPE{name: name, ranks: ranks, cache: map[string]int{}}, nil
+}
+
+func (b *BPE) Name() string { return b.name }
+
+func (b *BPE) Count(text string) int {
+	n := 0
+	for _, piece := range splitPieces(text) {
+		n += b.pieceTokens(piece)
+	}
+	return n
+}
+
+func (b *BPE) pieceTokens(piece string) int {
+	if _, ok := b.ranks[piece]; ok {
+		return 1
+	}
+	b.mu.Lock()
+	n, ok := b.cache[piece]
+	b.mu.Unlock()
+	if ok {
+		return n
+	}
+	n = b.merge(piece)
+	b.mu.Lock()
+	if len(b.cache) >= bpeCacheLimit {
+		b.cache = map[string]int{}
+	}
+	b.cache[piece] = n
+	b.mu.Unlock()
+	return n
+}
+
+// merge applies byte-pair merges to one piece and returns its token count.
+func (b *BPE) merge(piece string) int {
+	// bounds[i] is where part i starts; the last entry is len(piece).
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, 0
+		for i := 0; i+2 < len(bounds); i++ {
+			if r, ok := b.ranks[piece[bounds[i]:bounds[i+2]]]; ok && (best < 0 || r < bestRank) {
+				best, bestRank = i, r
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	return len(bounds) - 1
+}
+
+// splitPieces approximates the GPT-4 (cl100k) pre-tokenizer: contractions,
+// letter runs with one optional leading non-letter, digit groups of up to
+// three, punctuation runs with an optional leading space, and whitespace
+// where a single space before a word stays with the word.
+func splitPieces(text string) []string {
+	var out []string
+	for i := 0; i < len(text); {
+		j := nextPiece(text, i)
+		out = append(out, text[i:j])
+		i = j
+	}
+	return out
+}
+
+func nextPiece(text string, i int) int {
+	r, size := utf8.DecodeRuneInString(text[i:])
+	if r == '\'' {
+		rest := strings.ToLower(text[i+1:])
+		for _, c := range []string{"s", "t", "re", "ve", "m", "ll", "d"} {
+			if strings.HasPrefix(rest, c) {
+				return i + 1 + len(c)
+			}
+		}
+	}
+	// [^\r\n\p{L}\p{N}]?\p{L}+
+	if unicode.IsLetter(r) {
+		return scan(text, i+size, unicode.IsLetter)
+	}
+	if r != '\r' && r != '\n' && !unicode.IsNumber(r) && i+size < len(text) {
+		if next, _ := utf8.DecodeRuneInString(text[i+size:]); unicode.IsLetter(next) {
+			return scan(text, i+size, unicode.IsLetter)
+		}
+	}
+	// \p{N}{1,3}
+	if unicode.IsNumber(r) {
+		j := i + size
+		for k := 1; k < 3 && j < len(text); k++ {
+			r2, s2 := utf8.DecodeRuneInString(text[j:])
+			if !unicode.IsNumber(r2) {
+				break
+			}
+			j += s2
+		}
+		return j
+	}
+	// " ?[^\s\p{L}\p{N}]+[\r\n]*"
+	start := i
+	if r == ' ' && i+size < len(text) {
+		if next, _ := utf8.DecodeRuneInString(text[i+size:]); isPunct(next) {
+			start = i + size
+		}
+	}
+	if first, _ := utf8.DecodeRuneInString(text[start:]); isPunct(first) {
+		j := scan(text, start, isPunct)
+		return scan(text, j, func(r rune) bool { return r == '\r' || r == '\n' })
+	}
+	// \s*[\r\n]+ | \s+(?!\S) | \s+
+	j := scan(text, i, unicode.IsSpace)
+	if k := strings.LastIndexAny(text[i:j], "\r\n"); k >= 0 {
+		return i + k + 1
+	}
+	if j < len(text) && j-i > 1 {
+		// Leave the last space to prefix the following word.
+		_, last := utf8.DecodeLastRuneInString(text[i:j])
+		return j - last
+	}
+	return j
+}
+
+func isPunct(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+func scan(text string, i int, keep func(rune) bool) int {
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if !keep(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// parseTiktoken reads "base64-token rank" lines.
+func parseTiktoken(name string, data []byte) (Tokenizer, error) {
+	ranks := map[string]int{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"token rank\"", line)
+		}
+		tok, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		ranks[string(tok)] = rank
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return newBPE(name, ranks)
+}
+
+// parseHFTokenizer reads the merges of a Hugging Face byte-level BPE
+// tokenizer.json (DeepSeek, Qwen, Llama 3 and GPT-2 style vocabularies).
+func parseHFTokenizer(name string, data []byte) (Tokenizer, error) {
+	var doc struct {
+		Model struct {
+			Type   string            `json:"type"`
+			Merges []json.RawMessage `json:"merges"`
+		} `json:"model"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Model.Type != "" && doc.Model.Type != "BPE" {
+		return nil, fmt.Errorf("unsupported model type %q (only BPE)", doc.Model.Type)
+	}
+	decode := byteLevelDecoder()
+	ranks := make(map[string]int, len(doc.Model.Merges))
+	for i, raw := range doc.Model.Merges {
+		var left, right string
+		var pair []string
+		var joined string
+		switch {
+		case json.Unmarshal(raw, &pair) == nil && len(pair) == 2:
+			left, right = pair[0], pair[1]
+		case json.Unmarshal(raw, &joined) == nil:
+			var ok bool
+			left, right, ok = strings.Cut(joined, " ")
+			if !ok {
+				return nil, fmt.Errorf("merge %d: expected \"left right\"", i)
+			}
+		default:
+			return nil, fmt.Errorf("merge %d: unsupported format", i)
+		}
+		token := decode(left) + decode(right)
+		if _, ok := ranks[token]; !ok {
+			ranks[token] = i
+		}
+	}
+	return newBPE(name, ranks)
+}
+
+// byteLevelDecoder inverts the GPT-2 bytes-to-unicode table, which maps
+// every byte to a printable rune in vocabulary files.
+func byteLevelDecoder() func(string) string {
+	table := map[rune]byte{}
+	n := 0
+	for b := 0; b < 256; b++ {
+		if (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF) {
+			table[rune(b)] = byte(b)
+			continue
+		}
+		table[rune(256+n)] = byte(b)
+		n++
+	}
+	return func(s string) string {
+		out := make([]byte, 0, len(s))
+		for _, r := range s {
+			if b, ok := table[r]; ok {
+				out = append(out, b)
+				continue
+			}
+			out = append(out, string(r)...)
+		}
+		return string(out)
+	}
+}
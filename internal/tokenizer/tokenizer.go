@@ -0,0 +1,299 @@
+// Package tokenizer counts prompt tokens for context budgeting. Models with a
+// BPE vocabulary on disk are counted exactly (up to pre-tokenization details);
+// everything else falls back to a script-aware heuristic.
+package tokenizer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer counts the tokens a model would see for a text.
+type Tokenizer interface {
+	Name() string
+	Count(text string) int
+}
+
+// HeuristicName selects the built-in heuristic explicitly.
+const HeuristicName = "heuristic"
+
+// DirEnv names an extra directory searched for vocabulary files.
+const DirEnv = "DEEPH_TOKENIZERS_DIR"
+
+type heuristic struct{}
+
+var defaultHeuristic Tokenizer = heuristic{}
+
+// Heuristic returns the fallback tokenizer. It counts words, digit groups,
+// punctuation runs and non-Latin scripts separately instead of dividing
+// characters by four, which under-counts code, accented text and CJK.
+func Heuristic() Tokenizer { return defaultHeuristic }
+
+func (heuristic) Name() string { return HeuristicName }
+
+func (heuristic) Count(text string) int {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0
+	}
+	n := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case isWideScript(r):
+			// CJK, kana and hangul are roughly one token per character.
+			n++
+			i += size
+		case unicode.IsLetter(r):
+			j := i
+			nonASCII := 0
+			run := 0
+			prevLower := false
+			for j < len(text) {
+				r2, s2 := utf8.DecodeRuneInString(text[j:])
+				if !unicode.IsLetter(r2) || isWideScript(r2) {
+					break
+				}
+				if r2 >= utf8.RuneSelf {
+					nonASCII++
+				}
+				// camelCase boundaries start a new sub-word, as in identifiers.
+				if unicode.IsUpper(r2) && prevLower {
+					n += 1 + (run-1)/6
+					run = 0
+				}
+				prevLower = unicode.IsLower(r2)
+				run++
+				j += s2
+			}
+			n += 1 + (run-1)/6
+			// Accented and non-Latin letters split words into more pieces.
+			n += (nonASCII + 1) / 2
+			i = j
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(text) {
+				r2, s2 := utf8.DecodeRuneInString(text[j:])
+				if !unicode.IsDigit(r2) {
+					break
+				}
+				j += s2
+			}
+			n += (utf8.RuneCountInString(text[i:j]) + 2) / 3
+			i = j
+		case unicode.IsSpace(r):
+			j := i
+			newlines := 0
+			for j < len(text) {
+				r2, s2 := utf8.DecodeRuneInString(text[j:])
+				if !unicode.IsSpace(r2) {
+					break
+				}
+				if r2 == '\n' {
+					newlines++
+				}
+				j += s2
+			}
+			// A single space joins the next word; indentation and line breaks
+			// cost tokens of their own.
+			if width := j - i; newlines > 0 || width > 1 {
+				n += maxInt(newlines, 1) + (width-newlines)/8
+			}
+			i = j
+		case r < utf8.RuneSelf:
+			// ASCII punctuation: common pairs such as ":=", "()" or "{}" merge.
+			j := i
+			for j < len(text) && text[j] < utf8.RuneSelf && !isASCIIWordOrSpace(text[j]) {
+				j++
+			}
+			n += (j - i + 1) / 2
+			i = j
+		default:
+			// Emoji and other symbols take several byte-level tokens.
+			n += (size + 1) / 2
+			i += size
+		}
+	}
+	return maxInt(n, 1)
+}
+
+// Clip returns the longest prefix of text, cut on a rune boundary, that tok
+// counts as at most max tokens.
+func Clip(tok Tokenizer, text string, max int) string {
+	if max <= 0 {
+		return ""
+	}
+	if tok.Count(text) <= max {
+		return text
+	}
+	lo, hi := 0, len(text)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		for mid > lo && !utf8.RuneStart(text[mid]) {
+			mid--
+		}
+		if mid == lo {
+			break
+		}
+		if tok.Count(text[:mid]) <= max {
+			lo = mid
+		} else {
+			hi = mid - 1
+			for hi > lo && hi < len(text) && !utf8.RuneStart(text[hi]) {
+				hi--
+			}
+		}
+	}
+	return text[:lo]
+}
+
+func isWideScript(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func isASCIIWordOrSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' ||
+		(c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// SearchDirs lists where vocabulary files are looked up for a workspace:
+// $DEEPH_TOKENIZERS_DIR, then <workspace>/.deeph/tokenizers.
+func SearchDirs(workspace string) []string {
+	var dirs []string
+	if d := strings.TrimSpace(os.Getenv(DirEnv)); d != "" {
+		dirs = append(dirs, d)
+	}
+	if strings.TrimSpace(workspace) != "" {
+		dirs = append(dirs, filepath.Join(workspace, ".deeph", "tokenizers"))
+	}
+	return dirs
+}
+
+// Resolve picks the tokenizer for a provider/model. spec is the provider's
+// `tokenizer` setting: "heuristic", a vocabulary name looked up in dirs, or a
+// file path (relative paths resolve against workspace). With no spec, files
+// named after the model or its family (cl100k_base, o200k_base, deepseek) are
+// looked up in dirs. The heuristic is returned when nothing is found; an
+// error is only returned for an explicit spec that cannot be loaded.
+func Resolve(workspace, spec, providerType, model string, dirs []string) (Tokenizer, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case strings.EqualFold(spec, HeuristicName):
+		return Heuristic(), nil
+	case spec != "":
+		if LooksLikePath(spec) {
+			path := spec
+			if !filepath.IsAbs(path) && workspace != "" {
+				path = filepath.Join(workspace, path)
+			}
+			return Load(path)
+		}
+		if tok, ok := findVocab(spec, dirs); ok {
+			return tok, nil
+		}
+		return nil, fmt.Errorf("tokenizer %q not found in %s", spec, strings.Join(dirs, ", "))
+	}
+	for _, name := range vocabCandidates(providerType, model) {
+		if tok, ok := findVocab(name, dirs); ok {
+			return tok, nil
+		}
+	}
+	return Heuristic(), nil
+}
+
+// LooksLikePath reports whether a tokenizer spec names a vocabulary file
+// rather than a vocabulary looked up by name.
+func LooksLikePath(spec string) bool {
+	return strings.ContainsAny(spec, `/\`) || strings.HasSuffix(spec, ".json") || strings.HasSuffix(spec, ".tiktoken")
+}
+
+// vocabCandidates are the vocabulary names tried for a model, most specific first.
+func vocabCandidates(providerType, model string) []string {
+	model = strings.ToLower(strings.TrimSpace(model))
+	var out []string
+	if model != "" {
+		out = append(out, model)
+	}
+	switch {
+	case strings.HasPrefix(model, "deepseek"):
+		out = append(out, "deepseek")
+	case strings.HasPrefix(model, "gpt-4o"), strings.HasPrefix(model, "gpt-4.1"), strings.HasPrefix(model, "gpt-5"),
+		strings.HasPrefix(model, "o1"), strings.HasPrefix(model, "o3"), strings.HasPrefix(model, "o4"):
+		out = append(out, "o200k_base")
+	case strings.HasPrefix(model, "gpt-4"), strings.HasPrefix(model, "gpt-3.5"):
+		out = append(out, "cl100k_base")
+	}
+	if strings.EqualFold(strings.TrimSpace(providerType), "deepseek") {
+		out = append(out, "deepseek")
+	}
+	return out
+}
+
+func findVocab(name string, dirs []string) (Tokenizer, bool) {
+	for _, dir := range dirs {
+		for _, candidate := range []string{name + ".tiktoken", name + ".json", filepath.Join(name, "tokenizer.json")} {
+			path := filepath.Join(dir, candidate)
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			if tok, err := Load(path); err == nil {
+				return tok, true
+			}
+		}
+	}
+	return nil, false
+}
+
+var (
+	loadedMu sync.Mutex
+	loaded   = map[string]Tokenizer{}
+)
+
+// Load reads a vocabulary file: tiktoken ranks (".tiktoken", one
+// "base64-token rank" per line) or a Hugging Face byte-level BPE
+// tokenizer.json. Loaded files are cached for the process.
+func Load(path string) (Tokenizer, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	loadedMu.Lock()
+	defer loadedMu.Unlock()
+	if tok, ok := loaded[abs]; ok {
+		return tok, nil
+	}
+	b, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(abs), ".tiktoken"), ".json")
+	if name == "tokenizer" {
+		name = filepath.Base(filepath.Dir(abs))
+	}
+	var tok Tokenizer
+	if strings.HasSuffix(abs, ".json") {
+		tok, err = parseHFTokenizer(name, b)
+	} else {
+		tok, err = parseTiktoken(name, b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load tokenizer %s: %w", path, err)
+	}
+	loaded[abs] = tok
+	return tok, nil
+}
+
+var errEmptyVocab = errors.New("no merge ranks found")
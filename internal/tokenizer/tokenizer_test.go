@@ -0,0 +1,112 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func writeTiktoken(t *testing.T, path string, tokens ...string) {
+	t.Helper()
+	var b strings.Builder
+	for i, tok := range tokens {
+		b.WriteString(base64.StdEncoding.EncodeToString([]byte(tok)) + " " + string(rune('0'+i)) + "\n")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeuristicCountsCodeAndWideScriptsAboveCharsOverFour(t *testing.T) {
+	h := Heuristic()
+	for _, text := range []string{
+		"if err := json.Unmarshal(raw, &v); err != nil {\n\t\treturn nil, err\n\t}",
+		"a configuração da integração não foi concluída",
+		"上下文预算不足，请压缩输入。",
+	} {
+		if got, naive := h.Count(text), (len(text)+3)/4; got <= naive*3/4 {
+			t.Fatalf("heuristic count %d too low for %q (chars/4=%d)", got, text, naive)
+		}
+	}
+	if got := h.Count("上下文预算"); got != 5 {
+		t.Fatalf("expected one token per CJK character, got %d", got)
+	}
+	if h.Count("   ") != 0 || h.Count("ok") != 1 {
+		t.Fatal("unexpected counts for blank and single-word text")
+	}
+}
+
+func TestBPEMergesByRank(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tiny.tiktoken")
+	writeTiktoken(t, path, "ab", "abc", " abc")
+	tok, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	// "abc" and " abc" are single tokens; " abd" merges to " "+ab+d.
+	if got := tok.Count("abc abc abd"); got != 5 {
+		t.Fatalf("expected 5 tokens, got %d (pieces %q)", got, splitPieces("abc abc abd"))
+	}
+
+	hf := filepath.Join(dir, "deepseek", "tokenizer.json")
+	if err := os.MkdirAll(filepath.Dir(hf), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Ġ is the byte-level rune for a space.
+	doc := `{"model": {"type": "BPE", "vocab": {}, "merges": ["a b", ["Ġ", "ab"], "Ġab c"]}}`
+	if err := os.WriteFile(hf, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Resolve(dir, "", "deepseek", "deepseek-chat", []string{dir})
+	if err != nil || got.Name() != "deepseek" {
+		t.Fatalf("expected deepseek vocabulary, got %v (%v)", got, err)
+	}
+	if n := got.Count("abc abc"); n != 3 {
+		t.Fatalf("expected a+b+c then \" abc\" (3 tokens), got %d", n)
+	}
+}
+
+func TestResolveByModelFamilyAndExplicitSpec(t *testing.T) {
+	dir := t.TempDir()
+	writeTiktoken(t, filepath.Join(dir, "o200k_base.tiktoken"), "ab")
+	tok, err := Resolve("", "", "openai", "gpt-4o-mini", []string{dir})
+	if err != nil || tok.Name() != "o200k_base" {
+		t.Fatalf("expected o200k_base for gpt-4o-mini, got %v (%v)", tok, err)
+	}
+	if tok, _ := Resolve("", "", "http", "llama3", []string{dir}); tok.Name() != HeuristicName {
+		t.Fatalf("expected heuristic fallback, got %s", tok.Name())
+	}
+	if tok, _ := Resolve("", "heuristic", "openai", "gpt-4o", []string{dir}); tok.Name() != HeuristicName {
+		t.Fatalf("expected explicit heuristic, got %s", tok.Name())
+	}
+	if _, err := Resolve(dir, "vocab/missing.tiktoken", "", "", nil); err == nil {
+		t.Fatal("expected error for a missing explicit vocabulary file")
+	}
+}
+
+func TestClipFitsTheBudgetOnRuneBoundaries(t *testing.T) {
+	tok := Heuristic()
+	text := strings.Repeat("função validaEntrada(x int) 错误 ", 20)
+	for _, max := range []int{1, 7, 40, 1000} {
+		got := Clip(tok, text, max)
+		if !utf8.ValidString(got) || !strings.HasPrefix(text, got) {
+			t.Fatalf("max=%d: invalid clip %q", max, got)
+		}
+		if n := tok.Count(got); n > max {
+			t.Fatalf("max=%d: clipped text counts %d tokens", max, n)
+		}
+		if len(got) < len(text) && tok.Count(text[:len(got)+utf8.RuneLen([]rune(text[len(got):])[0])]) <= max {
+			t.Fatalf("max=%d: clip %d bytes is not the longest fitting prefix", max, len(got))
+		}
+	}
+	if got := Clip(tok, text, 0); got != "" {
+		t.Fatalf("expected empty clip for a zero budget, got %q", got)
+	}
+}